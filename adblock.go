@@ -0,0 +1,56 @@
+package warnlist
+
+import (
+	"strings"
+)
+
+// parseAdblockLine extracts the domain from an AdBlock Plus domain anchor rule (e.g. ||ads.example.com^).
+// All other rules are ignored, so unmodified EasyList-style filter lists can be used as a source.
+func parseAdblockLine(line string) (string, bool) {
+	rule := strings.TrimSpace(line)
+
+	switch {
+	case strings.HasPrefix(rule, "!"), strings.HasPrefix(rule, "["):
+		// Comments and the list header
+		return "", false
+	case strings.HasPrefix(rule, "@@"):
+		// Exception rules
+		return "", false
+	case strings.Contains(rule, "##"), strings.Contains(rule, "#@#"), strings.Contains(rule, "#?#"):
+		// Cosmetic and element hiding rules
+		return "", false
+	case strings.HasPrefix(rule, "/"):
+		// Regex rules
+		return "", false
+	}
+
+	if !strings.HasPrefix(rule, "||") || !strings.HasSuffix(rule, "^") {
+		// Only rules anchored to a whole domain can be matched on DNS queries.
+		// Rules with $ modifiers only apply to certain requests, so they are skipped too.
+		return "", false
+	}
+
+	domain := strings.TrimSuffix(strings.TrimPrefix(rule, "||"), "^")
+	if !isHostname(domain) {
+		// Path, wildcard, and other partial URL rules
+		return "", false
+	}
+
+	return domain, true
+}
+
+// isHostname returns true if s only consists of characters which are valid in a hostname.
+func isHostname(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '.', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package warnlist
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseAdblockLine(t *testing.T) {
+	var testCases = []struct {
+		name   string
+		line   string
+		domain string
+		ok     bool
+	}{
+		{
+			name:   "case 0: a domain anchor rule is parsed",
+			line:   "||ads.example.com^",
+			domain: "ads.example.com",
+			ok:     true,
+		},
+		{
+			name:   "case 1: surrounding whitespace is ignored",
+			line:   "  ||tracker.example^  ",
+			domain: "tracker.example",
+			ok:     true,
+		},
+		{
+			name: "case 2: a comment is skipped",
+			line: "! Title: EasyList",
+		},
+		{
+			name: "case 3: the list header is skipped",
+			line: "[Adblock Plus 2.0]",
+		},
+		{
+			name: "case 4: an exception rule is skipped",
+			line: "@@||safe.example.com^",
+		},
+		{
+			name: "case 5: a cosmetic rule is skipped",
+			line: "example.com##.advert",
+		},
+		{
+			name: "case 6: an element hiding exception is skipped",
+			line: "example.com#@#.advert",
+		},
+		{
+			name: "case 7: a regex rule is skipped",
+			line: `/banner\d+/`,
+		},
+		{
+			name: "case 8: a rule with modifiers is skipped",
+			line: "||ads.example.com^$third-party",
+		},
+		{
+			name: "case 9: a rule with a path is skipped",
+			line: "||example.com/ads/*",
+		},
+		{
+			name: "case 10: an anchored rule with a path is skipped",
+			line: "||example.com/ads^",
+		},
+		{
+			name: "case 11: a wildcard rule is skipped",
+			line: "||ads.*.example^",
+		},
+		{
+			name: "case 12: a plain url pattern is skipped",
+			line: "/ads/banner.",
+		},
+		{
+			name: "case 13: a substring rule is skipped",
+			line: "-ad-banner-",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			domain, ok := parseAdblockLine(tc.line)
+			if !cmp.Equal(tc.ok, ok) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.ok, ok))
+			}
+			if !cmp.Equal(tc.domain, domain) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.domain, domain))
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package warnlist
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultAlertWindow is the window matches are counted over if only alert_threshold is configured.
+const DefaultAlertWindow = time.Minute
+
+// maxAlertClients bounds the number of clients whose matches are counted, so a flood of spoofed addresses can't
+// exhaust memory.
+const maxAlertClients = 10000
+
+// clientAlerts counts the matches of each client over a sliding window, and warns when a client reaches the
+// threshold, which is a sign of an infected host.
+type clientAlerts struct {
+	threshold int
+	window    time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*clientMatches
+}
+
+// clientMatches holds the times of the latest matches of a client, at most threshold of them.
+type clientMatches struct {
+	times   []time.Time
+	alerted bool
+}
+
+func newClientAlerts(threshold int, window time.Duration) *clientAlerts {
+	return &clientAlerts{threshold: threshold, window: window, clients: make(map[string]*clientMatches)}
+}
+
+// record counts a match of the client, and warns if it's the one which brings the client to the threshold.
+// It is a no-op on a nil clientAlerts, so callers don't have to check if alerting is enabled.
+func (a *clientAlerts) record(client string, now time.Time) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c, ok := a.clients[client]
+	if !ok {
+		if len(a.clients) >= maxAlertClients {
+			a.evict(now)
+		}
+		c = &clientMatches{times: make([]time.Time, 0, a.threshold)}
+		a.clients[client] = c
+	}
+
+	c.expire(now.Add(-a.window))
+	if len(c.times) == a.threshold {
+		// Only the latest matches are needed to tell whether the threshold is reached
+		c.times = append(c.times[:0], c.times[1:]...)
+	}
+	c.times = append(c.times, now)
+
+	if len(c.times) < a.threshold {
+		// Warn again the next time the client reaches the threshold
+		c.alerted = false
+		return
+	}
+	if !c.alerted {
+		c.alerted = true
+		log.Warningf("host %s requested %d warnlisted domains within %s", client, a.threshold, a.window)
+	}
+}
+
+// evict drops the clients without matches in the window. If there are still too many, it drops arbitrary clients
+// until a tenth of the room is free, so a flood of new clients doesn't scan the map on every match.
+func (a *clientAlerts) evict(now time.Time) {
+	since := now.Add(-a.window)
+	for client, c := range a.clients {
+		if c.times[len(c.times)-1].Before(since) {
+			delete(a.clients, client)
+		}
+	}
+	for client := range a.clients {
+		if len(a.clients) < maxAlertClients*9/10 {
+			break
+		}
+		delete(a.clients, client)
+	}
+}
+
+// expire drops the matches before since.
+func (c *clientMatches) expire(since time.Time) {
+	i := 0
+	for i < len(c.times) && c.times[i].Before(since) {
+		i++
+	}
+	c.times = append(c.times[:0], c.times[i:]...)
+}
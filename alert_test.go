@@ -0,0 +1,91 @@
+package warnlist
+
+import (
+	"bytes"
+	golog "log"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_clientAlerts(t *testing.T) {
+	start := time.Now()
+
+	var testCases = []struct {
+		name    string
+		matches []time.Duration
+		alerts  int
+	}{
+		{
+			name:    "case 0: matches below the threshold don't alert",
+			matches: []time.Duration{0, time.Second},
+			alerts:  0,
+		},
+		{
+			name:    "case 1: reaching the threshold within the window alerts",
+			matches: []time.Duration{0, time.Second, 2 * time.Second},
+			alerts:  1,
+		},
+		{
+			name:    "case 2: matches beyond the threshold don't alert again",
+			matches: []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second},
+			alerts:  1,
+		},
+		{
+			name:    "case 3: matches spread over more than the window don't alert",
+			matches: []time.Duration{0, 40 * time.Second, 80 * time.Second},
+			alerts:  0,
+		},
+		{
+			name:    "case 4: reaching the threshold again after dropping below it alerts again",
+			matches: []time.Duration{0, time.Second, 2 * time.Second, 5 * time.Minute, 5*time.Minute + time.Second, 5*time.Minute + 2*time.Second},
+			alerts:  2,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			b := &bytes.Buffer{}
+			golog.SetOutput(b)
+			defer golog.SetOutput(os.Stderr)
+
+			a := newClientAlerts(3, time.Minute)
+			for _, m := range tc.matches {
+				a.record("10.240.0.1", start.Add(m))
+			}
+
+			alerts := strings.Count(b.String(), "host 10.240.0.1 requested 3 warnlisted domains within 1m0s")
+			if !cmp.Equal(tc.alerts, alerts) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.alerts, alerts))
+			}
+		})
+	}
+}
+
+func Test_clientAlertsBounded(t *testing.T) {
+	start := time.Now()
+	a := newClientAlerts(3, time.Minute)
+	for i := 0; i < 2*maxAlertClients; i++ {
+		a.record(strconv.Itoa(i), start.Add(time.Duration(i)*time.Millisecond))
+	}
+
+	if len(a.clients) > maxAlertClients {
+		t.Fatalf("expected at most %d clients, got %d", maxAlertClients, len(a.clients))
+	}
+	// The most recent client is still counted
+	if _, ok := a.clients[strconv.Itoa(2*maxAlertClients-1)]; !ok {
+		t.Fatalf("expected the most recent client to be counted")
+	}
+}
+
+func Test_clientAlertsNil(t *testing.T) {
+	var a *clientAlerts
+	// Alerting is disabled, so this must not panic
+	a.record("10.240.0.1", time.Now())
+}
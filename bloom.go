@@ -0,0 +1,156 @@
+package warnlist
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	// bloomBitsPerKey and bloomHashes give a false positive rate of roughly 1%.
+	bloomBitsPerKey = 10
+	bloomHashes     = 7
+
+	// FNV-1a parameters, inlined to keep hashing allocation free on the query path
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// BloomWarnlist wraps another Warnlist with a bloom filter, so most lookups for unlisted domains can be answered
+// without consulting the wrapped Warnlist.
+type BloomWarnlist struct {
+	Warnlist
+	matchSubdomains bool
+	filter          *bloomFilter
+	hashes          []uint64
+}
+
+// NewBloomWarnlist returns a Warnlist which checks a bloom filter before the given Warnlist.
+// If matchSubdomains is set, every parent domain of a lookup is checked against the filter.
+func NewBloomWarnlist(w Warnlist, matchSubdomains bool) Warnlist {
+	b := &BloomWarnlist{Warnlist: w, matchSubdomains: matchSubdomains}
+	b.Open()
+	return b
+}
+
+func (b *BloomWarnlist) Add(key string) {
+	b.Warnlist.Add(key)
+	if b.matchSubdomains {
+		// The wrapped Warnlist matches wildcard entries by their base domain
+		key = strings.TrimPrefix(key, wildcardPrefix)
+	}
+	// The filter can only be sized once all keys are known, so keep their hashes until then
+	b.hashes = append(b.hashes, bloomHash(key))
+}
+
+// Remove removes the key from the wrapped Warnlist. The filter still has its bits set, so lookups for the key are only
+// answered by the wrapped Warnlist, until the next rebuild.
+func (b *BloomWarnlist) Remove(key string) {
+	b.Warnlist.Remove(key)
+}
+
+func (b *BloomWarnlist) Contains(key string) bool {
+	if !b.mayContain(key) {
+		return false
+	}
+	return b.Warnlist.Contains(key)
+}
+
+func (b *BloomWarnlist) Match(key string) (string, bool) {
+	if !b.mayContain(key) {
+		return "", false
+	}
+	return b.Warnlist.Match(key)
+}
+
+func (b *BloomWarnlist) MatchAll(key string) []string {
+	if !b.mayContain(key) {
+		return nil
+	}
+	return b.Warnlist.MatchAll(key)
+}
+
+func (b *BloomWarnlist) Close() error {
+	if b.filter == nil {
+		b.filter = newBloomFilter(len(b.hashes))
+	}
+	// Keys added after the list was closed go into the existing filter, which can only be resized by a rebuild
+	for _, h := range b.hashes {
+		b.filter.add(h)
+	}
+	b.hashes = nil
+
+	return b.Warnlist.Close()
+}
+
+func (b *BloomWarnlist) Open() {
+	b.Warnlist.Open()
+	b.filter = nil
+	b.hashes = nil
+}
+
+// mayContain returns false if the key, or any of its parents when matching subdomains, is definitely not listed.
+func (b *BloomWarnlist) mayContain(key string) bool {
+	if b.filter == nil {
+		// Not closed yet, so the filter can't tell
+		return true
+	}
+	if !b.matchSubdomains {
+		return b.filter.mayContain(bloomHash(key))
+	}
+
+	for {
+		if b.filter.mayContain(bloomHash(key)) {
+			return true
+		}
+		i := strings.Index(key, ".")
+		if i < 0 || i == len(key)-1 {
+			return false
+		}
+		key = key[i+1:]
+	}
+}
+
+// bloomFilter is a fixed size bloom filter using double hashing of a single 64 bit hash.
+type bloomFilter struct {
+	bits []uint64
+	m    uint32
+}
+
+func newBloomFilter(n int) *bloomFilter {
+	m := uint64(n) * bloomBitsPerKey
+	if m < 64 {
+		m = 64
+	}
+	if m > math.MaxUint32 {
+		m = math.MaxUint32
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: uint32(m)}
+}
+
+func (f *bloomFilter) add(h uint64) {
+	h1, h2 := uint32(h), uint32(h>>32)
+	for i := uint32(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *bloomFilter) mayContain(h uint64) bool {
+	h1, h2 := uint32(h), uint32(h>>32)
+	for i := uint32(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomHash(key string) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= fnvPrime64
+	}
+	return h
+}
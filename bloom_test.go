@@ -0,0 +1,103 @@
+package warnlist
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_bloomContains(t *testing.T) {
+	var testCases = []struct {
+		name            string
+		domain          string
+		matchSubdomains bool
+		hit             bool
+	}{
+		{
+			name:            "case 0: a domain in the list is matched",
+			domain:          "example.org",
+			matchSubdomains: false,
+			hit:             true,
+		},
+		{
+			name:            "case 1: a domain not in the list is not matched",
+			domain:          "this-is-ok.org",
+			matchSubdomains: false,
+			hit:             false,
+		},
+		{
+			name:            "case 2: a subdomain is not matched without subdomain matching",
+			domain:          "very.evil.com",
+			matchSubdomains: false,
+			hit:             false,
+		},
+		{
+			name:            "case 3: a subdomain is matched with subdomain matching",
+			domain:          "oh.so.very.evil.com",
+			matchSubdomains: true,
+			hit:             true,
+		},
+		{
+			name:            "case 4: a similar suffix domain is not matched",
+			domain:          "devil.com",
+			matchSubdomains: true,
+			hit:             false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			var inner Warnlist = NewWarnlist()
+			if tc.matchSubdomains {
+				inner = NewRadixWarnlist()
+			}
+			list := NewBloomWarnlist(inner, tc.matchSubdomains)
+			for _, d := range testWarnlist {
+				list.Add(d)
+			}
+			list.Close()
+
+			hit := list.Contains(tc.domain)
+			if !cmp.Equal(tc.hit, hit) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.hit, hit))
+			}
+		})
+	}
+}
+
+func benchmarkContains(b *testing.B, bloom bool) {
+	var list Warnlist = NewRadixWarnlist()
+	if bloom {
+		list = NewBloomWarnlist(list, true)
+	}
+	for i := 0; i < 100000; i++ {
+		list.Add(fmt.Sprintf("listed-%d.example.", i))
+	}
+	if err := list.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	// Most queries are for domains which are not listed
+	queries := make([]string, 1000)
+	for i := range queries {
+		queries[i] = fmt.Sprintf("www.unlisted-%d.example.", i)
+	}
+	queries[0] = "www.listed-42.example."
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		list.Contains(queries[i%len(queries)])
+	}
+}
+
+func BenchmarkContains(b *testing.B) {
+	benchmarkContains(b, false)
+}
+
+func BenchmarkContainsBloom(b *testing.B) {
+	benchmarkContains(b, true)
+}
@@ -0,0 +1,153 @@
+package warnlist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultChangeThreshold is the percentage of entries a rebuild has to add or remove for change_webhook to be notified,
+// if none is configured.
+const DefaultChangeThreshold = 10.0
+
+// listChange counts how a rebuild changed the warnlist. If previous is set, the build counts the entries it adds
+// which previous didn't hold.
+type listChange struct {
+	previous        Warnlist
+	matchSubdomains bool
+
+	Old     int `json:"old_count"`
+	New     int `json:"new_count"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// count counts an entry newly added to the warnlist being built, unless the previous warnlist held it too. It is a
+// no-op on a nil listChange, so builds which don't count changes don't have to check.
+func (c *listChange) count(entry listEntry) {
+	if c == nil || c.previous == nil {
+		return
+	}
+	if c.matchSubdomains {
+		// Entries matching subdomains are returned without their wildcard
+		entry.domain = strings.TrimPrefix(entry.domain, wildcardPrefix)
+	}
+	if !holdsEntry(c.previous, entry) {
+		c.Added++
+	}
+}
+
+// finish records the sizes of the previous and the new warnlist, from which the number of removed entries follows.
+func (c *listChange) finish(warnlist Warnlist) {
+	if c == nil || c.previous == nil {
+		return
+	}
+	c.Old, c.New = c.previous.Len(), warnlist.Len()
+	c.Removed = c.Old + c.Added - c.New
+	if c.Removed < 0 {
+		// Only the case for inconsistent sizes, like those of wildcard entries listed on their own as well
+		c.Removed = 0
+	}
+}
+
+// percent returns the entries added and removed as a percentage of the previous size. A change of an empty warnlist
+// counts as a change of 100%.
+func (c *listChange) percent() float64 {
+	if c.Old == 0 {
+		if c.Added == 0 {
+			return 0
+		}
+		return 100
+	}
+	return 100 * float64(c.Added+c.Removed) / float64(c.Old)
+}
+
+// holdsEntry returns true if the warnlist holds the entry itself, rather than a parent of it, or holds its pattern.
+func holdsEntry(warnlist Warnlist, entry listEntry) bool {
+	if entry.pattern != nil {
+		for {
+			switch w := warnlist.(type) {
+			case *RegexWarnlist:
+				return w.hasPattern(entry.pattern.String())
+			case *DeltaWarnlist:
+				warnlist = w.Warnlist
+			case *ExceptionWarnlist:
+				warnlist = w.Warnlist
+			default:
+				return false
+			}
+		}
+	}
+
+	if e, ok := warnlist.(*ExceptionWarnlist); ok {
+		// An excepted entry is still held by the list
+		warnlist = e.Warnlist
+	}
+	for _, e := range warnlist.MatchAll(entry.domain) {
+		if e == entry.domain {
+			return true
+		}
+	}
+	return false
+}
+
+// changeSummary is the JSON body posted to change_webhook.
+type changeSummary struct {
+	Server string    `json:"server,omitempty"`
+	Time   time.Time `json:"time"`
+	listChange
+	Percent float64 `json:"change_percent"`
+}
+
+// changeToCount returns the change of the next rebuild to count, if change_webhook is configured and a warnlist has
+// been loaded, or nil otherwise. The first load of an empty startup isn't a change of the feed.
+func (wp *WarnlistPlugin) changeToCount() *listChange {
+	if wp.Options.ChangeWebhook == "" {
+		return nil
+	}
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	if !wp.loaded || wp.warnlist == nil {
+		return nil
+	}
+	return &listChange{previous: wp.warnlist, matchSubdomains: wp.Options.MatchSubdomains}
+}
+
+// notifyChange posts a summary of the change to change_webhook if it reaches the change threshold. The post runs in
+// the background, and failures are only logged, so a slow or broken webhook never holds up reloads or queries.
+func (wp *WarnlistPlugin) notifyChange(change *listChange, server string) {
+	if change == nil || change.previous == nil {
+		return
+	}
+	percent := change.percent()
+	if percent < wp.Options.ChangeThreshold {
+		return
+	}
+
+	log.Warningf("warnlist changed by %.1f%%: %d entries before, %d after, %d added, %d removed", percent, change.Old, change.New, change.Added, change.Removed)
+	summary := changeSummary{Server: server, Time: time.Now().UTC(), listChange: *change, Percent: percent}
+	go func() {
+		if err := postChange(wp.Options, summary); err != nil {
+			log.Warningf("unable to notify change_webhook %s: %v", wp.Options.ChangeWebhook, err)
+		}
+	}()
+}
+
+// postChange posts the summary to change_webhook.
+func postChange(options PluginOptions, summary changeSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient(options).Post(options.ChangeWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
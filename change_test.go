@@ -0,0 +1,180 @@
+package warnlist
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func Test_buildCacheChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+
+	var testCases = []struct {
+		name            string
+		matchSubdomains bool
+		previous        string
+		current         string
+		expected        listChange
+	}{
+		{
+			name:     "case 0: an unchanged list has no changes",
+			previous: "a.example\nb.example\n",
+			current:  "b.example\na.example\n",
+			expected: listChange{Old: 2, New: 2},
+		},
+		{
+			name:     "case 1: added and removed entries are counted",
+			previous: "a.example\nb.example\nc.example\n",
+			current:  "b.example\nc.example\nd.example\ne.example\n",
+			expected: listChange{Old: 3, New: 4, Added: 2, Removed: 1},
+		},
+		{
+			name:     "case 2: a feed which drops to near zero entries removes most of them",
+			previous: "a.example\nb.example\nc.example\nd.example\n",
+			current:  "a.example\n",
+			expected: listChange{Old: 4, New: 1, Removed: 3},
+		},
+		{
+			name:     "case 3: entries listed twice are only counted once",
+			previous: "a.example\n",
+			current:  "a.example\nd.example\nd.example\n",
+			expected: listChange{Old: 1, New: 2, Added: 1},
+		},
+		{
+			name:            "case 4: a subdomain of a listed entry is counted as added",
+			matchSubdomains: true,
+			previous:        "*.a.example\n",
+			current:         "*.a.example\nwww.a.example\n",
+			expected:        listChange{Old: 1, New: 2, Added: 1},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+				MatchSubdomains: tc.matchSubdomains,
+			}
+			if err := ioutil.WriteFile(path, []byte(tc.previous), 0600); err != nil {
+				t.Fatal(err)
+			}
+			previous, err := buildCacheFromFile(options, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := ioutil.WriteFile(path, []byte(tc.current), 0600); err != nil {
+				t.Fatal(err)
+			}
+			change := &listChange{previous: previous, matchSubdomains: tc.matchSubdomains}
+			if _, err := buildWarnlistCache(options, nil, change, nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(tc.expected, *change, cmpopts.IgnoreUnexported(listChange{})) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, *change, cmpopts.IgnoreUnexported(listChange{})))
+			}
+		})
+	}
+}
+
+func TestReloadChangeWebhook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("a.example\nb.example\nc.example\nd.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries := make(chan map[string]interface{}, 10)
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var summary map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+			t.Errorf("unable to decode the summary: %v", err)
+		}
+		summaries <- summary
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+		ChangeWebhook:   server.URL,
+		ChangeThreshold: 50,
+	}
+	list, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := newWarnlistPlugin(options, startupCaches{warnlist: list, loaded: true}, time.Now())
+
+	// A change below the threshold isn't posted
+	if err := ioutil.WriteFile(path, []byte("a.example\nb.example\nc.example\nd.example\ne.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A feed dropping to a single entry is posted, so it's the first summary received
+	if err := ioutil.WriteFile(path, []byte("a.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case summary := <-summaries:
+		expected := map[string]interface{}{"old_count": 5.0, "new_count": 1.0, "added": 0.0, "removed": 4.0, "change_percent": 80.0}
+		for key, value := range expected {
+			if !cmp.Equal(value, summary[key]) {
+				t.Fatalf("%s: \n\n%s\n", key, cmp.Diff(value, summary[key]))
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a summary to be posted")
+	}
+
+	// A failing webhook doesn't fail the reload
+	atomic.StoreInt32(&failing, 1)
+	if err := ioutil.WriteFile(path, []byte("f.example\ng.example\nh.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-summaries:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a summary to be posted")
+	}
+	if warnlist, _ := wp.lists(); !warnlist.Contains("f.example.") {
+		t.Fatalf("expected the rebuilt warnlist to be served")
+	}
+}
@@ -0,0 +1,55 @@
+package warnlist
+
+import (
+	"io"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/caddy/caddyfile"
+)
+
+// CorefileBlock holds the options of the warnlist plugin in a server block of a Corefile.
+type CorefileBlock struct {
+	// Keys are the addresses at the top of the server block, e.g. .:53
+	Keys    []string
+	Options PluginOptions
+}
+
+// ParseCorefile parses the options of the warnlist plugin in every server block of a Corefile, the same way CoreDNS
+// does when it starts, so a configuration can be checked without running it. Server blocks without the plugin are
+// skipped, and other plugins aren't checked.
+func ParseCorefile(filename string, input io.Reader) ([]CorefileBlock, error) {
+	serverBlocks, err := caddyfile.Parse(filename, input, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []CorefileBlock
+	for _, serverBlock := range serverBlocks {
+		tokens, ok := serverBlock.Tokens["warnlist"]
+		if !ok {
+			continue
+		}
+		c := &caddy.Controller{Dispenser: caddyfile.NewDispenserTokens(filename, tokens)}
+		options, err := parseArguments(c)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, CorefileBlock{Keys: serverBlock.Keys, Options: options})
+	}
+	return blocks, nil
+}
+
+// BuildWarnlistPlugin builds the lists of the options, the same way the plugin does when it starts, and returns a
+// plugin serving them, which isn't reloaded. The build fails if any of the sources fails to load. Checking a Corefile
+// mustn't affect the CoreDNS instances running it, so no snapshot is written, and no change webhook is notified.
+func BuildWarnlistPlugin(options PluginOptions) (*WarnlistPlugin, error) {
+	options.CacheFile = ""
+	options.ChangeWebhook = ""
+
+	caches, err := buildCaches(options, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newWarnlistPlugin(options, caches, time.Now()), nil
+}
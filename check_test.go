@@ -0,0 +1,97 @@
+package warnlist
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseCorefile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("evil.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name      string
+		corefile  string
+		keys      [][]string
+		expectErr bool
+	}{
+		{
+			name: "case 0: the warnlist blocks are parsed, and other server blocks and plugins are skipped",
+			corefile: fmt.Sprintf(`example.org:53 {
+				forward . 8.8.8.8
+			}
+			.:53 .:5353 {
+				log
+				warnlist {
+					file %s text name local
+					exclude safe.evil.example
+				}
+				forward . 8.8.8.8
+			}`, path),
+			keys: [][]string{{".:53", ".:5353"}},
+		},
+		{
+			name: "case 1: an invalid warnlist block returns an error",
+			corefile: fmt.Sprintf(`.:53 {
+				warnlist {
+					file %s bogus
+				}
+			}`, path),
+			expectErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			blocks, err := ParseCorefile("Corefile", strings.NewReader(tc.corefile))
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			keys := make([][]string, 0, len(blocks))
+			for _, block := range blocks {
+				keys = append(keys, block.Keys)
+			}
+			if !cmp.Equal(tc.keys, keys) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.keys, keys))
+			}
+
+			// The parsed options build the same lists as the plugin
+			wp, err := BuildWarnlistPlugin(blocks[0].Options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected := CheckResult{Domain: "www.evil.example.", Match: true, Entry: "evil.example.", Source: "local"}
+			if result := wp.Check("www.evil.example"); !cmp.Equal(expected, result) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(expected, result))
+			}
+			expected = CheckResult{Domain: "safe.evil.example.", Excluded: true}
+			if result := wp.Check("safe.evil.example"); !cmp.Equal(expected, result) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(expected, result))
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Command warnlist-check validates the warnlist blocks of a Corefile, builds their lists, and reports whether the
+// given domains match them, without running CoreDNS.
+//
+//	warnlist-check [-corefile Corefile] [-parse] [-v] [domain...]
+//
+// It exits with 1 if the Corefile can't be parsed or a list fails to load. With -parse, the Corefile is only parsed,
+// without connecting to any source.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	golog "log"
+	"os"
+	"strings"
+
+	warnlist "github.com/giantswarm/coredns-warnlist-plugin"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command with the arguments, and returns its exit code.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("warnlist-check", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	corefile := flags.String("corefile", "Corefile", "path of the Corefile to check")
+	parseOnly := flags.Bool("parse", false, "only parse the Corefile, without loading the lists")
+	verbose := flags.Bool("v", false, "print the log of the plugin while parsing and loading the lists")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: warnlist-check [-corefile Corefile] [-parse] [-v] [domain...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if !*verbose {
+		golog.SetOutput(ioutil.Discard)
+	}
+
+	if err := check(stdout, *corefile, *parseOnly, flags.Args()); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", *corefile, err)
+		return 1
+	}
+	return 0
+}
+
+// check parses the warnlist blocks of the Corefile, builds their lists unless parseOnly is set, and prints whether the
+// domains match them.
+func check(w io.Writer, corefile string, parseOnly bool, domains []string) error {
+	file, err := os.Open(corefile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	blocks, err := warnlist.ParseCorefile(corefile, file)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("no warnlist block found")
+	}
+	if parseOnly && len(domains) > 0 {
+		return fmt.Errorf("domains can't be checked with -parse, which doesn't load the lists")
+	}
+
+	for _, block := range blocks {
+		keys := strings.Join(block.Keys, " ")
+		if parseOnly {
+			fmt.Fprintf(w, "%s: ok\n", keys)
+			continue
+		}
+		wp, err := warnlist.BuildWarnlistPlugin(block.Options)
+		if err != nil {
+			return fmt.Errorf("%s: %w", keys, err)
+		}
+		fmt.Fprintf(w, "%s: ok\n", keys)
+
+		for _, domain := range domains {
+			fmt.Fprintf(w, "  %s\n", describe(wp.Check(domain)))
+		}
+	}
+	return nil
+}
+
+// describe returns a line telling whether a domain matched, and why.
+func describe(result warnlist.CheckResult) string {
+	switch {
+	case result.Excluded:
+		return result.Domain + " excluded"
+	case result.Allowlisted:
+		return result.Domain + " allowlisted"
+	case result.Match && result.Source != "":
+		return fmt.Sprintf("%s matched by %s from %s", result.Domain, result.Entry, result.Source)
+	case result.Match:
+		return fmt.Sprintf("%s matched by %s", result.Domain, result.Entry)
+	default:
+		return result.Domain + " not matched"
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("evil.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.txt")
+	cacheFile := filepath.Join(dir, "warnlist.gz")
+
+	var testCases = []struct {
+		name     string
+		corefile string
+		args     []string
+		exitCode int
+		stdout   string
+	}{
+		{
+			name: "case 0: a valid Corefile exits with 0, and the domains are checked",
+			corefile: fmt.Sprintf(`.:53 {
+				warnlist {
+					file %s text name local
+				}
+			}`, path),
+			args:   []string{"www.evil.example", "clean.example"},
+			stdout: ".:53: ok\n  www.evil.example. matched by evil.example. from local\n  clean.example. not matched\n",
+		},
+		{
+			name: "case 1: an invalid option exits with 1",
+			corefile: fmt.Sprintf(`.:53 {
+				warnlist {
+					file %s bogus
+				}
+			}`, path),
+			exitCode: 1,
+		},
+		{
+			name: "case 2: a list failing to load exits with 1",
+			corefile: fmt.Sprintf(`.:53 {
+				warnlist {
+					file %s text
+				}
+			}`, missing),
+			exitCode: 1,
+		},
+		{
+			name: "case 3: the lists aren't loaded with -parse",
+			corefile: fmt.Sprintf(`.:53 {
+				warnlist {
+					file %s text
+				}
+			}`, missing),
+			args:   []string{"-parse"},
+			stdout: ".:53: ok\n",
+		},
+		{
+			name: "case 4: no snapshot is written to the cache file",
+			corefile: fmt.Sprintf(`.:53 {
+				warnlist {
+					file %s text
+					cache_file %s
+				}
+			}`, path, cacheFile),
+			stdout: ".:53: ok\n",
+		},
+		{
+			name:     "case 5: a Corefile without a warnlist block exits with 1",
+			corefile: ".:53 {\n\tforward . 8.8.8.8\n}",
+			exitCode: 1,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			corefile := filepath.Join(dir, "Corefile")
+			if err := ioutil.WriteFile(corefile, []byte(tc.corefile), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			exitCode := run(append([]string{"-corefile", corefile}, tc.args...), &stdout, &stderr)
+			if !cmp.Equal(tc.exitCode, exitCode) {
+				t.Fatalf("\n\n%s\n%s", cmp.Diff(tc.exitCode, exitCode), stderr.String())
+			}
+			if !cmp.Equal(tc.stdout, stdout.String()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.stdout, stdout.String()))
+			}
+
+			if _, err := os.Stat(cacheFile); !os.IsNotExist(err) {
+				t.Fatalf("expected no cache file, got %v", err)
+			}
+		})
+	}
+}
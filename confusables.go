@@ -0,0 +1,92 @@
+package warnlist
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// punycodePrefix is the prefix of the labels holding non-ASCII names in their ASCII (punycode) form.
+const punycodePrefix = "xn--"
+
+// confusables maps the non-ASCII letters which look like Latin ones to the Latin letter they are confused with. It is
+// a curated subset of the Unicode TR39 confusables data (https://www.unicode.org/reports/tr39/), holding the lowercase
+// Cyrillic, Greek and Latin letters most used in homographs which map to a single ASCII one, since names are already
+// case-folded, and only ASCII skeletons can match the Latin names of the brands homographs imitate. Letters missing
+// from it are left as they are, so homographs using them aren't matched.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a',
+	'с': 'c',
+	'ԁ': 'd',
+	'е': 'e',
+	'һ': 'h',
+	'і': 'i',
+	'ј': 'j',
+	'ӏ': 'l',
+	'о': 'o',
+	'р': 'p',
+	'ԛ': 'q',
+	'ѕ': 's',
+	'ԝ': 'w',
+	'х': 'x',
+	'у': 'y',
+	// Greek
+	'α': 'a',
+	'ι': 'i',
+	'ν': 'v',
+	'ο': 'o',
+	'ρ': 'p',
+	// Latin letters outside of ASCII
+	'ɑ': 'a',
+	'ɡ': 'g',
+	'ı': 'i',
+	'ȷ': 'j',
+}
+
+// skeletonDomain returns a canonical name with the confusable letters of its non-ASCII labels replaced by the Latin
+// letters they look like, so the homograph xn--pple-43d.com. ("аpple.com." with a Cyrillic 'а') matches the
+// listed apple.com. entry. Canonical names are ASCII, so only the punycode labels are decoded, and names without any
+// are returned as they are without allocating.
+func skeletonDomain(name string) string {
+	if !strings.Contains(name, punycodePrefix) {
+		return name
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if strings.HasPrefix(label, punycodePrefix) {
+			labels[i] = skeletonLabel(label)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// skeletonLabel returns the skeleton of a punycode label, in ASCII form. Labels which can't be decoded, or have no
+// confusable letters, are returned as they are.
+func skeletonLabel(label string) string {
+	decoded, err := idna.Punycode.ToUnicode(label)
+	if err != nil {
+		return label
+	}
+
+	mapped := strings.Map(func(r rune) rune {
+		if latin, ok := confusables[r]; ok {
+			return latin
+		}
+		return r
+	}, decoded)
+	if mapped == decoded {
+		return label
+	}
+	if isASCII(mapped) {
+		return mapped
+	}
+
+	// Some letters aren't confusable, so the skeleton is still a punycode label
+	ascii, err := idna.Punycode.ToASCII(mapped)
+	if err != nil {
+		return label
+	}
+	return ascii
+}
@@ -0,0 +1,187 @@
+package warnlist
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+)
+
+func Test_skeletonDomain(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		domain   string
+		skeleton string
+	}{
+		{
+			name:     "case 0: an ASCII domain is unchanged",
+			domain:   "apple.com.",
+			skeleton: "apple.com.",
+		},
+		{
+			name:     "case 1: a Cyrillic 'а' is mapped to a Latin 'a'",
+			domain:   canonicalDomain("аpple.com"),
+			skeleton: "apple.com.",
+		},
+		{
+			name:     "case 2: a label spelled only with Cyrillic letters is mapped to Latin",
+			domain:   canonicalDomain("аррӏе.com"),
+			skeleton: "apple.com.",
+		},
+		{
+			name:     "case 3: Cyrillic letters mixed with Latin ones are mapped",
+			domain:   canonicalDomain("раураl.com"),
+			skeleton: "paypal.com.",
+		},
+		{
+			name:     "case 4: a Greek 'ο' is mapped to a Latin 'o'",
+			domain:   canonicalDomain("gοοgle.com"),
+			skeleton: "google.com.",
+		},
+		{
+			name:     "case 5: only the punycode labels are mapped",
+			domain:   canonicalDomain("login.аpple.com"),
+			skeleton: "login.apple.com.",
+		},
+		{
+			name:     "case 6: letters which aren't confusable are kept in punycode form",
+			domain:   canonicalDomain("bücher.example"),
+			skeleton: "xn--bcher-kva.example.",
+		},
+		{
+			name:     "case 7: the confusable letters of a label with other letters are mapped",
+			domain:   canonicalDomain("bücherаpp.example"),
+			skeleton: canonicalDomain("bücherapp.example"),
+		},
+		{
+			name:     "case 8: an invalid punycode label is kept",
+			domain:   "xn--zz-.example.",
+			skeleton: "xn--zz-.example.",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			skeleton := skeletonDomain(tc.domain)
+			if !cmp.Equal(tc.skeleton, skeleton) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.skeleton, skeleton))
+			}
+		})
+	}
+}
+
+func TestConfusables(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		confusables bool
+		entries     []string
+		allowlist   []string
+		excludes    []string
+		domain      string
+		rcode       int
+	}{
+		{
+			name:        "case 0: a homograph matches the listed domain",
+			confusables: true,
+			entries:     []string{"apple.com."},
+			domain:      "xn--pple-43d.com.",
+			rcode:       dns.RcodeNameError,
+		},
+		{
+			name:        "case 1: a homograph in Unicode form matches the listed domain",
+			confusables: true,
+			entries:     []string{"paypal.com."},
+			domain:      "раураl.com.",
+			rcode:       dns.RcodeNameError,
+		},
+		{
+			name:        "case 2: a listed homograph matches another homograph of the same domain",
+			confusables: true,
+			entries:     []string{canonicalDomain("аpple.com")},
+			domain:      canonicalDomain("аррӏе.com"),
+			rcode:       dns.RcodeNameError,
+		},
+		{
+			name:    "case 3: without confusables, a homograph doesn't match the listed domain",
+			entries: []string{"apple.com."},
+			domain:  "xn--pple-43d.com.",
+			rcode:   dns.RcodeServerFailure,
+		},
+		{
+			name:        "case 4: an unrelated internationalized domain doesn't match",
+			confusables: true,
+			entries:     []string{"apple.com."},
+			domain:      "xn--bcher-kva.example.",
+			rcode:       dns.RcodeServerFailure,
+		},
+		{
+			name:        "case 5: allowlisting the listed domain doesn't allowlist its homographs",
+			confusables: true,
+			entries:     []string{"xn--pple-43d.com."},
+			allowlist:   []string{"apple.com."},
+			domain:      "xn--pple-43d.com.",
+			rcode:       dns.RcodeNameError,
+		},
+		{
+			name:        "case 6: the allowlisted domain itself is still allowlisted",
+			confusables: true,
+			entries:     []string{"xn--pple-43d.com."},
+			allowlist:   []string{"apple.com."},
+			domain:      "apple.com.",
+			rcode:       dns.RcodeServerFailure,
+		},
+		{
+			name:        "case 7: excluding the listed domain doesn't exclude its homographs",
+			confusables: true,
+			entries:     []string{"apple.com."},
+			excludes:    []string{"apple.com."},
+			domain:      "xn--pple-43d.com.",
+			rcode:       dns.RcodeNameError,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{Response: ResponseNXDomain, Confusables: tc.confusables, Excludes: tc.excludes}
+			b := newListBuilder(options)
+			for _, entry := range tc.entries {
+				b.add(listEntry{domain: entry}, "")
+			}
+			wl, err := b.close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var allowlist Warnlist
+			if tc.allowlist != nil {
+				allowlist = NewRadixWarnlist()
+				for _, entry := range tc.allowlist {
+					allowlist.Add(entry)
+				}
+				allowlist.Close()
+			}
+			m := newWarnlistPlugin(options, startupCaches{warnlist: wl, allowlist: allowlist, loaded: true}, time.Now())
+			m.Next = test.ErrorHandler()
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+		})
+	}
+}
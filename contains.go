@@ -0,0 +1,41 @@
+package warnlist
+
+import "github.com/miekg/dns"
+
+// listMatch is how a name matches the loaded lists.
+type listMatch struct {
+	// key is the form in which the name is looked up in the warnlist
+	key string
+	// allowed is true if the name is carved out of matching before the warnlist is consulted, and excluded if it is
+	// carved out by an exclude rather than by the allowlist
+	allowed  bool
+	excluded bool
+
+	entry     string
+	mechanism string
+	hit       bool
+}
+
+// match matches a name, in the form returned by matchName, against the given snapshot of the lists. Queries, checks
+// and metadata all match names with it, so they can't disagree on whether a name matches.
+func (wp *WarnlistPlugin) match(warnlist Warnlist, allowlist Warnlist, name string, qtype uint16) listMatch {
+	m := listMatch{key: wp.Options.warnlistName(name)}
+	if wp.allowedFirst(allowlist, name) {
+		m.allowed = true
+		m.excluded = wp.excludes != nil && wp.excludes.Contains(name)
+		return m
+	}
+	if warnlist != nil {
+		m.entry, m.mechanism, m.hit = lookup(warnlist, m.key, qtype)
+	}
+	return m
+}
+
+// Contains returns true if the domain matches the loaded warnlist, along with the entry it matched. The domain is
+// matched the same way ServeDNS matches queries, honoring the allowlist and excludes, and entries limited to query
+// types match it for any of them.
+func (wp *WarnlistPlugin) Contains(domain string) (bool, string) {
+	warnlist, allowlist := wp.lists()
+	m := wp.match(warnlist, allowlist, wp.Options.matchName(canonicalDomain(domain)), dns.TypeANY)
+	return m.hit, m.entry
+}
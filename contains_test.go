@@ -0,0 +1,121 @@
+package warnlist
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+)
+
+func TestWarnlistPlugin_Contains(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		options   PluginOptions
+		entries   []string
+		allowlist []string
+		domain    string
+		match     bool
+		entry     string
+	}{
+		{
+			name:    "case 0: a listed domain matches its entry",
+			entries: []string{"evil.example."},
+			domain:  "Evil.Example",
+			match:   true,
+			entry:   "evil.example.",
+		},
+		{
+			name:    "case 1: a subdomain matches its listed parent",
+			options: PluginOptions{MatchSubdomains: true},
+			entries: []string{"evil.example."},
+			domain:  "www.evil.example.",
+			match:   true,
+			entry:   "evil.example.",
+		},
+		{
+			name:    "case 2: an unlisted domain doesn't match",
+			entries: []string{"evil.example."},
+			domain:  "clean.example.",
+		},
+		{
+			name:      "case 3: an allowlisted domain doesn't match",
+			entries:   []string{"evil.example."},
+			allowlist: []string{"evil.example."},
+			domain:    "evil.example.",
+		},
+		{
+			name:      "case 4: an allowlisted domain matches if the warnlist takes precedence",
+			options:   PluginOptions{Precedence: PrecedenceBlock},
+			entries:   []string{"evil.example."},
+			allowlist: []string{"evil.example."},
+			domain:    "evil.example.",
+			match:     true,
+			entry:     "evil.example.",
+		},
+		{
+			name:    "case 5: an excluded domain doesn't match",
+			options: PluginOptions{Excludes: []string{"evil.example."}},
+			entries: []string{"evil.example."},
+			domain:  "evil.example.",
+		},
+		{
+			name:    "case 6: the www. label is stripped with strip_www",
+			options: PluginOptions{StripWWW: true},
+			entries: []string{"evil.example."},
+			domain:  "www.evil.example.",
+			match:   true,
+			entry:   "evil.example.",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := tc.options
+			options.Response = ResponseNXDomain
+			b := newListBuilder(options)
+			for _, entry := range tc.entries {
+				b.add(listEntry{domain: entry}, "")
+			}
+			wl, err := b.close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var allowlist Warnlist
+			if tc.allowlist != nil {
+				allowlist = NewRadixWarnlist()
+				for _, entry := range tc.allowlist {
+					allowlist.Add(entry)
+				}
+				allowlist.Close()
+			}
+			m := newWarnlistPlugin(options, startupCaches{warnlist: wl, allowlist: allowlist, loaded: true}, time.Now())
+			m.Next = test.ErrorHandler()
+
+			match, entry := m.Contains(tc.domain)
+			if !cmp.Equal(tc.match, match) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.match, match))
+			}
+			if !cmp.Equal(tc.entry, entry) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.entry, entry))
+			}
+
+			// A query for the domain is blocked exactly when it matches
+			r := new(dns.Msg)
+			r.SetQuestion(canonicalDomain(tc.domain), dns.TypeA)
+			rcode, err := m.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.match, rcode == dns.RcodeNameError) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.match, rcode == dns.RcodeNameError))
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package warnlist
+
+import (
+	"encoding/csv"
+	"strings"
+)
+
+// DefaultCSVColumn is the column holding the domain in csv sources, counting from 1.
+const DefaultCSVColumn = 1
+
+// newCSVParser returns a parser for comma separated files which takes the domain from the given column, counting
+// from 1. If header is set, the first row is skipped. Quoted fields may not span lines. malformed is called for every
+// row which can't be parsed.
+func newCSVParser(column int, header bool, malformed func()) lineParser {
+	skipHeader := header
+
+	return func(line string) (string, bool) {
+		r := csv.NewReader(strings.NewReader(line))
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		fields, err := r.Read()
+		if err != nil {
+			malformed()
+			log.Warningf("skipping malformed csv row %q: %v", line, err)
+			return "", false
+		}
+
+		if skipHeader {
+			skipHeader = false
+			return "", false
+		}
+
+		if len(fields) < column {
+			malformed()
+			log.Warningf("skipping csv row with %d columns, expected at least %d: %q", len(fields), column, line)
+			return "", false
+		}
+
+		domain := strings.TrimSpace(fields[column-1])
+		return domain, domain != ""
+	}
+}
@@ -0,0 +1,66 @@
+package warnlist
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testCSV = `first_seen,type,domain,tags
+2021-06-01,phishing,login.evil.example,"bank, credentials"
+2021-06-02,malware,"Quoted.Example",c2
+2021-06-03,malware
+2021-06-04,spam,,
+# exported by the SOC
+2021-06-05,"scam ""offer""",offer.example,
+`
+
+func Test_csvParser(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		data     string
+		column   int
+		header   bool
+		expected []string
+	}{
+		{
+			name:     "case 0: domains are taken from the configured column below the header",
+			data:     testCSV,
+			column:   3,
+			header:   true,
+			expected: []string{"login.evil.example", "Quoted.Example", "offer.example"},
+		},
+		{
+			name:     "case 1: the first row is kept without a header",
+			data:     "evil.example,malware\nbad.example,spam\n",
+			column:   1,
+			expected: []string{"evil.example", "bad.example"},
+		},
+		{
+			name:     "case 2: rows with too few columns are skipped",
+			data:     "domain,type\nevil.example\nbad.example,spam\n",
+			column:   2,
+			header:   true,
+			expected: []string{"spam"},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			parse := newCSVParser(tc.column, tc.header, func() {})
+			var domains []string
+			for _, line := range splitLines(tc.data) {
+				if domain, ok := parse(line); ok {
+					domains = append(domains, domain)
+				}
+			}
+
+			if !cmp.Equal(tc.expected, domains) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, domains))
+			}
+		})
+	}
+}
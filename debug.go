@@ -0,0 +1,107 @@
+package warnlist
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// debugShutdownTimeout is the time allowed for in-flight debug requests when the server shuts down.
+const debugShutdownTimeout = 5 * time.Second
+
+// CheckResult is the result of checking a domain against the loaded lists, as answered by the debug endpoint.
+type CheckResult struct {
+	Domain      string `json:"domain"`
+	Match       bool   `json:"match"`
+	Entry       string `json:"entry,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Allowlisted bool   `json:"allowlisted"`
+	Excluded    bool   `json:"excluded"`
+}
+
+// debugServer serves the debug endpoints of the plugin on a separate address, so it doesn't affect DNS serving.
+type debugServer struct {
+	addr string
+	wp   *WarnlistPlugin
+
+	ln     net.Listener
+	server *http.Server
+}
+
+// OnStartup starts listening, following the health plugin, so a Corefile reload can bind the same address again.
+func (d *debugServer) OnStartup() error {
+	ln, err := net.Listen("tcp", d.addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/check", d.wp.serveCheck)
+	mux.HandleFunc("/hits", d.wp.serveHits)
+	d.ln = ln
+	d.server = &http.Server{Handler: mux}
+	go func() { _ = d.server.Serve(ln) }()
+
+	log.Infof("Serving debug endpoint on %s", ln.Addr())
+	return nil
+}
+
+// OnFinalShutdown stops the server, waiting for in-flight requests.
+func (d *debugServer) OnFinalShutdown() error {
+	if d.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), debugShutdownTimeout)
+	defer cancel()
+	err := d.server.Shutdown(ctx)
+	d.server = nil
+	return err
+}
+
+// serveCheck answers GET /check?domain=<domain> with whether the domain currently matches the warnlist, the same
+// way a query for it would.
+func (wp *WarnlistPlugin) serveCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	domain := r.URL.Query().Get("domain")
+	if domain == "" {
+		http.Error(w, "missing domain parameter", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(wp.Check(domain))
+}
+
+// Check returns whether the domain currently matches the warnlist, the same way a query for it would, and why it
+// doesn't if it is carved out of matching.
+func (wp *WarnlistPlugin) Check(domain string) CheckResult {
+	name := canonicalDomain(domain)
+	result := CheckResult{Domain: name}
+	name = wp.Options.matchName(name)
+
+	// Take a snapshot of the caches, just like ServeDNS
+	warnlist, allowlist := wp.lists()
+	match := wp.match(warnlist, allowlist, name, dns.TypeANY)
+	switch {
+	case match.excluded:
+		result.Excluded = true
+	case match.allowed:
+		result.Allowlisted = true
+	default:
+		result.Match, result.Entry = match.hit, match.entry
+		if result.Match {
+			result.Source = sourceOf(warnlist, result.Entry)
+		}
+		// If the warnlist takes precedence, the allowlist only applies to names it doesn't match
+		result.Allowlisted = !result.Match && allowlist != nil && allowlist.Contains(name)
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package warnlist
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_serveCheck(t *testing.T) {
+	warnlist := NewTrieWarnlist()
+	warnlist.Add("example.org.")
+	warnlist.Add("something.evil.")
+	_ = warnlist.Close()
+	allowlist := NewWarnlist()
+	allowlist.Add("good.something.evil.")
+	_ = allowlist.Close()
+	wp := &WarnlistPlugin{warnlist: warnlist, allowlist: allowlist, excludes: newExcludeList([]string{"safe.example.org."})}
+
+	var testCases = []struct {
+		name     string
+		method   string
+		query    string
+		status   int
+		expected CheckResult
+	}{
+		{
+			name:     "case 0: a listed subdomain matches its entry",
+			query:    "?domain=www.Example.org",
+			status:   http.StatusOK,
+			expected: CheckResult{Domain: "www.example.org.", Match: true, Entry: "example.org."},
+		},
+		{
+			name:     "case 1: an unlisted domain doesn't match",
+			query:    "?domain=example.com.",
+			status:   http.StatusOK,
+			expected: CheckResult{Domain: "example.com."},
+		},
+		{
+			name:     "case 2: an allowlisted domain doesn't match",
+			query:    "?domain=good.something.evil",
+			status:   http.StatusOK,
+			expected: CheckResult{Domain: "good.something.evil.", Allowlisted: true},
+		},
+		{
+			name:     "case 3: an excluded domain doesn't match",
+			query:    "?domain=www.safe.example.org",
+			status:   http.StatusOK,
+			expected: CheckResult{Domain: "www.safe.example.org.", Excluded: true},
+		},
+		{
+			name:   "case 4: a missing domain is a bad request",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "case 5: a POST is not allowed",
+			method: http.MethodPost,
+			query:  "?domain=example.org",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := httptest.NewRecorder()
+			wp.serveCheck(rec, httptest.NewRequest(method, "/check"+tc.query, nil))
+
+			if !cmp.Equal(tc.status, rec.Code) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.status, rec.Code))
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var result CheckResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(tc.expected, result) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, result))
+			}
+		})
+	}
+}
+
+func Test_debugServer(t *testing.T) {
+	warnlist := NewWarnlist()
+	warnlist.Add("example.org.")
+	_ = warnlist.Close()
+	d := &debugServer{addr: "127.0.0.1:0", wp: &WarnlistPlugin{warnlist: warnlist}}
+
+	if err := d.OnStartup(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := http.Get("http://" + d.ln.Addr().String() + "/check?domain=example.org")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if !cmp.Equal(http.StatusOK, resp.StatusCode) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(http.StatusOK, resp.StatusCode))
+	}
+
+	if err := d.OnFinalShutdown(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := http.Get("http://" + d.ln.Addr().String() + "/check?domain=example.org"); err == nil {
+		t.Fatalf("expected the server to be shut down")
+	}
+	// Shutting down again, like on a restart followed by the final shutdown, is a no-op
+	if err := d.OnFinalShutdown(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
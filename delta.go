@@ -0,0 +1,345 @@
+package warnlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultFullSyncPeriod is the age of the full warnlist above which a reload fetches all sources again, instead of the
+// delta feed configured with delta_url.
+const DefaultFullSyncPeriod = 24 * time.Hour
+
+// DeltaWarnlist applies the changes of a delta feed on top of a full Warnlist, without rebuilding it. Domains added by
+// the feed are kept in a small list of their own, and removed entries are skipped when they match, so the full list is
+// never changed while queries are being served. Like other Warnlists, a DeltaWarnlist is only changed until it is
+// closed; the next delta is applied to a copy made by next.
+type DeltaWarnlist struct {
+	Warnlist
+	options PluginOptions
+
+	// added holds the entries added by the feed which the full list doesn't hold, and removed the entries of the full
+	// list removed by the feed, both in the form Match returns them
+	added   map[string]struct{}
+	removed map[string]struct{}
+	list    Warnlist
+}
+
+// NewDeltaWarnlist returns a DeltaWarnlist without changes to the given full Warnlist, which was built from the options.
+func NewDeltaWarnlist(w Warnlist, options PluginOptions) *DeltaWarnlist {
+	d := &DeltaWarnlist{Warnlist: w, options: options}
+	d.Open()
+	return d
+}
+
+// next returns a copy of the DeltaWarnlist holding the same changes, which further changes can be applied to.
+func (d *DeltaWarnlist) next() *DeltaWarnlist {
+	n := NewDeltaWarnlist(d.Warnlist, d.options)
+	for key := range d.added {
+		n.added[key] = struct{}{}
+	}
+	for key := range d.removed {
+		n.removed[key] = struct{}{}
+	}
+	return n
+}
+
+// Add adds a domain, unless the full list holds it already. A domain removed by an earlier change is listed again.
+func (d *DeltaWarnlist) Add(key string) {
+	key, ok := d.entryKey(key)
+	if !ok {
+		return
+	}
+	if _, ok := d.removed[key]; ok {
+		delete(d.removed, key)
+		return
+	}
+	if !d.baseHolds(key) {
+		d.added[key] = struct{}{}
+	}
+}
+
+// Remove removes a domain, whether it is held by the full list or was added by an earlier change. Only the entry
+// itself is removed, so subdomains of a listed parent still match it.
+func (d *DeltaWarnlist) Remove(key string) {
+	key, ok := d.entryKey(key)
+	if !ok {
+		return
+	}
+	if _, ok := d.added[key]; ok {
+		delete(d.added, key)
+		return
+	}
+	if d.baseHolds(key) {
+		d.removed[key] = struct{}{}
+	}
+}
+
+func (d *DeltaWarnlist) Contains(key string) bool {
+	_, ok := d.Match(key)
+	return ok
+}
+
+func (d *DeltaWarnlist) Match(key string) (string, bool) {
+	if entry, ok := d.list.Match(key); ok {
+		return entry, true
+	}
+	entry, ok := d.Warnlist.Match(key)
+	if !ok || !d.isRemoved(entry) {
+		return entry, ok
+	}
+	// Another entry of the full list may still match the key, like a listed parent
+	return d.firstKept(d.Warnlist.MatchAll(key))
+}
+
+func (d *DeltaWarnlist) MatchType(key string, qtype uint16) (string, bool) {
+	entry, _, ok := d.Lookup(key, qtype)
+	return entry, ok
+}
+
+// Lookup returns the entry matching a query for the key and type, and the mechanism which matched it. Entries added by
+// the feed are looked up first. If the matching entry of the full list was removed, any other entry of the full list
+// matching the key is returned, whatever query types it is limited to.
+func (d *DeltaWarnlist) Lookup(key string, qtype uint16) (string, string, bool) {
+	if entry, ok := matchType(d.list, key, qtype); ok {
+		return entry, MatchLiteral, true
+	}
+	entry, mechanism, ok := lookup(d.Warnlist, key, qtype)
+	if !ok || !d.isRemoved(entry) {
+		return entry, mechanism, ok
+	}
+
+	entry, ok = d.firstKept(d.Warnlist.MatchAll(key))
+	if !ok {
+		return "", "", false
+	}
+	if r, isRegex := d.Warnlist.(*RegexWarnlist); isRegex {
+		if pattern, matched := r.matchPattern(key); matched && pattern == entry {
+			return entry, MatchRegex, true
+		}
+	}
+	return entry, MatchLiteral, true
+}
+
+func (d *DeltaWarnlist) MatchAll(key string) []string {
+	var entries []string
+	for _, entry := range d.Warnlist.MatchAll(key) {
+		if !d.isRemoved(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return append(entries, d.list.MatchAll(key)...)
+}
+
+// Source returns the name of the source a matched entry was loaded from. Entries added by the feed have none.
+func (d *DeltaWarnlist) Source(entry string) string {
+	if _, ok := d.added[entry]; ok {
+		return ""
+	}
+	return sourceOf(d.Warnlist, entry)
+}
+
+// Close builds the list of added entries. The full list was closed already.
+func (d *DeltaWarnlist) Close() error {
+	b := newListBuilder(d.options)
+	for key := range d.added {
+		b.add(listEntry{domain: key}, "")
+	}
+	list, err := b.close()
+	if err != nil {
+		return err
+	}
+	d.list = list
+	return nil
+}
+
+func (d *DeltaWarnlist) Len() int {
+	return d.Warnlist.Len() - len(d.removed) + len(d.added)
+}
+
+// Open drops all changes, leaving the full list as it is.
+func (d *DeltaWarnlist) Open() {
+	d.added = make(map[string]struct{})
+	d.removed = make(map[string]struct{})
+	d.list = newWarnlist(d.options)
+}
+
+// entryKey returns a canonical domain in the form the full list returns its entries in, which is stripped of a leading
+// www. label with strip_www, mapped to its skeleton with confusables, and reduced to its registered domain with etld_plus_one. It returns false for public suffixes, which are never listed then.
+func (d *DeltaWarnlist) entryKey(key string) (string, bool) {
+	if d.options.MatchSubdomains {
+		// Entries matching subdomains are returned without their wildcard
+		key = strings.TrimPrefix(key, wildcardPrefix)
+	}
+	key = d.options.warnlistName(d.options.matchName(key))
+	if d.options.ETLDPlusOne {
+		return registeredDomain(key)
+	}
+	return key, true
+}
+
+// baseHolds returns true if the full list holds the entry itself, rather than a parent of it.
+func (d *DeltaWarnlist) baseHolds(entry string) bool {
+	for _, e := range d.Warnlist.MatchAll(entry) {
+		if e == entry {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DeltaWarnlist) isRemoved(entry string) bool {
+	_, ok := d.removed[entry]
+	return ok
+}
+
+// firstKept returns the first of the entries which wasn't removed.
+func (d *DeltaWarnlist) firstKept(entries []string) (string, bool) {
+	for _, entry := range entries {
+		if !d.isRemoved(entry) {
+			return entry, true
+		}
+	}
+	return "", false
+}
+
+// deltaCounts are the changes of a delta feed, and the number of its lines skipped because they couldn't be parsed.
+type deltaCounts struct {
+	added     int
+	removed   int
+	malformed int
+}
+
+// applyDelta reads a delta feed, with a domain prefixed by + to add it or by - to remove it on each line, and applies
+// its changes to the DeltaWarnlist in order, so a later line for a domain wins over an earlier one. Empty lines and
+// lines starting with # are skipped.
+func applyDelta(d *DeltaWarnlist, feed *bufio.Scanner) (deltaCounts, error) {
+	var counts deltaCounts
+	feed.Buffer(nil, maxLineSize)
+	first := true
+	for feed.Scan() {
+		line := feed.Text()
+		if first {
+			line = strings.TrimPrefix(line, utf8BOM)
+			first = false
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		domain := canonicalDomain(strings.TrimSpace(line[1:]))
+		if !isValidEntry(domain) || (line[0] != '+' && line[0] != '-') {
+			log.Debugf("skipping invalid delta line %q", line)
+			counts.malformed++
+			continue
+		}
+		if line[0] == '+' && d.options.rejectsBroad(domain) {
+			log.Warningf("skipping delta entry %s, which would match every domain under a public suffix (set allow_broad_entries true to load it)", domain)
+			continue
+		}
+		if line[0] == '+' {
+			d.Add(domain)
+			counts.added++
+		} else {
+			d.Remove(domain)
+			counts.removed++
+		}
+	}
+	if err := feed.Err(); err != nil {
+		return counts, fmt.Errorf("unable to read delta feed: %w", err)
+	}
+	return counts, nil
+}
+
+// deltaDue returns true if the next reload applies the delta feed, rather than fetching all sources again. The full
+// warnlist is fetched instead once it is older than the full sync period, which corrects any drift from missed or
+// inconsistent deltas, or while it hasn't been fetched since the plugin started.
+func (wp *WarnlistPlugin) deltaDue() bool {
+	if wp.Options.DeltaURL == "" || wp.lastFullSync.IsZero() {
+		return false
+	}
+	return time.Since(wp.lastFullSync) < wp.Options.FullSyncPeriod
+}
+
+// reloadDelta fetches the delta feed, and swaps in the warnlist with its changes applied. The feed is fetched with a
+// conditional request, so an unchanged feed is neither downloaded nor applied again. On failure the loaded warnlist is
+// kept, like for full reloads.
+func (wp *WarnlistPlugin) reloadDelta() error {
+	resp, err := fetchURL(wp.Options.DeltaURL, wp.Options, wp.deltaValidator)
+	if err == errNotModified {
+		log.Info("warnlist delta feed is unchanged, skipping reload")
+
+		wp.mu.Lock()
+		defer wp.mu.Unlock()
+		wp.lastReloadTime = time.Now()
+		wp.lastReloadErr = nil
+		if wp.serverName != "" {
+			reloadsSkipped.WithLabelValues(wp.serverName).Inc()
+			lastReloadTimestamp.WithLabelValues(wp.serverName).Set(float64(wp.lastReloadTime.Unix()))
+		}
+		return nil
+	}
+
+	var counts deltaCounts
+	var delta *DeltaWarnlist
+	if err == nil {
+		compressed := resp.Header.Get("Content-Encoding") == "gzip" || strings.HasSuffix(resp.Request.URL.Path, ".gz")
+		counts, delta, err = wp.buildDelta(resp.Body, compressed)
+	}
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	if err != nil {
+		log.Warningf("error applying warnlist delta, keeping the previously loaded warnlist: %v", err)
+		wp.lastReloadErr = err
+
+		if wp.serverName != "" {
+			countReloadFailure(wp.serverName)
+		}
+		return err
+	}
+
+	log.Infof("applied warnlist delta: %d domains added, %d removed, skipped %d malformed lines", counts.added, counts.removed, counts.malformed)
+	wp.warnlist = delta
+	wp.deltaValidator = responseValidator(resp)
+	wp.lastReloadTime = time.Now()
+	wp.lastReloadErr = nil
+	if wp.serverName != "" {
+		warnlistSize.WithLabelValues(wp.serverName).Set(float64(wp.warnlist.Len()))
+		lastReloadTimestamp.WithLabelValues(wp.serverName).Set(float64(wp.lastReloadTime.Unix()))
+	}
+	return nil
+}
+
+// buildDelta applies the delta feed read from the body to a copy of the loaded warnlist, which keeps being served until
+// the copy is swapped in.
+func (wp *WarnlistPlugin) buildDelta(body io.ReadCloser, compressed bool) (deltaCounts, *DeltaWarnlist, error) {
+	feed, err := decompressSource(body, compressed, redactURL(wp.Options.DeltaURL))
+	if err != nil {
+		return deltaCounts{}, nil, err
+	}
+	defer feed.Close()
+
+	warnlist, _ := wp.lists()
+	var delta *DeltaWarnlist
+	if d, ok := warnlist.(*DeltaWarnlist); ok {
+		delta = d.next()
+	} else {
+		delta = NewDeltaWarnlist(warnlist, wp.Options)
+	}
+
+	counts, err := applyDelta(delta, bufio.NewScanner(feed))
+	if err != nil {
+		return counts, nil, err
+	}
+	if err := delta.Close(); err != nil {
+		return counts, nil, err
+	}
+	if err := checkMinEntries(delta, wp.Options); err != nil {
+		return counts, nil, err
+	}
+	return counts, delta, nil
+}
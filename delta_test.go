@@ -0,0 +1,206 @@
+package warnlist
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDeltaWarnlist(t *testing.T) {
+	var testCases = []struct {
+		name            string
+		matchSubdomains bool
+		deltas          []string
+		matched         []string
+		unmatched       []string
+		len             int
+	}{
+		{
+			name:            "case 0: added domains match, and removed ones don't",
+			matchSubdomains: true,
+			deltas:          []string{"+added.example\n-evil.example\n"},
+			matched:         []string{"added.example.", "www.added.example.", "bad.example."},
+			unmatched:       []string{"evil.example.", "www.evil.example."},
+			len:             4,
+		},
+		{
+			name:            "case 1: a removed entry doesn't hide a listed parent",
+			matchSubdomains: true,
+			deltas:          []string{"-www.bad.example\n"},
+			matched:         []string{"www.bad.example.", "bad.example."},
+			len:             3,
+		},
+		{
+			name:            "case 2: later lines and deltas win over earlier ones",
+			matchSubdomains: true,
+			deltas:          []string{"-evil.example\n+added.example\n", "+evil.example\n-added.example\n+other.example\n-other.example\n"},
+			matched:         []string{"evil.example."},
+			unmatched:       []string{"added.example.", "other.example."},
+			len:             4,
+		},
+		{
+			name:      "case 3: comments, empty and malformed lines are skipped",
+			deltas:    []string{"# changes\n\nadded.example\n+\n+bad domain.example\n"},
+			matched:   []string{"evil.example."},
+			unmatched: []string{"added.example."},
+			len:       4,
+		},
+		{
+			name:      "case 4: entries are removed exactly without match_subdomains",
+			deltas:    []string{"-*.wild.example\n+*.new.example\n"},
+			matched:   []string{"evil.example.", "sub.new.example."},
+			unmatched: []string{"sub.wild.example.", "wild.example."},
+			len:       4,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{MatchSubdomains: tc.matchSubdomains}
+			b := newListBuilder(options)
+			for _, domain := range []string{"evil.example.", "bad.example.", "www.bad.example.", "*.wild.example."} {
+				b.add(listEntry{domain: domain}, "feed")
+			}
+			base, err := b.close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d := NewDeltaWarnlist(base, options)
+			for _, delta := range tc.deltas {
+				d = d.next()
+				if _, err := applyDelta(d, bufio.NewScanner(strings.NewReader(delta))); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := d.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, name := range tc.matched {
+				if !d.Contains(name) {
+					t.Fatalf("expected %s to be matched", name)
+				}
+				if _, _, ok := lookup(d, name, 1); !ok {
+					t.Fatalf("expected a lookup of %s to match", name)
+				}
+			}
+			for _, name := range tc.unmatched {
+				if d.Contains(name) {
+					t.Fatalf("expected %s not to be matched", name)
+				}
+				if _, _, ok := lookup(d, name, 1); ok {
+					t.Fatalf("expected a lookup of %s not to match", name)
+				}
+			}
+			if !cmp.Equal(tc.len, d.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.len, d.Len()))
+			}
+
+			// The full list is never changed
+			if !base.Contains("evil.example.") {
+				t.Fatalf("expected the full list to still match evil.example")
+			}
+		})
+	}
+}
+
+func TestReloadDelta(t *testing.T) {
+	fullRequests := 0
+	full := "evil.example\n"
+	fullServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fullRequests++
+		_, _ = w.Write([]byte(full))
+	}))
+	defer fullServer.Close()
+
+	deltaRequests := 0
+	delta := "+added.example\n"
+	etag := `"1"`
+	deltaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deltaRequests++
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(delta))
+	}))
+	defer deltaServer.Close()
+
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: fullServer.URL, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+		DeltaURL:        deltaServer.URL,
+		FullSyncPeriod:  time.Hour,
+	}
+	list, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := newWarnlistPlugin(options, startupCaches{warnlist: list, loaded: true}, time.Now())
+
+	// The delta is applied without fetching the full list again
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	warnlist, _ := wp.lists()
+	if !warnlist.Contains("added.example.") || !warnlist.Contains("evil.example.") {
+		t.Fatalf("expected the delta to be applied on top of the full list")
+	}
+	if !cmp.Equal(1, fullRequests) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(1, fullRequests))
+	}
+
+	// An unchanged delta keeps the loaded warnlist
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if current, _ := wp.lists(); current != warnlist {
+		t.Fatalf("expected the warnlist to be kept for an unchanged delta")
+	}
+	if !cmp.Equal(2, deltaRequests) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(2, deltaRequests))
+	}
+
+	// A changed delta is applied on top of the previous one
+	delta, etag = "-evil.example\n", `"2"`
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	warnlist, _ = wp.lists()
+	if !warnlist.Contains("added.example.") || warnlist.Contains("evil.example.") {
+		t.Fatalf("expected the delta to be applied on top of the previous one")
+	}
+
+	// Once the full list is older than the full sync period, it is fetched again, dropping the changes of the deltas
+	full = "other.example\n"
+	wp.lastFullSync = time.Now().Add(-2 * time.Hour)
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	warnlist, _ = wp.lists()
+	if _, ok := warnlist.(*DeltaWarnlist); ok || !warnlist.Contains("other.example.") || warnlist.Contains("added.example.") {
+		t.Fatalf("expected the full list to replace the deltas")
+	}
+	if !cmp.Equal(2, fullRequests) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(2, fullRequests))
+	}
+
+	// The delta is fetched again for the new full list
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	warnlist, _ = wp.lists()
+	if !warnlist.Contains("other.example.") || warnlist.Contains("evil.example.") {
+		t.Fatalf("expected the delta to be applied on top of the new full list")
+	}
+}
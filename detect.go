@@ -0,0 +1,125 @@
+package warnlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// The amount of a source sniffed to detect its format, and the number of its lines looked at.
+const (
+	detectSize  = 64 * 1024
+	detectLines = 100
+)
+
+// formatUnknown is the format of lines which don't look like any format, and formatJSON that of JSON documents,
+// which aren't line delimited.
+const (
+	formatUnknown = "unrecognized"
+	formatJSON    = "json"
+)
+
+// detectFormat returns the format of the source read by r, from the first lines it holds, without consuming them. The
+// lines have to agree on a single format, except for adblock lists, which also hold rules no other format has.
+// Otherwise the format is ambiguous, and the error lists the formats of the lines seen. A source without any lines,
+// like an empty feed, is read as a text list.
+func detectFormat(r *bufio.Reader, path string) (string, error) {
+	head, err := r.Peek(detectSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimPrefix(string(head), utf8BOM), "\n")
+	if len(head) == detectSize {
+		// The last line was cut off
+		lines = lines[:len(lines)-1]
+	}
+
+	seen := make(map[string]int)
+	detected := 0
+	for _, line := range lines {
+		if detected == detectLines {
+			break
+		}
+		format, ok := detectLineFormat(line)
+		if !ok {
+			continue
+		}
+		if format == DomainFileFormatRPZ {
+			// Zone files start with directives or the SOA, and their records don't look like any other format
+			return format, nil
+		}
+		seen[format]++
+		detected++
+	}
+
+	if seen[DomainFileFormatAdblock] > 0 {
+		// Cosmetic, regex and other rules aren't recognized, but only belong to adblock lists
+		delete(seen, formatUnknown)
+	}
+	switch len(seen) {
+	case 0:
+		return DomainFileFormatTextList, nil
+	case 1:
+		for format := range seen {
+			if format != formatUnknown && format != formatJSON {
+				log.Infof("Detected format %s for %s", format, path)
+				return format, nil
+			}
+		}
+	}
+
+	formats := make([]string, 0, len(seen))
+	for format, count := range seen {
+		formats = append(formats, fmt.Sprintf("%d %s", count, format))
+	}
+	sort.Strings(formats)
+	return "", fmt.Errorf("unable to detect the format of %s, its first lines are %s (set the format explicitly)", path, strings.Join(formats, ", "))
+}
+
+// detectLineFormat returns the format a line of a source looks like, returning false for lines which are the same in
+// every format, like comments and empty lines.
+func detectLineFormat(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "", strings.HasPrefix(trimmed, "#"):
+		return "", false
+	case strings.HasPrefix(trimmed, "!"), strings.HasPrefix(trimmed, "@@"):
+		// Comments of adblock lists, and exceptions of adblock and text lists
+		return "", false
+	case strings.HasPrefix(trimmed, "[Adblock"), strings.Contains(trimmed, "||"), strings.Contains(trimmed, "##"):
+		return DomainFileFormatAdblock, true
+	case strings.HasPrefix(trimmed, "$ORIGIN"), strings.HasPrefix(trimmed, "$TTL"), strings.Contains(trimmed, " IN SOA "):
+		return DomainFileFormatRPZ, true
+	case strings.HasPrefix(trimmed, "{"):
+		return DomainFileFormatJSONL, true
+	case strings.HasPrefix(trimmed, "["):
+		return formatJSON, true
+	case strings.Contains(trimmed, "://"):
+		return DomainFileFormatURLList, true
+	case strings.Contains(trimmed, ","):
+		if rank, _, ok := splitRankedDomain(trimmed); ok && isRank(rank) {
+			// A ranked list, whose first column would otherwise be loaded as domains
+			return DomainFileFormatUmbrella, true
+		}
+		return DomainFileFormatCSV, true
+	}
+
+	fields := strings.Fields(trimmed)
+	if net.ParseIP(fields[0]) != nil {
+		if len(fields) > 1 {
+			// An address followed by the hostnames mapped to it
+			return DomainFileFormatHostfile, true
+		}
+		return DomainFileFormatIPList, true
+	}
+	if _, _, err := net.ParseCIDR(fields[0]); err == nil && len(fields) == 1 {
+		return DomainFileFormatIPList, true
+	}
+	if _, _, ok := parseQualifiedDomain(trimmed); ok && isHostname(strings.TrimPrefix(fields[0], wildcardPrefix)) {
+		return DomainFileFormatTextList, true
+	}
+	return formatUnknown, true
+}
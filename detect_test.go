@@ -0,0 +1,164 @@
+package warnlist
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_detectFormat(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		contents  string
+		format    string
+		expectErr string
+	}{
+		{
+			name:     "case 0: lines starting with an address are a hostfile",
+			contents: "# abuse.ch URLhaus Host file\n127.0.0.1\tbad.example\n0.0.0.0 evil.example worse.example\n",
+			format:   DomainFileFormatHostfile,
+		},
+		{
+			name:     "case 1: lines of hostnames are a text list",
+			contents: "bad.example\n*.evil.example\nexfil.example TXT NULL\n!safe.evil.example\n",
+			format:   DomainFileFormatTextList,
+		},
+		{
+			name:     "case 2: domain anchors are an adblock list, whatever its other rules",
+			contents: "[Adblock Plus 2.0]\n! Title: Example list\n||ads.example^\n@@||safe.example^\nexample.com##.advert\n/banner[0-9]+/\n",
+			format:   DomainFileFormatAdblock,
+		},
+		{
+			name:     "case 3: lines of JSON objects are a jsonl list",
+			contents: "{\"domain\": \"bad.example\"}\n{\"domain\": \"evil.example\"}\n",
+			format:   DomainFileFormatJSONL,
+		},
+		{
+			name:     "case 4: a zone file is an rpz list",
+			contents: "$TTL 300\n$ORIGIN rpz.example.\n@ IN SOA localhost. root.localhost. 1 3600 600 86400 60\nbad.example CNAME .\n",
+			format:   DomainFileFormatRPZ,
+		},
+		{
+			name:     "case 5: lines of URLs are a urllist",
+			contents: "http://bad.example/login\nhttps://evil.example:8443/\n",
+			format:   DomainFileFormatURLList,
+		},
+		{
+			name:     "case 6: lines of addresses and CIDRs are an iplist",
+			contents: "198.51.100.0/24\n203.0.113.7\n2001:db8::/32\n",
+			format:   DomainFileFormatIPList,
+		},
+		{
+			name:     "case 7: comma separated lines are a csv list",
+			contents: "bad.example,2021-01-01,malware\nevil.example,2021-01-02,phishing\n",
+			format:   DomainFileFormatCSV,
+		},
+		{
+			name:     "case 8: a source without any lines is a text list",
+			contents: "# Nothing listed yet\n\n",
+			format:   DomainFileFormatTextList,
+		},
+		{
+			name:      "case 9: a mix of hostfile and text lines is ambiguous",
+			contents:  "127.0.0.1 bad.example\nevil.example\nworse.example\n",
+			expectErr: "its first lines are 1 hostfile, 2 text",
+		},
+		{
+			name:      "case 10: a JSON document isn't detected",
+			contents:  "[\"bad.example\", \"evil.example\"]\n",
+			expectErr: "its first lines are 1 json",
+		},
+		{
+			name:      "case 11: lines which don't look like any format aren't detected",
+			contents:  "<html>\n<body>Session expired</body>\n",
+			expectErr: "its first lines are 2 unrecognized",
+		},
+		{
+			name:     "case 12: rank,domain lines are an umbrella list",
+			contents: "1,google.com\n2,microsoft.com\n3,facebook.com\n",
+			format:   DomainFileFormatUmbrella,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			reader := bufio.NewReaderSize(strings.NewReader(tc.contents), detectSize)
+			format, err := detectFormat(reader, "domains.txt")
+			if tc.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(tc.format, format) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.format, format))
+			}
+
+			// Detection doesn't consume the lines it looked at
+			rest, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tc.contents, string(rest)) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.contents, string(rest)))
+			}
+		})
+	}
+}
+
+func Test_buildCacheAutoFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hosts := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(hosts, []byte("127.0.0.1 localhost\n0.0.0.0 bad.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	adblock := filepath.Join(dir, "adblock.txt")
+	if err := ioutil.WriteFile(adblock, []byte("[Adblock Plus 2.0]\n||evil.example^\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{
+		Sources: []DomainSource{
+			{Path: hosts, Type: DomainSourceTypeFile, Format: DomainFileFormatAuto},
+			{Path: adblock, Type: DomainSourceTypeFile, Format: DomainFileFormatAuto},
+		},
+		ReservedHosts: DefaultReservedHosts,
+	}
+	warnlist, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Each source is detected on its own, and the baseline entries of the hosts file are skipped as usual
+	for _, name := range []string{"bad.example.", "evil.example."} {
+		if !warnlist.Contains(name) {
+			t.Fatalf("expected %s to be loaded", name)
+		}
+	}
+	if warnlist.Contains("localhost.") {
+		t.Fatalf("expected the baseline entries of the hosts file to be skipped")
+	}
+
+	// An ambiguous source fails the build
+	if err := ioutil.WriteFile(adblock, []byte("0.0.0.0 bad.example\nevil.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildCacheFromFile(options, nil); err == nil {
+		t.Fatalf("expected an ambiguous source to fail the build")
+	}
+}
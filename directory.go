@@ -0,0 +1,67 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandSources replaces file sources naming a directory with a file source for each list in the directory, in the
+// same format. Directories are listed on every build, so files added to them are picked up by the next reload.
+func expandSources(sources []DomainSource, options PluginOptions) ([]DomainSource, error) {
+	expanded := make([]DomainSource, 0, len(sources))
+	for _, source := range sources {
+		if source.Type != DomainSourceTypeFile {
+			expanded = append(expanded, source)
+			continue
+		}
+		if info, err := os.Stat(source.Path); err != nil || !info.IsDir() {
+			// Errors are reported when the file is opened
+			expanded = append(expanded, source)
+			continue
+		}
+
+		files, err := listDirectory(source.Path, options.FileExtension)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			log.Warningf("no list files found in directory %s", source.Path)
+		}
+		for _, file := range files {
+			expanded = append(expanded, DomainSource{Path: file, Type: DomainSourceTypeFile, Format: source.Format, Name: source.Name, ReloadPeriod: source.ReloadPeriod})
+		}
+	}
+	return expanded, nil
+}
+
+// listDirectory returns the paths of the files in the directory with the extension, or all of them if the extension
+// is empty, sorted by name. Symlinks are followed, but subdirectories and hidden entries are skipped, which also
+// skips the ..data directory of Kubernetes volumes while keeping the symlinks to its files.
+func listDirectory(dir string, extension string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !strings.HasSuffix(name, extension) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Warningf("skipping %s: %v", path, err)
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
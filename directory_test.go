@@ -0,0 +1,96 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_buildCacheFromDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lists := filepath.Join(dir, "lists")
+	files := map[string]string{
+		"lists/a.list":        "a.example\n",
+		"lists/b.list":        "b.example\n",
+		"lists/c.txt":         "c.example\n",
+		"lists/.hidden.list":  "hidden.example\n",
+		"lists/sub/d.list":    "d.example\n",
+		"outside/linked.list": "linked.example\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "outside/linked.list"), filepath.Join(lists, "e.list")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "missing.list"), filepath.Join(lists, "broken.list")); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: lists, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+		FileExtension:   ".list",
+	}
+	validators := sourceValidators{}
+	list, err := buildCacheFromFile(options, validators)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Files with the extension and symlinks to them are loaded, other files, hidden files, subdirectories and broken
+	// symlinks are skipped
+	expected := map[string]bool{
+		"a.example.":      true,
+		"b.example.":      true,
+		"linked.example.": true,
+		"c.example.":      false,
+		"hidden.example.": false,
+		"d.example.":      false,
+	}
+	for name, hit := range expected {
+		if !cmp.Equal(hit, list.Contains(name)) {
+			t.Fatalf("%s: \n\n%s\n", name, cmp.Diff(hit, list.Contains(name)))
+		}
+	}
+
+	wp := &WarnlistPlugin{warnlist: list, validators: validators, Options: options}
+
+	// An unchanged directory keeps the loaded warnlist
+	rebuildWarnlist(wp)
+	if list != wp.warnlist {
+		t.Fatalf("expected the unchanged warnlist to be kept")
+	}
+
+	// A file added to the directory is picked up by the next reload
+	if err := ioutil.WriteFile(filepath.Join(lists, "f.list"), []byte("f.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rebuildWarnlist(wp)
+	if !wp.warnlist.Contains("f.example.") {
+		t.Fatalf("expected f.example. to be loaded")
+	}
+
+	// A file removed from the directory is dropped by the next reload
+	if err := os.Remove(filepath.Join(lists, "a.list")); err != nil {
+		t.Fatal(err)
+	}
+	rebuildWarnlist(wp)
+	if wp.warnlist.Contains("a.example.") {
+		t.Fatalf("expected a.example. to be dropped")
+	}
+}
@@ -2,78 +2,459 @@ package warnlist
 
 import (
 	"bufio"
+	"compress/gzip"
+	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"regexp"
 	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/miekg/dns"
 )
 
 const (
 	DomainFileFormatHostfile = "hostfile"
 	DomainFileFormatTextList = "text"
+	DomainFileFormatRPZ      = "rpz"
+	DomainFileFormatAdblock  = "adblock"
+	DomainFileFormatCSV      = "csv"
+	DomainFileFormatJSONL    = "jsonl"
+	DomainFileFormatIPList   = "iplist"
+	DomainFileFormatRegex    = "regex"
+	DomainFileFormatURLList  = "urllist"
+	DomainFileFormatUmbrella = "umbrella"
+	DomainFileFormatScored   = "scored"
+	DomainFileFormatAuto     = "auto"
 	DomainSourceTypeFile     = "file"
 	DomainSourceTypeURL      = "url"
+	DomainSourceTypeS3       = "s3"
+	DomainSourceTypeSFTP     = "sftp"
+	DomainSourceTypeSocket   = "socket"
+	DomainSourceTypeRedis    = "redis"
+	DomainSourceTypeTAXII    = "taxii"
 )
 
-func domainsFromSource(source string, sourceType string, sourceFormat string) chan string {
+// DomainSource describes a location to load domains from.
+type DomainSource struct {
+	Path   string
+	Type   string
+	Format string
+	// Name labels the matches of domains loaded from the source, if set
+	Name string
+	// ReloadPeriod reloads the source on its own schedule, rather than the reload period of the plugin, if set
+	ReloadPeriod time.Duration
+}
+
+// maxLineSize is the longest line read from a source. Sources are read a line at a time, so only a line, rather than
+// the whole source, is ever held in memory; longer lines fail the load.
+const maxLineSize = 1024 * 1024
 
-	c := make(chan string)
+// utf8BOM is the byte order mark some editors write at the start of UTF-8 files.
+const utf8BOM = "\ufeff"
+
+// gzipMagic are the leading bytes of every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// listEntry is a domain read from a source, along with the query types it is limited to, if any.
+type listEntry struct {
+	domain string
+	qtypes []uint16
+	// pattern is set for the patterns of regex sources, whose domain holds the pattern as it was given
+	pattern *regexp.Regexp
+	// exception is set for the exceptions of text and adblock sources, which carve the domain out of the list
+	exception bool
+}
+
+// domainsFromSource streams the domains read from the given source.
+// The returned error channel yields at most one error once the domain channel has been closed.
+// If validators is not nil, the cache validators of the source are recorded in it. If malformed is not nil, the
+// number of lines skipped because they couldn't be parsed is added to it, by the time the error channel is closed.
+func domainsFromSource(source DomainSource, options PluginOptions, validators sourceValidators, malformed *int) (chan listEntry, chan error) {
+
+	c := make(chan listEntry)
+	errs := make(chan error, 1)
 
 	go func() {
+		defer close(errs)
 		defer close(c)
 
-		var sourceData io.Reader
-		{
-			if sourceType == DomainSourceTypeFile {
-				log.Infof("Loading from file: %s", source)
-				file, err := os.Open(source)
-				if err != nil {
-					log.Error(err)
-				}
-				defer file.Close()
-				sourceData = file
-			} else if sourceType == DomainSourceTypeURL {
-				// TODO
-				log.Infof("Loading from URL: %s", source)
-				// Load the domain list from the URL
-				resp, err := http.Get(source) // nolint: gosec
-				if err != nil {
-					log.Error(err)
-				}
-				defer resp.Body.Close()
-				sourceData = resp.Body
+		sourceData, err := openSource(source, options, validators)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer sourceData.Close()
+
+		var data io.Reader = sourceData
+		if source.Format == DomainFileFormatAuto {
+			reader := bufio.NewReaderSize(sourceData, detectSize)
+			format, err := detectFormat(reader, redactURL(source.Path))
+			if err != nil {
+				errs <- err
+				return
+			}
+			source.Format = format
+			data = reader
+		}
+
+		skipped := 0
+		defer func() {
+			if malformed != nil {
+				*malformed += skipped
 			}
+		}()
+		skip := func() {
+			malformedEntries.WithLabelValues(source.Format).Inc()
+			skipped++
 		}
 
-		scanner := bufio.NewScanner(sourceData)
+		add := func(domain string, qtypes []uint16, exception bool) {
+			// Store the canonical form, so it matches queries in any case or form. All domains are assumed to be
+			// relative to the root, so they get a trailing dot (e.g. example.com.)
+			domain = canonicalDomain(domain)
+			if !isValidEntry(domain) {
+				// Usually a stray line, like an HTML error page served instead of the list
+				log.Debugf("skipping invalid domain %q in %s", domain, redactURL(source.Path))
+				skip()
+				return
+			}
+
+			c <- listEntry{domain: domain, qtypes: qtypes, exception: exception}
+		}
+
+		parse := newLineParser(source.Format, options, skip)
+		scanner := bufio.NewScanner(data)
+		// Start with the default buffer, which only grows for long lines, like stray minified HTML
+		scanner.Buffer(nil, maxLineSize)
+		first := true
 		for scanner.Scan() {
-			domain := strings.TrimSpace(scanner.Text())
-			if strings.HasPrefix(domain, "#") {
+			// The scanner already drops the \r of CRLF line endings
+			line := scanner.Text()
+			if first {
+				// Lists written on Windows often start with a byte order mark
+				line = strings.TrimPrefix(line, utf8BOM)
+				first = false
+			}
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "#") {
 				// Skip comment lines
 				continue
 			}
 
-			if domain == "" {
+			if trimmed == "" {
 				// Skip empty lines
 				continue
 			}
 
-			if sourceFormat == DomainFileFormatHostfile {
-				domain = strings.Fields(domain)[1] // Assumes hostfile format:   127.0.0.1  some.host
+			if source.Format == DomainFileFormatIPList {
+				// A single address range can cover several reverse zones, which are already fully qualified
+				names, ok := parseIPListLine(line)
+				if !ok {
+					skip()
+				}
+				for _, name := range names {
+					c <- listEntry{domain: name}
+				}
+				continue
 			}
 
-			// Assume all domains are global origin, with trailing dot (e.g. example.com.)
-			if !strings.HasSuffix(domain, ".") {
-				domain += "."
+			if source.Format == DomainFileFormatRegex {
+				// Patterns are matched against names as they are, so they aren't normalized
+				re, err := regexp.Compile(trimmed)
+				if err != nil {
+					// A single broken pattern shouldn't fail the whole feed
+					log.Errorf("skipping invalid pattern %q in %s: %v", trimmed, redactURL(source.Path), err)
+					skip()
+					continue
+				}
+				c <- listEntry{domain: trimmed, pattern: re}
+				continue
+			}
+
+			if source.Format == DomainFileFormatHostfile {
+				// A hostfile line can map several hostnames to the same address
+				domains, ok := parseHostfileLine(line)
+				if !ok {
+					skip()
+				}
+				for _, domain := range domains {
+					if isReservedHost(domain, options.ReservedHosts) {
+						// Baseline entries of the hosts file itself, like localhost, aren't warnlisted
+						continue
+					}
+					add(domain, nil, false)
+				}
+				continue
 			}
 
-			c <- domain
+			line, exception := parseException(line, source.Format)
+			domain, ok := parse(line)
+			if !ok {
+				continue
+			}
+			var qtypes []uint16
+			if source.Format == DomainFileFormatTextList {
+				// A text line may limit its domain to some query types, e.g. "bad.example TXT"
+				domain, qtypes, ok = parseQualifiedDomain(domain)
+				if !ok {
+					skip()
+					continue
+				}
+			}
+			if exception {
+				// Exceptions carve the domain out of every query type
+				qtypes = nil
+			}
+			add(domain, qtypes, exception)
 		}
 		if err := scanner.Err(); err != nil {
-			log.Error(err)
+			errs <- fmt.Errorf("unable to read domains from %s: %w", redactURL(source.Path), err)
 		}
 	}()
 
-	return c
+	return c, errs
+
+}
+
+// lineParser extracts a domain from a single line of a source, returning false if the line holds none.
+type lineParser func(line string) (string, bool)
+
+// newLineParser returns the parser for the given file format. The parser calls malformed for every line it skips
+// because it couldn't be parsed.
+func newLineParser(format string, options PluginOptions, malformed func()) lineParser {
+	switch format {
+	case DomainFileFormatRPZ:
+		return newRPZParser()
+	case DomainFileFormatAdblock:
+		return parseAdblockLine
+	case DomainFileFormatCSV:
+		column := options.CSVColumn
+		if column == 0 {
+			column = DefaultCSVColumn
+		}
+		return newCSVParser(column, options.CSVHeader, malformed)
+	case DomainFileFormatJSONL:
+		field := options.JSONField
+		if field == "" {
+			field = DefaultJSONField
+		}
+		return newJSONLParser(field, malformed)
+	case DomainFileFormatURLList:
+		return newURLListParser(malformed)
+	case DomainFileFormatUmbrella:
+		return newUmbrellaParser(malformed)
+	case DomainFileFormatScored:
+		return newScoredParser(options.MinScore, options.DefaultScore, malformed)
+	default:
+		return parseTextLine
+	}
+}
+
+func parseTextLine(line string) (string, bool) {
+	return strings.TrimSpace(line), true
+}
+
+// parseQualifiedDomain splits the query types a text line limits its domain to off the domain, e.g.
+// "bad.example TXT NULL", returning false if any of them isn't a known type.
+func parseQualifiedDomain(line string) (string, []uint16, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return line, nil, true
+	}
+
+	qtypes := make([]uint16, 0, len(fields)-1)
+	for _, field := range fields[1:] {
+		qtype, ok := dns.StringToType[strings.ToUpper(field)]
+		if !ok {
+			return "", nil, false
+		}
+		qtypes = append(qtypes, qtype)
+	}
+	return fields[0], qtypes, true
+}
+
+// parseHostfileLine returns every hostname mapped to an address on a hostfile line, e.g.
+// "0.0.0.0 some.host other.host # comment", returning false if the line has no hostname.
+func parseHostfileLine(line string) ([]string, bool) {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, false
+	}
+	// The address itself isn't needed, so any address is accepted
+	return fields[1:], true
+}
+
+// DefaultReservedHosts are the hostnames of the baseline entries of hosts files, which are skipped when loading
+// hostfile sources. A trailing * matches any hostname starting with the rest of the pattern.
+var DefaultReservedHosts = []string{
+	"localhost",
+	"localhost.localdomain",
+	"local",
+	"broadcasthost",
+	"ip6-*",
+	"0.0.0.0",
+}
+
+// isReservedHost returns true if the hostname of a hostfile line matches any of the reserved patterns.
+func isReservedHost(hostname string, reserved []string) bool {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	for _, pattern := range reserved {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(hostname, prefix) {
+				return true
+			}
+		} else if hostname == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidEntry returns true if the normalized domain could be a list entry: a name of at most 255 characters, made
+// of letters, digits, hyphens, underscores, and wildcards. Bytes outside ASCII are allowed for names which aren't
+// valid IDNs, since queries for them are normalized the same way.
+func isValidEntry(domain string) bool {
+	if len(domain) > 255 {
+		return false
+	}
+	for i := 0; i < len(domain); i++ {
+		b := domain[i]
+		switch {
+		case b >= 'a' && b <= 'z', b >= '0' && b <= '9', b >= 0x80:
+		case b == '-', b == '_', b == '.', b == '*':
+		default:
+			return false
+		}
+	}
+	return domain != "."
+}
+
+// openSource opens the given source for reading, transparently decompressing gzipped content.
+func openSource(source DomainSource, options PluginOptions, validators sourceValidators) (io.ReadCloser, error) {
+	var sourceData io.ReadCloser
+	compressed := false
+	{
+		if source.Type == DomainSourceTypeFile {
+			log.Infof("Loading from file: %s", source.Path)
+			file, err := os.Open(source.Path)
+			if err != nil {
+				return nil, err
+			}
+			if validators != nil {
+				if info, err := file.Stat(); err == nil {
+					validators[source.Path] = fileValidator(info)
+				}
+			}
+			sourceData = file
+			compressed = strings.HasSuffix(source.Path, ".gz")
+		} else if source.Type == DomainSourceTypeURL {
+			log.Infof("Loading from URL: %s", redactURL(source.Path))
+			// Load the domain list from the URL
+			resp, ok := options.prefetched.takeURL(source.Path)
+			if !ok {
+				var err error
+				if resp, err = fetchURL(source.Path, options, httpValidator{}); err != nil {
+					return nil, err
+				}
+			}
+			if options.StrictContentType {
+				if err := checkContentType(source.Format, resp.Header.Get("Content-Type")); err != nil {
+					resp.Body.Close()
+					return nil, fmt.Errorf("refusing to load %s: %w", redactURL(source.Path), err)
+				}
+			}
+			if validators != nil {
+				validators[source.Path] = responseValidator(resp)
+			}
+			sourceData = resp.Body
+			// The transport only strips this header when it decompressed the body itself.
+			compressed = resp.Header.Get("Content-Encoding") == "gzip" || strings.HasSuffix(resp.Request.URL.Path, ".gz")
+		} else if source.Type == DomainSourceTypeS3 {
+			log.Infof("Loading from S3: %s", source.Path)
+			out, ok := options.prefetched.takeObject(source.Path)
+			if !ok {
+				var err error
+				if out, err = fetchS3(source.Path, httpValidator{}); err != nil {
+					return nil, err
+				}
+			}
+			if validators != nil {
+				validators[source.Path] = objectValidator(out)
+			}
+			sourceData = out.Body
+			compressed = aws.StringValue(out.ContentEncoding) == "gzip" || strings.HasSuffix(source.Path, ".gz")
+		} else if source.Type == DomainSourceTypeSFTP {
+			log.Infof("Loading from SFTP: %s", source.Path)
+			file, err := openSFTP(source.Path, options)
+			if err != nil {
+				return nil, err
+			}
+			if validators != nil {
+				if info, err := file.Stat(); err == nil {
+					validators[source.Path] = fileValidator(info)
+				}
+			}
+			sourceData = file
+			compressed = strings.HasSuffix(source.Path, ".gz")
+		} else if source.Type == DomainSourceTypeSocket {
+			log.Infof("Loading from socket: %s", source.Path)
+			conn, err := dialSocket(source.Path, options)
+			if err != nil {
+				return nil, err
+			}
+			// Streamed lists have no validators, so they are always reloaded
+			sourceData = conn
+		} else if source.Type == DomainSourceTypeRedis {
+			log.Infof("Loading from redis: %s", source.Path)
+			set, err := openRedis(source.Path, options)
+			if err != nil {
+				return nil, err
+			}
+			// Sets have no validators either, so pipeline updates are picked up by every reload
+			sourceData = set
+		} else if source.Type == DomainSourceTypeTAXII {
+			log.Infof("Loading from TAXII: %s", source.Path)
+			objects, err := openTAXII(source.Path, options)
+			if err != nil {
+				return nil, err
+			}
+			// Collections have no validators either, so every reload fetches them in full
+			sourceData = objects
+		} else {
+			return nil, fmt.Errorf("unknown domain source type: %s", source.Type)
+		}
+	}
+
+	return decompressSource(sourceData, compressed, redactURL(source.Path))
+}
+
+// decompressSource returns a reader of the decompressed content of a source at the given path if it is compressed, or
+// starts with the gzip magic bytes. The source is closed if it can't be decompressed.
+func decompressSource(sourceData io.ReadCloser, compressed bool, path string) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(sourceData)
+	if magic, err := buffered.Peek(len(gzipMagic)); err == nil && string(magic) == string(gzipMagic) {
+		compressed = true
+	}
+
+	if !compressed {
+		return readCloser{Reader: buffered, Closer: sourceData}, nil
+	}
+
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		sourceData.Close()
+		return nil, fmt.Errorf("unable to decompress %s: %w", path, err)
+	}
+	return readCloser{Reader: gz, Closer: sourceData}, nil
+}
 
+// readCloser combines a wrapping reader with the Closer of the underlying source.
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
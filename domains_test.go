@@ -0,0 +1,554 @@
+package warnlist
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+)
+
+const testHostfile = `# Some hostfile header
+127.0.0.1	example.org
+127.0.0.1	something.evil
+`
+
+const testTextList = `# Some text list header
+example.org
+something.evil
+`
+
+// gzipped returns the gzip-compressed representation of the input.
+func gzipped(t *testing.T, data string) []byte {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func Test_buildCacheFromGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(gzipped(t, testTextList))
+	}))
+	defer server.Close()
+
+	var testCases = []struct {
+		name       string
+		filename   string
+		content    []byte
+		format     string
+		sourceType string
+		expectErr  bool
+	}{
+		{
+			name:       "case 0: a gzipped hostfile is loaded",
+			filename:   "hosts.gz",
+			content:    gzipped(t, testHostfile),
+			format:     DomainFileFormatHostfile,
+			sourceType: DomainSourceTypeFile,
+		},
+		{
+			name:       "case 1: a gzipped text list is loaded",
+			filename:   "domains.txt.gz",
+			content:    gzipped(t, testTextList),
+			format:     DomainFileFormatTextList,
+			sourceType: DomainSourceTypeFile,
+		},
+		{
+			name:       "case 2: gzipped content without a .gz suffix is detected",
+			filename:   "domains.txt",
+			content:    gzipped(t, testTextList),
+			format:     DomainFileFormatTextList,
+			sourceType: DomainSourceTypeFile,
+		},
+		{
+			name:       "case 3: a gzipped url response is loaded",
+			format:     DomainFileFormatTextList,
+			sourceType: DomainSourceTypeURL,
+		},
+		{
+			name:       "case 4: a corrupt gzip file returns an error",
+			filename:   "corrupt.gz",
+			content:    []byte("this is not gzip"),
+			format:     DomainFileFormatTextList,
+			sourceType: DomainSourceTypeFile,
+			expectErr:  true,
+		},
+		{
+			name:       "case 5: a truncated gzip file returns an error",
+			filename:   "truncated.gz",
+			content:    gzipped(t, testTextList)[:20],
+			format:     DomainFileFormatTextList,
+			sourceType: DomainSourceTypeFile,
+			expectErr:  true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			source := server.URL
+			if tc.sourceType == DomainSourceTypeFile {
+				source = filepath.Join(dir, tc.filename)
+				if err := ioutil.WriteFile(source, tc.content, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: source, Type: tc.sourceType, Format: tc.format}},
+				MatchSubdomains: true,
+			}
+			list, err := buildCacheFromFile(options, nil)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, domain := range []string{"example.org.", "something.evil."} {
+				if !cmp.Equal(true, list.Contains(domain)) {
+					t.Fatalf("expected %s to be loaded", domain)
+				}
+			}
+			if !cmp.Equal(2, list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(2, list.Len()))
+			}
+		})
+	}
+}
+
+// splitLines splits test input into lines the way the source scanner does, skipping blank and comment lines.
+func splitLines(data string) []string {
+	var lines []string
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func Test_buildCacheCountsMalformedLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var testCases = []struct {
+		name      string
+		content   string
+		format    string
+		len       int
+		malformed int
+	}{
+		{
+			name:    "case 0: a well formed list has no malformed lines",
+			content: testTextList,
+			format:  DomainFileFormatTextList,
+			len:     2,
+		},
+		{
+			name:      "case 1: stray lines in a text list are skipped",
+			content:   "example.org\n<html>\nsome error page\n*.something.evil\n",
+			format:    DomainFileFormatTextList,
+			len:       2,
+			malformed: 2,
+		},
+		{
+			name:      "case 2: hostfile lines without a domain are skipped",
+			content:   "127.0.0.1 example.org\n127.0.0.1\n",
+			format:    DomainFileFormatHostfile,
+			len:       1,
+			malformed: 1,
+		},
+		{
+			name:      "case 3: invalid addresses in an iplist are skipped",
+			content:   "192.0.2.1\nnot.an.ip\n",
+			format:    DomainFileFormatIPList,
+			len:       1,
+			malformed: 1,
+		},
+		{
+			name:      "case 4: every hostname on a hostfile line is loaded, and lines with only a comment are skipped",
+			content:   "127.0.0.1 bad.example other.example # blocked by team\n0.0.0.0 # nothing\n",
+			format:    DomainFileFormatHostfile,
+			len:       2,
+			malformed: 1,
+		},
+		{
+			name:      "case 5: a line longer than the default scanner buffer is skipped",
+			content:   "example.org\n" + strings.Repeat("x", 100*1024) + "\nsomething.evil\n",
+			format:    DomainFileFormatTextList,
+			len:       2,
+			malformed: 1,
+		},
+		{
+			name:      "case 6: the hosts of a url list are loaded once, and lines which aren't urls are skipped",
+			content:   "http://bad.example/a\nhttps://bad.example:8443/b\nevil.example:8080\nhttp://[2001:db8::1]/\n<html>\n",
+			format:    DomainFileFormatURLList,
+			len:       2,
+			malformed: 2,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			path := filepath.Join(dir, strconv.Itoa(i)+".txt")
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: tc.format}},
+				MatchSubdomains: true,
+				counts:          newListCounts(),
+			}
+
+			list, err := buildCacheFromFile(options, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(tc.len, list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.len, list.Len()))
+			}
+			// The skipped lines of the build are counted for the gauge
+			malformed := options.counts.malformed["warnlist"]
+			if !cmp.Equal(tc.malformed, malformed) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.malformed, malformed))
+			}
+		})
+	}
+}
+
+func Test_parseHostfileLine(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		line    string
+		domains []string
+		ok      bool
+	}{
+		{
+			name:    "case 0: a hostname after the address is returned",
+			line:    "127.0.0.1\tbad.example",
+			domains: []string{"bad.example"},
+			ok:      true,
+		},
+		{
+			name:    "case 1: an inline comment is stripped",
+			line:    "127.0.0.1 bad.example # blocked by team",
+			domains: []string{"bad.example"},
+			ok:      true,
+		},
+		{
+			name:    "case 2: every hostname on the line is returned",
+			line:    "0.0.0.0 bad.example www.bad.example\tother.example",
+			domains: []string{"bad.example", "www.bad.example", "other.example"},
+			ok:      true,
+		},
+		{
+			name:    "case 3: any address is accepted",
+			line:    "::1 bad.example#comment",
+			domains: []string{"bad.example"},
+			ok:      true,
+		},
+		{
+			name: "case 4: an address without a hostname is skipped",
+			line: "10.0.0.1 # nothing to see",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			domains, ok := parseHostfileLine(tc.line)
+			if !cmp.Equal(tc.ok, ok) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.ok, ok))
+			}
+			if !cmp.Equal(tc.domains, domains) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.domains, domains))
+			}
+		})
+	}
+}
+
+// testStevenBlackHosts is the header of a widely used hosts blocklist, followed by a single blocked host.
+const testStevenBlackHosts = `# Title: StevenBlack/hosts
+#
+# This hosts file is a merged collection of hosts from reputable sources,
+# with a dash of crowd sourcing via GitHub
+#
+# ===============================================================
+
+127.0.0.1 localhost
+127.0.0.1 localhost.localdomain
+127.0.0.1 local
+255.255.255.255 broadcasthost
+::1 localhost
+::1 ip6-localhost ip6-loopback
+fe80::1%lo0 localhost
+ff00::0 ip6-localnet
+ff00::0 ip6-mcastprefix
+ff02::1 ip6-allnodes
+ff02::2 ip6-allrouters
+ff02::3 ip6-allhosts
+0.0.0.0 0.0.0.0
+
+# Custom host records are listed here.
+
+# End of custom host records.
+# Start StevenBlack
+
+0.0.0.0 bad.example
+0.0.0.0 Localhost.bad.example
+`
+
+func Test_buildCacheSkipsReservedHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(path, []byte(testStevenBlackHosts), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name     string
+		reserved []string
+		listed   []string
+		skipped  []string
+	}{
+		{
+			name:     "case 0: the baseline entries of the header are skipped by default",
+			reserved: DefaultReservedHosts,
+			listed:   []string{"bad.example.", "localhost.bad.example."},
+			skipped:  []string{"localhost.", "localhost.localdomain.", "local.", "broadcasthost.", "ip6-allnodes.", "0.0.0.0."},
+		},
+		{
+			name:     "case 1: only the configured hostnames are skipped",
+			reserved: []string{"localhost", "ip6-all*"},
+			listed:   []string{"bad.example.", "broadcasthost.", "ip6-localnet.", "0.0.0.0."},
+			skipped:  []string{"localhost.", "ip6-allnodes.", "ip6-allrouters."},
+		},
+		{
+			name:   "case 2: without reserved hostnames every hostname is loaded",
+			listed: []string{"bad.example.", "localhost.", "broadcasthost.", "ip6-loopback."},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatHostfile}},
+				MatchSubdomains: false,
+				ReservedHosts:   tc.reserved,
+				counts:          newListCounts(),
+			}
+			list, err := buildCacheFromFile(options, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, domain := range tc.listed {
+				if !list.Contains(domain) {
+					t.Fatalf("expected %s to be loaded", domain)
+				}
+			}
+			for _, domain := range tc.skipped {
+				if list.Contains(domain) {
+					t.Fatalf("expected %s to be skipped", domain)
+				}
+			}
+			// Reserved hostnames aren't malformed
+			malformed := options.counts.malformed["warnlist"]
+			if !cmp.Equal(0, malformed) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(0, malformed))
+			}
+		})
+	}
+}
+
+func Test_parseQualifiedDomain(t *testing.T) {
+	var testCases = []struct {
+		name   string
+		line   string
+		domain string
+		qtypes []uint16
+		ok     bool
+	}{
+		{
+			name:   "case 0: a domain without a qualifier matches all types",
+			line:   "bad.example",
+			domain: "bad.example",
+			ok:     true,
+		},
+		{
+			name:   "case 1: a qualified domain is limited to its type",
+			line:   "bad.example TXT",
+			domain: "bad.example",
+			qtypes: []uint16{dns.TypeTXT},
+			ok:     true,
+		},
+		{
+			name:   "case 2: several types may be given, in any case",
+			line:   "bad.example\tmx aaaa",
+			domain: "bad.example",
+			qtypes: []uint16{dns.TypeMX, dns.TypeAAAA},
+			ok:     true,
+		},
+		{
+			name: "case 3: an unknown type is rejected",
+			line: "bad.example BOGUS",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			domain, qtypes, ok := parseQualifiedDomain(tc.line)
+			if !cmp.Equal(tc.ok, ok) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.ok, ok))
+			}
+			if !cmp.Equal(tc.domain, domain) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.domain, domain))
+			}
+			if !cmp.Equal(tc.qtypes, qtypes) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.qtypes, qtypes))
+			}
+		})
+	}
+}
+
+// BenchmarkBuildCacheLargeList loads a large synthetic list, and reports the allocations of each load next to the
+// size of the source. Sources are streamed a line at a time, so a load doesn't allocate a copy of the source.
+func BenchmarkBuildCacheLargeList(b *testing.B) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var content strings.Builder
+	for i := 0; i < 500000; i++ {
+		content.WriteString("0.0.0.0 listed-" + strconv.Itoa(i) + ".some-long-malicious-domain.example # feed comment\n")
+	}
+	path := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(path, []byte(content.String()), 0600); err != nil {
+		b.Fatal(err)
+	}
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatHostfile}},
+		MatchSubdomains: true,
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := buildCacheFromFile(options, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(content.Len()), "source-B")
+}
+
+func Test_buildCacheStripsBOMAndCRLF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var testCases = []struct {
+		name    string
+		content string
+		format  string
+		domains []string
+	}{
+		{
+			name:    "case 0: a text list with a byte order mark and CRLF line endings is loaded",
+			content: "\ufeffexample.org\r\nsomething.evil\r\n",
+			format:  DomainFileFormatTextList,
+			domains: []string{"example.org.", "something.evil."},
+		},
+		{
+			name:    "case 1: a hostfile with a byte order mark and CRLF line endings is loaded",
+			content: "\ufeff127.0.0.1 example.org\r\n127.0.0.1 something.evil # comment\r\n",
+			format:  DomainFileFormatHostfile,
+			domains: []string{"example.org.", "something.evil."},
+		},
+		{
+			name:    "case 2: a jsonl list with a byte order mark and CRLF line endings is loaded",
+			content: "\ufeff{\"value\": \"example.org\"}\r\n{\"value\": \"something.evil\"}\r\n",
+			format:  DomainFileFormatJSONL,
+			domains: []string{"example.org.", "something.evil."},
+		},
+		{
+			name:    "case 3: an iplist with a byte order mark and CRLF line endings is loaded",
+			content: "\ufeff192.0.2.1\r\n192.0.2.2\r\n",
+			format:  DomainFileFormatIPList,
+			domains: []string{"1.2.0.192.in-addr.arpa.", "2.2.0.192.in-addr.arpa."},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			path := filepath.Join(dir, strconv.Itoa(i)+".txt")
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			options := PluginOptions{
+				Sources: []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: tc.format}},
+			}
+
+			list, err := buildCacheFromFile(options, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, domain := range tc.domains {
+				if !list.Contains(domain) {
+					t.Fatalf("expected %s to be loaded", domain)
+				}
+			}
+			if !cmp.Equal(len(tc.domains), list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(len(tc.domains), list.Len()))
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package warnlist
+
+import (
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// clientIP returns the address of the client which made the request. With use_ecs, it is the address of the EDNS0
+// Client Subnet option if the request has one, since the remote address is usually a resolver forwarding the query.
+func (wp *WarnlistPlugin) clientIP(req request.Request) string {
+	if wp.Options.UseECS {
+		if subnet := clientSubnet(req.Req); subnet != nil && subnet.Address != nil {
+			return subnet.Address.String()
+		}
+	}
+	return req.IP()
+}
+
+// clientSubnet returns the EDNS0 Client Subnet option of the message, or nil if it has none.
+func clientSubnet(m *dns.Msg) *dns.EDNS0_SUBNET {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, o := range opt.Option {
+		if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return subnet
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package warnlist
+
+import (
+	"strings"
+)
+
+// exceptionPrefixes are the prefixes marking a line of a source as an exception to the list, by the file format.
+// AdBlock lists mark their exceptions with @@, and use ! for comments.
+var exceptionPrefixes = map[string][]string{
+	DomainFileFormatTextList: {"@@", "!"},
+	DomainFileFormatAdblock:  {"@@"},
+}
+
+// parseException strips the exception prefix off a line of a source of the given format, returning true if the line
+// is an exception, e.g. !safe.example or @@||safe.example^. Other lines are returned as they are.
+func parseException(line string, format string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range exceptionPrefixes[format] {
+		if strings.HasPrefix(trimmed, prefix) {
+			return strings.TrimPrefix(trimmed, prefix), true
+		}
+	}
+	return line, false
+}
+
+// ExceptionWarnlist carves the exceptions listed by the sources of a Warnlist out of its matches, so a list can
+// unblock a name under one of its own entries, like safe.example. under *.example. Exceptions match their subdomains
+// too, like excludes, and take precedence over every entry of the list, whatever its mechanism.
+type ExceptionWarnlist struct {
+	Warnlist
+	exceptions Warnlist
+}
+
+func NewExceptionWarnlist(w Warnlist, exceptions Warnlist) *ExceptionWarnlist {
+	return &ExceptionWarnlist{Warnlist: w, exceptions: exceptions}
+}
+
+func (e *ExceptionWarnlist) Contains(key string) bool {
+	return !e.exceptions.Contains(key) && e.Warnlist.Contains(key)
+}
+
+func (e *ExceptionWarnlist) Match(key string) (string, bool) {
+	if e.exceptions.Contains(key) {
+		return "", false
+	}
+	return e.Warnlist.Match(key)
+}
+
+func (e *ExceptionWarnlist) MatchType(key string, qtype uint16) (string, bool) {
+	if e.exceptions.Contains(key) {
+		return "", false
+	}
+	return matchType(e.Warnlist, key, qtype)
+}
+
+func (e *ExceptionWarnlist) MatchAll(key string) []string {
+	if e.exceptions.Contains(key) {
+		return nil
+	}
+	return e.Warnlist.MatchAll(key)
+}
+
+// Lookup returns the entry matching a query for the key and type, and the mechanism which matched it, unless the key
+// is an exception.
+func (e *ExceptionWarnlist) Lookup(key string, qtype uint16) (string, string, bool) {
+	if e.exceptions.Contains(key) {
+		return "", "", false
+	}
+	return lookup(e.Warnlist, key, qtype)
+}
+
+func (e *ExceptionWarnlist) Source(entry string) string {
+	return sourceOf(e.Warnlist, entry)
+}
@@ -0,0 +1,129 @@
+package warnlist
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+)
+
+func TestExceptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+
+	var testCases = []struct {
+		name            string
+		format          string
+		matchSubdomains bool
+		contents        string
+		domain          string
+		rcode           int
+	}{
+		{
+			name:     "case 0: an exception carves a name out of a wildcard entry",
+			format:   DomainFileFormatTextList,
+			contents: "*.bad.example\n!safe.bad.example\n",
+			domain:   "safe.bad.example.",
+			rcode:    dns.RcodeServerFailure,
+		},
+		{
+			name:     "case 1: other names under the wildcard entry are still blocked",
+			format:   DomainFileFormatTextList,
+			contents: "*.bad.example\n!safe.bad.example\n",
+			domain:   "login.bad.example.",
+			rcode:    dns.RcodeNameError,
+		},
+		{
+			name:            "case 2: an exception carves its whole subtree out of a listed parent",
+			format:          DomainFileFormatTextList,
+			matchSubdomains: true,
+			contents:        "bad.example\n@@safe.bad.example\n",
+			domain:          "www.safe.bad.example.",
+			rcode:           dns.RcodeServerFailure,
+		},
+		{
+			name:            "case 3: the listed parent is still blocked",
+			format:          DomainFileFormatTextList,
+			matchSubdomains: true,
+			contents:        "bad.example\n@@safe.bad.example\n",
+			domain:          "bad.example.",
+			rcode:           dns.RcodeNameError,
+		},
+		{
+			name:     "case 4: an exception listed before the entry it overrides still applies",
+			format:   DomainFileFormatTextList,
+			contents: "!bad.example\nbad.example\n",
+			domain:   "bad.example.",
+			rcode:    dns.RcodeServerFailure,
+		},
+		{
+			name:            "case 5: an adblock exception rule carves a name out of a domain anchor",
+			format:          DomainFileFormatAdblock,
+			matchSubdomains: true,
+			contents:        "[Adblock Plus 2.0]\n||bad.example^\n@@||safe.bad.example^\n",
+			domain:          "safe.bad.example.",
+			rcode:           dns.RcodeServerFailure,
+		},
+		{
+			name:            "case 6: an adblock comment isn't an exception",
+			format:          DomainFileFormatAdblock,
+			matchSubdomains: true,
+			contents:        "||bad.example^\n! safe.bad.example\n",
+			domain:          "safe.bad.example.",
+			rcode:           dns.RcodeNameError,
+		},
+		{
+			name:     "case 7: an exception overrides an entry limited to the query type",
+			format:   DomainFileFormatTextList,
+			contents: "exfil.example TXT\n!exfil.example\n",
+			domain:   "exfil.example.",
+			rcode:    dns.RcodeServerFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			if err := ioutil.WriteFile(path, []byte(tc.contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: tc.format}},
+				Response:        ResponseNXDomain,
+				MatchSubdomains: tc.matchSubdomains,
+			}
+			wl, err := buildCacheFromFile(options, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			m := newWarnlistPlugin(options, startupCaches{warnlist: wl, loaded: true}, time.Now())
+			m.Next = test.ErrorHandler()
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeTXT)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package warnlist
+
+// newExcludeList returns a list matching the excluded domains and their subdomains, or nil if there are none.
+// Excludes are configured in the Corefile, so the list is built once and never reloaded.
+func newExcludeList(domains []string) Warnlist {
+	if len(domains) == 0 {
+		return nil
+	}
+	list := NewTrieWarnlist()
+	for _, domain := range domains {
+		list.Add(domain)
+	}
+	list.Close()
+	return list
+}
+
+// allowed returns true if the name is carved out of matching, either by the allowlist or by an exclude.
+func (wp *WarnlistPlugin) allowed(allowlist Warnlist, name string) bool {
+	if wp.excludes != nil && wp.excludes.Contains(name) {
+		return true
+	}
+	return allowlist != nil && allowlist.Contains(name)
+}
+
+// allowedFirst returns true if the name is carved out of matching before the warnlist is consulted. Excluded names
+// always are, allowlisted ones unless the warnlist takes precedence.
+func (wp *WarnlistPlugin) allowedFirst(allowlist Warnlist, name string) bool {
+	if wp.Options.Precedence == PrecedenceBlock {
+		return wp.excludes != nil && wp.excludes.Contains(name)
+	}
+	return wp.allowed(allowlist, name)
+}
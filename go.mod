@@ -5,12 +5,19 @@ go 1.14
 require (
 	github.com/alecthomas/mph v0.0.0-20190930022807-712982e3d8a2
 	github.com/alecthomas/unsafeslice v0.0.0-20190825002529-d95de1041e15 // indirect
+	github.com/aws/aws-sdk-go v1.37.10
 	github.com/coredns/caddy v1.1.1
 	github.com/coredns/coredns v1.8.3
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/google/go-cmp v0.5.6
 	github.com/hashicorp/go-immutable-radix v1.3.1
 	github.com/miekg/dns v1.1.43
+	github.com/pkg/sftp v1.13.0
 	github.com/prometheus/client_golang v1.11.0
+	github.com/prometheus/client_model v0.2.0
+	go.uber.org/goleak v1.1.10
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
 )
 
 replace github.com/gorilla/websocket v1.4.0 => github.com/gorilla/websocket v1.4.2
@@ -0,0 +1,96 @@
+package warnlist
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+// healthShutdownTimeout is the time allowed for in-flight health requests when the server shuts down.
+const healthShutdownTimeout = 5 * time.Second
+
+// HealthStatus is the freshness of the loaded warnlist, as answered by the health endpoint.
+type HealthStatus struct {
+	Healthy        bool      `json:"healthy"`
+	LastReloadTime time.Time `json:"lastReloadTime"`
+	Entries        int       `json:"entries"`
+	LastError      string    `json:"lastError,omitempty"`
+}
+
+// healthServer serves the health endpoint of the plugin on a separate address. Unlike the health plugin of CoreDNS,
+// it reports whether the warnlist is kept up to date with its feeds, rather than whether the server is running.
+type healthServer struct {
+	addr string
+	wp   *WarnlistPlugin
+
+	ln     net.Listener
+	server *http.Server
+}
+
+// OnStartup starts listening, following the debug endpoint.
+func (h *healthServer) OnStartup() error {
+	ln, err := net.Listen("tcp", h.addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", h.wp.serveHealth)
+	h.ln = ln
+	h.server = &http.Server{Handler: mux}
+	go func() { _ = h.server.Serve(ln) }()
+
+	log.Infof("Serving health endpoint on %s", ln.Addr())
+	return nil
+}
+
+// OnFinalShutdown stops the server, waiting for in-flight requests.
+func (h *healthServer) OnFinalShutdown() error {
+	if h.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+	defer cancel()
+	err := h.server.Shutdown(ctx)
+	h.server = nil
+	return err
+}
+
+// serveHealth answers GET /health with the health of the warnlist, with a 200 status if it is healthy, and a 503
+// status otherwise.
+func (wp *WarnlistPlugin) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := wp.Health()
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// Health returns the freshness of the loaded warnlist. It is healthy once a warnlist has been loaded, as long as the
+// last successful reload is at most twice the reload period ago, so a single failed reload doesn't make it unhealthy.
+// Without a reload period, the warnlist is never stale.
+func (wp *WarnlistPlugin) Health() HealthStatus {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	status := HealthStatus{LastReloadTime: wp.lastReloadTime.UTC(), Healthy: wp.loaded}
+	if wp.warnlist != nil {
+		status.Entries = wp.warnlist.Len()
+	}
+	if wp.lastReloadErr != nil {
+		status.LastError = wp.lastReloadErr.Error()
+	}
+	if period := wp.Options.ReloadPeriod; period > 0 && time.Since(wp.lastReloadTime) > 2*period {
+		status.Healthy = false
+	}
+	return status
+}
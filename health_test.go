@@ -0,0 +1,141 @@
+package warnlist
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_serveHealth(t *testing.T) {
+	warnlist := NewWarnlist()
+	warnlist.Add("example.org.")
+	warnlist.Add("something.evil.")
+	_ = warnlist.Close()
+
+	var testCases = []struct {
+		name     string
+		wp       *WarnlistPlugin
+		method   string
+		status   int
+		expected HealthStatus
+	}{
+		{
+			name:     "case 0: a recently reloaded warnlist is healthy",
+			wp:       &WarnlistPlugin{warnlist: warnlist, loaded: true, lastReloadTime: time.Now().Add(-time.Minute), Options: PluginOptions{ReloadPeriod: time.Hour}},
+			status:   http.StatusOK,
+			expected: HealthStatus{Healthy: true, Entries: 2},
+		},
+		{
+			name:     "case 1: a single failed reload is still healthy, and reports its error",
+			wp:       &WarnlistPlugin{warnlist: warnlist, loaded: true, lastReloadTime: time.Now().Add(-90 * time.Minute), lastReloadErr: errors.New("unexpected status: 502 Bad Gateway"), Options: PluginOptions{ReloadPeriod: time.Hour}},
+			status:   http.StatusOK,
+			expected: HealthStatus{Healthy: true, Entries: 2, LastError: "unexpected status: 502 Bad Gateway"},
+		},
+		{
+			name:     "case 2: a warnlist not reloaded for twice the reload period is unhealthy",
+			wp:       &WarnlistPlugin{warnlist: warnlist, loaded: true, lastReloadTime: time.Now().Add(-3 * time.Hour), lastReloadErr: errors.New("timeout"), Options: PluginOptions{ReloadPeriod: time.Hour}},
+			status:   http.StatusServiceUnavailable,
+			expected: HealthStatus{Entries: 2, LastError: "timeout"},
+		},
+		{
+			name:     "case 3: an empty startup is unhealthy until a warnlist is loaded",
+			wp:       &WarnlistPlugin{warnlist: NewWarnlist(), lastReloadTime: time.Now(), Options: PluginOptions{ReloadPeriod: time.Hour}},
+			status:   http.StatusServiceUnavailable,
+			expected: HealthStatus{},
+		},
+		{
+			name:     "case 4: a warnlist without a reload period is never stale",
+			wp:       &WarnlistPlugin{warnlist: warnlist, loaded: true, lastReloadTime: time.Now().Add(-72 * time.Hour)},
+			status:   http.StatusOK,
+			expected: HealthStatus{Healthy: true, Entries: 2},
+		},
+		{
+			name:   "case 5: a POST is not allowed",
+			wp:     &WarnlistPlugin{warnlist: warnlist, loaded: true},
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := httptest.NewRecorder()
+			tc.wp.serveHealth(rec, httptest.NewRequest(method, "/health", nil))
+
+			if !cmp.Equal(tc.status, rec.Code) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.status, rec.Code))
+			}
+			if tc.method != "" {
+				return
+			}
+
+			var status HealthStatus
+			if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tc.expected.LastReloadTime = tc.wp.lastReloadTime.UTC()
+			if !cmp.Equal(tc.expected, status) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, status))
+			}
+		})
+	}
+}
+
+func TestReloadHealth(t *testing.T) {
+	options := PluginOptions{
+		Sources:      []DomainSource{{Path: "/nonexistent/domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		ReloadPeriod: time.Hour,
+	}
+	warnlist := NewWarnlist()
+	warnlist.Add("example.org.")
+	_ = warnlist.Close()
+	wp := newWarnlistPlugin(options, startupCaches{warnlist: warnlist, loaded: true}, time.Now())
+
+	// A failed reload is reported, and keeps the time of the last successful one
+	if err := wp.Reload(); err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+	status := wp.Health()
+	if !status.Healthy || status.LastError == "" || status.Entries != 1 {
+		t.Fatalf("expected a healthy status reporting the failed reload, got %+v", status)
+	}
+}
+
+func Test_healthServer(t *testing.T) {
+	h := &healthServer{addr: "127.0.0.1:0", wp: &WarnlistPlugin{warnlist: NewWarnlist()}}
+
+	if err := h.OnStartup(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := http.Get("http://" + h.ln.Addr().String() + "/health")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if !cmp.Equal(http.StatusServiceUnavailable, resp.StatusCode) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(http.StatusServiceUnavailable, resp.StatusCode))
+	}
+
+	if err := h.OnFinalShutdown(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := http.Get("http://" + h.ln.Addr().String() + "/health"); err == nil {
+		t.Fatalf("expected the server to be shut down")
+	}
+	// Shutting down again, like on a restart followed by the final shutdown, is a no-op
+	if err := h.OnFinalShutdown(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
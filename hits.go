@@ -0,0 +1,102 @@
+package warnlist
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// defaultTopHits is the number of entries the hits endpoint answers with if the request doesn't set it.
+const defaultTopHits = 100
+
+// EntryHits is the number of queries a list entry matched, as answered by the hits endpoint of the debug server.
+type EntryHits struct {
+	Entry string `json:"entry"`
+	Hits  uint64 `json:"hits"`
+}
+
+// entryHits counts the queries matching each list entry, so the entries which are actually queried can be told apart
+// from dead weight. At most max entries are counted: once it is full, the least recently matched entry is dropped to
+// make room for a new one, so the counts of entries which are still matched are kept.
+type entryHits struct {
+	max int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// recent holds the counted entries, the most recently matched first
+	recent *list.List
+}
+
+func newEntryHits(max int) *entryHits {
+	return &entryHits{max: max, entries: make(map[string]*list.Element), recent: list.New()}
+}
+
+// record counts a query matching the entry. It is a no-op on a nil entryHits, so callers don't have to check if
+// hit counts are enabled.
+func (h *entryHits) record(entry string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if e, ok := h.entries[entry]; ok {
+		e.Value.(*EntryHits).Hits++
+		h.recent.MoveToFront(e)
+		return
+	}
+	if h.recent.Len() >= h.max {
+		oldest := h.recent.Back()
+		h.recent.Remove(oldest)
+		delete(h.entries, oldest.Value.(*EntryHits).Entry)
+	}
+	h.entries[entry] = h.recent.PushFront(&EntryHits{Entry: entry, Hits: 1})
+}
+
+// top returns the n entries with the most hits, the most matched first.
+func (h *entryHits) top(n int) []EntryHits {
+	h.mu.Lock()
+	hits := make([]EntryHits, 0, h.recent.Len())
+	for e := h.recent.Front(); e != nil; e = e.Next() {
+		hits = append(hits, *e.Value.(*EntryHits))
+	}
+	h.mu.Unlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Hits != hits[j].Hits {
+			return hits[i].Hits > hits[j].Hits
+		}
+		return hits[i].Entry < hits[j].Entry
+	})
+	if len(hits) > n {
+		hits = hits[:n]
+	}
+	return hits
+}
+
+// serveHits answers GET /hits?top=<n> with the n list entries matched by the most queries since the plugin started.
+func (wp *WarnlistPlugin) serveHits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if wp.hits == nil {
+		http.Error(w, "hit counts are disabled (set hit_counts)", http.StatusNotFound)
+		return
+	}
+	n := defaultTopHits
+	if top := r.URL.Query().Get("top"); top != "" {
+		var err error
+		if n, err = strconv.Atoi(top); err != nil || n < 1 {
+			http.Error(w, "invalid top parameter (must be a positive number)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(wp.hits.top(n))
+}
@@ -0,0 +1,192 @@
+package warnlist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+)
+
+func Test_entryHits(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		max      int
+		entries  []string
+		top      int
+		expected []EntryHits
+	}{
+		{
+			name:    "case 0: entries are ordered by their hits, then by name",
+			max:     10,
+			entries: []string{"b.example.", "a.example.", "c.example.", "c.example.", "a.example.", "c.example."},
+			top:     10,
+			expected: []EntryHits{
+				{Entry: "c.example.", Hits: 3},
+				{Entry: "a.example.", Hits: 2},
+				{Entry: "b.example.", Hits: 1},
+			},
+		},
+		{
+			name:    "case 1: only the top entries are returned",
+			max:     10,
+			entries: []string{"b.example.", "a.example.", "a.example."},
+			top:     1,
+			expected: []EntryHits{
+				{Entry: "a.example.", Hits: 2},
+			},
+		},
+		{
+			name:    "case 2: the least recently matched entry is dropped once the counts are full",
+			max:     2,
+			entries: []string{"a.example.", "a.example.", "b.example.", "a.example.", "c.example."},
+			top:     10,
+			expected: []EntryHits{
+				{Entry: "a.example.", Hits: 3},
+				{Entry: "c.example.", Hits: 1},
+			},
+		},
+		{
+			name:    "case 3: a dropped entry is counted anew",
+			max:     1,
+			entries: []string{"a.example.", "a.example.", "b.example.", "a.example."},
+			top:     10,
+			expected: []EntryHits{
+				{Entry: "a.example.", Hits: 1},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			h := newEntryHits(tc.max)
+			for _, entry := range tc.entries {
+				h.record(entry)
+			}
+			top := h.top(tc.top)
+			if !cmp.Equal(tc.expected, top) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, top))
+			}
+		})
+	}
+}
+
+func Test_entryHitsConcurrent(t *testing.T) {
+	h := newEntryHits(10)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				h.record("a.example.")
+				_ = h.top(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	expected := []EntryHits{{Entry: "a.example.", Hits: 8000}}
+	if !cmp.Equal(expected, h.top(1)) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(expected, h.top(1)))
+	}
+}
+
+func Test_serveHits(t *testing.T) {
+	warnlist := NewTrieWarnlist()
+	warnlist.Add("example.org.")
+	warnlist.Add("something.evil.")
+	_ = warnlist.Close()
+	wp := &WarnlistPlugin{Next: test.ErrorHandler(), warnlist: warnlist, hits: newEntryHits(10), Options: PluginOptions{Response: ResponseNXDomain}}
+
+	// Queries matching the warnlist are counted by the entry they matched
+	for _, domain := range []string{"www.example.org.", "example.org.", "something.evil.", "unlisted.example."} {
+		r := new(dns.Msg)
+		r.SetQuestion(domain, dns.TypeA)
+		if _, err := wp.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), r); err != nil {
+			t.Fatalf("Error serving DNS: %v", err)
+		}
+	}
+
+	var testCases = []struct {
+		name     string
+		method   string
+		query    string
+		disabled bool
+		status   int
+		expected []EntryHits
+	}{
+		{
+			name:   "case 0: the entries are listed by their hits",
+			status: http.StatusOK,
+			expected: []EntryHits{
+				{Entry: "example.org.", Hits: 2},
+				{Entry: "something.evil.", Hits: 1},
+			},
+		},
+		{
+			name:   "case 1: top limits the number of entries",
+			query:  "?top=1",
+			status: http.StatusOK,
+			expected: []EntryHits{
+				{Entry: "example.org.", Hits: 2},
+			},
+		},
+		{
+			name:   "case 2: an invalid top is a bad request",
+			query:  "?top=0",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:     "case 3: hits aren't found unless hit counts are enabled",
+			disabled: true,
+			status:   http.StatusNotFound,
+		},
+		{
+			name:   "case 4: a POST is not allowed",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			m := wp
+			if tc.disabled {
+				m = &WarnlistPlugin{warnlist: warnlist}
+			}
+			rec := httptest.NewRecorder()
+			m.serveHits(rec, httptest.NewRequest(method, "/hits"+tc.query, nil))
+
+			if !cmp.Equal(tc.status, rec.Code) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.status, rec.Code))
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var result []EntryHits
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(tc.expected, result) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, result))
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package warnlist
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// MatchAnswerIP is a match of an address in the answer to a query, rather than of the name queried.
+const MatchAnswerIP = "answer_ip"
+
+// IPBlocklist matches addresses against a set of networks, like sinkholes and bulletproof hosting ranges, so
+// responses resolving to them can be blocked even if the name isn't listed yet, like those of fast-flux domains.
+type IPBlocklist struct {
+	// networks holds the listed networks in their canonical CIDR form, by the size of their address and prefix, so
+	// an address is looked up once per listed prefix length
+	networks map[ipPrefix]map[string]struct{}
+	prefixes []ipPrefix
+	len      int
+}
+
+// ipPrefix is the length of a network prefix, and the size of its addresses.
+type ipPrefix struct {
+	ones, bits int
+}
+
+func NewIPBlocklist() *IPBlocklist {
+	return &IPBlocklist{networks: make(map[ipPrefix]map[string]struct{})}
+}
+
+// Add adds a network to the blocklist.
+func (b *IPBlocklist) Add(network *net.IPNet) {
+	ones, bits := network.Mask.Size()
+	prefix := ipPrefix{ones: ones, bits: bits}
+	networks, ok := b.networks[prefix]
+	if !ok {
+		networks = make(map[string]struct{})
+		b.networks[prefix] = networks
+		b.prefixes = append(b.prefixes, prefix)
+		// Longer prefixes come first, so the most specific network is matched
+		sort.Slice(b.prefixes, func(i, j int) bool { return b.prefixes[i].ones > b.prefixes[j].ones })
+	}
+	if _, ok := networks[network.String()]; !ok {
+		networks[network.String()] = struct{}{}
+		b.len++
+	}
+}
+
+// Match returns the listed network holding the address, in its CIDR form.
+func (b *IPBlocklist) Match(ip net.IP) (string, bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, prefix := range b.prefixes {
+		if prefix.bits != len(ip)*8 {
+			continue
+		}
+		network := net.IPNet{IP: ip.Mask(net.CIDRMask(prefix.ones, prefix.bits)), Mask: net.CIDRMask(prefix.ones, prefix.bits)}
+		if _, ok := b.networks[prefix][network.String()]; ok {
+			return network.String(), true
+		}
+	}
+	return "", false
+}
+
+// Len returns the number of networks listed.
+func (b *IPBlocklist) Len() int {
+	return b.len
+}
+
+// buildIPBlocklistFromFile builds the blocklist of answer addresses. It returns nil if no ip_blocklist is configured.
+// Each line of its sources holds an address or a CIDR, like those of iplist sources.
+func buildIPBlocklistFromFile(options PluginOptions, validators sourceValidators) (*IPBlocklist, error) {
+	if len(options.IPBlocklist) == 0 {
+		return nil, nil
+	}
+
+	// Print a log message with the time it took to build the blocklist
+	defer logTime("Building IP blocklist took %s", time.Now())
+
+	sources, err := expandSources(options.IPBlocklist, options)
+	if err != nil {
+		return nil, err
+	}
+	blocklist := NewIPBlocklist()
+	malformed := 0
+	for _, source := range sources {
+		if err := loadIPBlocklist(blocklist, source, options, validators, &malformed); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof("loaded %d networks into IP blocklist, skipped %d malformed lines", blocklist.Len(), malformed)
+	options.counts.recordLoaded("ip_blocklist", blocklist.Len())
+	options.counts.recordMalformed("ip_blocklist", malformed)
+	return blocklist, nil
+}
+
+// loadIPBlocklist adds the networks of a source to the blocklist, adding the number of lines which couldn't be parsed
+// to malformed.
+func loadIPBlocklist(blocklist *IPBlocklist, source DomainSource, options PluginOptions, validators sourceValidators, malformed *int) error {
+	sourceData, err := openSource(source, options, validators)
+	if err != nil {
+		return err
+	}
+	defer sourceData.Close()
+
+	scanner := bufio.NewScanner(sourceData)
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.TrimPrefix(scanner.Text(), utf8BOM))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		network, ok := parseIPOrCIDR(fields[0])
+		if !ok {
+			log.Debugf("skipping invalid IP address or CIDR %q in %s", fields[0], redactURL(source.Path))
+			malformedEntries.WithLabelValues(DomainFileFormatIPList).Inc()
+			*malformed++
+			continue
+		}
+		blocklist.Add(network)
+	}
+	return scanner.Err()
+}
+
+// checkAnswerIPs reports a response with an A or AAAA answer in a network of the IP blocklist, and replaces it with
+// the block response if one is configured.
+func (wp *WarnlistPlugin) checkAnswerIPs(ctx context.Context, req request.Request, blocklist *IPBlocklist, res *dns.Msg) *dns.Msg {
+	for _, rr := range res.Answer {
+		var ip net.IP
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			continue
+		}
+		network, hit := blocklist.Match(ip)
+		if !hit {
+			continue
+		}
+
+		// Warn and increment the counter for the hit
+		warnlistCount.WithLabelValues(metrics.WithServer(ctx), wp.clientIP(req), req.Name()).Inc()
+		mechanismMatches.WithLabelValues(metrics.WithServer(ctx), MatchAnswerIP).Inc()
+		wp.logAnswerIP(req, ip.String(), network)
+		wp.alerts.record(wp.clientIP(req), time.Now())
+		if wp.Options.Audit {
+			auditMatches.WithLabelValues(metrics.WithServer(ctx)).Inc()
+		}
+
+		if wp.blocks(req.QType(), "") && !wp.stale(metrics.WithServer(ctx)) {
+			blockedCount.WithLabelValues(metrics.WithServer(ctx), req.Type(), "").Inc()
+			// The network isn't a name, so the block SOA is owned by the name queried, and annotations hold the network
+			return wp.blockResponse(req.Req, network, "")
+		}
+		return res
+	}
+	return res
+}
@@ -0,0 +1,212 @@
+package warnlist
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+)
+
+func Test_buildIPBlocklistFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "networks.txt")
+	contents := "# Sinkholes\n198.51.100.0/24\n203.0.113.7\n2001:db8:bad::/48\nnot-a-network\n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	options := PluginOptions{IPBlocklist: []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatIPList}}}
+	blocklist, err := buildIPBlocklistFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cmp.Equal(3, blocklist.Len()) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(3, blocklist.Len()))
+	}
+
+	var testCases = []struct {
+		name    string
+		ip      string
+		network string
+		match   bool
+	}{
+		{
+			name:    "case 0: an address inside a CIDR matches it",
+			ip:      "198.51.100.42",
+			network: "198.51.100.0/24",
+			match:   true,
+		},
+		{
+			name: "case 1: an address outside every CIDR doesn't match",
+			ip:   "198.51.101.1",
+		},
+		{
+			name:    "case 2: a listed address matches itself",
+			ip:      "203.0.113.7",
+			network: "203.0.113.7/32",
+			match:   true,
+		},
+		{
+			name: "case 3: a neighbour of a listed address doesn't match",
+			ip:   "203.0.113.8",
+		},
+		{
+			name:    "case 4: an IPv6 address inside a CIDR matches it",
+			ip:      "2001:db8:bad:1::1",
+			network: "2001:db8:bad::/48",
+			match:   true,
+		},
+		{
+			name: "case 5: an IPv6 address outside every CIDR doesn't match",
+			ip:   "2001:db8:beef::1",
+		},
+		{
+			name:    "case 6: an IPv4-mapped IPv6 address matches its IPv4 CIDR",
+			ip:      "::ffff:198.51.100.42",
+			network: "198.51.100.0/24",
+			match:   true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			network, match := blocklist.Match(net.ParseIP(tc.ip))
+			if !cmp.Equal(tc.match, match) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.match, match))
+			}
+			if !cmp.Equal(tc.network, network) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.network, network))
+			}
+		})
+	}
+}
+
+func TestCheckAnswerIPs(t *testing.T) {
+	wl := NewRadixWarnlist()
+	wl.Add("evil.com.")
+	wl.Close()
+
+	al := NewRadixWarnlist()
+	al.Add("allowed.example.")
+	al.Close()
+
+	blocklist := NewIPBlocklist()
+	for _, cidr := range []string{"198.51.100.0/24", "2001:db8:bad::/48"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		blocklist.Add(network)
+	}
+
+	// The next plugin answers every query with the given records
+	next := func(answers ...string) plugin.Handler {
+		return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			for _, answer := range answers {
+				rr, err := dns.NewRR(r.Question[0].Name + " 300 IN " + answer)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m.Answer = append(m.Answer, rr)
+			}
+			return dns.RcodeSuccess, w.WriteMsg(m)
+		})
+	}
+
+	var testCases = []struct {
+		name     string
+		domain   string
+		answers  []string
+		response string
+		rcode    int
+	}{
+		{
+			name:     "case 0: an answer inside a blocklisted CIDR is blocked",
+			domain:   "flux.example.",
+			answers:  []string{"A 198.51.100.42"},
+			response: ResponseNXDomain,
+			rcode:    dns.RcodeNameError,
+		},
+		{
+			name:     "case 1: answers outside the CIDRs are passed through",
+			domain:   "clean.example.",
+			answers:  []string{"A 192.0.2.1", "AAAA 2001:db8::1"},
+			response: ResponseNXDomain,
+			rcode:    dns.RcodeSuccess,
+		},
+		{
+			name:     "case 2: a single blocklisted address among clean ones is blocked",
+			domain:   "flux.example.",
+			answers:  []string{"A 192.0.2.1", "A 198.51.100.7"},
+			response: ResponseRefused,
+			rcode:    dns.RcodeRefused,
+		},
+		{
+			name:     "case 3: an IPv6 answer inside a blocklisted CIDR is blocked",
+			domain:   "flux.example.",
+			answers:  []string{"AAAA 2001:db8:bad::1"},
+			response: ResponseNXDomain,
+			rcode:    dns.RcodeNameError,
+		},
+		{
+			name:     "case 4: an allowlisted name isn't checked",
+			domain:   "allowed.example.",
+			answers:  []string{"A 198.51.100.42"},
+			response: ResponseNXDomain,
+			rcode:    dns.RcodeSuccess,
+		},
+		{
+			name:     "case 5: a blocklisted answer is passed through with the passthrough response",
+			domain:   "flux.example.",
+			answers:  []string{"A 198.51.100.42"},
+			response: ResponsePassthrough,
+			rcode:    dns.RcodeSuccess,
+		},
+		{
+			name:     "case 6: addresses in other records aren't checked",
+			domain:   "flux.example.",
+			answers:  []string{"TXT \"198.51.100.42\""},
+			response: ResponseNXDomain,
+			rcode:    dns.RcodeSuccess,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{
+				Next:        next(tc.answers...),
+				warnlist:    wl,
+				allowlist:   al,
+				ipBlocklist: blocklist,
+				Options:     PluginOptions{Response: tc.response},
+			}
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rec.Msg.Rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rec.Msg.Rcode))
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package warnlist
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// parseIPListLine returns the reverse DNS names covering the IP address or CIDR on the line, so PTR queries for the
+// addresses match them. A range is listed as a wildcard entry of its reverse zone; ranges which don't end on an octet
+// (IPv4) or nibble (IPv6) boundary are split into the reverse zones of the next boundary.
+func parseIPListLine(line string) ([]string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, false
+	}
+
+	network, ok := parseIPOrCIDR(fields[0])
+	if !ok {
+		log.Warningf("skipping invalid IP address or CIDR %q", fields[0])
+		return nil, false
+	}
+	return reverseNames(network), true
+}
+
+// parseIPOrCIDR parses an address, which is a network of a single host, or a CIDR.
+func parseIPOrCIDR(s string) (*net.IPNet, bool) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err == nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, true
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, true
+}
+
+// reverseNames returns the in-addr.arpa or ip6.arpa names covering the network.
+func reverseNames(network *net.IPNet) []string {
+	ones, bits := network.Mask.Size()
+
+	// Reverse names have a label per octet of IPv4 addresses, and per nibble of IPv6 addresses
+	labelBits := 4
+	suffix := "ip6.arpa."
+	if bits == 32 {
+		labelBits = 8
+		suffix = "in-addr.arpa."
+	}
+	aligned := (ones + labelBits - 1) / labelBits * labelBits
+
+	names := make([]string, 0, 1<<uint(aligned-ones))
+	for i := 0; i < 1<<uint(aligned-ones); i++ {
+		ip := make(net.IP, len(network.IP))
+		copy(ip, network.IP)
+		// Fill the bits between the prefix and the boundary with the index of the subnet
+		for j := 0; j < aligned-ones; j++ {
+			if i>>uint(aligned-ones-1-j)&1 == 1 {
+				bit := ones + j
+				ip[bit/8] |= 0x80 >> uint(bit%8)
+			}
+		}
+
+		name := reverseLabels(ip, aligned/labelBits, labelBits) + suffix
+		if aligned < bits {
+			// The whole reverse zone of the subnet
+			name = wildcardPrefix + name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// reverseLabels returns the first n octets or nibbles of the address as reversed labels, with a trailing dot.
+func reverseLabels(ip net.IP, n int, labelBits int) string {
+	var b strings.Builder
+	for i := n - 1; i >= 0; i-- {
+		if labelBits == 8 {
+			b.WriteString(strconv.Itoa(int(ip[i])))
+		} else {
+			nibble := ip[i/2] >> 4
+			if i%2 == 1 {
+				nibble = ip[i/2] & 0x0f
+			}
+			b.WriteString(strconv.FormatInt(int64(nibble), 16))
+		}
+		b.WriteByte('.')
+	}
+	return b.String()
+}
@@ -0,0 +1,114 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseIPListLine(t *testing.T) {
+	var testCases = []struct {
+		name  string
+		line  string
+		names []string
+		ok    bool
+	}{
+		{
+			name:  "case 0: an IPv4 address is its PTR name",
+			line:  "192.0.2.1",
+			names: []string{"1.2.0.192.in-addr.arpa."},
+			ok:    true,
+		},
+		{
+			name:  "case 1: an IPv4 CIDR on an octet boundary is a wildcard of its reverse zone",
+			line:  "192.0.2.0/24",
+			names: []string{"*.2.0.192.in-addr.arpa."},
+			ok:    true,
+		},
+		{
+			name:  "case 2: an IPv4 CIDR off an octet boundary is split",
+			line:  "198.51.100.0/23 # some comment",
+			names: []string{"*.100.51.198.in-addr.arpa.", "*.101.51.198.in-addr.arpa."},
+			ok:    true,
+		},
+		{
+			name:  "case 3: an IPv6 address is its PTR name",
+			line:  "2001:db8::1",
+			names: []string{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+			ok:    true,
+		},
+		{
+			name:  "case 4: an IPv6 CIDR on a nibble boundary is a wildcard of its reverse zone",
+			line:  "2001:db8::/32",
+			names: []string{"*.8.b.d.0.1.0.0.2.ip6.arpa."},
+			ok:    true,
+		},
+		{
+			name:  "case 5: an IPv6 CIDR off a nibble boundary is split",
+			line:  "2001:db8::/31",
+			names: []string{"*.8.b.d.0.1.0.0.2.ip6.arpa.", "*.9.b.d.0.1.0.0.2.ip6.arpa."},
+			ok:    true,
+		},
+		{
+			name: "case 6: an invalid address is skipped",
+			line: "not.an.ip",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			names, ok := parseIPListLine(tc.line)
+			if !cmp.Equal(tc.ok, ok) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.ok, ok))
+			}
+			if !cmp.Equal(tc.names, names) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.names, names))
+			}
+		})
+	}
+}
+
+func Test_buildCacheFromIPList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "ips.txt")
+	if err := ioutil.WriteFile(path, []byte("# bad ranges\n10.0.0.1\n192.0.2.0/24\n2001:db8::/32\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]bool{
+		"1.0.0.10.in-addr.arpa.":   true,
+		"2.0.0.10.in-addr.arpa.":   false,
+		"77.2.0.192.in-addr.arpa.": true,
+		"77.3.0.192.in-addr.arpa.": false,
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.": true,
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.9.b.d.0.1.0.0.2.ip6.arpa.": false,
+	}
+
+	for _, matchSubdomains := range []bool{false, true} {
+		options := PluginOptions{
+			Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatIPList}},
+			MatchSubdomains: matchSubdomains,
+		}
+		list, err := buildCacheFromFile(options, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for name, hit := range expected {
+			if !cmp.Equal(hit, list.Contains(name)) {
+				t.Fatalf("%s (match_subdomains %t): \n\n%s\n", name, matchSubdomains, cmp.Diff(hit, list.Contains(name)))
+			}
+		}
+	}
+}
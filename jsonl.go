@@ -0,0 +1,39 @@
+package warnlist
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// DefaultJSONField is the field holding the domain in jsonl sources.
+const DefaultJSONField = "value"
+
+// newJSONLParser returns a parser for newline delimited JSON objects which takes the domain from the given field.
+// Nested fields are separated by dots, e.g. indicator.value. malformed is called for every line which isn't JSON.
+func newJSONLParser(field string, malformed func()) lineParser {
+	path := strings.Split(field, ".")
+
+	return func(line string) (string, bool) {
+		var object interface{}
+		if err := json.Unmarshal([]byte(line), &object); err != nil {
+			malformed()
+			log.Debugf("skipping malformed jsonl line %q: %v", line, err)
+			return "", false
+		}
+
+		for _, key := range path {
+			fields, ok := object.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			object = fields[key]
+		}
+
+		domain, ok := object.(string)
+		if !ok {
+			return "", false
+		}
+		domain = strings.TrimSpace(domain)
+		return domain, domain != ""
+	}
+}
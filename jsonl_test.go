@@ -0,0 +1,66 @@
+package warnlist
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testJSONL = `{"type": "domain", "value": "evil.example"}
+{"type": "domain", "value": "Bad.Example", "indicator": {"value": "nested.example"}}
+{"type": "domain", "indicator": {"value": "other.example", "tags": ["c2"]}}
+{"type": "domain", "value": 42}
+{"type": "domain", "value": "truncated.exam
+["not", "an", "object"]
+`
+
+func Test_jsonlParser(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		field     string
+		expected  []string
+		malformed int
+	}{
+		{
+			name:      "case 0: domains are taken from a flat field",
+			field:     "value",
+			expected:  []string{"evil.example", "Bad.Example"},
+			malformed: 1,
+		},
+		{
+			name:      "case 1: domains are taken from a nested field",
+			field:     "indicator.value",
+			expected:  []string{"nested.example", "other.example"},
+			malformed: 1,
+		},
+		{
+			name:      "case 2: a missing field yields no domains",
+			field:     "domain",
+			malformed: 1,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			malformed := 0
+			parse := newJSONLParser(tc.field, func() { malformed++ })
+			var domains []string
+			for _, line := range splitLines(testJSONL) {
+				if domain, ok := parse(line); ok {
+					domains = append(domains, domain)
+				}
+			}
+
+			if !cmp.Equal(tc.expected, domains) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, domains))
+			}
+
+			if !cmp.Equal(tc.malformed, malformed) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.malformed, malformed))
+			}
+		})
+	}
+}
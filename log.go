@@ -0,0 +1,206 @@
+package warnlist
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/request"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Log levels of the log lines for matches.
+const (
+	LogLevelNone    = "none"
+	LogLevelError   = "error"
+	LogLevelWarning = "warning"
+	LogLevelInfo    = "info"
+	LogLevelDebug   = "debug"
+)
+
+// logLevels are the log levels matches can be logged at.
+var logLevels = []string{LogLevelNone, LogLevelError, LogLevelWarning, LogLevelInfo, LogLevelDebug}
+
+// matchRecord is the structured log record of a query matching the warnlist.
+type matchRecord struct {
+	Time        string   `json:"time"`
+	Client      string   `json:"client"`
+	Name        string   `json:"name"`
+	Type        string   `json:"qtype"`
+	Entry       string   `json:"entry,omitempty"`
+	Entries     []string `json:"entries,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Mechanism   string   `json:"mechanism,omitempty"`
+	CNAMETarget string   `json:"cname_target,omitempty"`
+	Protected   string   `json:"protected,omitempty"`
+	AnswerIP    string   `json:"answer_ip,omitempty"`
+	Report      bool     `json:"report,omitempty"`
+}
+
+// logMatch logs a query matching the given entry of the warnlist by the given mechanism, in the configured log
+// format. target is the CNAME target which matched, if the query name itself didn't.
+func (wp *WarnlistPlugin) logMatch(req request.Request, warnlist Warnlist, entry string, mechanism string, target string) {
+	if wp.Options.LogLevel == LogLevelNone || !wp.sampleLog() {
+		// Matches are only counted by the metrics
+		return
+	}
+	client := wp.clientIP(req)
+	name := target
+	if name == "" {
+		name = wp.Options.matchName(canonicalDomain(req.Name()))
+	}
+	entries := wp.matchedEntries(warnlist, wp.Options.warnlistName(name))
+	source := sourceOf(warnlist, entry)
+
+	if wp.Options.LogFormat != LogFormatJSON {
+		var details string
+		if mechanism == MatchRegex {
+			details += " matching pattern: " + entry
+		}
+		if source != "" {
+			details += " from source: " + source
+		}
+		if len(entries) > 0 {
+			details += " matching entries: " + strings.Join(entries, ", ")
+		}
+		if target == "" {
+			wp.logAtLevel("host ", client, " requested warnlisted domain: ", req.Name(), details)
+		} else {
+			wp.logAtLevel("host ", client, " requested domain: ", req.Name(), " with warnlisted CNAME target: ", target, details)
+		}
+		return
+	}
+
+	record := matchRecord{
+		Time:        time.Now().UTC().Format(time.RFC3339Nano),
+		Client:      client,
+		Name:        req.Name(),
+		Type:        req.Type(),
+		Entry:       entry,
+		Entries:     entries,
+		Source:      source,
+		Mechanism:   mechanism,
+		CNAMETarget: target,
+	}
+	msg, err := json.Marshal(record)
+	if err != nil {
+		// Only strings are marshaled, so this can't happen
+		log.Errorf("unable to marshal log record: %v", err)
+		return
+	}
+	wp.logAtLevel(string(msg))
+}
+
+// sampleLog returns true if the next match is logged, which is 1 in every log_sample matches, starting with the
+// first one. The metrics still count every match.
+func (wp *WarnlistPlugin) sampleLog() bool {
+	n := uint64(wp.Options.LogSample)
+	if n <= 1 {
+		return true
+	}
+	return atomic.AddUint64(&wp.logged, 1)%n == 1
+}
+
+// parseLogSample parses a log_sample setting of the form 1/N, returning N.
+func parseLogSample(s string) (int, bool) {
+	if !strings.HasPrefix(s, "1/") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s[len("1/"):])
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// logTyposquat logs a query for a name resembling the given protected domain, in the configured log format.
+func (wp *WarnlistPlugin) logTyposquat(req request.Request, protected string) {
+	if wp.Options.LogLevel == LogLevelNone {
+		return
+	}
+	client := wp.clientIP(req)
+	if wp.Options.LogFormat != LogFormatJSON {
+		wp.logAtLevel("host ", client, " requested domain: ", req.Name(), " resembling protected domain: ", protected)
+		return
+	}
+
+	record := matchRecord{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Client:    client,
+		Name:      req.Name(),
+		Type:      req.Type(),
+		Protected: protected,
+	}
+	msg, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("unable to marshal log record: %v", err)
+		return
+	}
+	wp.logAtLevel(string(msg))
+}
+
+// logAnswerIP logs a query answered with an address in the given network of the IP blocklist, in the configured log
+// format.
+func (wp *WarnlistPlugin) logAnswerIP(req request.Request, ip string, network string) {
+	if wp.Options.LogLevel == LogLevelNone || !wp.sampleLog() {
+		return
+	}
+	client := wp.clientIP(req)
+	if wp.Options.LogFormat != LogFormatJSON {
+		wp.logAtLevel("host ", client, " requested domain: ", req.Name(), " answered with blocklisted address: ", ip, " in network: ", network)
+		return
+	}
+
+	record := matchRecord{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Client:    client,
+		Name:      req.Name(),
+		Type:      req.Type(),
+		Entry:     network,
+		Mechanism: MatchAnswerIP,
+		AnswerIP:  ip,
+	}
+	msg, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("unable to marshal log record: %v", err)
+		return
+	}
+	wp.logAtLevel(string(msg))
+}
+
+// logAtLevel logs a match at the configured log level, which is warning by default. Debug lines are only printed
+// if the debug plugin is enabled.
+func (wp *WarnlistPlugin) logAtLevel(v ...interface{}) {
+	switch wp.Options.LogLevel {
+	case LogLevelNone:
+	case LogLevelError:
+		log.Error(v...)
+	case LogLevelInfo:
+		log.Info(v...)
+	case LogLevelDebug:
+		log.Debug(v...)
+	default:
+		log.Warning(v...)
+	}
+}
+
+// isValidLogLevel returns true if matches can be logged at the given level.
+func isValidLogLevel(level string) bool {
+	for _, l := range logLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidLogFormat returns true if the given log format is supported.
+func isValidLogFormat(format string) bool {
+	return format == LogFormatText || format == LogFormatJSON
+}
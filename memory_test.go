@@ -0,0 +1,45 @@
+package warnlist
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// benchmarkMemory reports the heap used per entry by a list of a million domains.
+func benchmarkMemory(b *testing.B, newList func() Warnlist) {
+	const entries = 1000000
+
+	var before, after runtime.MemStats
+	var used uint64
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		list := newList()
+		for j := 0; j < entries; j++ {
+			list.Add("listed-" + strconv.Itoa(j) + ".example.com.")
+		}
+		if err := list.Close(); err != nil {
+			b.Fatal(err)
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		used += after.HeapAlloc - before.HeapAlloc
+		runtime.KeepAlive(list)
+	}
+	b.ReportMetric(float64(used)/float64(b.N)/entries, "heap-bytes/entry")
+}
+
+func BenchmarkMemoryMap(b *testing.B) {
+	benchmarkMemory(b, NewWarnlist)
+}
+
+func BenchmarkMemoryPacked(b *testing.B) {
+	benchmarkMemory(b, NewPackedWarnlist)
+}
+
+func BenchmarkMemoryTrie(b *testing.B) {
+	benchmarkMemory(b, NewTrieWarnlist)
+}
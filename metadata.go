@@ -0,0 +1,35 @@
+package warnlist
+
+import (
+	"context"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/request"
+)
+
+// matchedLabel is the metadata label holding whether the query name matches the warnlist.
+const matchedLabel = "warnlist/matched"
+
+// Metadata implements the metadata.Provider interface. It publishes whether the query name matches the warnlist
+// as "true" or "false", honoring the allowlist and excludes. The lookup only happens when the value is read.
+func (wp *WarnlistPlugin) Metadata(ctx context.Context, state request.Request) context.Context {
+	var once sync.Once
+	var matched string
+	metadata.SetValueFunc(ctx, matchedLabel, func() string {
+		once.Do(func() {
+			matched = "false"
+			if wp.matches(wp.Options.matchName(canonicalDomain(state.Name())), state.QType()) {
+				matched = "true"
+			}
+		})
+		return matched
+	})
+	return ctx
+}
+
+// matches returns true if a query for the name and type matches the loaded warnlist, and isn't carved out of matching.
+func (wp *WarnlistPlugin) matches(name string, qtype uint16) bool {
+	warnlist, allowlist := wp.lists()
+	return wp.match(warnlist, allowlist, name, qtype).hit
+}
@@ -21,6 +21,15 @@ var warnlistCheckDuration = promauto.NewSummaryVec(prometheus.SummaryOpts{
 	Help:      "Summary of the average duration required to check the cache for a warnlisted domain.",
 }, []string{"server"})
 
+var requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_request_duration_seconds",
+	Help:      "Histogram of the time spent checking a query in the plugin, excluding the plugins it is passed to.",
+	// Checks take microseconds, far below the buckets of the CoreDNS request duration
+	Buckets: prometheus.ExponentialBuckets(0.000001, 4, 10),
+}, []string{"server"})
+
 var warnlistSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
 	Namespace: plugin.Namespace,
 	Subsystem: "warnlist",
@@ -28,9 +37,164 @@ var warnlistSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
 	Help:      "Counter of the number of currently warnlisted items.",
 }, []string{"server"})
 
+// reloadsFailedCount is the deprecated name of reloadFailures, which is only kept for existing dashboards and alerts.
+// Failed reloads are counted in both by countReloadFailure.
 var reloadsFailedCount = promauto.NewCounterVec(prometheus.CounterOpts{
 	Namespace: plugin.Namespace,
 	Subsystem: "warnlist",
 	Name:      "warnlist_failed_reloads_count",
+	Help:      "Deprecated: use warnlist_reload_failures_total. Counter of the number of times the plugin has failed to reload its warnlist.",
+}, []string{"server"})
+
+var blockedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_blocked_queries_total",
+	Help:      "Counter of the number of queries for warnlisted domains which were answered with a block response.",
+}, []string{"server", "qtype", "source"})
+
+var domainsLoaded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_domains_loaded",
+	Help:      "Gauge of the number of domains loaded by the most recent successful cache build.",
+}, []string{"server", "list"})
+
+// listCounts holds the number of entries loaded into each list by a build, and of lines it skipped because they
+// could not be parsed, keyed by their list label. The lists are built before the server handling their queries is
+// known, so their gauges are only set once it is.
+type listCounts struct {
+	loaded    map[string]int
+	malformed map[string]int
+}
+
+func newListCounts() *listCounts {
+	return &listCounts{loaded: map[string]int{}, malformed: map[string]int{}}
+}
+
+// recordLoaded records the number of entries loaded into a list. It does nothing on nil counts.
+func (c *listCounts) recordLoaded(list string, n int) {
+	if c != nil {
+		c.loaded[list] = n
+	}
+}
+
+// recordMalformed records the number of lines skipped by the build of a list. It does nothing on nil counts.
+func (c *listCounts) recordMalformed(list string, n int) {
+	if c != nil {
+		c.malformed[list] = n
+	}
+}
+
+// merge returns new counts holding those of c, updated with those of other.
+func (c *listCounts) merge(other *listCounts) *listCounts {
+	merged := newListCounts()
+	for _, counts := range []*listCounts{c, other} {
+		if counts == nil {
+			continue
+		}
+		for list, n := range counts.loaded {
+			merged.loaded[list] = n
+		}
+		for list, n := range counts.malformed {
+			merged.malformed[list] = n
+		}
+	}
+	return merged
+}
+
+// set sets the gauges of the server to the counts.
+func (c *listCounts) set(server string) {
+	if c == nil {
+		return
+	}
+	for list, n := range c.loaded {
+		domainsLoaded.WithLabelValues(server, list).Set(float64(n))
+	}
+	for list, n := range c.malformed {
+		parseErrors.WithLabelValues(server, list).Set(float64(n))
+	}
+}
+
+var lastReloadTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_last_reload_timestamp_seconds",
+	Help:      "Gauge of the Unix timestamp of the last successful warnlist build.",
+}, []string{"server"})
+
+var reloadFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_reload_failures_total",
 	Help:      "Counter of the number of times the plugin has failed to reload its warnlist.",
 }, []string{"server"})
+
+// countReloadFailure counts a failed reload of the server's warnlist, under the current and the deprecated name.
+func countReloadFailure(server string) {
+	reloadFailures.WithLabelValues(server).Inc()
+	reloadsFailedCount.WithLabelValues(server).Inc()
+}
+
+var reloadsSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_reloads_skipped_total",
+	Help:      "Counter of the number of reloads which were skipped because none of the sources had changed.",
+}, []string{"server"})
+
+var malformedEntries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_malformed_entries_total",
+	Help:      "Counter of the number of source entries skipped because they could not be parsed.",
+}, []string{"format"})
+
+var parseErrors = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_parse_errors",
+	Help:      "Gauge of the number of source lines skipped by the most recent successful cache build because they could not be parsed.",
+}, []string{"server", "list"})
+
+var typosquatMatches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_typosquat_matches_total",
+	Help:      "Counter of the number of queries for names resembling a protected domain.",
+}, []string{"server", "protected"})
+
+var auditMatches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_audit_matches_total",
+	Help:      "Counter of the number of warnlisted queries passed through because the plugin is in audit mode.",
+}, []string{"server"})
+
+var stalePassthroughs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_stale_passthroughs_total",
+	Help:      "Counter of the number of warnlisted queries passed through because the warnlist is older than max_stale.",
+}, []string{"server"})
+
+var reportMatches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_report_matches_total",
+	Help:      "Counter of the number of queries matching the report list, which are never blocked.",
+}, []string{"server", "source"})
+
+var mechanismMatches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_mechanism_matches_total",
+	Help:      "Counter of the number of warnlisted queries by the mechanism which matched them: literal or regex.",
+}, []string{"server", "mechanism"})
+
+var minEntriesRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: "warnlist",
+	Name:      "warnlist_min_entries_rejections_total",
+	Help:      "Counter of the number of builds failed because they loaded fewer entries than min_entries.",
+}, []string{"list"})
@@ -0,0 +1,115 @@
+package warnlist
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile maps names the way they are looked up, but still allows characters like '_' which appear in DNS
+// queries (e.g. SRV records) even though they are not valid in hostnames.
+var idnaProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false))
+
+// normalizeDomain returns the lowercase ASCII (punycode) form of a domain, so Unicode and punycode representations
+// of the same name compare equal. Names which can't be converted are only lowercased.
+func normalizeDomain(name string) string {
+	name = unescapeDomain(name)
+	if isASCII(name) {
+		// Already in ASCII form, which is the common case on the query path
+		return strings.ToLower(name)
+	}
+
+	ascii, err := idnaProfile.ToASCII(name)
+	if err != nil {
+		return strings.ToLower(name)
+	}
+	return ascii
+}
+
+// canonicalDomain returns the form in which list entries and queries are compared: normalized, and fully qualified
+// with a trailing dot, whatever the case and form they were given in.
+func canonicalDomain(name string) string {
+	return dns.Fqdn(normalizeDomain(name))
+}
+
+// wwwPrefix is the leading label strip_www removes from list entries and query names.
+const wwwPrefix = "www."
+
+// stripWWW returns a canonical name without its leading www. label, so www.bad.example. and bad.example. compare equal.
+// Names which would be left with a single label, like www.com., are returned as they are, so they never turn into
+// an entry matching a whole top-level domain.
+func stripWWW(name string) string {
+	if !strings.HasPrefix(name, wwwPrefix) {
+		return name
+	}
+	stripped := name[len(wwwPrefix):]
+	if strings.Count(stripped, ".") < 2 {
+		return name
+	}
+	return stripped
+}
+
+// matchName returns the form in which a canonical list entry or query name is matched, which is the name itself
+// unless strip_www is set. Wildcard entries keep their prefix, and have the www. label under it stripped.
+func (o PluginOptions) matchName(name string) string {
+	if !o.StripWWW {
+		return name
+	}
+	if strings.HasPrefix(name, wildcardPrefix) {
+		return wildcardPrefix + stripWWW(name[len(wildcardPrefix):])
+	}
+	return stripWWW(name)
+}
+
+// warnlistName returns the form in which a match name is looked up in the warnlist, which is its skeleton if
+// confusables is set. The allowlist and excludes match the name itself, so allowlisting a brand domain doesn't
+// allowlist its homographs as well.
+func (o PluginOptions) warnlistName(name string) string {
+	if o.Confusables {
+		return skeletonDomain(name)
+	}
+	return name
+}
+
+// unescapeDomain replaces the \DDD escapes used for non-ASCII bytes in presentation format names, so UTF-8 names
+// received on the wire can be converted. Escaped dots are left as they are, since they are not label separators.
+func unescapeDomain(name string) string {
+	if !strings.Contains(name, `\`) {
+		return name
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+3 < len(name) && isDigit(name[i+1]) && isDigit(name[i+2]) && isDigit(name[i+3]) {
+			v := int(name[i+1]-'0')*100 + int(name[i+2]-'0')*10 + int(name[i+3]-'0')
+			if v >= utf8.RuneSelf && v <= 0xff {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+
+	unescaped := b.String()
+	if !utf8.ValidString(unescaped) {
+		// Not a UTF-8 name, so keep the escaped form
+		return name
+	}
+	return unescaped
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
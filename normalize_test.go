@@ -0,0 +1,158 @@
+package warnlist
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_normalizeDomain(t *testing.T) {
+	var testCases = []struct {
+		name       string
+		domain     string
+		normalized string
+	}{
+		{
+			name:       "case 0: an ASCII domain is unchanged",
+			domain:     "example.org.",
+			normalized: "example.org.",
+		},
+		{
+			name:       "case 1: an uppercase domain is lowercased",
+			domain:     "Example.ORG.",
+			normalized: "example.org.",
+		},
+		{
+			name:       "case 2: a Unicode domain is converted to punycode",
+			domain:     "bücher.example.",
+			normalized: "xn--bcher-kva.example.",
+		},
+		{
+			name:       "case 3: an uppercase Unicode domain is folded and converted to punycode",
+			domain:     "BÜCHER.example.",
+			normalized: "xn--bcher-kva.example.",
+		},
+		{
+			name:       "case 4: an uppercase punycode domain is lowercased",
+			domain:     "XN--BCHER-KVA.example.",
+			normalized: "xn--bcher-kva.example.",
+		},
+		{
+			name:       "case 5: an escaped UTF-8 domain from the wire is converted to punycode",
+			domain:     `b\195\188cher.example.`,
+			normalized: "xn--bcher-kva.example.",
+		},
+		{
+			name:       "case 6: an underscore label is kept",
+			domain:     "_sip._tcp.bücher.example.",
+			normalized: "_sip._tcp.xn--bcher-kva.example.",
+		},
+		{
+			name:       "case 7: an escaped non UTF-8 domain is kept escaped",
+			domain:     `b\255cher.example.`,
+			normalized: `b\255cher.example.`,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			normalized := normalizeDomain(tc.domain)
+			if !cmp.Equal(tc.normalized, normalized) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.normalized, normalized))
+			}
+		})
+	}
+}
+
+func Test_canonicalDomain(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		domain    string
+		canonical string
+	}{
+		{
+			name:      "case 0: a lowercase domain gets a trailing dot",
+			domain:    "bad.example.com",
+			canonical: "bad.example.com.",
+		},
+		{
+			name:      "case 1: a mixed case domain is lowercased and gets a trailing dot",
+			domain:    "Bad.Example.COM",
+			canonical: "bad.example.com.",
+		},
+		{
+			name:      "case 2: a mixed case domain with a trailing dot is lowercased",
+			domain:    "BAD.example.com.",
+			canonical: "bad.example.com.",
+		},
+		{
+			name:      "case 3: a Unicode domain is converted to punycode and gets a trailing dot",
+			domain:    "Bücher.example",
+			canonical: "xn--bcher-kva.example.",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			canonical := canonicalDomain(tc.domain)
+			if !cmp.Equal(tc.canonical, canonical) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.canonical, canonical))
+			}
+		})
+	}
+}
+
+func Test_stripWWW(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		domain   string
+		stripped string
+	}{
+		{
+			name:     "case 0: a leading www label is stripped",
+			domain:   "www.bad.example.",
+			stripped: "bad.example.",
+		},
+		{
+			name:     "case 1: a name without a leading www label is kept",
+			domain:   "bad.example.",
+			stripped: "bad.example.",
+		},
+		{
+			name:     "case 2: only the first www label is stripped",
+			domain:   "www.www.bad.example.",
+			stripped: "www.bad.example.",
+		},
+		{
+			name:     "case 3: a label merely starting with www is kept",
+			domain:   "wwwbad.example.",
+			stripped: "wwwbad.example.",
+		},
+		{
+			name:     "case 4: a www label in the middle of a name is kept",
+			domain:   "login.www.bad.example.",
+			stripped: "login.www.bad.example.",
+		},
+		{
+			name:     "case 5: a name which would be left with a single label is kept",
+			domain:   "www.com.",
+			stripped: "www.com.",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			stripped := stripWWW(tc.domain)
+			if !cmp.Equal(tc.stripped, stripped) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.stripped, stripped))
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package warnlist
+
+import (
+	"errors"
+	"math"
+)
+
+// PackedWarnlist matches exact domains like the Go map, but Close packs all domains into a single byte slice, indexed
+// by an open addressing hash table of offsets. This avoids the overhead of a string and a map slot per domain.
+type PackedWarnlist struct {
+	// building holds domains added since the list was last closed
+	building map[string]struct{}
+
+	// data holds every packed domain, prefixed by its length
+	data []byte
+	// table holds the offset + 1 of each domain in data at its hash slot, with 0 marking an empty slot, and
+	// packedRemoved the slot of a removed domain
+	table []uint32
+	len   int
+	// removed counts the packed domains removed since the list was last closed
+	removed int
+}
+
+// packedRemoved marks the slot of a removed domain, which keeps the probe sequences of other domains intact. It can't
+// be the offset of a domain, since data is shorter than math.MaxUint32.
+const packedRemoved = math.MaxUint32
+
+func NewPackedWarnlist() Warnlist {
+	p := &PackedWarnlist{}
+	p.Open()
+	return p
+}
+
+func (p *PackedWarnlist) Add(key string) {
+	if len(key) > math.MaxUint8 {
+		// Longer than any valid domain name, and than the length prefix can hold
+		log.Warningf("skipping domain longer than %d characters: %s", math.MaxUint8, key)
+		return
+	}
+	if p.packedContains(key) {
+		return
+	}
+	if p.building == nil {
+		p.building = make(map[string]struct{})
+	}
+	p.building[key] = struct{}{}
+}
+
+// Remove removes the key. Packed domains are only dropped from the data by the next Close.
+func (p *PackedWarnlist) Remove(key string) {
+	if _, ok := p.building[key]; ok {
+		delete(p.building, key)
+		return
+	}
+	if slot, ok := p.packedSlot(key); ok {
+		p.table[slot] = packedRemoved
+		p.len--
+		p.removed++
+	}
+}
+
+func (p *PackedWarnlist) Contains(key string) bool {
+	if p.packedContains(key) {
+		return true
+	}
+	_, ok := p.building[key]
+	return ok
+}
+
+func (p *PackedWarnlist) Match(key string) (string, bool) {
+	return key, p.Contains(key)
+}
+
+func (p *PackedWarnlist) MatchAll(key string) []string {
+	return matchOne(p.Match(key))
+}
+
+// Close packs the domains added since the last Close together with those already packed, dropping removed ones.
+func (p *PackedWarnlist) Close() error {
+	if len(p.building) == 0 && p.removed == 0 {
+		p.building = nil
+		return nil
+	}
+
+	n := p.len + len(p.building)
+	size := 0
+	for key := range p.building {
+		size += 1 + len(key)
+	}
+	if len(p.data)+size >= math.MaxUint32 {
+		return errors.New("too many domains to be packed")
+	}
+
+	// Keep the table at most half full, so probe sequences stay short
+	slots := 1
+	for slots < 2*n {
+		slots <<= 1
+	}
+
+	old, oldTable := p.data, p.table
+	p.data = make([]byte, 0, len(old)+size)
+	p.table = make([]uint32, slots)
+	p.len = 0
+	p.removed = 0
+
+	for _, v := range oldTable {
+		if v == 0 || v == packedRemoved {
+			continue
+		}
+		offset := v - 1
+		l := uint32(old[offset])
+		p.insert(string(old[offset+1 : offset+1+l]))
+	}
+	for key := range p.building {
+		p.insert(key)
+	}
+	p.building = nil
+	return nil
+}
+
+func (p *PackedWarnlist) Len() int {
+	return p.len + len(p.building)
+}
+
+func (p *PackedWarnlist) Open() {
+	p.building = make(map[string]struct{})
+	p.data = nil
+	p.table = nil
+	p.len = 0
+	p.removed = 0
+}
+
+// insert appends the key to the packed data, and stores its offset in the first free slot of its probe sequence.
+func (p *PackedWarnlist) insert(key string) {
+	mask := uint64(len(p.table) - 1)
+	slot := bloomHash(key) & mask
+	for p.table[slot] != 0 {
+		slot = (slot + 1) & mask
+	}
+
+	p.table[slot] = uint32(len(p.data)) + 1
+	p.data = append(p.data, byte(len(key)))
+	p.data = append(p.data, key...)
+	p.len++
+}
+
+func (p *PackedWarnlist) packedContains(key string) bool {
+	_, ok := p.packedSlot(key)
+	return ok
+}
+
+// packedSlot returns the slot of a packed key.
+func (p *PackedWarnlist) packedSlot(key string) (uint64, bool) {
+	if len(p.table) == 0 {
+		return 0, false
+	}
+
+	mask := uint64(len(p.table) - 1)
+	for slot := bloomHash(key) & mask; p.table[slot] != 0; slot = (slot + 1) & mask {
+		if p.table[slot] == packedRemoved {
+			continue
+		}
+		offset := p.table[slot] - 1
+		l := uint32(p.data[offset])
+		if int(l) == len(key) && string(p.data[offset+1:offset+1+l]) == key {
+			return slot, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,104 @@
+package warnlist
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_packedContains(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		added    []string
+		reopened []string
+		domain   string
+		hit      bool
+		len      int
+	}{
+		{
+			name:   "case 0: an added domain is found",
+			added:  []string{"example.org.", "something.evil."},
+			domain: "example.org.",
+			hit:    true,
+			len:    2,
+		},
+		{
+			name:   "case 1: subdomains are not matched",
+			added:  []string{"example.org.", "something.evil."},
+			domain: "www.example.org.",
+			len:    2,
+		},
+		{
+			name:   "case 2: duplicate domains are only stored once",
+			added:  []string{"example.org.", "example.org.", "something.evil."},
+			domain: "something.evil.",
+			hit:    true,
+			len:    2,
+		},
+		{
+			name:     "case 3: domains added after closing are found once closed again",
+			added:    []string{"example.org."},
+			reopened: []string{"something.evil.", "example.org."},
+			domain:   "something.evil.",
+			hit:      true,
+			len:      2,
+		},
+		{
+			name:   "case 4: domains longer than a length prefix holds are skipped",
+			added:  []string{strings.Repeat("a", 256) + "."},
+			domain: strings.Repeat("a", 256) + ".",
+			len:    0,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			list := NewPackedWarnlist()
+			for _, d := range tc.added {
+				list.Add(d)
+			}
+			if err := list.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, d := range tc.reopened {
+				list.Add(d)
+			}
+			if err := list.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(tc.hit, list.Contains(tc.domain)) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.hit, list.Contains(tc.domain)))
+			}
+			if !cmp.Equal(tc.len, list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.len, list.Len()))
+			}
+		})
+	}
+}
+
+func Test_packedMatchesMap(t *testing.T) {
+	packed := NewPackedWarnlist()
+	m := NewWarnlist()
+	for i := 0; i < 10000; i++ {
+		d := "listed-" + strconv.Itoa(i) + ".example."
+		packed.Add(d)
+		m.Add(d)
+	}
+	packed.Close()
+	m.Close()
+
+	for i := 0; i < 20000; i++ {
+		d := "listed-" + strconv.Itoa(i) + ".example."
+		if !cmp.Equal(m.Contains(d), packed.Contains(d)) {
+			t.Fatalf("%s: \n\n%s\n", d, cmp.Diff(m.Contains(d), packed.Contains(d)))
+		}
+	}
+	if !cmp.Equal(m.Len(), packed.Len()) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(m.Len(), packed.Len()))
+	}
+}
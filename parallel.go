@@ -0,0 +1,95 @@
+package warnlist
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultBuildWorkers is the number of sources fetched at once if build_workers isn't set, which builds the lists
+// one source after the other.
+const DefaultBuildWorkers = 1
+
+// fetchedSource is the partial list of a source fetched ahead of being added to a list, by a concurrent build.
+type fetchedSource struct {
+	entries    []listEntry
+	malformed  int
+	validators sourceValidators
+	err        error
+
+	// done is closed once the source has been read
+	done chan struct{}
+}
+
+// prefetchSources fetches and parses the sources in the background, with at most workers of them at once, and returns
+// their partial lists in the same order. Each partial list is ready once its done channel is closed. If validators is
+// set, the validators of each source are recorded in its own partial list, so the workers don't share a map. Once stop
+// is closed, the sources which haven't been started yet aren't fetched, and their partial lists fail with
+// errBuildStopped.
+func prefetchSources(sources []DomainSource, options PluginOptions, validators bool, workers int, stop <-chan struct{}) []*fetchedSource {
+	fetched := make([]*fetchedSource, len(sources))
+	for i := range sources {
+		fetched[i] = &fetchedSource{done: make(chan struct{})}
+		if validators {
+			fetched[i].validators = sourceValidators{}
+		}
+	}
+
+	sem := make(chan struct{}, workers)
+	go func() {
+		for i, source := range sources {
+			select {
+			case <-stop:
+			case sem <- struct{}{}:
+			}
+			select {
+			case <-stop:
+				// The build returned early, so the remaining sources are left alone
+				for _, f := range fetched[i:] {
+					f.err = errBuildStopped
+					close(f.done)
+				}
+				return
+			default:
+			}
+			go func(source DomainSource, f *fetchedSource) {
+				defer func() { <-sem }()
+				defer close(f.done)
+
+				domains, errs := domainsFromSource(source, options, f.validators, &f.malformed)
+				for entry := range domains {
+					f.entries = append(f.entries, entry)
+				}
+				f.err = <-errs
+			}(source, fetched[i])
+		}
+	}()
+	return fetched
+}
+
+// errBuildStopped is the error of the sources a concurrent build didn't fetch, because it returned before them.
+var errBuildStopped = errors.New("build stopped before the source was fetched")
+
+// sourceErrors are the failures of the sources of a concurrent build, which are all reported rather than only the
+// first one, since every source was fetched anyway.
+type sourceErrors []error
+
+func (e sourceErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d sources failed to load: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// err returns nil if no source failed, the error of the source if a single one did, or all of the errors otherwise.
+func (e sourceErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	default:
+		return e
+	}
+}
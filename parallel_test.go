@@ -0,0 +1,215 @@
+package warnlist
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// startListServers starts a server answering with each list, after the delay, and returns their URLs.
+func startListServers(lists []string, delay time.Duration) ([]*httptest.Server, []string) {
+	servers := make([]*httptest.Server, 0, len(lists))
+	urls := make([]string, 0, len(lists))
+	for _, list := range lists {
+		list := list
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			if list == "" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("ETag", `"`+strconv.Itoa(len(list))+`"`)
+			_, _ = w.Write([]byte(list))
+		}))
+		servers = append(servers, server)
+		urls = append(urls, server.URL)
+	}
+	return servers, urls
+}
+
+func Test_buildCacheConcurrent(t *testing.T) {
+	var testCases = []struct {
+		name       string
+		lists      []string
+		workers    int
+		maxEntries int
+		entries    map[string]string
+		failed     int
+	}{
+		{
+			name:    "case 0: the entries of every source are loaded",
+			lists:   []string{"a.example\nb.example\n", "c.example\n", "d.example\n"},
+			workers: 3,
+			entries: map[string]string{"a.example.": "0", "b.example.": "0", "c.example.": "1", "d.example.": "2"},
+		},
+		{
+			name:    "case 1: an entry listed by several sources is recorded for the first one, like a sequential build",
+			lists:   []string{"a.example\n", "a.example\nb.example\n", "b.example\n"},
+			workers: 3,
+			entries: map[string]string{"a.example.": "0", "b.example.": "1"},
+		},
+		{
+			name:    "case 2: fewer workers than sources load them all",
+			lists:   []string{"a.example\n", "b.example\n", "c.example\n", "d.example\n"},
+			workers: 2,
+			entries: map[string]string{"a.example.": "0", "b.example.": "1", "c.example.": "2", "d.example.": "3"},
+		},
+		{
+			name:       "case 3: max_entries drops the entries of the last sources, like a sequential build",
+			lists:      []string{"a.example\nb.example\n", "c.example\n", "d.example\n"},
+			workers:    3,
+			maxEntries: 3,
+			entries:    map[string]string{"a.example.": "0", "b.example.": "0", "c.example.": "1"},
+		},
+		{
+			name:    "case 4: a failing source fails the build with its error",
+			lists:   []string{"a.example\n", "", "c.example\n"},
+			workers: 3,
+			failed:  1,
+		},
+		{
+			name:    "case 5: the errors of all the failing sources are returned",
+			lists:   []string{"", "b.example\n", ""},
+			workers: 3,
+			failed:  2,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			servers, urls := startListServers(tc.lists, 0)
+			for _, server := range servers {
+				defer server.Close()
+			}
+			options := PluginOptions{MatchSubdomains: true, BuildWorkers: tc.workers, MaxEntries: tc.maxEntries}
+			for j, url := range urls {
+				options.Sources = append(options.Sources, DomainSource{Path: url, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList, Name: strconv.Itoa(j)})
+			}
+
+			validators := sourceValidators{}
+			list, err := buildCacheFromFile(options, validators)
+			if tc.failed > 0 {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				errs, ok := err.(sourceErrors)
+				if tc.failed == 1 && ok {
+					t.Fatalf("expected the error of the failing source, got: %v", err)
+				}
+				if tc.failed > 1 && !cmp.Equal(tc.failed, len(errs)) {
+					t.Fatalf("\n\n%s\n", cmp.Diff(tc.failed, len(errs)))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(len(tc.entries), list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(len(tc.entries), list.Len()))
+			}
+			for entry, source := range tc.entries {
+				if !list.Contains(entry) {
+					t.Fatalf("expected %s to be loaded", entry)
+				}
+				if !cmp.Equal(source, sourceOf(list, entry)) {
+					t.Fatalf("\n\n%s\n", cmp.Diff(source, sourceOf(list, entry)))
+				}
+			}
+
+			// The validators recorded by the workers are merged, so unchanged sources skip the next reload
+			if !cmp.Equal(len(urls), len(validators)) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(len(urls), len(validators)))
+			}
+		})
+	}
+}
+
+func Test_buildCacheConcurrentStops(t *testing.T) {
+	// The first source fails a strict max_entries right away, while the others are slow
+	var requests []int32
+	var urls []string
+	for i := 0; i < 4; i++ {
+		requests = append(requests, 0)
+		i := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests[i], 1)
+			if i > 0 {
+				time.Sleep(200 * time.Millisecond)
+			}
+			_, _ = w.Write([]byte("a.example\nb.example\n"))
+		}))
+		defer server.Close()
+		urls = append(urls, server.URL)
+	}
+	options := PluginOptions{MatchSubdomains: true, BuildWorkers: 2, MaxEntries: 1, StrictMaxEntries: true}
+	for _, url := range urls {
+		options.Sources = append(options.Sources, DomainSource{Path: url, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList})
+	}
+
+	if _, err := buildCacheFromFile(options, nil); err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+
+	// No worker is free for the last source until a slow one is done, by which time the build has returned
+	time.Sleep(300 * time.Millisecond)
+	if !cmp.Equal(int32(0), atomic.LoadInt32(&requests[3])) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(int32(0), atomic.LoadInt32(&requests[3])))
+	}
+}
+
+func Test_sourceErrors(t *testing.T) {
+	errs := sourceErrors{errors.New("first failed"), errors.New("second failed")}
+	expected := "2 sources failed to load: first failed; second failed"
+	if !cmp.Equal(expected, errs.err().Error()) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(expected, errs.err().Error()))
+	}
+	if errs[:1].err() != errs[0] {
+		t.Fatalf("expected the error of the single failing source, got: %v", errs[:1].err())
+	}
+	if errs[:0].err() != nil {
+		t.Fatalf("expected no error, got: %v", errs[:0].err())
+	}
+}
+
+// BenchmarkBuildCacheSources loads lists from several slow servers, one at a time and concurrently.
+func BenchmarkBuildCacheSources(b *testing.B) {
+	lists := make([]string, 8)
+	for i := range lists {
+		var list strings.Builder
+		for j := 0; j < 10000; j++ {
+			list.WriteString("listed-" + strconv.Itoa(j) + ".source-" + strconv.Itoa(i) + ".example\n")
+		}
+		lists[i] = list.String()
+	}
+	servers, urls := startListServers(lists, 20*time.Millisecond)
+	for _, server := range servers {
+		defer server.Close()
+	}
+
+	for _, workers := range []int{1, 4, 8} {
+		b.Run("workers-"+strconv.Itoa(workers), func(b *testing.B) {
+			options := PluginOptions{MatchSubdomains: true, BuildWorkers: workers}
+			for _, url := range urls {
+				options.Sources = append(options.Sources, DomainSource{Path: url, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList})
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := buildCacheFromFile(options, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
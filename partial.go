@@ -0,0 +1,157 @@
+package warnlist
+
+import (
+	"strings"
+	"time"
+)
+
+// sourceCache holds the entries read from each warnlist source by the last build, keyed by the source as it was
+// configured, so the warnlist can be rebuilt from the sources which are due for a reload without fetching the others
+// again. It is only kept if any source has a reload period of its own, since it holds every entry a second time.
+type sourceCache map[DomainSource]*cachedSource
+
+// cachedSource holds the entries read from a source, and the number of its lines skipped because they couldn't be
+// parsed.
+type cachedSource struct {
+	entries   []listEntry
+	malformed int
+	// paths are the paths the source was expanded to, like the files of a directory, which hold its validators
+	paths []string
+}
+
+// newSourceCache returns an empty sourceCache to record the entries of a build in, if any source has a reload period
+// of its own, or nil otherwise.
+func newSourceCache(options PluginOptions) sourceCache {
+	if len(options.sourceReloadPeriods()) == 0 {
+		return nil
+	}
+	return sourceCache{}
+}
+
+// without returns a copy of the sourceCache without the given sources, and a copy of the validators without theirs,
+// which a build fetching those sources again records new entries and validators in.
+func (c sourceCache) without(sources []DomainSource, validators sourceValidators) (sourceCache, sourceValidators) {
+	cache := make(sourceCache, len(c))
+	for source, cached := range c {
+		cache[source] = cached
+	}
+	kept := make(sourceValidators, len(validators))
+	for path, v := range validators {
+		kept[path] = v
+	}
+
+	for _, source := range sources {
+		if cached, ok := cache[source]; ok {
+			for _, path := range cached.paths {
+				delete(kept, path)
+			}
+		}
+		delete(cache, source)
+	}
+	return cache, kept
+}
+
+// unchanged returns true if none of the sources changed since their entries were recorded, including the files of
+// directory sources.
+func (c sourceCache) unchanged(sources []DomainSource, options PluginOptions, validators sourceValidators) bool {
+	for _, source := range sources {
+		cached, ok := c[source]
+		if !ok {
+			return false
+		}
+		expanded, err := expandSources([]DomainSource{source}, options)
+		if err != nil || len(expanded) != len(cached.paths) {
+			return false
+		}
+		for i, e := range expanded {
+			if e.Path != cached.paths[i] || !sourceUnchanged(e, options, validators[e.Path]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sourceReloadPeriods returns the warnlist sources with a reload period of their own, grouped by their period, so
+// sources sharing a period are reloaded together.
+func (o PluginOptions) sourceReloadPeriods() map[time.Duration][]DomainSource {
+	periods := make(map[time.Duration][]DomainSource)
+	for _, source := range o.Sources {
+		if source.ReloadPeriod > 0 {
+			periods[source.ReloadPeriod] = append(periods[source.ReloadPeriod], source)
+		}
+	}
+	return periods
+}
+
+// reloadSources rebuilds the warnlist from the given sources, which are fetched again, and the entries the previous
+// build recorded for all other sources, so each source is reloaded on its own schedule. The result is the same as a
+// full build would be if the other sources hadn't changed, since the entries are added in the order of the sources.
+// The allowlist and the protected domains are kept. Like for Reload, the rebuilt warnlist is only swapped in if it
+// was built successfully, and reloads run one at a time, so the sources stay consistent with each other.
+func (wp *WarnlistPlugin) reloadSources(sources []DomainSource) error {
+	wp.reloadMu.Lock()
+	defer wp.reloadMu.Unlock()
+
+	if wp.sources == nil || wp.validators == nil {
+		// No entries were recorded yet, like for a warnlist loaded from a snapshot, so every source is fetched
+		return wp.reload()
+	}
+
+	paths := make([]string, 0, len(sources))
+	for _, source := range sources {
+		paths = append(paths, redactURL(source.Path))
+	}
+	// The sources found changed are kept, so the rebuild doesn't fetch them a second time
+	options := wp.Options
+	options.prefetched = newPrefetchedSources()
+	defer options.prefetched.close()
+	options.counts = newListCounts()
+
+	if wp.sources.unchanged(sources, options, wp.validators) {
+		log.Infof("warnlist sources %s are unchanged, skipping reload", strings.Join(paths, ", "))
+
+		wp.mu.Lock()
+		defer wp.mu.Unlock()
+		wp.lastReloadTime = time.Now()
+		wp.lastReloadErr = nil
+		if wp.serverName != "" {
+			reloadsSkipped.WithLabelValues(wp.serverName).Inc()
+			lastReloadTimestamp.WithLabelValues(wp.serverName).Set(float64(wp.lastReloadTime.Unix()))
+		}
+		return nil
+	}
+
+	cache, validators := wp.sources.without(sources, wp.validators)
+	change := wp.changeToCount()
+	warnlist, err := buildWarnlistCache(options, validators, change, cache)
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	if err != nil {
+		log.Warningf("error reloading warnlist sources %s, keeping the previously loaded warnlist: %v", strings.Join(paths, ", "), err)
+		wp.lastReloadErr = err
+
+		if wp.serverName != "" {
+			countReloadFailure(wp.serverName)
+		}
+		return err
+	}
+
+	wp.warnlist = warnlist
+	wp.validators = validators
+	wp.sources = cache
+	wp.counts = wp.counts.merge(options.counts)
+	// The changes of the delta feed are dropped along with the previous warnlist, so they are fetched again. The full
+	// sync is kept, since the other sources weren't fetched, so it still corrects their drift when it is due.
+	wp.deltaValidator = httpValidator{}
+	wp.lastReloadTime = time.Now()
+	wp.lastReloadErr = nil
+	wp.notifyChange(change, wp.serverName)
+	wp.loaded = true
+	if wp.serverName != "" {
+		warnlistSize.WithLabelValues(wp.serverName).Set(float64(wp.warnlist.Len()))
+		lastReloadTimestamp.WithLabelValues(wp.serverName).Set(float64(wp.lastReloadTime.Unix()))
+		wp.counts.set(wp.serverName)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReloadSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fast := filepath.Join(dir, "internal.txt")
+	if err := ioutil.WriteFile(fast, []byte("internal.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var slowRequests int32
+	slow := "public.example\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowRequests, 1)
+		_, _ = w.Write([]byte(slow))
+	}))
+	defer server.Close()
+
+	fastSource := DomainSource{Path: fast, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList, Name: "internal", ReloadPeriod: time.Minute}
+	options := PluginOptions{
+		Sources: []DomainSource{
+			fastSource,
+			{Path: server.URL, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList, Name: "public"},
+		},
+		MatchSubdomains: true,
+	}
+	caches, err := buildCachesWithin(options, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := newWarnlistPlugin(options, caches, time.Now())
+
+	// An unchanged source is skipped, keeping the loaded warnlist
+	before, _ := wp.lists()
+	if err := wp.reloadSources([]DomainSource{fastSource}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if current, _ := wp.lists(); current != before {
+		t.Fatalf("expected the warnlist to be kept for an unchanged source")
+	}
+
+	// Reloading the fast source picks up its changes, and keeps the entries of the slow one without fetching it
+	if err := ioutil.WriteFile(fast, []byte("internal.example\nnew-internal.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	slow = "public.example\nnew-public.example\n"
+	if err := wp.reloadSources([]DomainSource{fastSource}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	warnlist, _ := wp.lists()
+	for _, name := range []string{"internal.example.", "new-internal.example.", "public.example."} {
+		if !warnlist.Contains(name) {
+			t.Fatalf("expected %s to be matched", name)
+		}
+	}
+	if warnlist.Contains("new-public.example.") {
+		t.Fatalf("expected the slow source not to be reloaded")
+	}
+	if !cmp.Equal(int32(1), atomic.LoadInt32(&slowRequests)) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(int32(1), atomic.LoadInt32(&slowRequests)))
+	}
+	// The entries replayed from the slow source keep its name
+	if !cmp.Equal("public", sourceOf(warnlist, "public.example.")) {
+		t.Fatalf("\n\n%s\n", cmp.Diff("public", sourceOf(warnlist, "public.example.")))
+	}
+
+	// A failing partial reload keeps the loaded warnlist
+	if err := os.Remove(fast); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.reloadSources([]DomainSource{fastSource}); err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+	if current, _ := wp.lists(); current != warnlist {
+		t.Fatalf("expected the warnlist to be kept after a failed reload")
+	}
+
+	// A full reload fetches every source
+	if err := ioutil.WriteFile(fast, []byte("internal.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	warnlist, _ = wp.lists()
+	if !warnlist.Contains("new-public.example.") || warnlist.Contains("new-internal.example.") {
+		t.Fatalf("expected every source to be reloaded")
+	}
+
+	// The entries recorded by the full reload are replayed by the next partial one
+	if err := ioutil.WriteFile(fast, []byte("other-internal.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(fast, time.Now().Add(time.Minute), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.reloadSources([]DomainSource{fastSource}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	warnlist, _ = wp.lists()
+	if !warnlist.Contains("other-internal.example.") || !warnlist.Contains("new-public.example.") || warnlist.Contains("internal.example.") {
+		t.Fatalf("expected the fast source to be reloaded on top of the entries of the full reload")
+	}
+	if !cmp.Equal(int32(2), atomic.LoadInt32(&slowRequests)) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(int32(2), atomic.LoadInt32(&slowRequests)))
+	}
+}
+
+func TestReloadHookStaggered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fast := filepath.Join(dir, "internal.txt")
+	if err := ioutil.WriteFile(fast, []byte("internal.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var slowRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowRequests, 1)
+		_, _ = w.Write([]byte("public.example\n"))
+	}))
+	defer server.Close()
+
+	options := PluginOptions{
+		Sources: []DomainSource{
+			{Path: fast, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList, ReloadPeriod: 10 * time.Millisecond},
+			{Path: server.URL, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList},
+		},
+		MatchSubdomains: true,
+	}
+	caches, err := buildCachesWithin(options, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := newWarnlistPlugin(options, caches, time.Now())
+
+	// Only the fast source has a reload period, so the slow one is never fetched again
+	wp.startReloadHook(0)
+	defer wp.stopReloadHook()
+	if err := ioutil.WriteFile(fast, []byte("internal.example\nnew-internal.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(fast, time.Now().Add(time.Minute), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if warnlist, _ := wp.lists(); warnlist.Contains("new-internal.example.") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the fast source to be reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if warnlist, _ := wp.lists(); !warnlist.Contains("public.example.") {
+		t.Fatalf("expected the entries of the slow source to be kept")
+	}
+	if !cmp.Equal(int32(1), atomic.LoadInt32(&slowRequests)) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(int32(1), atomic.LoadInt32(&slowRequests)))
+	}
+}
+
+func TestReloadSourcesDelta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "internal.txt")
+	if err := ioutil.WriteFile(path, []byte("internal.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	etag := `"1"`
+	deltaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte("+added.example\n"))
+	}))
+	defer deltaServer.Close()
+
+	source := DomainSource{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList, ReloadPeriod: time.Minute}
+	options := PluginOptions{
+		Sources:         []DomainSource{source},
+		MatchSubdomains: true,
+		DeltaURL:        deltaServer.URL,
+		FullSyncPeriod:  time.Hour,
+	}
+	caches, err := buildCachesWithin(options, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := newWarnlistPlugin(options, caches, time.Now())
+
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if warnlist, _ := wp.lists(); !warnlist.Contains("added.example.") {
+		t.Fatalf("expected the delta to be applied")
+	}
+
+	// Reloading the source drops the changes of the delta, which the next reload applies to the rebuilt warnlist
+	if err := ioutil.WriteFile(path, []byte("internal.example\nnew-internal.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.reloadSources([]DomainSource{source}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	warnlist, _ := wp.lists()
+	if !warnlist.Contains("new-internal.example.") || !warnlist.Contains("added.example.") {
+		t.Fatalf("expected the delta to be applied on top of the reloaded source")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/coredns/coredns/request"
@@ -15,66 +16,277 @@ import (
 	"github.com/miekg/dns"
 )
 
+const (
+	// OnErrorPassthrough passes queries to the next plugin if checking them fails
+	OnErrorPassthrough = "passthrough"
+	// OnErrorRefuse answers queries with SERVFAIL if checking them fails
+	OnErrorRefuse = "refuse"
+)
+
+// The precedences between a name matching both the allowlist and the warnlist.
+const (
+	// PrecedenceAllow never reports a name matching the allowlist, even if a more specific entry of the warnlist
+	// matches it
+	PrecedenceAllow = "allow"
+	// PrecedenceBlock reports a name matching the warnlist, even if a more specific entry of the allowlist matches it
+	PrecedenceBlock = "block"
+)
+
 // Define log to be a logger with the plugin name in it. This way we can just use log.Info and
 // friends to log.
 var log = clog.NewWithPlugin("warnlist")
 
 // WarnlistPlugin is a plugin which counts requests to warnlisted domains
 type WarnlistPlugin struct {
-	Next           plugin.Handler
+	// logged counts the matches eligible for logging, to sample them with log_sample. It is accessed atomically, so
+	// it comes first to be 64-bit aligned on 32-bit platforms.
+	logged uint64
+
+	Next    plugin.Handler
+	Options PluginOptions
+
+	// cancel stops the reload hook, if a reload period is configured
+	cancel context.CancelFunc
+
+	// watcher reloads the lists when their files change, if watch is enabled
+	watcher *fileWatcher
+
+	// validators of the sources of the loaded caches, and the entries of the warnlist sources if any of them has a
+	// reload period of its own, only used by reloads
+	validators sourceValidators
+	sources    sourceCache
+
+	// lastFullSync is the time the warnlist was last built from all sources, and deltaValidator holds the validators of
+	// the delta feed applied to it since, both only used by reloads
+	lastFullSync   time.Time
+	deltaValidator httpValidator
+
+	// excludes holds the domains carved out of matching by exclude directives
+	excludes Warnlist
+
+	// alerts counts the matches of each client, if alert_threshold is configured
+	alerts *clientAlerts
+
+	// hits counts the queries matching each list entry, if hit_counts is configured
+	hits *entryHits
+
+	// staleLogged is set once passing queries through because of max_stale has been logged. It is accessed atomically.
+	staleLogged uint32
+
+	// reloadMu serializes rebuilds, which can be triggered by both the reload ticker and the reload signal
+	reloadMu sync.Mutex
+
+	// mu guards the fields below, which are swapped by reloads while queries are being served
+	mu             sync.RWMutex
 	warnlist       Warnlist
+	allowlist      Warnlist
+	protected      *TypoMatcher
+	ipBlocklist    *IPBlocklist
+	reportList     Warnlist
 	lastReloadTime time.Time
-	Options        PluginOptions
 	serverName     string
-	quit           chan bool
+	// counts holds the sizes of the loaded lists, whose gauges are set once the server name is known
+	counts *listCounts
+
+	// lastReloadErr is the error of the last reload, or nil if it succeeded
+	lastReloadErr error
+
+	// loaded is set once a warnlist has been built successfully, and reported by Ready
+	loaded bool
 }
 
 // ServeDNS implements the plugin.Handler interface. This method gets called when warnlist is used
 // in a Server.
 func (wp *WarnlistPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	start := time.Now()
+	pw, rcode, err := wp.check(ctx, w, r)
+	// Only the check is timed, so the overhead of the plugin can be told apart from the time spent resolving
+	requestDuration.WithLabelValues(metrics.WithServer(ctx)).Observe(time.Since(start).Seconds())
+	if pw == nil {
+		// The query was answered, or refused after a failed check
+		return rcode, err
+	}
+
+	// Call next plugin (if any).
+	return plugin.NextOrFailure(wp.Name(), wp.Next, ctx, pw, r)
+}
+
+// check matches the query against the lists, and answers it if it is blocked. Otherwise it returns the writer to
+// pass the query to the next plugin with. A panic while checking is recovered, and handled according to on_error.
+func (wp *WarnlistPlugin) check(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (pw *ResponsePrinter, rcode int, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			name := ""
+			if len(r.Question) > 0 {
+				name = r.Question[0].Name
+			}
+			log.Errorf("recovered from panic while checking query %q: %v", name, rec)
+			if wp.Options.OnError == OnErrorRefuse {
+				pw, rcode, err = nil, dns.RcodeServerFailure, nil
+				return
+			}
+			// Fail open, so a bug in the plugin doesn't break resolution
+			pw, rcode, err = NewResponsePrinter(w), 0, nil
+		}
+	}()
 
 	req := request.Request{W: w, Req: r}
 
-	if wp.warnlist != nil {
-		// See if the requested domain is in the cache
-		retrievalStart := time.Now()
-		hit := wp.warnlist.Contains(req.Name())
+	// Update the server name from context if it has changed
+	wp.updateServerName(metrics.WithServer(ctx))
+
+	// Match on the canonical form, so it matches list entries in any case or form
+	name := wp.Options.matchName(canonicalDomain(req.Name()))
+
+	// Take a snapshot of the caches, so a concurrent reload can't swap them mid-query
+	warnlist, allowlist := wp.lists()
+
+	// Wrap the response when it returns from the next plugin
+	pw = NewResponsePrinter(w)
+
+	// See if the requested domain is in the cache
+	retrievalStart := time.Now()
+	match := wp.match(warnlist, allowlist, name, req.QType())
+	retrievalDuration := time.Since(retrievalStart)
+
+	if match.allowed {
+		// Excluded domains are never reported, and neither are allowlisted ones unless the warnlist takes precedence
+		return pw, 0, nil
+	}
+
+	// Matches of the report list are only reported, whatever the warnlist does with the query
+	wp.checkReportList(ctx, req, name)
+
+	if warnlist != nil {
+		entry, mechanism, hit := match.entry, match.mechanism, match.hit
+		kind := matchKind(mechanism, entry, match.key)
 
 		// Record the duration for the query
-		warnlistCheckDuration.WithLabelValues(metrics.WithServer(ctx)).Observe(time.Since(retrievalStart).Seconds())
+		warnlistCheckDuration.WithLabelValues(metrics.WithServer(ctx)).Observe(retrievalDuration.Seconds())
 
 		if hit {
 			// Warn and increment the counter for the hit
-			warnlistCount.WithLabelValues(metrics.WithServer(ctx), req.IP(), req.Name()).Inc()
-			log.Warning("host ", req.IP(), " requested warnlisted domain: ", req.Name())
+			warnlistCount.WithLabelValues(metrics.WithServer(ctx), wp.clientIP(req), req.Name()).Inc()
+			mechanismMatches.WithLabelValues(metrics.WithServer(ctx), mechanism).Inc()
+			wp.logMatch(req, warnlist, entry, mechanism, "")
+			wp.alerts.record(wp.clientIP(req), time.Now())
+			wp.hits.record(entry)
+			if wp.audits(kind) {
+				auditMatches.WithLabelValues(metrics.WithServer(ctx)).Inc()
+			}
 		}
 
 		// Update the current warnlist size metric
-		warnlistSize.WithLabelValues(metrics.WithServer(ctx)).Set(float64(wp.warnlist.Len()))
+		warnlistSize.WithLabelValues(metrics.WithServer(ctx)).Set(float64(warnlist.Len()))
+
+		if hit && wp.blocks(req.QType(), kind) && !wp.stale(metrics.WithServer(ctx)) {
+			// Answer the query ourselves instead of letting it resolve
+			blockedCount.WithLabelValues(metrics.WithServer(ctx), req.Type(), sourceOf(warnlist, entry)).Inc()
+			rcode, err := wp.writeBlockResponse(w, r, entry, kind)
+			return nil, rcode, err
+		}
+
+		if !hit && wp.allowed(allowlist, name) {
+			// Allowlisted domains the warnlist doesn't match aren't checked any further
+			return pw, 0, nil
+		}
+
+		if !hit {
+			wp.checkTyposquat(ctx, req, name)
+		}
+
+		blocklist := wp.answerBlocklist()
+		if !hit && (wp.Options.CheckCNAME || blocklist != nil) {
+			// Check the CNAME targets and addresses in the response of the next plugin before it is written
+			pw.inspect = func(res *dns.Msg) *dns.Msg {
+				if wp.Options.CheckCNAME {
+					if checked := wp.checkCNAMEs(ctx, req, warnlist, allowlist, res); checked != res {
+						return checked
+					}
+				}
+				if blocklist != nil {
+					return wp.checkAnswerIPs(ctx, req, blocklist, res)
+				}
+				return res
+			}
+		}
 	} else {
 		log.Warning("no warnlist has been loaded")
 		// Update the current warnlist size metric to 0
 		warnlistSize.WithLabelValues(metrics.WithServer(ctx)).Set(float64(0))
 	}
 
-	// Update the server name from context if it has changed
-	if metrics.WithServer(ctx) != wp.serverName {
-		wp.serverName = metrics.WithServer(ctx)
+	return pw, 0, nil
+}
+
+// Name implements the Handler interface.
+func (wp *WarnlistPlugin) Name() string { return "warnlist" }
+
+// matchedEntries returns every warnlist entry matching the name if verbose_match is enabled, so overlapping entries
+// of merged feeds can be told apart. Otherwise it returns nil, keeping the query path to a single lookup.
+func (wp *WarnlistPlugin) matchedEntries(warnlist Warnlist, name string) []string {
+	if !wp.Options.VerboseMatch {
+		return nil
 	}
+	return warnlist.MatchAll(name)
+}
 
-	// Wrap the response when it returns from the next plugin
-	pw := NewResponsePrinter(w)
+// checkTyposquat reports a query for a name resembling a protected domain. Such queries are only reported, since
+// legitimate names can be close to a protected domain too.
+func (wp *WarnlistPlugin) checkTyposquat(ctx context.Context, req request.Request, name string) {
+	wp.mu.RLock()
+	protected := wp.protected
+	wp.mu.RUnlock()
+	if protected == nil {
+		return
+	}
 
-	// Call next plugin (if any).
-	return plugin.NextOrFailure(wp.Name(), wp.Next, ctx, pw, r)
+	if domain, ok := protected.Match(name); ok {
+		typosquatMatches.WithLabelValues(metrics.WithServer(ctx), domain).Inc()
+		wp.logTyposquat(req, domain)
+	}
 }
 
-// Name implements the Handler interface.
-func (wp WarnlistPlugin) Name() string { return "warnlist" }
+// answerBlocklist returns the currently loaded IP blocklist, or nil if none is configured.
+func (wp *WarnlistPlugin) answerBlocklist() *IPBlocklist {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	return wp.ipBlocklist
+}
+
+// lists returns the currently loaded warnlist and allowlist.
+func (wp *WarnlistPlugin) lists() (Warnlist, Warnlist) {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	return wp.warnlist, wp.allowlist
+}
+
+// updateServerName remembers the name of the server handling queries, so reloads can label their metrics.
+func (wp *WarnlistPlugin) updateServerName(serverName string) {
+	wp.mu.RLock()
+	changed := serverName != wp.serverName
+	wp.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	wp.mu.Lock()
+	wp.serverName = serverName
+	lastReloadTime := wp.lastReloadTime
+	counts := wp.counts
+	wp.mu.Unlock()
+
+	// The initial build happened before the server name was known
+	lastReloadTimestamp.WithLabelValues(serverName).Set(float64(lastReloadTime.Unix()))
+	counts.set(serverName)
+}
 
 // ResponsePrinter wraps a dns.ResponseWriter and will let the plugin inspect the response.
 type ResponsePrinter struct {
 	dns.ResponseWriter
+
+	// inspect, if set, is given the response and returns the message to write instead.
+	inspect func(*dns.Msg) *dns.Msg
 }
 
 // NewResponsePrinter returns ResponseWriter.
@@ -84,8 +296,47 @@ func NewResponsePrinter(w dns.ResponseWriter) *ResponsePrinter {
 
 // WriteMsg calls the underlying ResponseWriter's WriteMsg method and handles our future response logic.
 func (r *ResponsePrinter) WriteMsg(res *dns.Msg) error {
+	if r.inspect != nil {
+		res = r.inspect(res)
+	}
 	return r.ResponseWriter.WriteMsg(res)
 }
 
+// checkCNAMEs reports a response whose CNAME chain leads to a warnlisted domain, and replaces it with the block
+// response if one is configured.
+func (wp *WarnlistPlugin) checkCNAMEs(ctx context.Context, req request.Request, warnlist Warnlist, allowlist Warnlist, res *dns.Msg) *dns.Msg {
+	for _, rr := range res.Answer {
+		cname, ok := rr.(*dns.CNAME)
+		if !ok {
+			continue
+		}
+
+		target := wp.Options.matchName(canonicalDomain(cname.Target))
+		match := wp.match(warnlist, allowlist, target, req.QType())
+		if !match.hit {
+			continue
+		}
+		entry, mechanism := match.entry, match.mechanism
+		kind := matchKind(mechanism, entry, match.key)
+
+		// Warn and increment the counter for the hit
+		warnlistCount.WithLabelValues(metrics.WithServer(ctx), wp.clientIP(req), target).Inc()
+		mechanismMatches.WithLabelValues(metrics.WithServer(ctx), mechanism).Inc()
+		wp.logMatch(req, warnlist, entry, mechanism, target)
+		wp.alerts.record(wp.clientIP(req), time.Now())
+		wp.hits.record(entry)
+		if wp.audits(kind) {
+			auditMatches.WithLabelValues(metrics.WithServer(ctx)).Inc()
+		}
+
+		if wp.blocks(req.QType(), kind) && !wp.stale(metrics.WithServer(ctx)) {
+			blockedCount.WithLabelValues(metrics.WithServer(ctx), req.Type(), sourceOf(warnlist, entry)).Inc()
+			return wp.blockResponse(req.Req, entry, kind)
+		}
+		return res
+	}
+	return res
+}
+
 // Make out a reference to os.Stdout so we can easily overwrite it for testing.
 var out io.Writer = os.Stdout // nolint: unused
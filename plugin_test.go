@@ -3,10 +3,28 @@ package warnlist
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"io/ioutil"
+	golog "log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metadata"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 
 	"github.com/miekg/dns"
 )
@@ -43,3 +61,2038 @@ func TestWarnlist(t *testing.T) {
 	// 	t.Errorf("Failed to print '%s', got %s", "example", a)
 	// }
 }
+
+func TestAllowlist(t *testing.T) {
+	wl := NewRadixWarnlist()
+	wl.Add("evil.com.")
+	wl.Close()
+
+	al := NewRadixWarnlist()
+	al.Add("cdn.evil.com.")
+	al.Close()
+
+	m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, allowlist: al}
+
+	var testCases = []struct {
+		name   string
+		domain string
+		hits   float64
+	}{
+		{
+			name:   "case 0: a warnlisted domain is counted",
+			domain: "evil.com.",
+			hits:   1,
+		},
+		{
+			name:   "case 1: an allowlisted domain is not counted",
+			domain: "cdn.evil.com.",
+			hits:   0,
+		},
+		{
+			name:   "case 2: a subdomain of an allowlisted domain is not counted",
+			domain: "static.cdn.evil.com.",
+			hits:   0,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			counter := warnlistCount.WithLabelValues("", "10.240.0.1", tc.domain)
+			before := testutil.ToFloat64(counter)
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+
+			hits := testutil.ToFloat64(counter) - before
+			if !cmp.Equal(tc.hits, hits) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.hits, hits))
+			}
+		})
+	}
+}
+
+func TestExclude(t *testing.T) {
+	wl := NewTrieWarnlist()
+	wl.Add("*.example.")
+	wl.Close()
+
+	m := WarnlistPlugin{
+		Next:     test.ErrorHandler(),
+		warnlist: wl,
+		excludes: newExcludeList([]string{"good.example.", "safe.example."}),
+		Options:  PluginOptions{Response: ResponseNXDomain},
+	}
+
+	var testCases = []struct {
+		name     string
+		domain   string
+		msgRcode int
+		hits     float64
+	}{
+		{
+			name:     "case 0: a name in the blocked subtree is blocked",
+			domain:   "bad.example.",
+			msgRcode: dns.RcodeNameError,
+			hits:     1,
+		},
+		{
+			name:     "case 1: an excluded name is passed through",
+			domain:   "good.example.",
+			msgRcode: dns.RcodeServerFailure,
+		},
+		{
+			name:     "case 2: a subdomain of an excluded name is passed through",
+			domain:   "www.safe.example.",
+			msgRcode: dns.RcodeServerFailure,
+		},
+		{
+			name:     "case 3: a name sharing a suffix with an excluded name is blocked",
+			domain:   "notgood.example.",
+			msgRcode: dns.RcodeNameError,
+			hits:     1,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			counter := warnlistCount.WithLabelValues("", "10.240.0.1", tc.domain)
+			before := testutil.ToFloat64(counter)
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+
+			if !cmp.Equal(tc.msgRcode, rec.Msg.Rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.msgRcode, rec.Msg.Rcode))
+			}
+			hits := testutil.ToFloat64(counter) - before
+			if !cmp.Equal(tc.hits, hits) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.hits, hits))
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	wl := NewTrieWarnlist()
+	wl.Add("evil.com.")
+	wl.Add("bad.cdn.good.com.")
+	wl.Add("*.wild.example.")
+	wl.Close()
+
+	al := NewTrieWarnlist()
+	al.Add("cdn.evil.com.")
+	al.Add("good.com.")
+	al.Add("www.wild.example.")
+	al.Close()
+
+	var testCases = []struct {
+		name       string
+		precedence string
+		domain     string
+		rcode      int
+	}{
+		{
+			name:       "case 0: with precedence allow, an allowlist entry wins over a less specific warnlist entry",
+			precedence: PrecedenceAllow,
+			domain:     "static.cdn.evil.com.",
+			rcode:      dns.RcodeServerFailure,
+		},
+		{
+			name:       "case 1: with precedence allow, an allowlist entry wins over a more specific warnlist entry",
+			precedence: PrecedenceAllow,
+			domain:     "bad.cdn.good.com.",
+			rcode:      dns.RcodeServerFailure,
+		},
+		{
+			name:       "case 2: with precedence allow, an allowlist entry wins over a wildcard entry",
+			precedence: PrecedenceAllow,
+			domain:     "www.wild.example.",
+			rcode:      dns.RcodeServerFailure,
+		},
+		{
+			name:       "case 3: with precedence block, a warnlist entry wins over a more specific allowlist entry",
+			precedence: PrecedenceBlock,
+			domain:     "static.cdn.evil.com.",
+			rcode:      dns.RcodeNameError,
+		},
+		{
+			name:       "case 4: with precedence block, a warnlist entry wins over a less specific allowlist entry",
+			precedence: PrecedenceBlock,
+			domain:     "bad.cdn.good.com.",
+			rcode:      dns.RcodeNameError,
+		},
+		{
+			name:       "case 5: with precedence block, a wildcard entry wins over an allowlist entry",
+			precedence: PrecedenceBlock,
+			domain:     "www.wild.example.",
+			rcode:      dns.RcodeNameError,
+		},
+		{
+			name:       "case 6: with precedence block, an allowlisted domain the warnlist doesn't match is passed through",
+			precedence: PrecedenceBlock,
+			domain:     "www.good.com.",
+			rcode:      dns.RcodeServerFailure,
+		},
+		{
+			name:       "case 7: with precedence block, an excluded domain is still passed through",
+			precedence: PrecedenceBlock,
+			domain:     "safe.evil.com.",
+			rcode:      dns.RcodeServerFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{
+				Next:      test.ErrorHandler(),
+				warnlist:  wl,
+				allowlist: al,
+				excludes:  newExcludeList([]string{"safe.evil.com."}),
+				Options:   PluginOptions{Response: ResponseNXDomain, Precedence: tc.precedence},
+			}
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+		})
+	}
+}
+
+// TestQNAMEMinimization checks the queries of a resolver using QNAME minimization (RFC 9156), which walks down from
+// the root a label at a time, so the plugin sees the intermediate names of a blocked name before the full one.
+func TestQNAMEMinimization(t *testing.T) {
+	var testCases = []struct {
+		name            string
+		matchSubdomains bool
+		entries         []string
+		domain          string
+		qtype           uint16
+		rcode           int
+	}{
+		{
+			name:            "case 0: an intermediate name above a blocked domain is passed through",
+			matchSubdomains: true,
+			entries:         []string{"evil.example."},
+			domain:          "example.",
+			qtype:           dns.TypeNS,
+			rcode:           dns.RcodeServerFailure,
+		},
+		{
+			name:            "case 1: the minimized query for the blocked domain itself is blocked",
+			matchSubdomains: true,
+			entries:         []string{"evil.example."},
+			domain:          "evil.example.",
+			qtype:           dns.TypeNS,
+			rcode:           dns.RcodeNameError,
+		},
+		{
+			name:            "case 2: an intermediate name strictly under a blocked domain is blocked",
+			matchSubdomains: true,
+			entries:         []string{"evil.example."},
+			domain:          "c.evil.example.",
+			qtype:           dns.TypeA,
+			rcode:           dns.RcodeNameError,
+		},
+		{
+			name:            "case 3: the full name under a blocked domain is blocked, whatever its leaf",
+			matchSubdomains: true,
+			entries:         []string{"evil.example."},
+			domain:          "a.b.c.evil.example.",
+			qtype:           dns.TypeA,
+			rcode:           dns.RcodeNameError,
+		},
+		{
+			name:            "case 4: a name sharing the suffix but not the label boundary is passed through",
+			matchSubdomains: true,
+			entries:         []string{"evil.example."},
+			domain:          "notevil.example.",
+			qtype:           dns.TypeA,
+			rcode:           dns.RcodeServerFailure,
+		},
+		{
+			name:    "case 5: without matching subdomains, an intermediate name under an exact entry is passed through",
+			entries: []string{"evil.example."},
+			domain:  "c.evil.example.",
+			qtype:   dns.TypeA,
+			rcode:   dns.RcodeServerFailure,
+		},
+		{
+			name:    "case 6: without matching subdomains, an intermediate name under a wildcard entry is blocked",
+			entries: []string{"*.evil.example."},
+			domain:  "c.evil.example.",
+			qtype:   dns.TypeNS,
+			rcode:   dns.RcodeNameError,
+		},
+		{
+			name:    "case 7: without matching subdomains, an intermediate name above a listed leaf is passed through",
+			entries: []string{"a.b.evil.example."},
+			domain:  "b.evil.example.",
+			qtype:   dns.TypeA,
+			rcode:   dns.RcodeServerFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{Response: ResponseNXDomain, MatchSubdomains: tc.matchSubdomains}
+			wl := newWarnlist(options)
+			for _, entry := range tc.entries {
+				wl.Add(entry)
+			}
+			if err := wl.Close(); err != nil {
+				t.Fatal(err)
+			}
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: options}
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, tc.qtype)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+		})
+	}
+}
+
+func TestStripWWW(t *testing.T) {
+	var testCases = []struct {
+		name            string
+		stripWWW        bool
+		matchSubdomains bool
+		entries         []string
+		excludes        []string
+		domain          string
+		rcode           int
+	}{
+		{
+			name:     "case 0: a www query matches an entry without www",
+			stripWWW: true,
+			entries:  []string{"bad.example."},
+			domain:   "www.bad.example.",
+			rcode:    dns.RcodeNameError,
+		},
+		{
+			name:     "case 1: a query without www matches a www entry",
+			stripWWW: true,
+			entries:  []string{"www.bad.example."},
+			domain:   "bad.example.",
+			rcode:    dns.RcodeNameError,
+		},
+		{
+			name:     "case 2: a www query matches a www entry",
+			stripWWW: true,
+			entries:  []string{"www.bad.example."},
+			domain:   "WWW.Bad.Example.",
+			rcode:    dns.RcodeNameError,
+		},
+		{
+			name:    "case 3: without strip_www, a www query doesn't match an entry without www",
+			entries: []string{"bad.example."},
+			domain:  "www.bad.example.",
+			rcode:   dns.RcodeServerFailure,
+		},
+		{
+			name:     "case 4: other subdomains still don't match without match_subdomains",
+			stripWWW: true,
+			entries:  []string{"www.bad.example."},
+			domain:   "login.bad.example.",
+			rcode:    dns.RcodeServerFailure,
+		},
+		{
+			name:            "case 5: with match_subdomains, a www entry matches every subdomain of its parent",
+			stripWWW:        true,
+			matchSubdomains: true,
+			entries:         []string{"www.bad.example."},
+			domain:          "login.bad.example.",
+			rcode:           dns.RcodeNameError,
+		},
+		{
+			name:            "case 6: a www entry of a top-level domain isn't widened to the whole domain",
+			stripWWW:        true,
+			matchSubdomains: true,
+			entries:         []string{"www.example."},
+			domain:          "bad.example.",
+			rcode:           dns.RcodeServerFailure,
+		},
+		{
+			name:     "case 7: a www exclude carves out the name without www",
+			stripWWW: true,
+			entries:  []string{"bad.example."},
+			excludes: []string{"www.bad.example."},
+			domain:   "bad.example.",
+			rcode:    dns.RcodeServerFailure,
+		},
+		{
+			name:     "case 8: a wildcard www entry matches the name without www",
+			stripWWW: true,
+			entries:  []string{"*.www.bad.example."},
+			domain:   "bad.example.",
+			rcode:    dns.RcodeNameError,
+		},
+		{
+			name:     "case 9: a wildcard www entry matches a www query",
+			stripWWW: true,
+			entries:  []string{"*.www.bad.example."},
+			domain:   "www.bad.example.",
+			rcode:    dns.RcodeNameError,
+		},
+		{
+			name:     "case 10: a wildcard www entry of a top-level domain isn't widened to the whole domain",
+			stripWWW: true,
+			entries:  []string{"*.www.example."},
+			domain:   "bad.example.",
+			rcode:    dns.RcodeServerFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{Response: ResponseNXDomain, MatchSubdomains: tc.matchSubdomains, StripWWW: tc.stripWWW, Excludes: tc.excludes}
+			b := newListBuilder(options)
+			for _, entry := range tc.entries {
+				b.add(listEntry{domain: entry}, "")
+			}
+			wl, err := b.close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := newWarnlistPlugin(options, startupCaches{warnlist: wl, loaded: true}, time.Now())
+			m.Next = test.ErrorHandler()
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+		})
+	}
+}
+
+func TestBlockResponse(t *testing.T) {
+	wl := NewWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	var testCases = []struct {
+		name     string
+		response string
+		audit    bool
+		domain   string
+		rcode    int
+		msgRcode int
+		blocked  float64
+		audited  float64
+	}{
+		{
+			name:     "case 0: passthrough calls the next plugin",
+			response: ResponsePassthrough,
+			domain:   "example.org.",
+			rcode:    dns.RcodeServerFailure,
+			msgRcode: dns.RcodeServerFailure,
+		},
+		{
+			name:     "case 1: nxdomain answers with name error",
+			response: ResponseNXDomain,
+			domain:   "example.org.",
+			rcode:    dns.RcodeNameError,
+			msgRcode: dns.RcodeNameError,
+			blocked:  1,
+		},
+		{
+			name:     "case 2: refused answers with refused",
+			response: ResponseRefused,
+			domain:   "example.org.",
+			rcode:    dns.RcodeSuccess,
+			msgRcode: dns.RcodeRefused,
+			blocked:  1,
+		},
+		{
+			name:     "case 3: a domain not in the list calls the next plugin",
+			response: ResponseNXDomain,
+			domain:   "this-is-ok.org.",
+			rcode:    dns.RcodeServerFailure,
+			msgRcode: dns.RcodeServerFailure,
+		},
+		{
+			name:     "case 4: audit mode calls the next plugin instead of blocking",
+			response: ResponseNXDomain,
+			audit:    true,
+			domain:   "example.org.",
+			rcode:    dns.RcodeServerFailure,
+			msgRcode: dns.RcodeServerFailure,
+			audited:  1,
+		},
+		{
+			name:     "case 5: audit mode doesn't count domains not in the list",
+			response: ResponseRefused,
+			audit:    true,
+			domain:   "this-is-ok.org.",
+			rcode:    dns.RcodeServerFailure,
+			msgRcode: dns.RcodeServerFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: PluginOptions{Response: tc.response, Audit: tc.audit}}
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			counter := blockedCount.WithLabelValues("", "A", "")
+			before := testutil.ToFloat64(counter)
+			auditCounter := auditMatches.WithLabelValues("")
+			auditBefore := testutil.ToFloat64(auditCounter)
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+			if !cmp.Equal(tc.msgRcode, rec.Msg.Rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.msgRcode, rec.Msg.Rcode))
+			}
+			blocked := testutil.ToFloat64(counter) - before
+			if !cmp.Equal(tc.blocked, blocked) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.blocked, blocked))
+			}
+			audited := testutil.ToFloat64(auditCounter) - auditBefore
+			if !cmp.Equal(tc.audited, audited) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.audited, audited))
+			}
+		})
+	}
+}
+
+func TestSinkholeResponse(t *testing.T) {
+	wl := NewWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	options := PluginOptions{
+		Response:     ResponseSinkhole,
+		SinkholeIPv4: net.ParseIP("10.0.0.1").To4(),
+		SinkholeIPv6: net.ParseIP("fd00::1"),
+		BlockTTL:     30,
+	}
+
+	var testCases = []struct {
+		name      string
+		qtype     uint16
+		ipv6      bool
+		answers   []string
+		authority []string
+	}{
+		{
+			name:    "case 0: an A query is answered with the IPv4 sinkhole",
+			qtype:   dns.TypeA,
+			ipv6:    true,
+			answers: []string{"example.org.\t30\tIN\tA\t10.0.0.1"},
+		},
+		{
+			name:    "case 1: an AAAA query is answered with the IPv6 sinkhole",
+			qtype:   dns.TypeAAAA,
+			ipv6:    true,
+			answers: []string{"example.org.\t30\tIN\tAAAA\tfd00::1"},
+		},
+		{
+			name:      "case 2: an AAAA query without an IPv6 sinkhole gets an empty answer",
+			qtype:     dns.TypeAAAA,
+			ipv6:      false,
+			authority: []string{"example.org.\t30\tIN\tSOA\twarnlist.invalid. hostmaster.warnlist.invalid. 1 7200 3600 86400 30"},
+		},
+		{
+			name:      "case 3: other query types get an empty answer",
+			qtype:     dns.TypeMX,
+			ipv6:      true,
+			authority: []string{"example.org.\t30\tIN\tSOA\twarnlist.invalid. hostmaster.warnlist.invalid. 1 7200 3600 86400 30"},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			o := options
+			if !tc.ipv6 {
+				o.SinkholeIPv6 = nil
+			}
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: o}
+
+			r := new(dns.Msg)
+			r.SetQuestion("example.org.", tc.qtype)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(dns.RcodeSuccess, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(dns.RcodeSuccess, rcode))
+			}
+
+			var answers []string
+			for _, rr := range rec.Msg.Answer {
+				answers = append(answers, rr.String())
+			}
+			if !cmp.Equal(tc.answers, answers) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.answers, answers))
+			}
+			var authority []string
+			for _, rr := range rec.Msg.Ns {
+				authority = append(authority, rr.String())
+			}
+			if !cmp.Equal(tc.authority, authority) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.authority, authority))
+			}
+		})
+	}
+}
+
+func TestTypeResponse(t *testing.T) {
+	wl := NewWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	soa := "example.org.\t30\tIN\tSOA\twarnlist.invalid. hostmaster.warnlist.invalid. 1 7200 3600 86400 30"
+
+	var testCases = []struct {
+		name          string
+		response      string
+		typeResponses map[uint16]string
+		qtype         uint16
+		rcode         int
+		msgRcode      int
+		answers       []string
+		authority     []string
+	}{
+		{
+			name:          "case 0: an A query is sinkholed while AAAA queries get no data",
+			response:      ResponseSinkhole,
+			typeResponses: map[uint16]string{dns.TypeAAAA: ResponseNoData},
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeSuccess,
+			msgRcode:      dns.RcodeSuccess,
+			answers:       []string{"example.org.\t30\tIN\tA\t10.0.0.1"},
+		},
+		{
+			name:          "case 1: an AAAA query gets no data even with an IPv6 sinkhole",
+			response:      ResponseSinkhole,
+			typeResponses: map[uint16]string{dns.TypeAAAA: ResponseNoData},
+			qtype:         dns.TypeAAAA,
+			rcode:         dns.RcodeSuccess,
+			msgRcode:      dns.RcodeSuccess,
+			authority:     []string{soa},
+		},
+		{
+			name:          "case 2: an A query is sinkholed while other queries get name error",
+			response:      ResponseNXDomain,
+			typeResponses: map[uint16]string{dns.TypeA: ResponseSinkhole},
+			qtype:         dns.TypeA,
+			rcode:         dns.RcodeSuccess,
+			msgRcode:      dns.RcodeSuccess,
+			answers:       []string{"example.org.\t30\tIN\tA\t10.0.0.1"},
+		},
+		{
+			name:          "case 3: query types without a type response get the configured response",
+			response:      ResponseNXDomain,
+			typeResponses: map[uint16]string{dns.TypeA: ResponseSinkhole},
+			qtype:         dns.TypeMX,
+			rcode:         dns.RcodeNameError,
+			msgRcode:      dns.RcodeNameError,
+			authority:     []string{soa},
+		},
+		{
+			name:          "case 4: a passthrough type response calls the next plugin",
+			response:      ResponseNXDomain,
+			typeResponses: map[uint16]string{dns.TypeAAAA: ResponsePassthrough},
+			qtype:         dns.TypeAAAA,
+			rcode:         dns.RcodeServerFailure,
+			msgRcode:      dns.RcodeServerFailure,
+		},
+		{
+			name:          "case 5: a type response blocks queries even if others are passed through",
+			response:      ResponsePassthrough,
+			typeResponses: map[uint16]string{dns.TypeAAAA: ResponseRefused},
+			qtype:         dns.TypeAAAA,
+			rcode:         dns.RcodeSuccess,
+			msgRcode:      dns.RcodeRefused,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Response:      tc.response,
+				TypeResponses: tc.typeResponses,
+				SinkholeIPv4:  net.ParseIP("10.0.0.1").To4(),
+				SinkholeIPv6:  net.ParseIP("fd00::1"),
+				BlockTTL:      30,
+			}
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: options}
+
+			r := new(dns.Msg)
+			r.SetQuestion("example.org.", tc.qtype)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+			if !cmp.Equal(tc.msgRcode, rec.Msg.Rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.msgRcode, rec.Msg.Rcode))
+			}
+
+			var answers []string
+			for _, rr := range rec.Msg.Answer {
+				answers = append(answers, rr.String())
+			}
+			if !cmp.Equal(tc.answers, answers) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.answers, answers))
+			}
+			var authority []string
+			for _, rr := range rec.Msg.Ns {
+				authority = append(authority, rr.String())
+			}
+			if !cmp.Equal(tc.authority, authority) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.authority, authority))
+			}
+		})
+	}
+}
+
+func TestKindResponse(t *testing.T) {
+	// Matching subdomains, and matching exactly with wildcard entries
+	lists := make(map[bool]Warnlist)
+	for _, matchSubdomains := range []bool{true, false} {
+		b := newListBuilder(PluginOptions{MatchSubdomains: matchSubdomains})
+		for _, domain := range []string{"exact.example.", "*.wild.example."} {
+			b.add(listEntry{domain: domain}, "")
+		}
+		list, err := b.close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		lists[matchSubdomains] = list
+	}
+
+	var testCases = []struct {
+		name            string
+		matchSubdomains bool
+		response        string
+		typeResponses   map[uint16]string
+		kindResponses   map[string]string
+		audit           bool
+		domain          string
+		msgRcode        int
+		audited         bool
+	}{
+		{
+			name:            "case 0: an exact match gets the exact response",
+			matchSubdomains: true,
+			kindResponses:   map[string]string{MatchKindExact: ResponseNXDomain, MatchKindSubtree: ResponseAudit},
+			domain:          "exact.example.",
+			msgRcode:        dns.RcodeNameError,
+		},
+		{
+			name:            "case 1: a subtree match with the audit response is passed through and audited",
+			matchSubdomains: true,
+			kindResponses:   map[string]string{MatchKindExact: ResponseNXDomain, MatchKindSubtree: ResponseAudit},
+			domain:          "a.exact.example.",
+			msgRcode:        dns.RcodeServerFailure,
+			audited:         true,
+		},
+		{
+			name:            "case 2: a subtree match gets the subtree response",
+			matchSubdomains: true,
+			response:        ResponsePassthrough,
+			kindResponses:   map[string]string{MatchKindSubtree: ResponseRefused},
+			domain:          "a.exact.example.",
+			msgRcode:        dns.RcodeRefused,
+		},
+		{
+			name:            "case 3: a kind of match without a response of its own gets the configured response",
+			matchSubdomains: true,
+			response:        ResponseRefused,
+			kindResponses:   map[string]string{MatchKindSubtree: ResponseAudit},
+			domain:          "exact.example.",
+			msgRcode:        dns.RcodeRefused,
+		},
+		{
+			name:            "case 4: the response of the kind of match wins over the type response",
+			matchSubdomains: true,
+			response:        ResponseNXDomain,
+			typeResponses:   map[uint16]string{dns.TypeA: ResponseRefused},
+			kindResponses:   map[string]string{MatchKindExact: ResponseNoData},
+			domain:          "exact.example.",
+			msgRcode:        dns.RcodeSuccess,
+		},
+		{
+			name:          "case 5: a wildcard match with the audit response is passed through and audited",
+			response:      ResponseNXDomain,
+			kindResponses: map[string]string{MatchKindWildcard: ResponseAudit},
+			domain:        "a.wild.example.",
+			msgRcode:      dns.RcodeServerFailure,
+			audited:       true,
+		},
+		{
+			name:          "case 6: a wildcard match of the domain itself gets the wildcard response",
+			response:      ResponseNXDomain,
+			kindResponses: map[string]string{MatchKindWildcard: ResponseRefused, MatchKindExact: ResponsePassthrough},
+			domain:        "wild.example.",
+			msgRcode:      dns.RcodeRefused,
+		},
+		{
+			name:          "case 7: an exact match with the passthrough response is passed through without being audited",
+			response:      ResponseNXDomain,
+			kindResponses: map[string]string{MatchKindExact: ResponsePassthrough},
+			domain:        "exact.example.",
+			msgRcode:      dns.RcodeServerFailure,
+		},
+		{
+			name:            "case 8: audit mode passes every kind of match through",
+			matchSubdomains: true,
+			kindResponses:   map[string]string{MatchKindExact: ResponseNXDomain},
+			audit:           true,
+			domain:          "exact.example.",
+			msgRcode:        dns.RcodeServerFailure,
+			audited:         true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Response:        tc.response,
+				TypeResponses:   tc.typeResponses,
+				KindResponses:   tc.kindResponses,
+				Audit:           tc.audit,
+				MatchSubdomains: tc.matchSubdomains,
+			}
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: lists[tc.matchSubdomains], Options: options}
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			counter := auditMatches.WithLabelValues("")
+			before := testutil.ToFloat64(counter)
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.msgRcode, rec.Msg.Rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.msgRcode, rec.Msg.Rcode))
+			}
+			audited := testutil.ToFloat64(counter) > before
+			if !cmp.Equal(tc.audited, audited) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.audited, audited))
+			}
+		})
+	}
+}
+
+func TestNegativeBlockTTL(t *testing.T) {
+	wl := NewTrieWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	var testCases = []struct {
+		name      string
+		response  string
+		domain    string
+		mname     string
+		rname     string
+		authority []string
+	}{
+		{
+			name:      "case 0: nxdomain is cached for the block TTL of the SOA of the matched entry",
+			response:  ResponseNXDomain,
+			domain:    "www.example.org.",
+			authority: []string{"example.org.\t300\tIN\tSOA\twarnlist.invalid. hostmaster.warnlist.invalid. 1 7200 3600 86400 300"},
+		},
+		{
+			name:     "case 1: refused has no SOA",
+			response: ResponseRefused,
+			domain:   "www.example.org.",
+		},
+		{
+			name:      "case 2: the SOA names are configurable",
+			response:  ResponseNXDomain,
+			domain:    "example.org.",
+			mname:     "ns.example.net.",
+			rname:     "dns.example.net.",
+			authority: []string{"example.org.\t300\tIN\tSOA\tns.example.net. dns.example.net. 1 7200 3600 86400 300"},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: PluginOptions{Response: tc.response, BlockTTL: 300, SOAMname: tc.mname, SOARname: tc.rname}}
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+
+			var authority []string
+			for _, rr := range rec.Msg.Ns {
+				authority = append(authority, rr.String())
+			}
+			if !cmp.Equal(tc.authority, authority) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.authority, authority))
+			}
+		})
+	}
+}
+
+func TestConcurrentReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(source, []byte("example.org\nsomething.evil\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{Sources: []DomainSource{{Path: source, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}}, MatchSubdomains: true}
+	wl, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: options}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				r := new(dns.Msg)
+				r.SetQuestion("example.org.", dns.TypeA)
+				rec := dnstest.NewRecorder(&test.ResponseWriter{})
+				_, _ = m.ServeDNS(context.TODO(), rec, r)
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		rebuildWarnlist(m)
+	}
+	close(done)
+	wg.Wait()
+
+	warnlist, _ := m.lists()
+	if !warnlist.Contains("example.org.") {
+		t.Fatalf("expected example.org. to match after reloads")
+	}
+}
+
+func TestListGaugesServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(source, []byte("example.org\nsomething.evil\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	allowlist := filepath.Join(dir, "allowlist.txt")
+	if err := ioutil.WriteFile(allowlist, []byte("safe.example.org\nnot a domain\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: source, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		Allowlist:       []DomainSource{{Path: allowlist, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+	}
+	caches, err := buildStartupCaches(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newWarnlistPlugin(options, caches, time.Now())
+	m.Next = test.ErrorHandler()
+
+	// The lists are built before the server is known, so their gauges are set once it handles a query
+	ctx := context.WithValue(context.TODO(), dnsserver.Key{}, &dnsserver.Server{Addr: "dns://:1053"})
+	r := new(dns.Msg)
+	r.SetQuestion("example.org.", dns.TypeA)
+	if _, err := m.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), r); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]float64{"warnlist": 2, "allowlist": 1}
+	loaded := map[string]float64{
+		"warnlist":  testutil.ToFloat64(domainsLoaded.WithLabelValues("dns://:1053", "warnlist")),
+		"allowlist": testutil.ToFloat64(domainsLoaded.WithLabelValues("dns://:1053", "allowlist")),
+	}
+	if !cmp.Equal(expected, loaded) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(expected, loaded))
+	}
+	if malformed := testutil.ToFloat64(parseErrors.WithLabelValues("dns://:1053", "allowlist")); !cmp.Equal(float64(1), malformed) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(float64(1), malformed))
+	}
+
+	// Reloads set the gauges of the server
+	if err := ioutil.WriteFile(source, []byte("example.org\nsomething.evil\nother.evil\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := testutil.ToFloat64(domainsLoaded.WithLabelValues("dns://:1053", "warnlist")); !cmp.Equal(float64(3), loaded) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(float64(3), loaded))
+	}
+}
+
+func TestIDNMatching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A mixed list of Unicode and punycode entries
+	source := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(source, []byte("bücher.example\nxn--mnchen-3ya.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	options := PluginOptions{Sources: []DomainSource{{Path: source, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}}, MatchSubdomains: true, Response: ResponseNXDomain}
+	wl, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: options}
+
+	var testCases = []struct {
+		name   string
+		domain string
+		rcode  int
+	}{
+		{
+			name:   "case 0: a punycode query matches a Unicode entry",
+			domain: "xn--bcher-kva.example.",
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 1: a Unicode query matches a Unicode entry",
+			domain: "bücher.example.",
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 2: a Unicode query matches a punycode entry",
+			domain: "münchen.example.",
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 3: an uppercase Unicode query matches a punycode entry",
+			domain: "MÜNCHEN.example.",
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 4: a different Unicode query is not matched",
+			domain: "bucher.example.",
+			rcode:  dns.RcodeServerFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+		})
+	}
+}
+
+func TestCaseInsensitiveMatching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Entries in mixed case, with and without trailing dots
+	source := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(source, []byte("Bad.Example.COM\nother.EXAMPLE.org.\n*.Wild.Example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name   string
+		domain string
+		rcode  int
+	}{
+		{
+			name:   "case 0: a lowercase query matches a mixed case entry",
+			domain: "bad.example.com.",
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 1: an uppercase query matches a mixed case entry",
+			domain: "BAD.EXAMPLE.COM.",
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 2: a mixed case query matches an entry with a trailing dot",
+			domain: "Other.Example.Org.",
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 3: a mixed case query matches a mixed case wildcard entry",
+			domain: "WWW.wild.EXAMPLE.",
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 4: an unlisted query is not matched",
+			domain: "Good.Example.COM.",
+			rcode:  dns.RcodeServerFailure,
+		},
+	}
+
+	for _, matchSubdomains := range []bool{true, false} {
+		options := PluginOptions{Sources: []DomainSource{{Path: source, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}}, MatchSubdomains: matchSubdomains, Response: ResponseNXDomain}
+		wl, err := buildCacheFromFile(options, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: options}
+
+		for i, tc := range testCases {
+			t.Run(strconv.Itoa(i), func(t *testing.T) {
+				t.Log(tc.name)
+
+				r := new(dns.Msg)
+				r.SetQuestion(tc.domain, dns.TypeA)
+				rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+				rcode, err := m.ServeDNS(context.TODO(), rec, r)
+				if err != nil {
+					t.Fatalf("Error serving DNS: %v", err)
+				}
+				if !cmp.Equal(tc.rcode, rcode) {
+					t.Fatalf("match_subdomains %t: \n\n%s\n", matchSubdomains, cmp.Diff(tc.rcode, rcode))
+				}
+			})
+		}
+	}
+}
+
+func TestQueryTypeMatching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	list := strings.Join([]string{
+		"txt.example TXT",
+		"any.example",
+		"mixed.example MX AAAA",
+		// Listed again without a type, so it matches all of them
+		"again.example TXT",
+		"again.example",
+		// A parent limited to a type doesn't hide a subdomain listed for all types
+		"parent.example TXT",
+		"www.parent.example",
+	}, "\n")
+	source := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(source, []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name   string
+		domain string
+		qtype  uint16
+		rcode  int
+	}{
+		{
+			name:   "case 0: a qualified entry matches queries of its type",
+			domain: "txt.example.",
+			qtype:  dns.TypeTXT,
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 1: a qualified entry doesn't match queries of other types",
+			domain: "txt.example.",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeServerFailure,
+		},
+		{
+			name:   "case 2: an unqualified entry matches queries of any type",
+			domain: "any.example.",
+			qtype:  dns.TypeTXT,
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 3: an entry qualified with several types matches each of them",
+			domain: "mixed.example.",
+			qtype:  dns.TypeAAAA,
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 4: an entry qualified with several types doesn't match others",
+			domain: "mixed.example.",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeServerFailure,
+		},
+		{
+			name:   "case 5: an entry also listed without a type matches any type",
+			domain: "again.example.",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 6: a subdomain listed for all types matches under a qualified parent",
+			domain: "www.parent.example.",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 7: ANY queries match qualified entries",
+			domain: "txt.example.",
+			qtype:  dns.TypeANY,
+			rcode:  dns.RcodeNameError,
+		},
+	}
+
+	for _, matchSubdomains := range []bool{true, false} {
+		options := PluginOptions{Sources: []DomainSource{{Path: source, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}}, MatchSubdomains: matchSubdomains, Response: ResponseNXDomain}
+		wl, err := buildCacheFromFile(options, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: options}
+
+		for i, tc := range testCases {
+			t.Run(strconv.Itoa(i), func(t *testing.T) {
+				t.Log(tc.name)
+
+				r := new(dns.Msg)
+				r.SetQuestion(tc.domain, tc.qtype)
+				rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+				rcode, err := m.ServeDNS(context.TODO(), rec, r)
+				if err != nil {
+					t.Fatalf("Error serving DNS: %v", err)
+				}
+				if !cmp.Equal(tc.rcode, rcode) {
+					t.Fatalf("match_subdomains %t: \n\n%s\n", matchSubdomains, cmp.Diff(tc.rcode, rcode))
+				}
+			})
+		}
+	}
+}
+
+func TestCheckCNAME(t *testing.T) {
+	wl := NewRadixWarnlist()
+	wl.Add("evil.com.")
+	wl.Close()
+
+	al := NewRadixWarnlist()
+	al.Add("cdn.evil.com.")
+	al.Close()
+
+	// The next plugin resolves every query through a CNAME chain
+	next := func(targets ...string) plugin.Handler {
+		return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			owner := r.Question[0].Name
+			for _, target := range targets {
+				m.Answer = append(m.Answer, test.CNAME(owner+" 300 IN CNAME "+target))
+				owner = target
+			}
+			m.Answer = append(m.Answer, test.A(owner+" 300 IN A 192.0.2.1"))
+			return dns.RcodeSuccess, w.WriteMsg(m)
+		})
+	}
+
+	var testCases = []struct {
+		name       string
+		targets    []string
+		response   string
+		checkCNAME bool
+		rcode      int
+	}{
+		{
+			name:       "case 0: a warnlisted CNAME target is blocked",
+			targets:    []string{"evil.com."},
+			response:   ResponseNXDomain,
+			checkCNAME: true,
+			rcode:      dns.RcodeNameError,
+		},
+		{
+			name:       "case 1: a warnlisted target deeper in the chain is blocked",
+			targets:    []string{"clean.example.", "also.clean.example.", "evil.com."},
+			response:   ResponseNXDomain,
+			checkCNAME: true,
+			rcode:      dns.RcodeNameError,
+		},
+		{
+			name:       "case 2: a subdomain of a warnlisted CNAME target is blocked",
+			targets:    []string{"very.evil.com."},
+			response:   ResponseRefused,
+			checkCNAME: true,
+			rcode:      dns.RcodeRefused,
+		},
+		{
+			name:       "case 3: a clean CNAME chain is passed through",
+			targets:    []string{"clean.example."},
+			response:   ResponseNXDomain,
+			checkCNAME: true,
+			rcode:      dns.RcodeSuccess,
+		},
+		{
+			name:       "case 4: an allowlisted CNAME target is passed through",
+			targets:    []string{"cdn.evil.com."},
+			response:   ResponseNXDomain,
+			checkCNAME: true,
+			rcode:      dns.RcodeSuccess,
+		},
+		{
+			name:       "case 5: a warnlisted CNAME target is passed through when not checking CNAMEs",
+			targets:    []string{"evil.com."},
+			response:   ResponseNXDomain,
+			checkCNAME: false,
+			rcode:      dns.RcodeSuccess,
+		},
+		{
+			name:       "case 6: a warnlisted CNAME target is passed through with the passthrough response",
+			targets:    []string{"evil.com."},
+			response:   ResponsePassthrough,
+			checkCNAME: true,
+			rcode:      dns.RcodeSuccess,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{
+				Next:      next(tc.targets...),
+				warnlist:  wl,
+				allowlist: al,
+				Options:   PluginOptions{Response: tc.response, CheckCNAME: tc.checkCNAME},
+			}
+
+			r := new(dns.Msg)
+			r.SetQuestion("innocent.example.", dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rec.Msg.Rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rec.Msg.Rcode))
+			}
+		})
+	}
+}
+
+func TestJSONLogFormat(t *testing.T) {
+	wl := NewRadixWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: PluginOptions{LogFormat: LogFormatJSON}}
+
+	// Capture the log output of the plugin
+	b := &bytes.Buffer{}
+	golog.SetOutput(b)
+	defer golog.SetOutput(os.Stderr)
+
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.org.", dns.TypeAAAA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+		t.Fatalf("Error serving DNS: %v", err)
+	}
+
+	line := strings.TrimSpace(b.String())
+	i := strings.Index(line, "{")
+	if i < 0 {
+		t.Fatalf("expected a JSON log record, got: %s", line)
+	}
+	var record matchRecord
+	if err := json.Unmarshal([]byte(line[i:]), &record); err != nil {
+		t.Fatalf("unable to decode log record %s: %v", line[i:], err)
+	}
+
+	if record.Time == "" {
+		t.Fatalf("expected the record to include a timestamp")
+	}
+	record.Time = ""
+	expected := matchRecord{Client: "10.240.0.1", Name: "www.example.org.", Type: "AAAA", Entry: "example.org.", Mechanism: MatchLiteral}
+	if !cmp.Equal(expected, record) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(expected, record))
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	wl := NewTrieWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	var testCases = []struct {
+		name     string
+		level    string
+		expected string
+	}{
+		{
+			name:     "case 0: matches are logged as warnings by default",
+			expected: "[WARNING]",
+		},
+		{
+			name:     "case 1: matches are logged at the configured level",
+			level:    LogLevelInfo,
+			expected: "[INFO]",
+		},
+		{
+			name:     "case 2: matches may be logged as errors",
+			level:    LogLevelError,
+			expected: "[ERROR]",
+		},
+		{
+			name:  "case 3: matches aren't logged at level none",
+			level: LogLevelNone,
+		},
+		{
+			name:  "case 4: debug lines are dropped without the debug plugin",
+			level: LogLevelDebug,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: PluginOptions{LogLevel: tc.level}}
+
+			// Capture the log output of the plugin
+			b := &bytes.Buffer{}
+			golog.SetOutput(b)
+			defer golog.SetOutput(os.Stderr)
+
+			r := new(dns.Msg)
+			r.SetQuestion("www.example.org.", dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+
+			line := strings.TrimSpace(b.String())
+			if tc.expected == "" {
+				if line != "" {
+					t.Fatalf("expected no log line, got: %s", line)
+				}
+				return
+			}
+			if !strings.Contains(line, tc.expected) || !strings.Contains(line, "requested warnlisted domain") {
+				t.Fatalf("expected a %s log line for the match, got: %s", tc.expected, line)
+			}
+		})
+	}
+}
+
+func TestLogSample(t *testing.T) {
+	wl := NewTrieWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	var testCases = []struct {
+		name   string
+		sample int
+		logged int
+	}{
+		{
+			name:   "case 0: every match is logged by default",
+			logged: 10,
+		},
+		{
+			name:   "case 1: every match is logged with 1/1",
+			sample: 1,
+			logged: 10,
+		},
+		{
+			name:   "case 2: 1 in N matches is logged, starting with the first",
+			sample: 4,
+			logged: 3,
+		},
+		{
+			name:   "case 3: a sample larger than the matches only logs the first",
+			sample: 1000,
+			logged: 1,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: PluginOptions{Response: ResponseNXDomain, LogSample: tc.sample}}
+
+			// Capture the log output of the plugin
+			b := &bytes.Buffer{}
+			golog.SetOutput(b)
+			defer golog.SetOutput(os.Stderr)
+
+			blocked := testutil.ToFloat64(blockedCount.WithLabelValues("", "A", ""))
+			for j := 0; j < 10; j++ {
+				r := new(dns.Msg)
+				r.SetQuestion("www.example.org.", dns.TypeA)
+				rec := dnstest.NewRecorder(&test.ResponseWriter{})
+				if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+					t.Fatalf("Error serving DNS: %v", err)
+				}
+			}
+
+			logged := strings.Count(b.String(), "requested warnlisted domain")
+			if !cmp.Equal(tc.logged, logged) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.logged, logged))
+			}
+			// Every blocked query is still counted
+			blocked = testutil.ToFloat64(blockedCount.WithLabelValues("", "A", "")) - blocked
+			if !cmp.Equal(10.0, blocked) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(10.0, blocked))
+			}
+		})
+	}
+}
+
+func TestVerboseMatch(t *testing.T) {
+	wl := NewTrieWarnlist()
+	wl.Add("example.org.")
+	wl.Add("www.example.org.")
+	wl.Close()
+
+	m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: PluginOptions{LogFormat: LogFormatJSON, VerboseMatch: true}}
+
+	// Capture the log output of the plugin
+	b := &bytes.Buffer{}
+	golog.SetOutput(b)
+	defer golog.SetOutput(os.Stderr)
+
+	r := new(dns.Msg)
+	r.SetQuestion("www.example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+		t.Fatalf("Error serving DNS: %v", err)
+	}
+
+	line := strings.TrimSpace(b.String())
+	i := strings.Index(line, "{")
+	if i < 0 {
+		t.Fatalf("expected a JSON log record, got: %s", line)
+	}
+	var record matchRecord
+	if err := json.Unmarshal([]byte(line[i:]), &record); err != nil {
+		t.Fatalf("unable to decode log record %s: %v", line[i:], err)
+	}
+
+	expected := []string{"example.org.", "www.example.org."}
+	if !cmp.Equal(expected, record.Entries) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(expected, record.Entries))
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	wl := NewRadixWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	var testCases = []struct {
+		name     string
+		annotate bool
+		qtype    uint16
+		edns     bool
+		option   string
+		answers  []string
+	}{
+		{
+			name:     "case 0: an EDNS0 query gets the matched entry as a local option",
+			annotate: true,
+			qtype:    dns.TypeA,
+			edns:     true,
+			option:   "example.org.",
+		},
+		{
+			name:     "case 1: a query without EDNS0 gets no OPT record",
+			annotate: true,
+			qtype:    dns.TypeA,
+		},
+		{
+			name:     "case 2: a TXT query gets the matched entry as a TXT answer",
+			annotate: true,
+			qtype:    dns.TypeTXT,
+			answers:  []string{"www.example.org.\t60\tIN\tTXT\t\"warnlisted: example.org.\""},
+		},
+		{
+			name:  "case 3: nothing is attached when disabled",
+			qtype: dns.TypeTXT,
+			edns:  true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{Response: ResponseNXDomain, BlockTTL: DefaultBlockTTL, Annotate: tc.annotate, AnnotateCode: DefaultAnnotateCode}
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: options}
+
+			r := new(dns.Msg)
+			r.SetQuestion("www.example.org.", tc.qtype)
+			if tc.edns {
+				r.SetEdns0(4096, false)
+			}
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+
+			var option string
+			opt := rec.Msg.IsEdns0()
+			if opt != nil {
+				for _, o := range opt.Option {
+					if local, ok := o.(*dns.EDNS0_LOCAL); ok && local.Code == DefaultAnnotateCode {
+						option = string(local.Data)
+					}
+				}
+			}
+			if !tc.edns && opt != nil {
+				t.Fatalf("expected no OPT record, got: %s", opt)
+			}
+			if !cmp.Equal(tc.option, option) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.option, option))
+			}
+
+			var answers []string
+			for _, rr := range rec.Msg.Answer {
+				answers = append(answers, rr.String())
+			}
+			if !cmp.Equal(tc.answers, answers) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.answers, answers))
+			}
+		})
+	}
+}
+
+func TestRefusedReason(t *testing.T) {
+	wl := NewRadixWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	var testCases = []struct {
+		name     string
+		response string
+		annotate bool
+		edns     bool
+		reason   bool
+		options  int
+	}{
+		{
+			name:     "case 0: an EDNS0 query is refused with a blocked extended error",
+			response: ResponseRefused,
+			edns:     true,
+			reason:   true,
+			options:  1,
+		},
+		{
+			name:     "case 1: a query without EDNS0 is refused without an OPT record",
+			response: ResponseRefused,
+		},
+		{
+			name:     "case 2: the extended error and the annotation share the OPT record",
+			response: ResponseRefused,
+			annotate: true,
+			edns:     true,
+			reason:   true,
+			options:  2,
+		},
+		{
+			name:     "case 3: nxdomain responses don't get the extended error",
+			response: ResponseNXDomain,
+			edns:     true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{Response: tc.response, BlockTTL: DefaultBlockTTL, Annotate: tc.annotate, AnnotateCode: DefaultAnnotateCode}
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: options}
+
+			r := new(dns.Msg)
+			r.SetQuestion("example.org.", dns.TypeA)
+			if tc.edns {
+				r.SetEdns0(4096, false)
+			}
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if tc.response == ResponseRefused {
+				// The response is written by the plugin, so the server must not write another one, but the rcode
+				// recorded for the metrics is the refusal
+				if !cmp.Equal(dns.RcodeSuccess, rcode) {
+					t.Fatalf("\n\n%s\n", cmp.Diff(dns.RcodeSuccess, rcode))
+				}
+				if !cmp.Equal(dns.RcodeRefused, rec.Rcode) {
+					t.Fatalf("\n\n%s\n", cmp.Diff(dns.RcodeRefused, rec.Rcode))
+				}
+			}
+
+			var reason bool
+			var records, count int
+			for _, rr := range rec.Msg.Extra {
+				opt, ok := rr.(*dns.OPT)
+				if !ok {
+					continue
+				}
+				records++
+				count += len(opt.Option)
+				for _, o := range opt.Option {
+					if ede, ok := o.(*dns.EDNS0_EDE); ok {
+						reason = ede.InfoCode == dns.ExtendedErrorCodeBlocked && ede.ExtraText == refusedReason
+					}
+				}
+			}
+			if !tc.edns && records != 0 {
+				t.Fatalf("expected no OPT record, got %d", records)
+			}
+			if records > 1 {
+				t.Fatalf("expected a single OPT record, got %d", records)
+			}
+			if !cmp.Equal(tc.reason, reason) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.reason, reason))
+			}
+			if !cmp.Equal(tc.options, count) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.options, count))
+			}
+		})
+	}
+}
+
+func TestClientSubnet(t *testing.T) {
+	wl := NewRadixWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	var testCases = []struct {
+		name   string
+		useECS bool
+		subnet net.IP
+		client string
+	}{
+		{
+			name:   "case 0: the remote address is the client without use_ecs",
+			subnet: net.ParseIP("192.0.2.0"),
+			client: "10.240.0.1",
+		},
+		{
+			name:   "case 1: the client subnet is the client with use_ecs",
+			useECS: true,
+			subnet: net.ParseIP("192.0.2.0"),
+			client: "192.0.2.0",
+		},
+		{
+			name:   "case 2: the remote address is the client with use_ecs if the request has no client subnet",
+			useECS: true,
+			client: "10.240.0.1",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: PluginOptions{UseECS: tc.useECS}}
+
+			r := new(dns.Msg)
+			r.SetQuestion("www.example.org.", dns.TypeA)
+			if tc.subnet != nil {
+				r.SetEdns0(4096, false)
+				opt := r.IsEdns0()
+				opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: tc.subnet})
+			}
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			counter := warnlistCount.WithLabelValues("", tc.client, "www.example.org.")
+			before := testutil.ToFloat64(counter)
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+
+			hits := testutil.ToFloat64(counter) - before
+			if !cmp.Equal(float64(1), hits) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(float64(1), hits))
+			}
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	wl := NewTrieWarnlist()
+	wl.Add("evil.com.")
+	wl.Close()
+
+	al := NewTrieWarnlist()
+	al.Add("cdn.evil.com.")
+	al.Close()
+
+	m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, allowlist: al}
+
+	var testCases = []struct {
+		name     string
+		domain   string
+		expected string
+	}{
+		{
+			name:     "case 0: a warnlisted domain is matched",
+			domain:   "www.evil.com.",
+			expected: "true",
+		},
+		{
+			name:     "case 1: an allowlisted domain is not matched",
+			domain:   "cdn.evil.com.",
+			expected: "false",
+		},
+		{
+			name:     "case 2: an unlisted domain is not matched",
+			domain:   "example.org.",
+			expected: "false",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			state := request.Request{W: &test.ResponseWriter{}, Req: r}
+
+			ctx := m.Metadata(metadata.ContextWithMetadata(context.TODO()), state)
+			f := metadata.ValueFunc(ctx, "warnlist/matched")
+			if f == nil {
+				t.Fatalf("expected the warnlist/matched metadata to be set")
+			}
+			if !cmp.Equal(tc.expected, f()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, f()))
+			}
+		})
+	}
+}
+
+func TestSourceLabel(t *testing.T) {
+	wl := NewAnnotatedWarnlist(NewTrieWarnlist(), true)
+	wl.AddEntry("evil.com.", "urlhaus", nil)
+	wl.Close()
+
+	m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: PluginOptions{Response: ResponseNXDomain, LogFormat: LogFormatJSON}}
+
+	// Capture the log output of the plugin
+	b := &bytes.Buffer{}
+	golog.SetOutput(b)
+	defer golog.SetOutput(os.Stderr)
+
+	r := new(dns.Msg)
+	r.SetQuestion("www.evil.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	counter := blockedCount.WithLabelValues("", "A", "urlhaus")
+	before := testutil.ToFloat64(counter)
+	if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+		t.Fatalf("Error serving DNS: %v", err)
+	}
+
+	blocked := testutil.ToFloat64(counter) - before
+	if !cmp.Equal(float64(1), blocked) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(float64(1), blocked))
+	}
+
+	line := strings.TrimSpace(b.String())
+	i := strings.Index(line, "{")
+	if i < 0 {
+		t.Fatalf("expected a JSON log record, got: %s", line)
+	}
+	var record matchRecord
+	if err := json.Unmarshal([]byte(line[i:]), &record); err != nil {
+		t.Fatalf("unable to decode log record %s: %v", line[i:], err)
+	}
+	if !cmp.Equal("urlhaus", record.Source) {
+		t.Fatalf("\n\n%s\n", cmp.Diff("urlhaus", record.Source))
+	}
+}
+
+// panickingWarnlist is a Warnlist with a lookup bug.
+type panickingWarnlist struct {
+	Warnlist
+}
+
+func (panickingWarnlist) Contains(key string) bool {
+	panic("lookup bug")
+}
+
+func (panickingWarnlist) Match(key string) (string, bool) {
+	panic("lookup bug")
+}
+
+func TestOnError(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		onError string
+		rcode   int
+	}{
+		{
+			name:    "case 0: a panicking lookup passes the query through",
+			onError: OnErrorPassthrough,
+			// The error handler of the next plugin answers SERVFAIL after writing its own response
+			rcode: dns.RcodeServerFailure,
+		},
+		{
+			name:    "case 1: a panicking lookup is answered with SERVFAIL",
+			onError: OnErrorRefuse,
+			rcode:   dns.RcodeServerFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: panickingWarnlist{}, Options: PluginOptions{OnError: tc.onError}}
+
+			r := new(dns.Msg)
+			r.SetQuestion("example.org.", dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+
+			// Only the next plugin writes a response
+			passedThrough := rec.Msg != nil
+			if !cmp.Equal(tc.onError == OnErrorPassthrough, passedThrough) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.onError == OnErrorPassthrough, passedThrough))
+			}
+		})
+	}
+}
+
+func TestRequestDuration(t *testing.T) {
+	wl := NewTrieWarnlist()
+	wl.Add("example.org.")
+	wl.Close()
+
+	m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: PluginOptions{Response: ResponseNXDomain}}
+
+	before := histogramCount(t, requestDuration.WithLabelValues(""))
+	// Both blocked and passed queries are timed
+	for _, name := range []string{"www.example.org.", "example.net."} {
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+			t.Fatalf("Error serving DNS: %v", err)
+		}
+	}
+
+	observed := histogramCount(t, requestDuration.WithLabelValues("")) - before
+	if !cmp.Equal(uint64(2), observed) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(uint64(2), observed))
+	}
+}
+
+// histogramCount returns the number of observations of a histogram.
+func histogramCount(t *testing.T, observer prometheus.Observer) uint64 {
+	var m dto.Metric
+	if err := observer.(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
@@ -1,5 +1,9 @@
 package warnlist
 
-// Ready implements the ready.Readiness interface, once this flips to true CoreDNS
-// assumes this plugin is ready for queries; it is not checked again.
-func (wp WarnlistPlugin) Ready() bool { return true }
+// Ready implements the ready.Readiness interface. The plugin is ready once a warnlist has been loaded successfully,
+// and stays ready afterwards, since failed reloads keep serving the loaded warnlist.
+func (wp *WarnlistPlugin) Ready() bool {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	return wp.loaded
+}
@@ -0,0 +1,216 @@
+package warnlist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisScanCount is the number of members asked for by each SSCAN call, so a large set is read in pages instead of
+// one enormous reply.
+const redisScanCount = 1000
+
+// redisClient is the subset of Redis commands needed to read a set, so tests can replace the connection.
+type redisClient interface {
+	// SScan returns a page of the members of the set at key, and the cursor of the next page, which is "0" once the
+	// whole set has been returned.
+	SScan(key string, cursor string) (string, []string, error)
+	Close() error
+}
+
+// dialRedis connects to the Redis server of a source. It is a variable so tests can replace the client.
+var dialRedis = func(addr string, options PluginOptions) (redisClient, error) {
+	return dialRESP(addr, options)
+}
+
+// splitRedisPath splits the path of a redis source into the address of the server and the key of the set.
+func splitRedisPath(path string) (string, string) {
+	i := strings.Index(path, "/")
+	if i < 0 {
+		return path, ""
+	}
+	return path[:i], path[i+1:]
+}
+
+// openRedis streams the members of the set of a redis source, one per line, as they are scanned.
+func openRedis(path string, options PluginOptions) (io.ReadCloser, error) {
+	addr, key := splitRedisPath(path)
+	client, err := dialRedis(addr, options)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to redis %s: %w", addr, err)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		// Disconnect before the reader sees the end of the set, so a build never leaves a connection behind
+		var err error
+		defer func() {
+			client.Close()
+			w.CloseWithError(err)
+		}()
+
+		cursor := "0"
+		for {
+			var next string
+			var members []string
+			next, members, err = client.SScan(key, cursor)
+			if err != nil {
+				err = fmt.Errorf("unable to scan redis set %s: %w", path, err)
+				return
+			}
+			for _, member := range members {
+				if _, err = io.WriteString(w, member+"\n"); err != nil {
+					// The reader was closed, so nobody is interested in the rest of the set
+					return
+				}
+			}
+			if next == "0" {
+				return
+			}
+			cursor = next
+		}
+	}()
+	return r, nil
+}
+
+// respConn is a minimal client of the Redis protocol (RESP), which only sends the commands needed to scan a set.
+type respConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+}
+
+// dialRESP connects to a Redis server, authenticating and selecting the database if they are configured.
+func dialRESP(addr string, options PluginOptions) (*respConn, error) {
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = DefaultFetchTimeout
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &respConn{conn: conn, r: bufio.NewReader(conn), timeout: timeout}
+
+	if options.RedisPassword != "" {
+		if _, err := c.do("AUTH", options.RedisPassword); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if options.RedisDB != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(options.RedisDB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *respConn) SScan(key string, cursor string) (string, []string, error) {
+	reply, err := c.do("SSCAN", key, cursor, "COUNT", strconv.Itoa(redisScanCount))
+	if err != nil {
+		return "", nil, err
+	}
+
+	// The reply is the next cursor, followed by an array of members
+	page, ok := reply.([]interface{})
+	if !ok || len(page) != 2 {
+		return "", nil, errors.New("unexpected SSCAN reply")
+	}
+	next, ok := page[0].(string)
+	if !ok {
+		return "", nil, errors.New("unexpected SSCAN cursor")
+	}
+	items, ok := page[1].([]interface{})
+	if !ok {
+		return "", nil, errors.New("unexpected SSCAN members")
+	}
+	members := make([]string, 0, len(items))
+	for _, item := range items {
+		if member, ok := item.(string); ok {
+			members = append(members, member)
+		}
+	}
+	return next, members, nil
+}
+
+func (c *respConn) Close() error {
+	return c.conn.Close()
+}
+
+// do sends a command, and returns its reply. Every command gets the full timeout, so scanning a large set isn't
+// limited to a single timeout.
+func (c *respConn) do(args ...string) (interface{}, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readRESP(c.r)
+}
+
+// readRESP reads a single reply. Strings are returned as strings, integers as int64, arrays as []interface{}, and
+// error replies as errors.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis error: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown redis reply: %q", line)
+	}
+}
@@ -0,0 +1,234 @@
+package warnlist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeRedis returns the pages of a set, keyed by their cursor.
+type fakeRedis struct {
+	key    string
+	pages  map[string][]string
+	next   map[string]string
+	err    error
+	closed bool
+}
+
+func (f *fakeRedis) SScan(key string, cursor string) (string, []string, error) {
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	if key != f.key {
+		return "0", nil, nil
+	}
+	return f.next[cursor], f.pages[cursor], nil
+}
+
+func (f *fakeRedis) Close() error {
+	f.closed = true
+	return nil
+}
+
+func Test_buildCacheFromRedis(t *testing.T) {
+	defer func(dial func(string, PluginOptions) (redisClient, error)) { dialRedis = dial }(dialRedis)
+
+	var testCases = []struct {
+		name      string
+		redis     *fakeRedis
+		dialErr   error
+		domains   []string
+		expectErr bool
+	}{
+		{
+			name: "case 0: every page of the set is loaded",
+			redis: &fakeRedis{
+				key:   "indicators",
+				pages: map[string][]string{"0": {"example.org", "Something.Evil"}, "17": {"other.example"}},
+				next:  map[string]string{"0": "17", "17": "0"},
+			},
+			domains: []string{"example.org.", "something.evil.", "other.example."},
+		},
+		{
+			name:      "case 1: a failed scan fails the build",
+			redis:     &fakeRedis{key: "indicators", err: errors.New("connection reset")},
+			expectErr: true,
+		},
+		{
+			name:      "case 2: a failed connection fails the build",
+			dialErr:   errors.New("connection refused"),
+			expectErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			var addr string
+			dialRedis = func(a string, options PluginOptions) (redisClient, error) {
+				addr = a
+				if tc.dialErr != nil {
+					return nil, tc.dialErr
+				}
+				return tc.redis, nil
+			}
+
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: "127.0.0.1:6379/indicators", Type: DomainSourceTypeRedis, Format: DomainFileFormatTextList}},
+				MatchSubdomains: true,
+			}
+			list, err := buildCacheFromFile(options, nil)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !cmp.Equal("127.0.0.1:6379", addr) {
+				t.Fatalf("\n\n%s\n", cmp.Diff("127.0.0.1:6379", addr))
+			}
+			for _, domain := range tc.domains {
+				if !list.Contains(domain) {
+					t.Fatalf("expected %s to be loaded", domain)
+				}
+			}
+			if !cmp.Equal(len(tc.domains), list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(len(tc.domains), list.Len()))
+			}
+			if !tc.redis.closed {
+				t.Fatalf("expected the redis client to be closed")
+			}
+		})
+	}
+}
+
+func Test_readRESP(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		reply     string
+		expected  interface{}
+		expectErr bool
+	}{
+		{
+			name:     "case 0: a simple string is returned",
+			reply:    "+OK\r\n",
+			expected: "OK",
+		},
+		{
+			name:     "case 1: an integer is returned",
+			reply:    ":42\r\n",
+			expected: int64(42),
+		},
+		{
+			name:     "case 2: a bulk string may hold a CRLF",
+			reply:    "$8\r\nbad\r\nfoo\r\n",
+			expected: "bad\r\nfoo",
+		},
+		{
+			name:     "case 3: an SSCAN page is a nested array",
+			reply:    "*2\r\n$1\r\n0\r\n*2\r\n$11\r\nexample.org\r\n$14\r\nsomething.evil\r\n",
+			expected: []interface{}{"0", []interface{}{"example.org", "something.evil"}},
+		},
+		{
+			name:      "case 4: an error reply is returned as an error",
+			reply:     "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+			expectErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			reply, err := readRESP(bufio.NewReader(strings.NewReader(tc.reply)))
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(tc.expected, reply) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, reply))
+			}
+		})
+	}
+}
+
+func Test_dialRESP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// Serve a single connection, recording the commands it receives
+	commands := make(chan []interface{}, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			command, err := readRESP(r)
+			if err != nil {
+				close(commands)
+				return
+			}
+			args := command.([]interface{})
+			commands <- args
+			switch args[0] {
+			case "SSCAN":
+				fmt.Fprint(conn, "*2\r\n$1\r\n0\r\n*1\r\n$11\r\nexample.org\r\n")
+			default:
+				fmt.Fprint(conn, "+OK\r\n")
+			}
+		}
+	}()
+
+	client, err := dialRESP(ln.Addr().String(), PluginOptions{RedisPassword: "secret", RedisDB: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	next, members, err := client.SScan("indicators", "0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client.Close()
+
+	if !cmp.Equal("0", next) {
+		t.Fatalf("\n\n%s\n", cmp.Diff("0", next))
+	}
+	if !cmp.Equal([]string{"example.org"}, members) {
+		t.Fatalf("\n\n%s\n", cmp.Diff([]string{"example.org"}, members))
+	}
+
+	var received [][]interface{}
+	for command := range commands {
+		received = append(received, command)
+	}
+	expected := [][]interface{}{
+		{"AUTH", "secret"},
+		{"SELECT", "2"},
+		{"SSCAN", "indicators", "0", "COUNT", "1000"},
+	}
+	if !cmp.Equal(expected, received) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(expected, received))
+	}
+}
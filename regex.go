@@ -0,0 +1,158 @@
+package warnlist
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The mechanisms a query name can be matched by.
+const (
+	// MatchLiteral is a match of a listed domain, or a parent of it
+	MatchLiteral = "literal"
+	// MatchRegex is a match of a regex pattern
+	MatchRegex = "regex"
+)
+
+// DefaultMaxRegexes is the number of patterns loaded from regex sources, above which the remaining ones are skipped.
+const DefaultMaxRegexes = 1000
+
+// RegexWarnlist adds regular expressions, like those published for the generated domains of malware families, to a
+// Warnlist. Unlike list entries, every pattern has to be evaluated against a query name the Warnlist doesn't match,
+// so the number of patterns is capped.
+type RegexWarnlist struct {
+	Warnlist
+	patterns []regexPattern
+	max      int
+}
+
+// regexPattern is a compiled pattern, along with the name of the source it was loaded from.
+type regexPattern struct {
+	re     *regexp.Regexp
+	source string
+}
+
+func NewRegexWarnlist(w Warnlist, max int) *RegexWarnlist {
+	if max == 0 {
+		max = DefaultMaxRegexes
+	}
+	return &RegexWarnlist{Warnlist: w, max: max}
+}
+
+// AddPattern adds a compiled pattern loaded from the named source, returning false if the cap on the number of
+// patterns has been reached.
+func (r *RegexWarnlist) AddPattern(re *regexp.Regexp, source string) bool {
+	if len(r.patterns) >= r.max {
+		return false
+	}
+	r.patterns = append(r.patterns, regexPattern{re: re, source: source})
+	return true
+}
+
+// Remove removes the pattern given as the key, or the entry of the wrapped Warnlist otherwise.
+func (r *RegexWarnlist) Remove(key string) {
+	for i, p := range r.patterns {
+		if p.re.String() == key {
+			r.patterns = append(r.patterns[:i], r.patterns[i+1:]...)
+			return
+		}
+	}
+	r.Warnlist.Remove(key)
+}
+
+func (r *RegexWarnlist) Contains(key string) bool {
+	_, ok := r.Match(key)
+	return ok
+}
+
+func (r *RegexWarnlist) Match(key string) (string, bool) {
+	if entry, ok := r.Warnlist.Match(key); ok {
+		return entry, true
+	}
+	return r.matchPattern(key)
+}
+
+func (r *RegexWarnlist) MatchType(key string, qtype uint16) (string, bool) {
+	entry, _, ok := r.Lookup(key, qtype)
+	return entry, ok
+}
+
+// Lookup returns the entry matching a query for the key and type, and the mechanism which matched it. Listed domains
+// are looked up first, and patterns are only evaluated if none of them match, which keeps most matches fast.
+func (r *RegexWarnlist) Lookup(key string, qtype uint16) (string, string, bool) {
+	if entry, ok := matchType(r.Warnlist, key, qtype); ok {
+		return entry, MatchLiteral, true
+	}
+	if entry, ok := r.matchPattern(key); ok {
+		return entry, MatchRegex, true
+	}
+	return "", "", false
+}
+
+func (r *RegexWarnlist) MatchAll(key string) []string {
+	entries := r.Warnlist.MatchAll(key)
+	name := strings.TrimSuffix(key, ".")
+	for _, p := range r.patterns {
+		if p.re.MatchString(name) {
+			entries = append(entries, p.re.String())
+		}
+	}
+	return entries
+}
+
+// Source returns the name of the source a matched entry or pattern was loaded from.
+func (r *RegexWarnlist) Source(entry string) string {
+	for _, p := range r.patterns {
+		if p.re.String() == entry {
+			return p.source
+		}
+	}
+	return sourceOf(r.Warnlist, entry)
+}
+
+func (r *RegexWarnlist) Len() int {
+	return r.Warnlist.Len() + len(r.patterns)
+}
+
+func (r *RegexWarnlist) Open() {
+	r.Warnlist.Open()
+	r.patterns = nil
+}
+
+// hasPattern returns true if the pattern given as a string was added.
+func (r *RegexWarnlist) hasPattern(pattern string) bool {
+	for _, p := range r.patterns {
+		if p.re.String() == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern returns the first pattern matching the key. Patterns are matched against the name without its
+// trailing dot, e.g. evil.example.
+func (r *RegexWarnlist) matchPattern(key string) (string, bool) {
+	name := strings.TrimSuffix(key, ".")
+	for _, p := range r.patterns {
+		if p.re.MatchString(name) {
+			return p.re.String(), true
+		}
+	}
+	return "", false
+}
+
+// mechanismMatcher is implemented by Warnlists which match names by several mechanisms.
+type mechanismMatcher interface {
+	Lookup(key string, qtype uint16) (string, string, bool)
+}
+
+// lookup returns the entry matching a query for the name and type, and the mechanism which matched it.
+func lookup(warnlist Warnlist, name string, qtype uint16) (string, string, bool) {
+	if l, ok := warnlist.(mechanismMatcher); ok {
+		return l.Lookup(name, qtype)
+	}
+	entry, ok := matchType(warnlist, name, qtype)
+	if !ok {
+		return "", "", false
+	}
+	return entry, MatchLiteral, true
+}
@@ -0,0 +1,268 @@
+package warnlist
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testRegexList holds the patterns of a made up DGA family, along with a pattern which doesn't compile.
+const testRegexList = `# DGA patterns
+^[a-z]{16}\.(com|net)$
+^[b-df-hj-np-tv-z]{10}\.example$
+([a-z
+`
+
+func Test_buildCacheFromRegex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	patterns := filepath.Join(dir, "dga.txt")
+	if err := ioutil.WriteFile(patterns, []byte(testRegexList), 0600); err != nil {
+		t.Fatal(err)
+	}
+	domains := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(domains, []byte("evil.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name       string
+		maxRegexes int
+		matched    []string
+		unmatched  []string
+		len        int
+	}{
+		{
+			name:      "case 0: query names are matched by patterns and domains, and invalid patterns are skipped",
+			matched:   []string{"qwertyuiopasdfgh.com.", "QWERTYUIOPASDFGH.net.", "bcdfghjklm.example.", "www.evil.example."},
+			unmatched: []string{"qwerty.com.", "www.qwertyuiopasdfgh.com.", "aeiouaeiou.example."},
+			len:       3,
+		},
+		{
+			name:       "case 1: patterns above the cap are skipped",
+			maxRegexes: 1,
+			matched:    []string{"qwertyuiopasdfgh.com."},
+			unmatched:  []string{"bcdfghjklm.example."},
+			len:        2,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Sources: []DomainSource{
+					{Path: patterns, Type: DomainSourceTypeFile, Format: DomainFileFormatRegex, Name: "dga"},
+					{Path: domains, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+				},
+				MatchSubdomains: true,
+				MaxRegexes:      tc.maxRegexes,
+				counts:          newListCounts(),
+			}
+			list, err := buildCacheFromFile(options, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, name := range tc.matched {
+				if _, ok := matchType(list, canonicalDomain(name), dns.TypeA); !ok {
+					t.Fatalf("expected %s to be matched", name)
+				}
+			}
+			for _, name := range tc.unmatched {
+				if _, ok := matchType(list, canonicalDomain(name), dns.TypeA); ok {
+					t.Fatalf("expected %s not to be matched", name)
+				}
+			}
+			if !cmp.Equal(tc.len, list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.len, list.Len()))
+			}
+			// The invalid pattern was skipped rather than failing the build
+			malformed := options.counts.malformed["warnlist"]
+			if !cmp.Equal(1, malformed) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(1, malformed))
+			}
+		})
+	}
+}
+
+func TestRegexMatching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dga.txt")
+	if err := ioutil.WriteFile(path, []byte(testRegexList), 0600); err != nil {
+		t.Fatal(err)
+	}
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatRegex, Name: "dga"}},
+		MatchSubdomains: true,
+		Response:        ResponseNXDomain,
+	}
+	wl, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, Options: options}
+
+	var testCases = []struct {
+		name   string
+		domain string
+		rcode  int
+	}{
+		{
+			name:   "case 0: a name matching a pattern is blocked",
+			domain: "qwertyuiopasdfgh.com.",
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "case 1: a name matching no pattern is passed through",
+			domain: "example.com.",
+			rcode:  dns.RcodeServerFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			counter := blockedCount.WithLabelValues("", "A", "dga")
+			before := testutil.ToFloat64(counter)
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+
+			// Blocks are attributed to the source of the pattern
+			blocked := testutil.ToFloat64(counter) - before
+			expected := float64(0)
+			if tc.rcode == dns.RcodeNameError {
+				expected = 1
+			}
+			if !cmp.Equal(expected, blocked) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(expected, blocked))
+			}
+		})
+	}
+}
+
+func Test_lookupMechanism(t *testing.T) {
+	r := NewRegexWarnlist(NewTrieWarnlist(), 0)
+	r.Add("evil.example.")
+	r.AddPattern(regexp.MustCompile(`^[a-z]{16}\.com$`), "dga")
+	// A pattern also matching a listed domain, which is matched literally
+	r.AddPattern(regexp.MustCompile(`evil`), "dga")
+	r.Close()
+
+	var testCases = []struct {
+		name      string
+		domain    string
+		entry     string
+		mechanism string
+		ok        bool
+	}{
+		{
+			name:      "case 0: a listed domain is matched literally, before any pattern",
+			domain:    "www.evil.example.",
+			entry:     "evil.example.",
+			mechanism: MatchLiteral,
+			ok:        true,
+		},
+		{
+			name:      "case 1: a name only matching a pattern is matched by regex",
+			domain:    "qwertyuiopasdfgh.com.",
+			entry:     `^[a-z]{16}\.com$`,
+			mechanism: MatchRegex,
+			ok:        true,
+		},
+		{
+			name:   "case 2: a name matching neither isn't matched",
+			domain: "example.com.",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			entry, mechanism, ok := lookup(r, tc.domain, dns.TypeA)
+			if !cmp.Equal(tc.ok, ok) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.ok, ok))
+			}
+			if !cmp.Equal(tc.entry, entry) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.entry, entry))
+			}
+			if !cmp.Equal(tc.mechanism, mechanism) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.mechanism, mechanism))
+			}
+		})
+	}
+}
+
+func benchmarkLookup(b *testing.B, patterns int) {
+	list := NewTrieWarnlist()
+	for i := 0; i < 100000; i++ {
+		list.Add(fmt.Sprintf("listed-%d.example.", i))
+	}
+	var warnlist Warnlist = list
+	if patterns > 0 {
+		r := NewRegexWarnlist(list, patterns)
+		for i := 0; i < patterns; i++ {
+			r.AddPattern(regexp.MustCompile(fmt.Sprintf(`^[a-z]{%d}\.dga%d\.example$`, 8+i%8, i)), "")
+		}
+		warnlist = r
+	}
+	if err := warnlist.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	// Most queries are for domains which are not listed, which are the ones evaluating every pattern
+	queries := make([]string, 1000)
+	for i := range queries {
+		queries[i] = fmt.Sprintf("www.unlisted-%d.example.", i)
+	}
+	queries[0] = "www.listed-42.example."
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lookup(warnlist, queries[i%len(queries)], dns.TypeA)
+	}
+}
+
+func BenchmarkLookupExactOnly(b *testing.B) {
+	benchmarkLookup(b, 0)
+}
+
+func BenchmarkLookupCombined10(b *testing.B) {
+	benchmarkLookup(b, 10)
+}
+
+func BenchmarkLookupCombined100(b *testing.B) {
+	benchmarkLookup(b, 100)
+}
@@ -0,0 +1,84 @@
+package warnlist
+
+import (
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// registeredDomain returns the registered domain of a name in its canonical form, its public suffix plus one label
+// (eTLD+1), e.g. evil.co.uk. for www.evil.co.uk. A wildcard prefix is dropped, since a registered domain matches all
+// of its subdomains anyway. It returns false for names which are public suffixes, like co.uk., which have none.
+func registeredDomain(name string) (string, bool) {
+	name = strings.TrimPrefix(name, wildcardPrefix)
+	domain, err := publicsuffix.EffectiveTLDPlusOne(strings.TrimSuffix(name, "."))
+	if err != nil {
+		return "", false
+	}
+	return domain + ".", true
+}
+
+// isBroadEntry returns true for an entry which is a public suffix, like com. or *.co.uk., so matching its subdomains
+// matches every domain registered under it. Single labels are public suffixes too, whether or not they are TLDs.
+func isBroadEntry(domain string) bool {
+	name := strings.TrimSuffix(strings.TrimPrefix(domain, wildcardPrefix), ".")
+	suffix, _ := publicsuffix.PublicSuffix(name)
+	return suffix == name
+}
+
+// rejectsBroad returns true if the entry is a public suffix which would match its subdomains, so a typo like a bare
+// com entry can't match every query, unless allow_broad_entries is set. Entries which are only matched exactly are
+// loaded whatever they are.
+func (o PluginOptions) rejectsBroad(domain string) bool {
+	if o.AllowBroadEntries {
+		return false
+	}
+	subtree := o.MatchSubdomains || o.ETLDPlusOne || strings.HasPrefix(domain, wildcardPrefix)
+	return subtree && isBroadEntry(domain)
+}
+
+// RegisteredWarnlist reduces query names to their registered domains before matching them against a Warnlist, whose
+// entries are registered domains themselves, so every name under a listed organization matches its entry.
+type RegisteredWarnlist struct {
+	Warnlist
+}
+
+func NewRegisteredWarnlist(w Warnlist) *RegisteredWarnlist {
+	return &RegisteredWarnlist{Warnlist: w}
+}
+
+// Remove removes the entry of the registered domain of the key, which also stops matching the other names under it.
+func (r *RegisteredWarnlist) Remove(key string) {
+	if domain, ok := registeredDomain(key); ok {
+		r.Warnlist.Remove(domain)
+	}
+}
+
+func (r *RegisteredWarnlist) Contains(key string) bool {
+	return r.Warnlist.Contains(r.reduce(key))
+}
+
+func (r *RegisteredWarnlist) Match(key string) (string, bool) {
+	return r.Warnlist.Match(r.reduce(key))
+}
+
+func (r *RegisteredWarnlist) MatchType(key string, qtype uint16) (string, bool) {
+	return matchType(r.Warnlist, r.reduce(key), qtype)
+}
+
+func (r *RegisteredWarnlist) MatchAll(key string) []string {
+	return r.Warnlist.MatchAll(r.reduce(key))
+}
+
+func (r *RegisteredWarnlist) Source(entry string) string {
+	return sourceOf(r.Warnlist, entry)
+}
+
+// reduce returns the registered domain of a query name, or the name itself if it has none. No entry matches those,
+// since public suffixes are never added.
+func (r *RegisteredWarnlist) reduce(key string) string {
+	if domain, ok := registeredDomain(key); ok {
+		return domain
+	}
+	return key
+}
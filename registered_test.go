@@ -0,0 +1,191 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_registeredDomain(t *testing.T) {
+	var testCases = []struct {
+		name   string
+		domain string
+		result string
+		ok     bool
+	}{
+		{
+			name:   "case 0: a subdomain under a multi-label public suffix is reduced to its registered domain",
+			domain: "a.b.evil.co.uk.",
+			result: "evil.co.uk.",
+			ok:     true,
+		},
+		{
+			name:   "case 1: a registered domain is kept",
+			domain: "evil.com.au.",
+			result: "evil.com.au.",
+			ok:     true,
+		},
+		{
+			name:   "case 2: a wildcard entry is reduced to its registered domain",
+			domain: "*.cdn.evil.co.uk.",
+			result: "evil.co.uk.",
+			ok:     true,
+		},
+		{
+			name:   "case 3: a multi-label public suffix has no registered domain",
+			domain: "co.uk.",
+		},
+		{
+			name:   "case 4: a wildcard public suffix has no registered domain",
+			domain: "*.com.au.",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			result, ok := registeredDomain(tc.domain)
+			if !cmp.Equal(tc.ok, ok) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.ok, ok))
+			}
+			if !cmp.Equal(tc.result, result) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.result, result))
+			}
+		})
+	}
+}
+
+func Test_buildCacheRegisteredDomains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	domains := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(domains, []byte("www.evil.co.uk\n*.bad.com.au\nco.uk\nevil.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	allowed := filepath.Join(dir, "allowed.txt")
+	if err := ioutil.WriteFile(allowed, []byte("cdn.evil.co.uk\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	matched := []string{"evil.co.uk.", "a.b.evil.co.uk.", "bad.com.au.", "www.bad.com.au.", "mail.evil.example."}
+	// The public suffix entry is skipped, so it doesn't match every domain under it
+	unmatched := []string{"good.co.uk.", "co.uk.", "good.com.au.", "example."}
+
+	for _, matchSubdomains := range []bool{true, false} {
+		options := PluginOptions{
+			Sources:         []DomainSource{{Path: domains, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+			Allowlist:       []DomainSource{{Path: allowed, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+			MatchSubdomains: matchSubdomains,
+			ETLDPlusOne:     true,
+		}
+		list, err := buildCacheFromFile(options, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, name := range matched {
+			if !list.Contains(name) {
+				t.Fatalf("match_subdomains %t: expected %s to be matched", matchSubdomains, name)
+			}
+		}
+		for _, name := range unmatched {
+			if list.Contains(name) {
+				t.Fatalf("match_subdomains %t: expected %s not to be matched", matchSubdomains, name)
+			}
+		}
+		if !cmp.Equal(3, list.Len()) {
+			t.Fatalf("match_subdomains %t: \n\n%s\n", matchSubdomains, cmp.Diff(3, list.Len()))
+		}
+
+		// Allowlist entries aren't reduced, so they don't carve out their whole organization
+		allowlist, err := buildAllowlistFromFile(options, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !allowlist.Contains("cdn.evil.co.uk.") || allowlist.Contains("www.evil.co.uk.") {
+			t.Fatalf("match_subdomains %t: expected the allowlist to only match cdn.evil.co.uk", matchSubdomains)
+		}
+	}
+}
+
+func Test_buildCacheBroadEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	domains := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(domains, []byte("com\n*.co.uk\nevil.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name            string
+		matchSubdomains bool
+		allowBroad      bool
+		matched         []string
+		unmatched       []string
+		len             int
+	}{
+		{
+			name:            "case 0: public suffixes matching their subdomains are skipped",
+			matchSubdomains: true,
+			matched:         []string{"evil.example.", "a.evil.example."},
+			unmatched:       []string{"com.", "good.com.", "good.co.uk."},
+			len:             1,
+		},
+		{
+			name:      "case 1: a public suffix matched exactly is loaded, but a wildcard one isn't",
+			matched:   []string{"com.", "evil.example."},
+			unmatched: []string{"good.com.", "good.co.uk."},
+			len:       2,
+		},
+		{
+			name:            "case 2: allow_broad_entries loads public suffixes matching their subdomains",
+			matchSubdomains: true,
+			allowBroad:      true,
+			matched:         []string{"com.", "good.com.", "good.co.uk.", "evil.example."},
+			len:             3,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Sources:           []DomainSource{{Path: domains, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+				MatchSubdomains:   tc.matchSubdomains,
+				AllowBroadEntries: tc.allowBroad,
+			}
+			list, err := buildCacheFromFile(options, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, name := range tc.matched {
+				if !list.Contains(name) {
+					t.Fatalf("expected %s to be matched", name)
+				}
+			}
+			for _, name := range tc.unmatched {
+				if list.Contains(name) {
+					t.Fatalf("expected %s not to be matched", name)
+				}
+			}
+			if !cmp.Equal(tc.len, list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.len, list.Len()))
+			}
+		})
+	}
+}
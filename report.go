@@ -0,0 +1,85 @@
+package warnlist
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/request"
+)
+
+// buildReportListFromFile builds the report list, whose matches are only reported, so the entries of an experimental
+// list can be evaluated before they are promoted to the warnlist. It is matched like the warnlist, and returns nil if
+// no report list is configured.
+func buildReportListFromFile(options PluginOptions, validators sourceValidators) (Warnlist, error) {
+	if len(options.ReportList) == 0 {
+		return nil, nil
+	}
+
+	// Print a log message with the time it took to build the cache
+	defer logTime("Building report list cache took %s", time.Now())
+
+	// The report list is matched on the query name, like the allowlist, rather than on its skeleton
+	options.Confusables = false
+
+	reportList, malformed, err := buildCache(options.ReportList, options, validators, nil, nil, nil)
+	if err == nil {
+		log.Infof("loaded %d domains into report list, skipped %d malformed lines", reportList.Len(), malformed)
+		options.counts.recordLoaded("report", reportList.Len())
+		options.counts.recordMalformed("report", malformed)
+	}
+
+	return reportList, err
+}
+
+// checkReportList reports a query matching the report list. The response is never changed, whatever the response
+// and audit settings are.
+func (wp *WarnlistPlugin) checkReportList(ctx context.Context, req request.Request, name string) {
+	wp.mu.RLock()
+	reportList := wp.reportList
+	wp.mu.RUnlock()
+	if reportList == nil {
+		return
+	}
+
+	entry, _, hit := lookup(reportList, name, req.QType())
+	if !hit {
+		return
+	}
+	source := sourceOf(reportList, entry)
+	reportMatches.WithLabelValues(metrics.WithServer(ctx), source).Inc()
+	wp.logReport(req, entry, source)
+}
+
+// logReport logs a query matching the given entry of the report list, in the configured log format.
+func (wp *WarnlistPlugin) logReport(req request.Request, entry string, source string) {
+	if wp.Options.LogLevel == LogLevelNone || !wp.sampleLog() {
+		return
+	}
+	client := wp.clientIP(req)
+	if wp.Options.LogFormat != LogFormatJSON {
+		var details string
+		if source != "" {
+			details = " from source: " + source
+		}
+		wp.logAtLevel("host ", client, " requested domain: ", req.Name(), " matching report list entry: ", entry, details)
+		return
+	}
+
+	record := matchRecord{
+		Time:   time.Now().UTC().Format(time.RFC3339Nano),
+		Client: client,
+		Name:   req.Name(),
+		Type:   req.Type(),
+		Entry:  entry,
+		Source: source,
+		Report: true,
+	}
+	msg, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("unable to marshal log record: %v", err)
+		return
+	}
+	wp.logAtLevel(string(msg))
+}
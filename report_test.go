@@ -0,0 +1,141 @@
+package warnlist
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCheckReportList(t *testing.T) {
+	wl := NewRadixWarnlist()
+	wl.Add("evil.com.")
+	wl.Close()
+
+	al := NewRadixWarnlist()
+	al.Add("allowed.example.")
+	al.Close()
+
+	rl := NewRadixWarnlist()
+	rl.Add("candidate.example.")
+	rl.Add("evil.com.")
+	rl.Add("allowed.example.")
+	rl.Close()
+
+	var testCases = []struct {
+		name     string
+		domain   string
+		rcode    int
+		reported bool
+	}{
+		{
+			name:     "case 0: a report list match is passed through and reported",
+			domain:   "candidate.example.",
+			rcode:    dns.RcodeServerFailure,
+			reported: true,
+		},
+		{
+			name:     "case 1: a domain in both lists is still blocked, and reported",
+			domain:   "evil.com.",
+			rcode:    dns.RcodeNameError,
+			reported: true,
+		},
+		{
+			name:   "case 2: an allowlisted domain isn't reported",
+			domain: "allowed.example.",
+			rcode:  dns.RcodeServerFailure,
+		},
+		{
+			name:   "case 3: a domain in neither list isn't reported",
+			domain: "clean.example.",
+			rcode:  dns.RcodeServerFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{
+				Next:       test.ErrorHandler(),
+				warnlist:   wl,
+				allowlist:  al,
+				reportList: rl,
+				Options:    PluginOptions{Response: ResponseNXDomain},
+			}
+
+			counter := reportMatches.WithLabelValues("", "")
+			before := testutil.ToFloat64(counter)
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rec.Msg.Rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rec.Msg.Rcode))
+			}
+			reported := testutil.ToFloat64(counter) > before
+			if !cmp.Equal(tc.reported, reported) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.reported, reported))
+			}
+		})
+	}
+}
+
+func TestReloadReportList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	warnlistPath := filepath.Join(dir, "warnlist.txt")
+	reportPath := filepath.Join(dir, "report.txt")
+	if err := ioutil.WriteFile(warnlistPath, []byte("evil.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(reportPath, []byte("a.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{
+		Sources:    []DomainSource{{Path: warnlistPath, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		ReportList: []DomainSource{{Path: reportPath, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+	}
+	caches, err := buildCaches(options, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := newWarnlistPlugin(options, caches, time.Now())
+	if !wp.reportList.Contains("a.example.") {
+		t.Fatalf("expected a.example. to be loaded into the report list")
+	}
+	if wp.warnlist.Contains("a.example.") {
+		t.Fatalf("expected a.example. not to be loaded into the warnlist")
+	}
+
+	if err := ioutil.WriteFile(reportPath, []byte("b.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !wp.reportList.Contains("b.example.") {
+		t.Fatalf("expected b.example. to be loaded into the report list after the reload")
+	}
+	if wp.reportList.Contains("a.example.") {
+		t.Fatalf("expected a.example. to be dropped from the report list after the reload")
+	}
+}
@@ -0,0 +1,230 @@
+package warnlist
+
+import (
+	"net"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	ResponsePassthrough = "passthrough"
+	ResponseNXDomain    = "nxdomain"
+	ResponseRefused     = "refused"
+	ResponseNoData      = "nodata"
+	ResponseSinkhole    = "sinkhole"
+
+	// ResponseAudit passes the queries matched by a kind of match through, counting them like audit mode does
+	ResponseAudit = "audit"
+
+	// DefaultBlockTTL is the TTL in seconds of synthesized answers if none is configured.
+	DefaultBlockTTL = 60
+
+	// DefaultSOAMname and DefaultSOARname are the primary server and mailbox of the SOA of negative block
+	// responses if none are configured, in a reserved TLD.
+	DefaultSOAMname = "warnlist.invalid."
+	DefaultSOARname = "hostmaster.warnlist.invalid."
+
+	// DefaultAnnotateCode is the EDNS0 option code carrying the matched entry, the first of the local range.
+	DefaultAnnotateCode = dns.EDNS0LOCALSTART
+
+	// refusedReason is the extra text of the extended DNS error of refused responses.
+	refusedReason = "blocked by warnlist"
+)
+
+// The kinds of literal matches, which can be answered with responses of their own.
+const (
+	// MatchKindExact is a match of the listed domain itself
+	MatchKindExact = "exact"
+	// MatchKindSubtree is a match of a subdomain of a listed domain
+	MatchKindSubtree = "subtree"
+	// MatchKindWildcard is a match of a *. wildcard entry, when subdomains aren't matched otherwise
+	MatchKindWildcard = "wildcard"
+)
+
+// matchKind returns the kind of a match of the entry for the name it was looked up by, or an empty string for
+// matches which aren't literal, like those of regex patterns.
+func matchKind(mechanism string, entry string, name string) string {
+	switch {
+	case mechanism != MatchLiteral:
+		return ""
+	case strings.HasPrefix(entry, wildcardPrefix):
+		return MatchKindWildcard
+	case entry == name:
+		return MatchKindExact
+	}
+	return MatchKindSubtree
+}
+
+// isValidResponse returns true if the given response is one the plugin knows how to write.
+func isValidResponse(response string) bool {
+	for _, t := range []string{ResponsePassthrough, ResponseNXDomain, ResponseRefused, ResponseNoData} {
+		if response == t {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBlockResponse answers a warnlisted query according to the configured response, without calling the next plugin.
+func (wp *WarnlistPlugin) writeBlockResponse(w dns.ResponseWriter, r *dns.Msg, entry string, kind string) (int, error) {
+	m := wp.blockResponse(r, entry, kind)
+	if err := w.WriteMsg(m); err != nil {
+		return dns.RcodeServerFailure, plugin.Error(wp.Name(), err)
+	}
+
+	// Some rcodes signal to the server that nothing was written yet, which we already did.
+	if !plugin.ClientWrite(m.Rcode) {
+		return dns.RcodeSuccess, nil
+	}
+	return m.Rcode, nil
+}
+
+// blockResponse returns the configured response to a query matching the given warnlist entry with the kind of match.
+func (wp *WarnlistPlugin) blockResponse(r *dns.Msg, entry string, kind string) *dns.Msg {
+	m := new(dns.Msg)
+	switch wp.responseFor(r.Question[0].Qtype, kind) {
+	case ResponseRefused:
+		m.SetRcode(r, dns.RcodeRefused)
+		// A bare REFUSED looks like a misconfigured server, so tell EDNS0 clients the name is blocked on purpose
+		if opt := responseEdns0(m, r); opt != nil {
+			opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeBlocked, ExtraText: refusedReason})
+		}
+	case ResponseNoData:
+		m.SetReply(r)
+		m.Ns = []dns.RR{wp.blockSOA(r.Question[0], entry)}
+	case ResponseSinkhole:
+		m.SetReply(r)
+		m.Answer = wp.sinkholeAnswer(r.Question[0])
+		if len(m.Answer) == 0 {
+			m.Ns = []dns.RR{wp.blockSOA(r.Question[0], entry)}
+		}
+	default:
+		m.SetRcode(r, dns.RcodeNameError)
+		m.Ns = []dns.RR{wp.blockSOA(r.Question[0], entry)}
+	}
+
+	if wp.Options.Annotate {
+		wp.annotate(m, r, entry)
+	}
+	return m
+}
+
+// annotate attaches the matched entry to a block response: as an EDNS0 local option if the client sent an OPT
+// record, and as a TXT answer to TXT queries. Clients not using EDNS0 never get an OPT record they didn't ask for.
+func (wp *WarnlistPlugin) annotate(m *dns.Msg, r *dns.Msg, entry string) {
+	if opt := responseEdns0(m, r); opt != nil {
+		opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{Code: wp.Options.AnnotateCode, Data: []byte(entry)})
+	}
+
+	q := r.Question[0]
+	if q.Qtype == dns.TypeTXT {
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: wp.Options.BlockTTL}
+		m.Answer = append(m.Answer, &dns.TXT{Hdr: hdr, Txt: []string{"warnlisted: " + entry}})
+	}
+}
+
+// responseEdns0 returns the OPT record of the response to a query, adding one matching the OPT record of the query if
+// the response has none yet. It returns nil if the query has no OPT record, since a client not using EDNS0 mustn't get
+// one back (RFC 6891).
+func responseEdns0(m *dns.Msg, r *dns.Msg) *dns.OPT {
+	if opt := m.IsEdns0(); opt != nil {
+		return opt
+	}
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	m.SetEdns0(opt.UDPSize(), opt.Do())
+	return m.IsEdns0()
+}
+
+// responseFor returns the response to warnlisted queries of the given type and kind of match: the one set for the kind
+// of match, like with response_exact, the one set with type_response for the type, or the configured response
+// otherwise.
+func (wp *WarnlistPlugin) responseFor(qtype uint16, kind string) string {
+	if response, ok := wp.Options.KindResponses[kind]; ok {
+		return response
+	}
+	if response, ok := wp.Options.TypeResponses[qtype]; ok {
+		return response
+	}
+	return wp.Options.Response
+}
+
+// blocks returns true if warnlisted queries of the given type and kind of match are answered by the plugin instead of
+// being passed through. In audit mode queries are always passed through, whatever the configured response.
+func (wp *WarnlistPlugin) blocks(qtype uint16, kind string) bool {
+	response := wp.responseFor(qtype, kind)
+	return !wp.audits(kind) && response != ResponsePassthrough && response != ""
+}
+
+// audits returns true if matches of the kind are only counted and passed through, because the plugin is in audit mode
+// or the kind of match has the audit response.
+func (wp *WarnlistPlugin) audits(kind string) bool {
+	return wp.Options.Audit || wp.Options.KindResponses[kind] == ResponseAudit
+}
+
+// blockSOA returns the SOA record of a negative block response, so resolvers cache it for block_ttl seconds
+// (RFC 2308). The record is owned by the matched entry, which is the closest zone of the name being blocked.
+func (wp *WarnlistPlugin) blockSOA(q dns.Question, entry string) dns.RR {
+	zone := dns.Fqdn(strings.TrimPrefix(entry, wildcardPrefix))
+	if entry == "" || !dns.IsSubDomain(zone, strings.ToLower(q.Name)) {
+		// The entry isn't in the same form as the question, e.g. for IDNs, so own the record by the name itself
+		zone = q.Name
+	}
+
+	mname, rname := wp.Options.SOAMname, wp.Options.SOARname
+	if mname == "" {
+		mname = DefaultSOAMname
+	}
+	if rname == "" {
+		rname = DefaultSOARname
+	}
+
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: wp.Options.BlockTTL},
+		Ns:      mname,
+		Mbox:    rname,
+		Serial:  1,
+		Refresh: 7200,
+		Retry:   3600,
+		Expire:  86400,
+		Minttl:  wp.Options.BlockTTL,
+	}
+}
+
+// sinkholeAnswer returns the records pointing the question at the configured sinkhole.
+// Questions for other types, or for an address family without a sinkhole, get no records.
+func (wp *WarnlistPlugin) sinkholeAnswer(q dns.Question) []dns.RR {
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: wp.Options.BlockTTL}
+
+	switch q.Qtype {
+	case dns.TypeA:
+		if wp.Options.SinkholeIPv4 != nil {
+			return []dns.RR{&dns.A{Hdr: hdr, A: wp.Options.SinkholeIPv4}}
+		}
+	case dns.TypeAAAA:
+		if wp.Options.SinkholeIPv6 != nil {
+			return []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: wp.Options.SinkholeIPv6}}
+		}
+	}
+	return nil
+}
+
+// parseSinkholeIP parses an address of the given family, returning nil if it is not one.
+func parseSinkholeIP(s string, v6 bool) net.IP {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	if v6 {
+		if ip.To4() != nil {
+			return nil
+		}
+		return ip
+	}
+	return ip.To4()
+}
@@ -0,0 +1,100 @@
+package warnlist
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// rpzNameTriggers are the RPZ qualifiers which are attached to a domain name.
+var rpzNameTriggers = []string{".rpz-nsdname"}
+
+// rpzAddressTriggers are the RPZ qualifiers which are attached to an IP address instead of a domain name.
+var rpzAddressTriggers = []string{".rpz-ip", ".rpz-nsip", ".rpz-client-ip"}
+
+// newRPZParser returns a parser for Response Policy Zone files.
+// It keeps track of the zone origin, so fully qualified owner names can be made relative to it.
+func newRPZParser() lineParser {
+	origin := ""
+
+	return func(line string) (string, bool) {
+		// Strip trailing comments
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+
+		// Lines starting with whitespace continue the previous owner, which is only used for the zone apex records
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			return "", false
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return "", false
+		}
+
+		if fields[0] == "$ORIGIN" {
+			if len(fields) > 1 {
+				origin = dns.Fqdn(strings.ToLower(fields[1]))
+			}
+			return "", false
+		}
+		if strings.HasPrefix(fields[0], "$") || fields[0] == "@" {
+			// Skip other directives ($TTL, $INCLUDE) and the zone apex
+			return "", false
+		}
+
+		rrtype, rdata := rpzRecord(fields[1:])
+		if rrtype == "SOA" || rrtype == "NS" {
+			return "", false
+		}
+		if rrtype == "CNAME" && strings.EqualFold(rdata, "rpz-passthru.") {
+			// Passthru entries explicitly exempt the name from the policy
+			return "", false
+		}
+
+		return rpzTrigger(fields[0], origin)
+	}
+}
+
+// rpzRecord returns the type and the first rdata field of a record, skipping an optional TTL and class.
+func rpzRecord(fields []string) (string, string) {
+	for i, f := range fields {
+		f = strings.ToUpper(f)
+		if _, ok := dns.StringToType[f]; ok {
+			if i+1 < len(fields) {
+				return f, fields[i+1]
+			}
+			return f, ""
+		}
+	}
+	return "", ""
+}
+
+// rpzTrigger returns the domain an RPZ owner name applies to.
+func rpzTrigger(owner string, origin string) (string, bool) {
+	name := strings.ToLower(owner)
+
+	// Make fully qualified names relative to the zone
+	if strings.HasSuffix(name, ".") {
+		if origin == "" || !dns.IsSubDomain(origin, name) || name == origin {
+			return "", false
+		}
+		name = strings.TrimSuffix(name, "."+origin)
+	}
+
+	for _, t := range rpzAddressTriggers {
+		if strings.HasSuffix(name, t) {
+			// IP address triggers don't name a domain
+			return "", false
+		}
+	}
+	for _, t := range rpzNameTriggers {
+		name = strings.TrimSuffix(name, t)
+	}
+
+	// Wildcard entries cover the subdomains of the base domain
+	name = strings.TrimPrefix(name, "*.")
+
+	return name, name != ""
+}
@@ -0,0 +1,119 @@
+package warnlist
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testRPZ = `$TTL 300
+$ORIGIN rpz.example.
+@ IN SOA localhost. root.localhost. (
+        1 ; serial
+        3600 ; refresh
+        600 ; retry
+        86400 ; expire
+        60 ) ; minimum
+    IN NS localhost.
+
+; Plain domain entries
+bad.example.com CNAME .
+*.wildcard.example CNAME .
+ttl.example 60 IN CNAME rpz-drop.
+Upper.Example A 10.0.0.1 ; trailing comment
+qualified.example.rpz.example. CNAME .
+
+; Qualified triggers
+ns.evil.example.rpz-nsdname CNAME .
+32.1.0.0.127.rpz-ip CNAME .
+32.1.0.0.127.rpz-client-ip CNAME .
+
+; Exemptions
+safe.example CNAME rpz-passthru.
+`
+
+func Test_rpzParser(t *testing.T) {
+	expected := []string{
+		"bad.example.com",
+		"wildcard.example",
+		"ttl.example",
+		"upper.example",
+		"qualified.example",
+		"ns.evil.example",
+	}
+
+	parse := newRPZParser()
+	var domains []string
+	for _, line := range splitLines(testRPZ) {
+		if domain, ok := parse(line); ok {
+			domains = append(domains, domain)
+		}
+	}
+
+	if !cmp.Equal(expected, domains) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(expected, domains))
+	}
+}
+
+func Test_rpzTrigger(t *testing.T) {
+	var testCases = []struct {
+		name   string
+		owner  string
+		origin string
+		domain string
+		ok     bool
+	}{
+		{
+			name:   "case 0: a relative owner is used as is",
+			owner:  "bad.example.com",
+			origin: "rpz.example.",
+			domain: "bad.example.com",
+			ok:     true,
+		},
+		{
+			name:   "case 1: a fully qualified owner is made relative to the origin",
+			owner:  "bad.example.com.rpz.example.",
+			origin: "rpz.example.",
+			domain: "bad.example.com",
+			ok:     true,
+		},
+		{
+			name:   "case 2: a fully qualified owner outside the origin is skipped",
+			owner:  "bad.example.com.",
+			origin: "rpz.example.",
+			ok:     false,
+		},
+		{
+			name:   "case 3: an nsdname trigger is stripped to the base domain",
+			owner:  "ns.bad.example.rpz-nsdname",
+			domain: "ns.bad.example",
+			ok:     true,
+		},
+		{
+			name:  "case 4: an ip trigger is skipped",
+			owner: "24.0.2.0.192.rpz-ip",
+			ok:    false,
+		},
+		{
+			name:   "case 5: a wildcard is stripped to the base domain",
+			owner:  "*.bad.example",
+			domain: "bad.example",
+			ok:     true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			domain, ok := rpzTrigger(tc.owner, tc.origin)
+			if !cmp.Equal(tc.ok, ok) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.ok, ok))
+			}
+			if !cmp.Equal(tc.domain, domain) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.domain, domain))
+			}
+		})
+	}
+}
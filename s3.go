@@ -0,0 +1,96 @@
+package warnlist
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3Client is the part of the S3 API used to load sources.
+type s3Client interface {
+	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+}
+
+// newS3Client returns a client configured from the standard AWS environment, shared config and instance role chain.
+// It is a variable so tests can replace it.
+var newS3Client = func() (s3Client, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess), nil
+}
+
+// sourceTypeForURL returns the source type of a url directive, which also accepts s3://bucket/key and
+// sftp://user@host/path URLs.
+func sourceTypeForURL(path string) string {
+	if strings.HasPrefix(path, "s3://") {
+		return DomainSourceTypeS3
+	}
+	if strings.HasPrefix(path, "sftp://") {
+		return DomainSourceTypeSFTP
+	}
+	return DomainSourceTypeURL
+}
+
+// parseS3URL splits an s3://bucket/key URL into its bucket and key.
+func parseS3URL(path string) (string, string, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "s3" || u.Host == "" || key == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %s (must be s3://bucket/key)", path)
+	}
+	return u.Host, key, nil
+}
+
+// fetchS3 gets the object the s3://bucket/key URL refers to. If the validator is set, the request is conditional and
+// errNotModified is returned if the object hasn't changed.
+func fetchS3(path string, v httpValidator) (*s3.GetObjectOutput, error) {
+	bucket, key, err := parseS3URL(path)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newS3Client()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create S3 client: %w", err)
+	}
+
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if v.ETag != "" {
+		input.IfNoneMatch = aws.String(v.ETag)
+	}
+	if v.LastModified != "" {
+		if t, err := time.Parse(http.TimeFormat, v.LastModified); err == nil {
+			input.IfModifiedSince = aws.Time(t)
+		}
+	}
+
+	out, err := client.GetObject(input)
+	if err != nil {
+		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotModified {
+			return nil, errNotModified
+		}
+		return nil, fmt.Errorf("unable to load %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// objectValidator returns the validators of an S3 object.
+func objectValidator(out *s3.GetObjectOutput) httpValidator {
+	v := httpValidator{ETag: aws.StringValue(out.ETag)}
+	if out.LastModified != nil {
+		v.LastModified = out.LastModified.UTC().Format(http.TimeFormat)
+	}
+	return v
+}
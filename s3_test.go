@@ -0,0 +1,166 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeS3Client serves objects from memory, and answers conditional requests for the given ETag.
+type fakeS3Client struct {
+	objects map[string]string
+	etag    string
+	inputs  []*s3.GetObjectInput
+}
+
+func (f *fakeS3Client) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	f.inputs = append(f.inputs, input)
+
+	if aws.StringValue(input.IfNoneMatch) == f.etag {
+		return nil, awserr.NewRequestFailure(awserr.New("NotModified", "Not Modified", nil), http.StatusNotModified, "")
+	}
+
+	data, ok := f.objects[aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil), http.StatusNotFound, "")
+	}
+	return &s3.GetObjectOutput{
+		Body:         ioutil.NopCloser(strings.NewReader(data)),
+		ETag:         aws.String(f.etag),
+		LastModified: aws.Time(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)),
+	}, nil
+}
+
+func Test_buildCacheFromS3(t *testing.T) {
+	client := &fakeS3Client{
+		objects: map[string]string{
+			"feeds/domains.txt": testTextList,
+			"feeds/hosts":       testHostfile,
+		},
+		etag: `"abc123"`,
+	}
+	defer func(f func() (s3Client, error)) { newS3Client = f }(newS3Client)
+	newS3Client = func() (s3Client, error) { return client, nil }
+
+	var testCases = []struct {
+		name      string
+		path      string
+		format    string
+		expectErr bool
+	}{
+		{
+			name:   "case 0: a text list object is loaded",
+			path:   "s3://feeds/domains.txt",
+			format: DomainFileFormatTextList,
+		},
+		{
+			name:   "case 1: a hostfile object is loaded",
+			path:   "s3://feeds/hosts",
+			format: DomainFileFormatHostfile,
+		},
+		{
+			name:      "case 2: a missing object returns an error",
+			path:      "s3://feeds/missing",
+			format:    DomainFileFormatTextList,
+			expectErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: tc.path, Type: DomainSourceTypeS3, Format: tc.format}},
+				MatchSubdomains: true,
+			}
+			validators := sourceValidators{}
+			list, err := buildCacheFromFile(options, validators)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, domain := range []string{"example.org.", "something.evil."} {
+				if !cmp.Equal(true, list.Contains(domain)) {
+					t.Fatalf("expected %s to be loaded", domain)
+				}
+			}
+
+			// The object's validators let later reloads skip it while it's unchanged
+			if !cmp.Equal(true, sourcesUnchanged(options.Sources, options, validators)) {
+				t.Fatalf("expected the unchanged object to be detected")
+			}
+		})
+	}
+}
+
+func Test_parseS3URL(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		path      string
+		bucket    string
+		key       string
+		expectErr bool
+	}{
+		{
+			name:   "case 0: a bucket and key are parsed",
+			path:   "s3://feeds/domains.txt",
+			bucket: "feeds",
+			key:    "domains.txt",
+		},
+		{
+			name:   "case 1: a nested key is parsed",
+			path:   "s3://feeds/lists/2021/domains.txt.gz",
+			bucket: "feeds",
+			key:    "lists/2021/domains.txt.gz",
+		},
+		{
+			name:      "case 2: a missing key returns an error",
+			path:      "s3://feeds/",
+			expectErr: true,
+		},
+		{
+			name:      "case 3: a missing bucket returns an error",
+			path:      "s3:///domains.txt",
+			expectErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			bucket, key, err := parseS3URL(tc.path)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(tc.bucket, bucket) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.bucket, bucket))
+			}
+			if !cmp.Equal(tc.key, key) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.key, key))
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package warnlist
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultScore is the score of the domains of scored sources listed without one, if default_score isn't set.
+const DefaultScore = 0
+
+// newScoredParser returns a parser for domain,score lists, which only takes the domains scored at least minScore, so
+// the threshold of a noisy feed can be tuned without editing it. Domains listed without a score get defaultScore. A
+// first row whose score isn't a number is skipped as a header. malformed is called for every other row which isn't a
+// domain followed by an optional score.
+func newScoredParser(minScore float64, defaultScore float64, malformed func()) lineParser {
+	first := true
+
+	return func(line string) (string, bool) {
+		header := first
+		first = false
+
+		domain, score, ok := splitScoredDomain(line, defaultScore)
+		if !ok {
+			if header && strings.Contains(line, ",") {
+				// The optional header, like "domain,score", is the only row whose score may not be a number
+				return "", false
+			}
+			malformed()
+			log.Warningf("skipping malformed scored row %q, expected domain,score", line)
+			return "", false
+		}
+		// Domains below the threshold aren't malformed, they are left out on purpose
+		return domain, score >= minScore
+	}
+}
+
+// splitScoredDomain splits a domain,score row into its domain and score, which is defaultScore if the row has none. It
+// returns false if the row has no domain, more than two columns, or a score which isn't a number.
+func splitScoredDomain(line string, defaultScore float64) (string, float64, bool) {
+	i := strings.IndexByte(line, ',')
+	if i < 0 {
+		domain := strings.TrimSpace(line)
+		return domain, defaultScore, domain != ""
+	}
+	domain := strings.TrimSpace(line[:i])
+	field := strings.TrimSpace(line[i+1:])
+	if domain == "" || strings.IndexByte(field, ',') >= 0 {
+		return "", 0, false
+	}
+	if field == "" {
+		return domain, defaultScore, true
+	}
+	score, err := strconv.ParseFloat(field, 64)
+	if err != nil || math.IsNaN(score) {
+		// NaN scores compare false with every threshold, so they would be silently dropped
+		return "", 0, false
+	}
+	return domain, score, true
+}
@@ -0,0 +1,149 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testScoredList = `domain,score
+low.example,10
+edge.example,50
+above.example,50.5
+high.example,99
+unscored.example
+empty.example,
+`
+
+func Test_scoredParser(t *testing.T) {
+	var testCases = []struct {
+		name         string
+		data         string
+		minScore     float64
+		defaultScore float64
+		expected     []string
+		malformed    int
+	}{
+		{
+			name:     "case 0: without a threshold, every scored domain is loaded",
+			data:     testScoredList,
+			expected: []string{"low.example", "edge.example", "above.example", "high.example", "unscored.example", "empty.example"},
+		},
+		{
+			name:     "case 1: a domain scored at the threshold is loaded, and one below it isn't",
+			data:     testScoredList,
+			minScore: 50,
+			expected: []string{"edge.example", "above.example", "high.example"},
+		},
+		{
+			name:     "case 2: a threshold just above a score leaves its domain out",
+			data:     testScoredList,
+			minScore: 50.1,
+			expected: []string{"above.example", "high.example"},
+		},
+		{
+			name:     "case 3: a threshold above every score loads nothing",
+			data:     testScoredList,
+			minScore: 100,
+		},
+		{
+			name:         "case 4: domains without a score get the default score",
+			data:         testScoredList,
+			minScore:     50,
+			defaultScore: 50,
+			expected:     []string{"edge.example", "above.example", "high.example", "unscored.example", "empty.example"},
+		},
+		{
+			name:         "case 5: a default score below the threshold leaves the unscored domains out",
+			data:         testScoredList,
+			minScore:     50,
+			defaultScore: 49.9,
+			expected:     []string{"edge.example", "above.example", "high.example"},
+		},
+		{
+			name:     "case 6: negative scores are compared like any other",
+			data:     "bad.example,-1\nworse.example,-0.5\n",
+			minScore: -0.5,
+			expected: []string{"worse.example"},
+		},
+		{
+			name:      "case 7: rows which aren't a domain followed by a score are malformed",
+			data:      "bad.example,90\nworse.example,high\n,90\nevil.example,90,phishing\nnan.example,NaN\nfine.example,80\n",
+			minScore:  50,
+			expected:  []string{"bad.example", "fine.example"},
+			malformed: 4,
+		},
+		{
+			name:      "case 8: only the first row can be a header",
+			data:      "bad.example,90\ndomain,score\n",
+			expected:  []string{"bad.example"},
+			malformed: 1,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			malformed := 0
+			parse := newScoredParser(tc.minScore, tc.defaultScore, func() { malformed++ })
+			var domains []string
+			for _, line := range splitLines(tc.data) {
+				if domain, ok := parse(line); ok {
+					domains = append(domains, domain)
+				}
+			}
+
+			if !cmp.Equal(tc.expected, domains) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, domains))
+			}
+			if !cmp.Equal(tc.malformed, malformed) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.malformed, malformed))
+			}
+		})
+	}
+}
+
+func Test_buildCacheScored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "scored.csv")
+	if err := ioutil.WriteFile(path, []byte(testScoredList), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{
+		Sources:      []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatScored}},
+		MinScore:     50,
+		DefaultScore: DefaultScore,
+	}
+	list, malformed, err := buildCache(options.Sources, options, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cmp.Equal(3, list.Len()) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(3, list.Len()))
+	}
+	// Domains below the threshold are left out on purpose, so they aren't counted as malformed
+	if !cmp.Equal(0, malformed) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(0, malformed))
+	}
+	for _, domain := range []string{"edge.example.", "above.example.", "high.example."} {
+		if !list.Contains(domain) {
+			t.Fatalf("expected %s to be loaded", domain)
+		}
+	}
+	for _, domain := range []string{"low.example.", "unscored.example."} {
+		if list.Contains(domain) {
+			t.Fatalf("expected %s not to be loaded", domain)
+		}
+	}
+}
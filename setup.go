@@ -1,26 +1,125 @@
 package warnlist
 
 import (
-	"fmt"
+	"context"
+	"math"
 	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 
 	"github.com/coredns/caddy"
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/ssh"
 )
 
 const MaxJitterPercent = 30
 
+const (
+	// DefaultMinReloadPeriod is the shortest reload period allowed when any of the sources is fetched from a server
+	DefaultMinReloadPeriod = time.Minute
+	// DefaultMinFileReloadPeriod is the shortest reload period allowed when all of the sources are local files
+	DefaultMinFileReloadPeriod = time.Second
+)
+
 // PluginOptions stores the configuration options given in the corefile
 type PluginOptions struct {
-	DomainSource     string
-	DomainSourceType string
-	FileFormat       string
-	MatchSubdomains  bool
-	ReloadPeriod     time.Duration
+	Sources           []DomainSource
+	MatchSubdomains   bool
+	ReloadPeriod      time.Duration
+	MinReloadPeriod   time.Duration
+	MaxStale          time.Duration
+	Response          string
+	TypeResponses     map[uint16]string
+	KindResponses     map[string]string
+	SinkholeIPv4      net.IP
+	SinkholeIPv6      net.IP
+	BlockTTL          uint32
+	SOAMname          string
+	SOARname          string
+	Bloom             bool
+	VerboseMatch      bool
+	CheckCNAME        bool
+	Audit             bool
+	LogFormat         string
+	Annotate          bool
+	AnnotateCode      uint16
+	Retries           int
+	Headers           map[string]string
+	HeaderFiles       map[string]string
+	FileExtension     string
+	MaxEntries        int
+	MinEntries        int
+	StrictMaxEntries  bool
+	StrictContentType bool
+	Timeout           time.Duration
+	TLSCert           string
+	TLSKey            string
+	TLSCA             string
+	SFTPKey           string
+	SFTPKnownHosts    string
+	Proxy             *url.URL
+	UserAgent         string
+	CSVColumn         int
+	CSVHeader         bool
+	JSONField         string
+	MinScore          float64
+	DefaultScore      float64
+	ReloadSignal      os.Signal
+	DebugAddr         string
+	HitCounts         int
+	HealthAddr        string
+	UseECS            bool
+	AlertThreshold    int
+	AlertWindow       time.Duration
+	TypoDistance      int
+	RedisPassword     string
+	RedisDB           int
+	TAXIIUser         string
+	TAXIIPassword     string
+	OnError           string
+	StartupTimeout    time.Duration
+	AllowEmptyStartup bool
+	CacheFile         string
+	CacheMaxAge       time.Duration
+	ReservedHosts     []string
+	LogLevel          string
+	LogSample         int
+	MaxRegexes        int
+	BuildWorkers      int
+	Precedence        string
+	ETLDPlusOne       bool
+	StripWWW          bool
+	Confusables       bool
+	AllowBroadEntries bool
+	Watch             bool
+	DeltaURL          string
+	FullSyncPeriod    time.Duration
+	ChangeWebhook     string
+	ChangeThreshold   float64
+
+	Allowlist   []DomainSource
+	Protected   []DomainSource
+	IPBlocklist []DomainSource
+	ReportList  []DomainSource
+	Excludes    []string
+
+	// Transport is used for url requests if set. It is built from the TLS settings.
+	Transport http.RoundTripper
+	// SFTPConfig is used to connect to sftp sources. It is built from the sftp_key and sftp_known_hosts settings.
+	SFTPConfig *ssh.ClientConfig
+
+	// prefetched holds the new content of the sources a reload found changed, so its rebuild doesn't fetch them again
+	prefetched *prefetchedSources
+	// counts, if not nil, records the sizes of the lists built with the options
+	counts *listCounts
 }
 
 // init registers this plugin.
@@ -35,66 +134,160 @@ func setup(c *caddy.Controller) error {
 		log.Error("Unable to parse arguments: ", err)
 		return err
 	}
+	if options.Audit {
+		log.Warningf("running in audit mode: warnlisted queries are logged and counted, but never answered with the %s response", options.Response)
+	}
 
-	// Build the cache for the warnlist
-	warnlist, err := buildCacheFromFile(options)
+	// Build the caches for the warnlist, the allowlist and the protected domains. The first build is required to
+	// succeed, unless the plugin may start empty.
+	caches, err := buildStartupCaches(options)
 	reloadTime := time.Now()
 	if err != nil {
-		// Require the first build to succeed
 		return err
 	}
 
 	// Add the Plugin to CoreDNS, so Servers can use it in their plugin chain.
-	q := make(chan bool)
-	wp := WarnlistPlugin{warnlist: warnlist, lastReloadTime: reloadTime, Options: options, quit: q}
+	wp := newWarnlistPlugin(options, caches, reloadTime)
 
-	var tick *time.Ticker
-	{
-		// If our ReloadPeriod is configured, set up the reload hook
-		if options.ReloadPeriod > 0*time.Second {
-			tick = time.NewTicker(options.ReloadPeriod)
-			reloadHook(&wp, tick)
-		}
+	if caches.fromSnapshot {
+		// Serve the snapshot while the live sources are fetched. The fetch only starts once the instance does, so an
+		// instance which never starts, like one of a failed Corefile reload, doesn't keep fetching in the background.
+		c.OnStartup(func() error {
+			go rebuildWarnlist(wp)
+			return nil
+		})
+	}
+
+	// If our ReloadPeriod, or that of any source, is configured, reload the warnlist periodically. Like the signal handler, the reload hook is
+	// stopped by OnShutdown, which also runs when the Corefile is reloaded and before OnFinalShutdown.
+	if options.ReloadPeriod > 0*time.Second || len(options.sourceReloadPeriods()) > 0 {
+		c.OnStartup(func() error {
+			wp.startReloadHook(options.ReloadPeriod)
+			return nil
+		})
+		c.OnShutdown(func() error {
+			wp.stopReloadHook()
+			return nil
+		})
 	}
 
-	c.OnFinalShutdown(func() error {
-		// log.Info("Final Shutdown")
+	// If a reload signal is configured, reload whenever it's received
+	if options.ReloadSignal != nil {
+		// Like the reload hook, the handler only starts with the instance, since the shutdown callbacks of an instance
+		// which never starts, like one of a failed Corefile reload or a validation run, aren't run.
+		var stop func()
+		c.OnStartup(func() error {
+			stop = signalHook(wp, options.ReloadSignal)
+			return nil
+		})
+		// Unlike OnFinalShutdown, OnShutdown also runs when the Corefile is reloaded, so the handler of the previous
+		// instance doesn't keep reloading a warnlist which is no longer served.
+		c.OnShutdown(func() error {
+			if stop != nil {
+				stop()
+			}
+			return nil
+		})
+	}
 
-		// If our ReloadPeriod is configured, tear down the reload hook
-		if options.ReloadPeriod > 0*time.Second {
-			tick.Stop()
-			wp.quit <- true
-		}
+	// If a debug address is configured, serve the debug endpoints on it
+	if options.DebugAddr != "" {
+		d := &debugServer{addr: options.DebugAddr, wp: wp}
+		c.OnStartup(d.OnStartup)
+		c.OnRestart(d.OnFinalShutdown)
+		c.OnRestartFailed(d.OnStartup)
+		c.OnFinalShutdown(d.OnFinalShutdown)
+	}
 
-		return nil
-	})
+	// If a health address is configured, serve the health endpoint on it
+	if options.HealthAddr != "" {
+		h := &healthServer{addr: options.HealthAddr, wp: wp}
+		c.OnStartup(h.OnStartup)
+		c.OnRestart(h.OnFinalShutdown)
+		c.OnRestartFailed(h.OnStartup)
+		c.OnFinalShutdown(h.OnFinalShutdown)
+	}
+
+	// If watching is enabled, reload the lists as soon as their files change
+	if options.Watch {
+		c.OnStartup(wp.startWatcher)
+		// Like the reload hook, the watcher of the previous instance is stopped when the Corefile is reloaded
+		c.OnShutdown(func() error {
+			wp.stopWatcher()
+			return nil
+		})
+	}
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		wp.Next = next
-		return &wp
+		return wp
 	})
 
 	// All OK, return a nil error.
 	return nil
 }
 
-func reloadHook(wp *WarnlistPlugin, tick *time.Ticker) {
-	go func() {
-		for {
-			// log.Info("loop iteration")
-			select {
-			case <-tick.C:
-				// log.Info("Hook ticked")
+// newWarnlistPlugin returns a plugin serving the caches, which were built from the options at the given time.
+func newWarnlistPlugin(options PluginOptions, caches startupCaches, reloadTime time.Time) *WarnlistPlugin {
+	wp := &WarnlistPlugin{warnlist: caches.warnlist, allowlist: caches.allowlist, protected: caches.protected, ipBlocklist: caches.ipBlocklist, reportList: caches.reportList, lastReloadTime: reloadTime, loaded: caches.loaded, validators: caches.validators, sources: caches.sources, counts: caches.counts, Options: options}
+	if caches.loaded && !caches.fromSnapshot {
+		// Warnlists loaded from a snapshot or started empty are fully synced by the next reload
+		wp.lastFullSync = reloadTime
+	}
+	if caches.fromSnapshot {
+		// The warnlist is as old as the build which wrote the snapshot, so it isn't reported fresher than it is
+		wp.lastReloadTime = caches.snapshotTime
+	}
+	excludes := make([]string, 0, len(options.Excludes))
+	for _, name := range options.Excludes {
+		excludes = append(excludes, options.matchName(name))
+	}
+	wp.excludes = newExcludeList(excludes)
+	if options.AlertThreshold > 0 {
+		wp.alerts = newClientAlerts(options.AlertThreshold, options.AlertWindow)
+	}
+	if options.HitCounts > 0 {
+		wp.hits = newEntryHits(options.HitCounts)
+	}
+	return wp
+}
 
-				rebuildWarnlist(wp)
+// startReloadHook rebuilds the warnlist every period, if it isn't 0, and the sources with a reload period of their own
+// on their own schedule, until stopReloadHook is called.
+func (wp *WarnlistPlugin) startReloadHook(period time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wp.cancel = cancel
 
-			case <-wp.quit:
-				// log.Info("Stopping hook")
-				tick.Stop()
-				return
-			}
+	if period > 0 {
+		go reloadEvery(ctx, period, func() { rebuildWarnlist(wp) })
+	}
+	for sourcePeriod, sources := range wp.Options.sourceReloadPeriods() {
+		sources := sources
+		// Like the reload period, spread the reloads of the sources of many servers
+		go reloadEvery(ctx, jitter(sourcePeriod), func() { _ = wp.reloadSources(sources) })
+	}
+}
+
+// reloadEvery calls reload every period, until the context is done.
+func reloadEvery(ctx context.Context, period time.Duration, reload func()) {
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			reload()
+
+		case <-ctx.Done():
+			return
 		}
-	}()
+	}
+}
+
+// stopReloadHook stops the reload hook. It is safe to call if the hook was never started, or was stopped already.
+func (wp *WarnlistPlugin) stopReloadHook() {
+	if wp.cancel != nil {
+		wp.cancel()
+	}
 }
 
 func parseArguments(c *caddy.Controller) (PluginOptions, error) {
@@ -105,6 +298,34 @@ func parseArguments(c *caddy.Controller) (PluginOptions, error) {
 	// Match subdomains by default
 	options.MatchSubdomains = true
 
+	// Only report warnlisted domains by default
+	options.Response = ResponsePassthrough
+	options.OnError = OnErrorPassthrough
+	options.Precedence = PrecedenceAllow
+	options.BlockTTL = DefaultBlockTTL
+	options.SOAMname = DefaultSOAMname
+	options.SOARname = DefaultSOARname
+	options.Timeout = DefaultFetchTimeout
+	options.LogFormat = LogFormatText
+	options.LogLevel = LogLevelWarning
+	options.MaxRegexes = DefaultMaxRegexes
+	options.BuildWorkers = DefaultBuildWorkers
+	options.AnnotateCode = DefaultAnnotateCode
+	options.AlertWindow = DefaultAlertWindow
+	options.CacheMaxAge = DefaultCacheMaxAge
+	options.ReservedHosts = DefaultReservedHosts
+	options.FullSyncPeriod = DefaultFullSyncPeriod
+	options.ChangeThreshold = DefaultChangeThreshold
+
+	// Take csv domains from the first column, below a header row, by default
+	options.CSVColumn = DefaultCSVColumn
+	options.CSVHeader = true
+	options.JSONField = DefaultJSONField
+	options.DefaultScore = DefaultScore
+
+	// Fail builds which exceed max_entries by default, keeping the loaded list
+	options.StrictMaxEntries = true
+
 	for c.NextBlock() {
 		if err := parseBlock(c, &options); err != nil {
 			return options, err
@@ -112,39 +333,522 @@ func parseArguments(c *caddy.Controller) (PluginOptions, error) {
 	}
 
 	// Check that a source for the warnlist was given
-	if options.DomainSource == "" {
+	if len(options.Sources) == 0 {
 		log.Error("domain warnlist file or url is required")
 		return options, plugin.Error("warnlist", c.ArgErr())
 	}
 
-	// Check that the specified file format is valid
-	valid := false
-	for _, t := range []string{DomainFileFormatHostfile, DomainFileFormatTextList} {
-		if options.FileFormat == t {
-			valid = true
+	// Check that the specified file formats are valid
+	for _, source := range options.Sources {
+		if !isValidFileFormat(source.Format) {
+			return options, plugin.Error("warnlist", c.Errf("unknown file format: %s", source.Format))
+		}
+	}
+	for _, source := range options.Allowlist {
+		if !isValidFileFormat(source.Format) {
+			return options, plugin.Error("warnlist", c.Errf("unknown allowlist file format: %s", source.Format))
+		}
+	}
+	for _, source := range options.ReportList {
+		if !isValidFileFormat(source.Format) {
+			return options, plugin.Error("warnlist", c.Errf("unknown report_list file format: %s", source.Format))
+		}
+	}
+	for _, source := range options.Protected {
+		if !isValidFileFormat(source.Format) {
+			return options, plugin.Error("warnlist", c.Errf("unknown protected file format: %s", source.Format))
+		}
+	}
+	if options.TypoDistance > 0 && len(options.Protected) == 0 {
+		return options, plugin.Error("warnlist", c.Err("typo_distance requires protected domains"))
+	}
+	for qtype, response := range options.TypeResponses {
+		if response == ResponseSinkhole && options.SinkholeIPv4 == nil {
+			return options, plugin.Error("warnlist", c.Errf("type_response %s sinkhole requires sinkhole", dns.TypeToString[qtype]))
+		}
+	}
+	for kind, response := range options.KindResponses {
+		if response == ResponseSinkhole && options.SinkholeIPv4 == nil {
+			return options, plugin.Error("warnlist", c.Errf("response_%s sinkhole requires sinkhole", kind))
+		}
+	}
+	if options.HitCounts > 0 && options.DebugAddr == "" {
+		return options, plugin.Error("warnlist", c.Err("hit_counts requires debug_addr"))
+	}
+	if options.HealthAddr != "" && options.HealthAddr == options.DebugAddr {
+		return options, plugin.Error("warnlist", c.Err("health_addr must differ from debug_addr"))
+	}
+	if options.Watch && !hasFileSource(options.allSources()) {
+		return options, plugin.Error("warnlist", c.Err("watch requires a file source"))
+	}
+	if options.MaxEntries > 0 && options.MinEntries > options.MaxEntries {
+		// No build could ever succeed
+		return options, plugin.Error("warnlist", c.Err("min_entries must not exceed max_entries"))
+	}
+	if options.DeltaURL != "" && options.ReloadPeriod == 0 && options.ReloadSignal == nil {
+		// The delta feed is only consulted on reloads
+		return options, plugin.Error("warnlist", c.Err("delta_url requires reload or reload_signal"))
+	}
+	if options.MaxStale > 0 && options.ReloadPeriod == 0 && len(options.sourceReloadPeriods()) == 0 && options.ReloadSignal == nil {
+		// Nothing would ever refresh the warnlist, so blocking would stop for good once it is max_stale old
+		return options, plugin.Error("warnlist", c.Err("max_stale requires reload or reload_signal"))
+	}
+	if longest := options.longestReloadPeriod(); options.MaxStale > 0 && options.MaxStale <= longest {
+		// Every reload period would pass queries through for a while, even if all reloads succeeded
+		return options, plugin.Error("warnlist", c.Errf("max_stale must be longer than the longest reload period %s", longest))
+	}
+	if options.AllowEmptyStartup && options.ReloadPeriod == 0 && len(options.sourceReloadPeriods()) == 0 &&
+		options.ReloadSignal == nil && !options.Watch {
+		// Nothing would ever populate the empty warnlist
+		return options, plugin.Error("warnlist", c.Err("allow_empty_startup requires reload, reload_signal or watch"))
+	}
+
+	// Load the TLS settings now, so missing or invalid files fail the setup instead of every fetch. Without any of them
+	// or a proxy, the default transport is used, which honors the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables.
+	if options.TLSCert != "" || options.TLSKey != "" || options.TLSCA != "" || options.Proxy != nil {
+		transport, err := newTLSTransport(options.TLSCert, options.TLSKey, options.TLSCA)
+		if err != nil {
+			return options, plugin.Error("warnlist", c.Err(err.Error()))
+		}
+		if options.Proxy != nil {
+			transport.Proxy = http.ProxyURL(options.Proxy)
+		}
+		options.Transport = transport
+	}
+
+	// Check that S3 sources name an object
+	for _, source := range options.allSources() {
+		if source.Type != DomainSourceTypeS3 {
+			continue
+		}
+		if _, _, err := parseS3URL(source.Path); err != nil {
+			return options, plugin.Error("warnlist", c.Err(err.Error()))
+		}
+	}
+
+	// Check that sftp sources name a file, and load their key and known hosts now, like the TLS settings
+	for _, source := range options.allSources() {
+		if source.Type != DomainSourceTypeSFTP {
+			continue
+		}
+		if _, _, _, err := parseSFTPURL(source.Path); err != nil {
+			return options, plugin.Error("warnlist", c.Err(err.Error()))
+		}
+		if options.SFTPConfig == nil {
+			config, err := newSFTPConfig(options.SFTPKey, options.SFTPKnownHosts)
+			if err != nil {
+				return options, plugin.Error("warnlist", c.Err(err.Error()))
+			}
+			options.SFTPConfig = config
+		}
+	}
+
+	// Check that the reload period won't hammer the servers hosting the sources
+	if options.ReloadPeriod > 0 {
+		minPeriod := options.MinReloadPeriod
+		if minPeriod == 0 {
+			minPeriod = defaultMinReloadPeriod(options.allSources())
+		}
+		if options.ReloadPeriod < minPeriod {
+			return options, plugin.Error("warnlist", c.Errf("reload period %s is below the minimum of %s", options.ReloadPeriod, minPeriod))
 		}
+
+		options.ReloadPeriod = jitter(options.ReloadPeriod)
+		log.Infof("Using reload period of: %s", options.ReloadPeriod)
 	}
-	if !valid {
-		return options, plugin.Error("warnlist", c.Errf("unknown file format: %s", options.FileFormat))
+	for _, source := range options.Sources {
+		if source.ReloadPeriod == 0 {
+			continue
+		}
+		minPeriod := options.MinReloadPeriod
+		if minPeriod == 0 {
+			minPeriod = defaultMinReloadPeriod([]DomainSource{source})
+		}
+		if source.ReloadPeriod < minPeriod {
+			return options, plugin.Error("warnlist", c.Errf("reload period %s of %s is below the minimum of %s", source.ReloadPeriod, source.Path, minPeriod))
+		}
+		if options.DeltaURL != "" {
+			// A partial reload would drop the changes of the delta feed applied to the full list
+			return options, plugin.Error("warnlist", c.Err("delta_url can't be combined with source reload periods"))
+		}
 	}
 
 	return options, nil
 }
 
+// allSources returns the sources of all lists: the warnlist, the allowlist, the protected domains, the IP blocklist,
+// and the report list.
+func (o PluginOptions) allSources() []DomainSource {
+	sources := make([]DomainSource, 0, len(o.Sources)+len(o.Allowlist)+len(o.Protected)+len(o.IPBlocklist)+len(o.ReportList))
+	sources = append(sources, o.Sources...)
+	sources = append(sources, o.Allowlist...)
+	sources = append(sources, o.Protected...)
+	sources = append(sources, o.IPBlocklist...)
+	return append(sources, o.ReportList...)
+}
+
+// hasFileSource returns true if any of the sources is a file or directory.
+func hasFileSource(sources []DomainSource) bool {
+	for _, source := range sources {
+		if source.Type == DomainSourceTypeFile {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultMinReloadPeriod returns the minimum reload period for the sources, which is longer if any of them is remote.
+func defaultMinReloadPeriod(sources []DomainSource) time.Duration {
+	for _, source := range sources {
+		if source.Type != DomainSourceTypeFile && source.Type != DomainSourceTypeSocket {
+			return DefaultMinReloadPeriod
+		}
+	}
+	return DefaultMinFileReloadPeriod
+}
+
+// fileFormats are the formats the plugin knows how to parse.
+var fileFormats = []string{
+	DomainFileFormatHostfile,
+	DomainFileFormatTextList,
+	DomainFileFormatRPZ,
+	DomainFileFormatAdblock,
+	DomainFileFormatCSV,
+	DomainFileFormatJSONL,
+	DomainFileFormatIPList,
+	DomainFileFormatRegex,
+	DomainFileFormatURLList,
+	DomainFileFormatUmbrella,
+	DomainFileFormatScored,
+	DomainFileFormatAuto,
+}
+
+// isValidFileFormat returns true if the given format is one the plugin knows how to parse.
+func isValidFileFormat(format string) bool {
+	for _, t := range fileFormats {
+		if format == t {
+			return true
+		}
+	}
+	return false
+}
+
+// parseListSource parses the source type, path, and file format of a list other than the warnlist, like the
+// allowlist, which name is used in errors.
+func parseListSource(c *caddy.Controller, name string) (DomainSource, error) {
+	source, err := parseListSourcePath(c, name)
+	if err != nil {
+		return source, err
+	}
+	if !c.NextArg() {
+		return source, c.ArgErr()
+	}
+	source.Format = c.Val()
+	return source, nil
+}
+
+// parseListSourcePath parses the source type and path of a list other than the warnlist, like parseListSource, for
+// lists which only have a single format.
+func parseListSourcePath(c *caddy.Controller, name string) (DomainSource, error) {
+	source := DomainSource{}
+	if !c.NextArg() {
+		return source, c.ArgErr()
+	}
+	switch c.Val() {
+	case DomainSourceTypeFile, DomainSourceTypeURL, DomainSourceTypeSocket:
+		source.Type = c.Val()
+	default:
+		return source, c.Errf("unknown %s source type: %s", name, c.Val())
+	}
+	if !c.NextArg() {
+		return source, c.ArgErr()
+	}
+	source.Path = c.Val()
+	if source.Type == DomainSourceTypeURL {
+		source.Type = sourceTypeForURL(source.Path)
+	}
+	return source, nil
+}
+
+// parseSourceOptions parses the options following a warnlist source, in any order: name <label>, which labels the
+// matches of its domains in logs and metrics, and reload <duration>, which reloads it on its own schedule.
+func parseSourceOptions(c *caddy.Controller, source *DomainSource) error {
+	for c.NextArg() {
+		switch c.Val() {
+		case "name":
+			if !c.NextArg() {
+				return c.ArgErr()
+			}
+			source.Name = c.Val()
+			log.Infof("Labelling matches of %s as %s", redactURL(source.Path), source.Name)
+
+		case "reload":
+			if !c.NextArg() {
+				return c.ArgErr()
+			}
+			t, err := time.ParseDuration(c.Val())
+			if err != nil || t <= 0 {
+				log.Error("unable to parse source reload duration (must be a positive duration)")
+				return c.ArgErr()
+			}
+			source.ReloadPeriod = t
+			log.Infof("Reloading %s every %s", redactURL(source.Path), source.ReloadPeriod)
+
+		default:
+			return c.Errf("unknown source option: %s", c.Val())
+		}
+	}
+	return nil
+}
+
 // Parses the configuration lines following our plugin declaration in the Corefile
 func parseBlock(c *caddy.Controller, options *PluginOptions) error {
 	switch c.Val() {
 	case "file":
+		source := DomainSource{Type: DomainSourceTypeFile}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		source.Path = c.Val()
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		source.Format = c.Val()
+		if err := parseSourceOptions(c, &source); err != nil {
+			return err
+		}
+		options.Sources = append(options.Sources, source)
+		log.Infof("Using domain warnlist file: %s with format %s", source.Path, source.Format)
+
+	case "max_entries":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		maxEntries, err := strconv.Atoi(c.Val())
+		if err != nil || maxEntries < 1 {
+			log.Error("unable to parse max_entries setting (must be a positive number)")
+			return c.ArgErr()
+		}
+		options.MaxEntries = maxEntries
+		log.Infof("Loading at most %d entries", options.MaxEntries)
+
+	case "min_entries":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		minEntries, err := strconv.Atoi(c.Val())
+		if err != nil || minEntries < 1 {
+			log.Error("unable to parse min_entries setting (must be a positive number)")
+			return c.ArgErr()
+		}
+		options.MinEntries = minEntries
+		log.Infof("Failing builds with fewer than %d entries", options.MinEntries)
+
+	case "max_regexes":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		maxRegexes, err := strconv.Atoi(c.Val())
+		if err != nil || maxRegexes < 1 {
+			log.Error("unable to parse max_regexes setting (must be a positive number)")
+			return c.ArgErr()
+		}
+		options.MaxRegexes = maxRegexes
+		log.Infof("Loading at most %d regex patterns", options.MaxRegexes)
+
+	case "build_workers":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		workers, err := strconv.Atoi(c.Val())
+		if err != nil || workers < 1 {
+			log.Error("unable to parse build_workers setting (must be a positive number)")
+			return c.ArgErr()
+		}
+		options.BuildWorkers = workers
+		log.Infof("Fetching up to %d sources at once", options.BuildWorkers)
+
+	case "strict_max_entries":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		strict, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse strict_max_entries setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.StrictMaxEntries = strict
+
+	case "strip_www":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		strip, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse strip_www setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.StripWWW = strip
+		if options.StripWWW {
+			log.Info("Matching queries and list entries without a leading www. label")
+		}
+
+	case "confusables":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		confusables, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse confusables setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.Confusables = confusables
+		if options.Confusables {
+			log.Info("Matching queries and list entries by their confusable skeletons")
+		}
+
+	case "allow_broad_entries":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		allow, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse allow_broad_entries setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.AllowBroadEntries = allow
+		if options.AllowBroadEntries {
+			log.Warning("Loading entries matching whole public suffixes")
+		}
+
+	case "watch":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		watch, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse watch setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.Watch = watch
+		if options.Watch {
+			log.Info("Watching file sources for changes")
+		}
+
+	case "etld_plus_one":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		registered, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse etld_plus_one setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.ETLDPlusOne = registered
+		if options.ETLDPlusOne {
+			log.Info("Matching the registered domains (eTLD+1) of queries and warnlist entries")
+		}
+
+	case "strict_content_type":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		strict, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse strict_content_type setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.StrictContentType = strict
+
+	case "file_extension":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.FileExtension = c.Val()
+		if !strings.HasPrefix(options.FileExtension, ".") {
+			options.FileExtension = "." + options.FileExtension
+		}
+		log.Infof("Loading files with extension %s from directories", options.FileExtension)
+
+	case "socket":
+		source := DomainSource{Type: DomainSourceTypeSocket}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		source.Path = c.Val()
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		source.Format = c.Val()
+		if err := parseSourceOptions(c, &source); err != nil {
+			return err
+		}
+		options.Sources = append(options.Sources, source)
+		log.Infof("Using domain warnlist socket: %s with format %s", source.Path, source.Format)
+
+	case "redis":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		addr := c.Val()
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return c.Errf("invalid redis address %s: %v", addr, err)
+		}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		// Sets hold one domain per member, so they are read as a text list
+		source := DomainSource{Path: addr + "/" + c.Val(), Type: DomainSourceTypeRedis, Format: DomainFileFormatTextList}
+		if err := parseSourceOptions(c, &source); err != nil {
+			return err
+		}
+		options.Sources = append(options.Sources, source)
+		log.Infof("Using domain warnlist redis set: %s", source.Path)
+
+	case "redis_password":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.RedisPassword = c.Val()
+
+	case "redis_db":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		db, err := strconv.Atoi(c.Val())
+		if err != nil || db < 0 {
+			log.Error("unable to parse redis_db setting (must be a non-negative number)")
+			return c.ArgErr()
+		}
+		options.RedisDB = db
+		log.Infof("Using redis database %d", options.RedisDB)
+
+	case "taxii":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if _, err := taxiiObjectsURL(c.Val()); err != nil {
+			return c.Errf("invalid taxii collection %s: %v", c.Val(), err)
+		}
+		// Domains are extracted from the STIX objects of collections, so they are read as a text list
+		source := DomainSource{Path: c.Val(), Type: DomainSourceTypeTAXII, Format: DomainFileFormatTextList}
+		if err := parseSourceOptions(c, &source); err != nil {
+			return err
+		}
+		options.Sources = append(options.Sources, source)
+		log.Infof("Using domain warnlist taxii collection: %s", source.Path)
+
+	case "taxii_user":
 		if !c.NextArg() {
 			return c.ArgErr()
 		}
-		options.DomainSource = c.Val()
-		options.DomainSourceType = DomainSourceTypeFile
+		options.TAXIIUser = c.Val()
+
+	case "taxii_password":
 		if !c.NextArg() {
 			return c.ArgErr()
 		}
-		options.FileFormat = c.Val()
-		log.Infof("Using domain warnlist file: %s with format %s", options.DomainSource, options.FileFormat)
+		options.TAXIIPassword = c.Val()
 
 	case "match_subdomains":
 		if !c.NextArg() {
@@ -162,44 +866,702 @@ func parseBlock(c *caddy.Controller, options *PluginOptions) error {
 			log.Infof("not matching subdomains")
 		}
 
-	case "url":
+	case "verbose_match":
 		if !c.NextArg() {
 			return c.ArgErr()
 		}
-		if options.DomainSource != "" {
-			return c.Err("file argument was already specified. Plugin can use either 'file' or 'url' option, but not both")
+		verbose, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse verbose_match setting (must be true or false)")
+			return c.ArgErr()
 		}
-		options.DomainSource = c.Val()
-		options.DomainSourceType = DomainSourceTypeURL
+		options.VerboseMatch = verbose
+		if options.VerboseMatch {
+			log.Infof("logging every warnlist entry matching a query")
+		}
+
+	case "bloom":
 		if !c.NextArg() {
 			return c.ArgErr()
 		}
-		options.FileFormat = c.Val()
-		log.Infof("Using domain warnlist url: %s with format %s", options.DomainSource, options.FileFormat)
+		bloom, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse bloom setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.Bloom = bloom
+		if options.Bloom {
+			log.Infof("using bloom filter")
+		}
 
-	case "reload":
+	case "audit":
 		if !c.NextArg() {
 			return c.ArgErr()
 		}
-
-		t, err := time.ParseDuration(c.Val())
+		audit, err := strconv.ParseBool(c.Val())
 		if err != nil {
-			log.Error("unable to parse reload duration")
+			log.Error("unable to parse audit setting (must be true or false)")
 			return c.ArgErr()
 		}
-		t = jitter(t)
+		options.Audit = audit
+
+	case "use_ecs":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		useECS, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse use_ecs setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.UseECS = useECS
+
+	case "annotate":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		annotate, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse annotate setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.Annotate = annotate
+		if options.Annotate {
+			log.Infof("annotating block responses with the matched entry")
+		}
+
+	case "annotate_code":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		code, err := strconv.ParseUint(c.Val(), 10, 16)
+		if err != nil || code < dns.EDNS0LOCALSTART || code > dns.EDNS0LOCALEND {
+			log.Errorf("unable to parse annotate_code setting (must be a local EDNS0 option code, %d-%d)", dns.EDNS0LOCALSTART, dns.EDNS0LOCALEND)
+			return c.ArgErr()
+		}
+		options.AnnotateCode = uint16(code)
+
+	case "log_format":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if !isValidLogFormat(c.Val()) {
+			return c.Errf("unknown log format: %s", c.Val())
+		}
+		options.LogFormat = c.Val()
+		log.Infof("Logging matches as %s", options.LogFormat)
+
+	case "log_level":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if !isValidLogLevel(c.Val()) {
+			return c.Errf("unknown log level: %s", c.Val())
+		}
+		options.LogLevel = c.Val()
+		log.Infof("Logging matches at level %s", options.LogLevel)
+
+	case "log_sample":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		sample, ok := parseLogSample(c.Val())
+		if !ok {
+			log.Error("unable to parse log_sample setting (must be 1/N with a positive N)")
+			return c.ArgErr()
+		}
+		options.LogSample = sample
+		log.Infof("Logging 1 in %d matches", options.LogSample)
+
+	case "check_cname":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		checkCNAME, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse check_cname setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.CheckCNAME = checkCNAME
+		if options.CheckCNAME {
+			log.Infof("checking CNAME targets in responses")
+		}
+
+	case "url":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		source := DomainSource{Path: c.Val(), Type: sourceTypeForURL(c.Val())}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		source.Format = c.Val()
+		if err := parseSourceOptions(c, &source); err != nil {
+			return err
+		}
+		options.Sources = append(options.Sources, source)
+		log.Infof("Using domain warnlist url: %s with format %s", redactURL(source.Path), source.Format)
+
+	case "delta_url":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if u, err := url.Parse(c.Val()); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c.Errf("invalid delta_url %s (must be an http or https url)", redactURL(c.Val()))
+		}
+		options.DeltaURL = c.Val()
+		log.Infof("Using warnlist delta feed: %s", redactURL(options.DeltaURL))
+
+	case "full_sync":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		t, err := time.ParseDuration(c.Val())
+		if err != nil || t <= 0 {
+			log.Error("unable to parse full_sync setting (must be a positive duration)")
+			return c.ArgErr()
+		}
+		options.FullSyncPeriod = t
+		log.Infof("Fetching the full warnlist every %s", options.FullSyncPeriod)
+
+	case "change_webhook":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if u, err := url.Parse(c.Val()); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c.Errf("invalid change_webhook %s (must be an http or https url)", c.Val())
+		}
+		options.ChangeWebhook = c.Val()
+		log.Infof("Notifying %s of significant warnlist changes", options.ChangeWebhook)
+
+	case "change_threshold":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		threshold, err := strconv.ParseFloat(strings.TrimSuffix(c.Val(), "%"), 64)
+		if err != nil || threshold <= 0 {
+			log.Error("unable to parse change_threshold setting (must be a positive percentage)")
+			return c.ArgErr()
+		}
+		options.ChangeThreshold = threshold
+		log.Infof("Notifying changes of at least %g%% of the warnlist", options.ChangeThreshold)
+
+	case "allowlist":
+		source, err := parseListSource(c, "allowlist")
+		if err != nil {
+			return err
+		}
+		options.Allowlist = append(options.Allowlist, source)
+		log.Infof("Using domain allowlist %s: %s with format %s", source.Type, redactURL(source.Path), source.Format)
+
+	case "report_list":
+		source, err := parseListSource(c, "report_list")
+		if err != nil {
+			return err
+		}
+		if err := parseSourceOptions(c, &source); err != nil {
+			return err
+		}
+		if source.ReloadPeriod > 0 {
+			// The report list is reloaded along with the warnlist
+			return c.Err("report_list sources can't have a reload period of their own")
+		}
+		options.ReportList = append(options.ReportList, source)
+		log.Infof("Using report list %s: %s with format %s", source.Type, redactURL(source.Path), source.Format)
+
+	case "protected":
+		source, err := parseListSource(c, "protected")
+		if err != nil {
+			return err
+		}
+		options.Protected = append(options.Protected, source)
+		log.Infof("Using protected domains %s: %s with format %s", source.Type, redactURL(source.Path), source.Format)
+
+	case "ip_blocklist":
+		source, err := parseListSourcePath(c, "ip_blocklist")
+		if err != nil {
+			return err
+		}
+		source.Format = DomainFileFormatIPList
+		options.IPBlocklist = append(options.IPBlocklist, source)
+		log.Infof("Using IP blocklist %s: %s", source.Type, redactURL(source.Path))
+
+	case "exclude":
+		names := c.RemainingArgs()
+		if len(names) == 0 {
+			return c.ArgErr()
+		}
+		for _, name := range names {
+			name = canonicalDomain(name)
+			if _, ok := dns.IsDomainName(name); !ok {
+				return c.Errf("invalid exclude domain: %s", name)
+			}
+			options.Excludes = append(options.Excludes, name)
+			log.Infof("Excluding %s and its subdomains from matching", name)
+		}
+
+	case "reserved_hosts":
+		// The given hostnames replace the defaults, so none at all keeps every hostname
+		options.ReservedHosts = nil
+		for _, name := range c.RemainingArgs() {
+			options.ReservedHosts = append(options.ReservedHosts, strings.ToLower(strings.TrimSuffix(name, ".")))
+		}
+		log.Infof("Skipping reserved hostnames in hostfile sources: %s", strings.Join(options.ReservedHosts, " "))
+
+	case "typo_distance":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		distance, err := strconv.Atoi(c.Val())
+		if err != nil || distance < 1 {
+			log.Error("unable to parse typo_distance setting (must be a positive number)")
+			return c.ArgErr()
+		}
+		options.TypoDistance = distance
+		log.Infof("Matching names within an edit distance of %d of protected domains", options.TypoDistance)
+
+	case "response":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if !isValidResponse(c.Val()) {
+			return c.Errf("unknown response: %s", c.Val())
+		}
+		options.Response = c.Val()
+		log.Infof("Using response %s for warnlisted domains", options.Response)
+
+	case "type_response":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		qtype, ok := dns.StringToType[strings.ToUpper(c.Val())]
+		if !ok {
+			return c.Errf("unknown query type: %s", c.Val())
+		}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if !isValidResponse(c.Val()) && c.Val() != ResponseSinkhole {
+			return c.Errf("unknown response: %s", c.Val())
+		}
+		if options.TypeResponses == nil {
+			options.TypeResponses = make(map[uint16]string)
+		}
+		options.TypeResponses[qtype] = c.Val()
+		log.Infof("Using response %s for warnlisted %s queries", c.Val(), dns.TypeToString[qtype])
+
+	case "response_exact", "response_subtree", "response_wildcard":
+		kind := strings.TrimPrefix(c.Val(), "response_")
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if !isValidResponse(c.Val()) && c.Val() != ResponseSinkhole && c.Val() != ResponseAudit {
+			return c.Errf("unknown response: %s", c.Val())
+		}
+		if options.KindResponses == nil {
+			options.KindResponses = make(map[string]string)
+		}
+		options.KindResponses[kind] = c.Val()
+		log.Infof("Using response %s for %s matches", c.Val(), kind)
+
+	case "on_error":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if c.Val() != OnErrorPassthrough && c.Val() != OnErrorRefuse {
+			return c.Errf("unknown on_error action: %s", c.Val())
+		}
+		options.OnError = c.Val()
+		log.Infof("Using on_error %s for queries which fail to be checked", options.OnError)
+
+	case "precedence":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if c.Val() != PrecedenceAllow && c.Val() != PrecedenceBlock {
+			return c.Errf("unknown precedence: %s (must be allow or block)", c.Val())
+		}
+		options.Precedence = c.Val()
+		log.Infof("Using precedence %s for domains matching both the allowlist and the warnlist", options.Precedence)
+
+	case "sinkhole":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.SinkholeIPv4 = parseSinkholeIP(c.Val(), false)
+		if options.SinkholeIPv4 == nil {
+			return c.Errf("invalid sinkhole IPv4 address: %s", c.Val())
+		}
+		if c.NextArg() {
+			options.SinkholeIPv6 = parseSinkholeIP(c.Val(), true)
+			if options.SinkholeIPv6 == nil {
+				return c.Errf("invalid sinkhole IPv6 address: %s", c.Val())
+			}
+		}
+		options.Response = ResponseSinkhole
+		if options.SinkholeIPv6 != nil {
+			log.Infof("Sinkholing warnlisted domains to %s and %s", options.SinkholeIPv4, options.SinkholeIPv6)
+		} else {
+			log.Infof("Sinkholing warnlisted domains to %s", options.SinkholeIPv4)
+		}
+
+	case "block_ttl":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		ttl, err := strconv.ParseUint(c.Val(), 10, 32)
+		if err != nil {
+			log.Error("unable to parse block_ttl setting (must be a number of seconds)")
+			return c.ArgErr()
+		}
+		options.BlockTTL = uint32(ttl)
+		log.Infof("Using TTL of %ds for block responses", options.BlockTTL)
+
+	case "soa":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		mname := dns.Fqdn(c.Val())
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		rname := dns.Fqdn(c.Val())
+		for _, name := range []string{mname, rname} {
+			if _, ok := dns.IsDomainName(name); !ok {
+				return c.Errf("invalid soa name: %s", name)
+			}
+		}
+		options.SOAMname = mname
+		options.SOARname = rname
+		log.Infof("Using SOA %s %s for negative block responses", options.SOAMname, options.SOARname)
+
+	case "retries":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		retries, err := strconv.Atoi(c.Val())
+		if err != nil || retries < 0 {
+			log.Error("unable to parse retries setting (must be a non-negative number)")
+			return c.ArgErr()
+		}
+		options.Retries = retries
+		log.Infof("Retrying failed url fetches %d times", options.Retries)
+
+	case "min_score":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		score, err := strconv.ParseFloat(c.Val(), 64)
+		if err != nil || math.IsNaN(score) {
+			log.Error("unable to parse min_score setting (must be a number)")
+			return c.ArgErr()
+		}
+		options.MinScore = score
+		log.Infof("Loading the domains of scored sources scored at least %g", options.MinScore)
+
+	case "default_score":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		score, err := strconv.ParseFloat(c.Val(), 64)
+		if err != nil || math.IsNaN(score) {
+			log.Error("unable to parse default_score setting (must be a number)")
+			return c.ArgErr()
+		}
+		options.DefaultScore = score
+		log.Infof("Scoring the domains of scored sources listed without a score %g", options.DefaultScore)
+
+	case "csv_column":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		column, err := strconv.Atoi(c.Val())
+		if err != nil || column < 1 {
+			log.Error("unable to parse csv_column setting (must be a column number, starting at 1)")
+			return c.ArgErr()
+		}
+		options.CSVColumn = column
+		log.Infof("Reading csv domains from column %d", options.CSVColumn)
+
+	case "csv_header":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		header, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse csv_header setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.CSVHeader = header
+
+	case "json_field":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.JSONField = c.Val()
+		log.Infof("Reading jsonl domains from field %s", options.JSONField)
+
+	case "timeout":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		timeout, err := time.ParseDuration(c.Val())
+		if err != nil || timeout <= 0 {
+			log.Error("unable to parse timeout setting (must be a positive duration)")
+			return c.ArgErr()
+		}
+		options.Timeout = timeout
+		log.Infof("Timing out url fetches after %s", options.Timeout)
+
+	case "max_stale":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		maxStale, err := time.ParseDuration(c.Val())
+		if err != nil || maxStale <= 0 {
+			log.Error("unable to parse max_stale setting (must be a positive duration)")
+			return c.ArgErr()
+		}
+		options.MaxStale = maxStale
+		log.Infof("Passing warnlisted queries through once the warnlist hasn't been reloaded for %s", options.MaxStale)
+
+	case "startup_timeout":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		timeout, err := time.ParseDuration(c.Val())
+		if err != nil || timeout <= 0 {
+			log.Error("unable to parse startup_timeout setting (must be a positive duration)")
+			return c.ArgErr()
+		}
+		options.StartupTimeout = timeout
+		log.Infof("Giving up on the first build after %s", options.StartupTimeout)
+
+	case "allow_empty_startup":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		allow, err := strconv.ParseBool(c.Val())
+		if err != nil {
+			log.Error("unable to parse allow_empty_startup setting (must be true or false)")
+			return c.ArgErr()
+		}
+		options.AllowEmptyStartup = allow
+
+	case "cache_file":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.CacheFile = c.Val()
+		log.Infof("Using warnlist snapshot %s", options.CacheFile)
+
+	case "cache_max_age":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		maxAge, err := time.ParseDuration(c.Val())
+		if err != nil || maxAge < 0 {
+			log.Error("unable to parse cache_max_age setting (must be a duration, or 0 for any age)")
+			return c.ArgErr()
+		}
+		options.CacheMaxAge = maxAge
+		log.Infof("Starting with warnlist snapshots up to %s old", options.CacheMaxAge)
+
+	case "tls_cert":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.TLSCert = c.Val()
+		log.Infof("Using TLS client certificate %s for url requests", options.TLSCert)
+
+	case "tls_key":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.TLSKey = c.Val()
+
+	case "tls_ca":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.TLSCA = c.Val()
+		log.Infof("Using TLS CA %s for url requests", options.TLSCA)
+
+	case "user_agent":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.UserAgent = c.Val()
+		log.Infof("Using user agent %q for url requests", options.UserAgent)
+
+	case "sftp_key":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.SFTPKey = c.Val()
+		log.Infof("Using key %s for sftp sources", options.SFTPKey)
+
+	case "sftp_known_hosts":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		options.SFTPKnownHosts = c.Val()
+		log.Infof("Verifying the host keys of sftp sources against %s", options.SFTPKnownHosts)
+
+	case "proxy":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		proxy, err := parseProxyURL(c.Val())
+		if err != nil {
+			return c.Errf("invalid proxy: %v", err)
+		}
+		options.Proxy = proxy
+		log.Infof("Fetching url sources through the proxy at %s://%s", proxy.Scheme, proxy.Host)
+
+	case "header":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		name := c.Val()
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if options.Headers == nil {
+			options.Headers = make(map[string]string)
+		}
+		// The value is deliberately not logged, since it usually holds a credential
+		options.Headers[name] = c.Val()
+		log.Infof("Sending header %s with url requests", name)
+
+	case "header_file":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		name := c.Val()
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if options.HeaderFiles == nil {
+			options.HeaderFiles = make(map[string]string)
+		}
+		options.HeaderFiles[name] = c.Val()
+		log.Infof("Sending header %s from %s with url requests", name, c.Val())
+
+	case "alert_threshold":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		threshold, err := strconv.Atoi(c.Val())
+		if err != nil || threshold < 1 {
+			log.Error("unable to parse alert_threshold setting (must be a positive number)")
+			return c.ArgErr()
+		}
+		options.AlertThreshold = threshold
+		log.Infof("Alerting on clients with %d matches", options.AlertThreshold)
+
+	case "alert_window":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		t, err := time.ParseDuration(c.Val())
+		if err != nil || t <= 0 {
+			log.Error("unable to parse alert_window setting (must be a positive duration)")
+			return c.ArgErr()
+		}
+		options.AlertWindow = t
+		log.Infof("Using alert window of: %s", options.AlertWindow)
+
+	case "debug_addr":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if _, _, err := net.SplitHostPort(c.Val()); err != nil {
+			return c.Errf("invalid debug_addr %s: %v", c.Val(), err)
+		}
+		options.DebugAddr = c.Val()
+		log.Infof("Using debug address %s", options.DebugAddr)
+
+	case "hit_counts":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		size, err := strconv.Atoi(c.Val())
+		if err != nil || size < 1 {
+			log.Error("unable to parse hit_counts setting (must be a positive number)")
+			return c.ArgErr()
+		}
+		options.HitCounts = size
+		log.Infof("Counting the hits of up to %d list entries", options.HitCounts)
+
+	case "health_addr":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if _, _, err := net.SplitHostPort(c.Val()); err != nil {
+			return c.Errf("invalid health_addr %s: %v", c.Val(), err)
+		}
+		options.HealthAddr = c.Val()
+		log.Infof("Using health address %s", options.HealthAddr)
+
+	case "reload_signal":
+		name := DefaultReloadSignal
+		if c.NextArg() {
+			name = c.Val()
+		}
+		if name == "SIGUSR2" {
+			return c.Errf("unsupported reload_signal %s, which upgrades the CoreDNS binary", name)
+		}
+		sig, ok := reloadSignals[name]
+		if !ok {
+			return c.Errf("unsupported reload_signal %s", name)
+		}
+		options.ReloadSignal = sig
+		log.Infof("Reloading on %s", name)
+
+	case "reload":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+
+		t, err := time.ParseDuration(c.Val())
+		if err != nil {
+			log.Error("unable to parse reload duration")
+			return c.ArgErr()
+		}
+		if t <= 0 {
+			return c.Errf("reload period must be positive, got %s", c.Val())
+		}
+		// Jitter is only added once the period has been checked against the minimum
 		options.ReloadPeriod = t
-		log.Infof("Using reload period of: %s", options.ReloadPeriod)
+
+	case "min_reload":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+
+		t, err := time.ParseDuration(c.Val())
+		if err != nil {
+			log.Error("unable to parse min_reload duration")
+			return c.ArgErr()
+		}
+		if t <= 0 {
+			return c.Errf("min_reload must be positive, got %s", c.Val())
+		}
+		options.MinReloadPeriod = t
+		log.Infof("Using minimum reload period of: %s", options.MinReloadPeriod)
 	}
 
 	return nil
 }
 
 func jitter(t time.Duration) time.Duration {
-	// Get the max jitter as a duration.
-	maxJitter, err := time.ParseDuration(fmt.Sprintf("%dms", t.Milliseconds()/MaxJitterPercent))
-	if err != nil {
-		log.Warningf("Failed to calculate jitter: %s", err)
+	// Get the max jitter as a duration, without rounding it to milliseconds.
+	maxJitter := t / MaxJitterPercent
+
+	// Periods too short to be jittered (including zero or negative ones) are used as they are, since rand.Int63n
+	// panics on 0.
+	if maxJitter <= 0 {
 		return t
 	}
 
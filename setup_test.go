@@ -1,21 +1,1327 @@
 package warnlist
 
-// import (
-// 	"testing"
-
-// 	"github.com/caddyserver/caddy"
-// )
-
-// TestSetup tests the various things that should be parsed by setup.
-// Make sure you also test for parse errors.
-// func TestSetup(t *testing.T) {
-// 	c := caddy.NewTestController("dns", `warnlist`)
-// 	if err := setup(c); err != nil {
-// 		t.Fatalf("Expected no errors, but got: %v", err)
-// 	}
-
-// 	c = caddy.NewTestController("dns", `warnlist more`)
-// 	if err := setup(c); err == nil {
-// 		t.Fatalf("Expected errors, but got: %v", err)
-// 	}
-// }
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"go.uber.org/goleak"
+)
+
+func Test_parseArguments(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		config    string
+		sources   []DomainSource
+		headers   map[string]string
+		expectErr bool
+	}{
+		{
+			name: "case 0: a single file source is parsed",
+			config: `warnlist {
+				file domains.txt text
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 1: a single url source is parsed",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/hosts", Type: DomainSourceTypeURL, Format: DomainFileFormatHostfile},
+			},
+		},
+		{
+			name: "case 2: repeated file and url sources are accumulated",
+			config: `warnlist {
+				file domains.txt text
+				url https://example.org/hosts hostfile
+				file more.txt text
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+				{Path: "https://example.org/hosts", Type: DomainSourceTypeURL, Format: DomainFileFormatHostfile},
+				{Path: "more.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name:      "case 3: a missing source returns an error",
+			config:    `warnlist`,
+			expectErr: true,
+		},
+		{
+			name: "case 4: an unknown file format returns an error",
+			config: `warnlist {
+				file domains.txt bogus
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 5: a source without a format returns an error",
+			config: `warnlist {
+				file domains.txt
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 6: repeated headers are collected",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				header Authorization "Bearer secret"
+				header X-Feed-Client coredns
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/hosts", Type: DomainSourceTypeURL, Format: DomainFileFormatHostfile},
+			},
+			headers: map[string]string{"Authorization": "Bearer secret", "X-Feed-Client": "coredns"},
+		},
+		{
+			name: "case 7: a header without a value returns an error",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				header Authorization
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 8: an s3 url is parsed as an s3 source",
+			config: `warnlist {
+				url s3://feeds/domains.txt text
+			}`,
+			sources: []DomainSource{
+				{Path: "s3://feeds/domains.txt", Type: DomainSourceTypeS3, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 9: an s3 url without a key returns an error",
+			config: `warnlist {
+				url s3://feeds text
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 10: a csv column below 1 returns an error",
+			config: `warnlist {
+				file indicators.csv csv
+				csv_column 0
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 11: an unknown reload signal returns an error",
+			config: `warnlist {
+				file domains.txt text
+				reload_signal SIGBOGUS
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 12: a reload period below a minute for a url source returns an error",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				reload 100ms
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 13: a reload period without a unit returns an error",
+			config: `warnlist {
+				file domains.txt text
+				reload 5
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 14: a reload period below a second for a file source returns an error",
+			config: `warnlist {
+				file domains.txt text
+				reload 100ms
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 15: a reload period below a minute for a file source is allowed",
+			config: `warnlist {
+				file domains.txt text
+				reload 10s
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 16: min_reload lowers the minimum for a url source",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				reload 10s
+				min_reload 5s
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/hosts", Type: DomainSourceTypeURL, Format: DomainFileFormatHostfile},
+			},
+		},
+		{
+			name: "case 17: min_reload raises the minimum for a file source",
+			config: `warnlist {
+				file domains.txt text
+				reload 10m
+				min_reload 1h
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 18: a url in the allowlist raises the minimum",
+			config: `warnlist {
+				file domains.txt text
+				allowlist url https://example.org/allowed.txt text
+				reload 10s
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 19: a negative reload period returns an error",
+			config: `warnlist {
+				file domains.txt text
+				reload -5m
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 20: a header_file without a path returns an error",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				header_file Authorization
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 21: a debug_addr without a port returns an error",
+			config: `warnlist {
+				file domains.txt text
+				debug_addr localhost
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 22: an alert_threshold below 1 returns an error",
+			config: `warnlist {
+				file domains.txt text
+				alert_threshold 0
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 23: a socket source is parsed, and reloads as often as a file",
+			config: `warnlist {
+				socket /run/feed.sock text
+				reload 10s
+			}`,
+			sources: []DomainSource{
+				{Path: "/run/feed.sock", Type: DomainSourceTypeSocket, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 24: an soa without an rname returns an error",
+			config: `warnlist {
+				file domains.txt text
+				soa ns.example.net.
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 25: a typo_distance without protected domains returns an error",
+			config: `warnlist {
+				file domains.txt text
+				typo_distance 2
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 26: protected domains in an unsupported format return an error",
+			config: `warnlist {
+				file domains.txt text
+				protected file brands.txt bogus
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 27: an exclude without a domain returns an error",
+			config: `warnlist {
+				file domains.txt text
+				exclude
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 28: sources are labelled with their name",
+			config: `warnlist {
+				url https://example.org/hosts hostfile name urlhaus
+				file domains.txt text name local
+				file other.txt text
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/hosts", Type: DomainSourceTypeURL, Format: DomainFileFormatHostfile, Name: "urlhaus"},
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList, Name: "local"},
+				{Path: "other.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 29: a source name without a label returns an error",
+			config: `warnlist {
+				file domains.txt text name
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 30: an unknown source option returns an error",
+			config: `warnlist {
+				file domains.txt text label local
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 31: a redis set is parsed as a text list",
+			config: `warnlist {
+				redis 127.0.0.1:6379 indicators name pipeline
+				redis_password secret
+				redis_db 2
+			}`,
+			sources: []DomainSource{
+				{Path: "127.0.0.1:6379/indicators", Type: DomainSourceTypeRedis, Format: DomainFileFormatTextList, Name: "pipeline"},
+			},
+		},
+		{
+			name: "case 32: a redis address without a port returns an error",
+			config: `warnlist {
+				redis 127.0.0.1 indicators
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 33: an unknown on_error action returns an error",
+			config: `warnlist {
+				file domains.txt text
+				on_error crash
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 34: an empty startup is allowed with a reload period",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				startup_timeout 10s
+				allow_empty_startup true
+				reload 1h
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/hosts", Type: DomainSourceTypeURL, Format: DomainFileFormatHostfile},
+			},
+		},
+		{
+			name: "case 35: an empty startup without reloads returns an error",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				allow_empty_startup true
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 36: an invalid startup_timeout returns an error",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				startup_timeout soon
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 37: a snapshot is parsed with its max age",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				cache_file /var/cache/warnlist.gz
+				cache_max_age 12h
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/hosts", Type: DomainSourceTypeURL, Format: DomainFileFormatHostfile},
+			},
+		},
+		{
+			name: "case 38: an invalid cache_max_age returns an error",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				cache_file /var/cache/warnlist.gz
+				cache_max_age -1h
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 39: reserved hostnames may be replaced",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				reserved_hosts localhost broadcasthost ip6-*
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/hosts", Type: DomainSourceTypeURL, Format: DomainFileFormatHostfile},
+			},
+		},
+		{
+			name: "case 40: an unknown log_level returns an error",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				log_level verbose
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 41: a regex source is parsed with its cap",
+			config: `warnlist {
+				file dga.txt regex name dga
+				max_regexes 50
+			}`,
+			sources: []DomainSource{
+				{Path: "dga.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatRegex, Name: "dga"},
+			},
+		},
+		{
+			name: "case 42: an invalid max_regexes returns an error",
+			config: `warnlist {
+				file dga.txt regex
+				max_regexes 0
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 43: an unknown precedence returns an error",
+			config: `warnlist {
+				file domains.txt text
+				allowlist file allowed.txt text
+				precedence deny
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 44: a proxy with an unsupported scheme returns an error",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				proxy ftp://proxy.example:3128
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 45: a taxii collection is parsed as a text list",
+			config: `warnlist {
+				taxii https://taxii.example/api1/collections/indicators/ name cti
+				taxii_user analyst
+				taxii_password secret
+			}`,
+			sources: []DomainSource{
+				{Path: "https://taxii.example/api1/collections/indicators/", Type: DomainSourceTypeTAXII, Format: DomainFileFormatTextList, Name: "cti"},
+			},
+		},
+		{
+			name: "case 46: a taxii collection which isn't an http url returns an error",
+			config: `warnlist {
+				taxii taxii.example/api1/collections/indicators/
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 47: an invalid etld_plus_one returns an error",
+			config: `warnlist {
+				file domains.txt text
+				etld_plus_one yes
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 48: type responses are parsed",
+			config: `warnlist {
+				file domains.txt text
+				sinkhole 10.0.0.1
+				type_response AAAA nodata
+				type_response mx refused
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 49: a type response for an unknown query type returns an error",
+			config: `warnlist {
+				file domains.txt text
+				type_response BOGUS nodata
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 50: an unknown type response returns an error",
+			config: `warnlist {
+				file domains.txt text
+				type_response AAAA drop
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 51: a sinkhole type response without a sinkhole returns an error",
+			config: `warnlist {
+				file domains.txt text
+				type_response A sinkhole
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 52: a delta feed is parsed",
+			config: `warnlist {
+				file domains.txt text
+				delta_url https://feed.example/domains.delta
+				full_sync 12h
+				reload 5m
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 53: a delta feed without reloads returns an error",
+			config: `warnlist {
+				file domains.txt text
+				delta_url https://feed.example/domains.delta
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 54: a delta feed which isn't an http url returns an error",
+			config: `warnlist {
+				file domains.txt text
+				delta_url feed.example/domains.delta
+				reload 5m
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 55: an invalid full_sync returns an error",
+			config: `warnlist {
+				file domains.txt text
+				delta_url https://feed.example/domains.delta
+				full_sync 0s
+				reload 5m
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 56: a change webhook is parsed",
+			config: `warnlist {
+				file domains.txt text
+				change_webhook https://alerts.example/hooks/warnlist
+				change_threshold 25%
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 57: a change webhook which isn't an http url returns an error",
+			config: `warnlist {
+				file domains.txt text
+				change_webhook alerts.example/hooks/warnlist
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 58: an invalid change_threshold returns an error",
+			config: `warnlist {
+				file domains.txt text
+				change_threshold -5
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 59: min_entries is accepted",
+			config: `warnlist {
+				file domains.txt text
+				min_entries 1000
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 60: an invalid min_entries returns an error",
+			config: `warnlist {
+				file domains.txt text
+				min_entries 0
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 61: a min_entries above max_entries returns an error",
+			config: `warnlist {
+				file domains.txt text
+				max_entries 100
+				min_entries 1000
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 62: the urllist format is accepted",
+			config: `warnlist {
+				url https://feeds.example/phishing.txt urllist
+			}`,
+			sources: []DomainSource{
+				{Path: "https://feeds.example/phishing.txt", Type: DomainSourceTypeURL, Format: DomainFileFormatURLList},
+			},
+		},
+		{
+			name: "case 63: health_addr is accepted",
+			config: `warnlist {
+				file domains.txt text
+				reload 1h
+				health_addr localhost:8081
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 64: an invalid health_addr returns an error",
+			config: `warnlist {
+				file domains.txt text
+				health_addr localhost
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 65: a health_addr equal to debug_addr returns an error",
+			config: `warnlist {
+				file domains.txt text
+				debug_addr localhost:8080
+				health_addr localhost:8080
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 66: sources accept a reload period of their own, before or after their name",
+			config: `warnlist {
+				file internal.txt text reload 5m name internal
+				url https://feeds.example/public.txt text name public reload 24h
+				reload 12h
+			}`,
+			sources: []DomainSource{
+				{Path: "internal.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList, Name: "internal", ReloadPeriod: 5 * time.Minute},
+				{Path: "https://feeds.example/public.txt", Type: DomainSourceTypeURL, Format: DomainFileFormatTextList, Name: "public", ReloadPeriod: 24 * time.Hour},
+			},
+		},
+		{
+			name: "case 67: a source reload period below the minimum returns an error",
+			config: `warnlist {
+				url https://feeds.example/public.txt text reload 10s
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 68: an invalid source reload period returns an error",
+			config: `warnlist {
+				file internal.txt text reload soon
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 69: a source reload period can't be combined with a delta feed",
+			config: `warnlist {
+				url https://feeds.example/public.txt text reload 1h
+				reload 24h
+				delta_url https://feeds.example/delta.txt
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 70: strip_www is accepted",
+			config: `warnlist {
+				file domains.txt text
+				strip_www true
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 71: an invalid strip_www returns an error",
+			config: `warnlist {
+				file domains.txt text
+				strip_www sometimes
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 72: log_sample is accepted",
+			config: `warnlist {
+				file domains.txt text
+				log_sample 1/100
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 73: a log_sample which isn't 1/N returns an error",
+			config: `warnlist {
+				file domains.txt text
+				log_sample 2/100
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 74: a log_sample of 1/0 returns an error",
+			config: `warnlist {
+				file domains.txt text
+				log_sample 1/0
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 75: watch is parsed for file sources",
+			config: `warnlist {
+				file domains.txt text
+				watch true
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 76: watch without a file source returns an error",
+			config: `warnlist {
+				url https://example.org/hosts hostfile
+				watch true
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 77: an invalid watch setting returns an error",
+			config: `warnlist {
+				file domains.txt text
+				watch sometimes
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 78: an ip_blocklist is parsed",
+			config: `warnlist {
+				file domains.txt text
+				ip_blocklist url https://example.org/networks.txt
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 79: an ip_blocklist without a path returns an error",
+			config: `warnlist {
+				file domains.txt text
+				ip_blocklist file
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 80: an ip_blocklist of an unknown source type returns an error",
+			config: `warnlist {
+				file domains.txt text
+				ip_blocklist ftp networks.txt
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 81: the auto format is parsed",
+			config: `warnlist {
+				url https://example.org/hosts auto
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/hosts", Type: DomainSourceTypeURL, Format: DomainFileFormatAuto},
+			},
+		},
+		{
+			name: "case 82: a report_list is parsed alongside the sources",
+			config: `warnlist {
+				file domains.txt text
+				report_list url https://example.org/candidates.txt text name candidates
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 83: a report_list of an unknown file format returns an error",
+			config: `warnlist {
+				file domains.txt text
+				report_list file candidates.txt xml
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 84: a report_list with a reload period of its own returns an error",
+			config: `warnlist {
+				file domains.txt text
+				report_list file candidates.txt text reload 1h
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 85: allow_broad_entries is parsed",
+			config: `warnlist {
+				file domains.txt text
+				allow_broad_entries true
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 86: an invalid allow_broad_entries setting returns an error",
+			config: `warnlist {
+				file domains.txt text
+				allow_broad_entries maybe
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 87: responses per kind of match are parsed",
+			config: `warnlist {
+				file domains.txt text
+				response_exact nxdomain
+				response_subtree audit
+				response_wildcard refused
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 88: an unknown response for a kind of match returns an error",
+			config: `warnlist {
+				file domains.txt text
+				response_subtree block
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 89: a sinkhole response for a kind of match without a sinkhole returns an error",
+			config: `warnlist {
+				file domains.txt text
+				response_exact sinkhole
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 90: hit_counts is parsed along with debug_addr",
+			config: `warnlist {
+				file domains.txt text
+				debug_addr 127.0.0.1:8080
+				hit_counts 1000
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 91: hit_counts without debug_addr returns an error",
+			config: `warnlist {
+				file domains.txt text
+				hit_counts 1000
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 92: a hit_counts size which isn't positive returns an error",
+			config: `warnlist {
+				file domains.txt text
+				debug_addr 127.0.0.1:8080
+				hit_counts 0
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 93: an sftp url without sftp_key and sftp_known_hosts returns an error",
+			config: `warnlist {
+				url sftp://feed@intel.example/domains.txt text
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 94: an sftp url with a missing sftp_key returns an error",
+			config: `warnlist {
+				url sftp://feed@intel.example/domains.txt text
+				sftp_key /nonexistent/id_ed25519
+				sftp_known_hosts /nonexistent/known_hosts
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 95: an sftp url without a user returns an error",
+			config: `warnlist {
+				url sftp://intel.example/domains.txt text
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 96: a quoted user_agent is parsed",
+			config: `warnlist {
+				url https://example.org/domains.txt text
+				user_agent "acme-resolver/1.0 (+https://acme.example/feeds)"
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/domains.txt", Type: DomainSourceTypeURL, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 97: user_agent without a value returns an error",
+			config: `warnlist {
+				url https://example.org/domains.txt text
+				user_agent
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 98: confusables is parsed",
+			config: `warnlist {
+				file /etc/coredns/brands.txt text
+				confusables true
+			}`,
+			sources: []DomainSource{
+				{Path: "/etc/coredns/brands.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 99: an invalid confusables setting returns an error",
+			config: `warnlist {
+				file /etc/coredns/brands.txt text
+				confusables sometimes
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 100: build_workers is parsed",
+			config: `warnlist {
+				url https://example.org/domains.txt text
+				url https://example.org/more-domains.txt text
+				build_workers 2
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/domains.txt", Type: DomainSourceTypeURL, Format: DomainFileFormatTextList},
+				{Path: "https://example.org/more-domains.txt", Type: DomainSourceTypeURL, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 101: a zero build_workers returns an error",
+			config: `warnlist {
+				url https://example.org/domains.txt text
+				build_workers 0
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 102: max_stale is parsed",
+			config: `warnlist {
+				url https://example.org/domains.txt text
+				reload 1h
+				max_stale 6h
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/domains.txt", Type: DomainSourceTypeURL, Format: DomainFileFormatTextList},
+			},
+		},
+		{
+			name: "case 103: max_stale without reloads returns an error",
+			config: `warnlist {
+				url https://example.org/domains.txt text
+				max_stale 6h
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 104: max_stale no longer than reload returns an error",
+			config: `warnlist {
+				url https://example.org/domains.txt text
+				reload 6h
+				max_stale 6h
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 105: an invalid max_stale returns an error",
+			config: `warnlist {
+				url https://example.org/domains.txt text
+				reload 1h
+				max_stale never
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 106: the umbrella format is parsed",
+			config: `warnlist {
+				url https://example.org/top-1m.csv umbrella
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/top-1m.csv", Type: DomainSourceTypeURL, Format: DomainFileFormatUmbrella},
+			},
+		},
+		{
+			name: "case 107: min_score and default_score are parsed",
+			config: `warnlist {
+				url https://example.org/scored.csv scored
+				min_score 0.75
+				default_score 0.5
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/scored.csv", Type: DomainSourceTypeURL, Format: DomainFileFormatScored},
+			},
+		},
+		{
+			name: "case 108: an invalid min_score returns an error",
+			config: `warnlist {
+				url https://example.org/scored.csv scored
+				min_score high
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 109: a NaN default_score returns an error",
+			config: `warnlist {
+				url https://example.org/scored.csv scored
+				default_score NaN
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 110: SIGUSR2, which upgrades the CoreDNS binary, returns an error as a reload signal",
+			config: `warnlist {
+				file domains.txt text
+				reload_signal SIGUSR2
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 111: max_stale no longer than the reload period of a source returns an error",
+			config: `warnlist {
+				url https://example.org/domains.txt text reload 24h
+				reload 1h
+				max_stale 6h
+			}`,
+			expectErr: true,
+		},
+		{
+			name: "case 112: max_stale longer than every reload period is parsed",
+			config: `warnlist {
+				url https://example.org/domains.txt text reload 2h
+				reload 1h
+				max_stale 6h
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/domains.txt", Type: DomainSourceTypeURL, Format: DomainFileFormatTextList, ReloadPeriod: 2 * time.Hour},
+			},
+		},
+		{
+			name: "case 113: an empty startup reloaded by a source of its own is parsed",
+			config: `warnlist {
+				url https://example.org/domains.txt text reload 1h
+				allow_empty_startup true
+			}`,
+			sources: []DomainSource{
+				{Path: "https://example.org/domains.txt", Type: DomainSourceTypeURL, Format: DomainFileFormatTextList, ReloadPeriod: time.Hour},
+			},
+		},
+		{
+			name: "case 114: an empty startup of a watched file is parsed",
+			config: `warnlist {
+				file domains.txt text
+				watch true
+				allow_empty_startup true
+			}`,
+			sources: []DomainSource{
+				{Path: "domains.txt", Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			c := caddy.NewTestController("dns", tc.config)
+			options, err := parseArguments(c)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(tc.sources, options.Sources) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.sources, options.Sources))
+			}
+			if !cmp.Equal(tc.headers, options.Headers) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.headers, options.Headers))
+			}
+		})
+	}
+}
+
+func Test_jitter(t *testing.T) {
+	var testCases = []struct {
+		name   string
+		period time.Duration
+		min    time.Duration
+	}{
+		{
+			name:   "case 0: a zero period is used as it is",
+			period: 0,
+			min:    0,
+		},
+		{
+			name:   "case 1: a negative period is used as it is",
+			period: -time.Second,
+			min:    -time.Second,
+		},
+		{
+			name:   "case 2: a period too short to be jittered is used as it is",
+			period: 20 * time.Nanosecond,
+			min:    20 * time.Nanosecond,
+		},
+		{
+			name:   "case 3: a 1ms period is jittered",
+			period: time.Millisecond,
+			min:    time.Millisecond - time.Millisecond/MaxJitterPercent,
+		},
+		{
+			name:   "case 4: a 30ms period is jittered",
+			period: 30 * time.Millisecond,
+			min:    29 * time.Millisecond,
+		},
+		{
+			name:   "case 5: a 1s period is jittered",
+			period: time.Second,
+			min:    time.Second - time.Second/MaxJitterPercent,
+		},
+		{
+			name:   "case 6: a 1h period is jittered",
+			period: time.Hour,
+			min:    time.Hour - 2*time.Minute,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			for n := 0; n < 100; n++ {
+				j := jitter(tc.period)
+				if j < tc.min || j > tc.period {
+					t.Fatalf("expected a period between %s and %s, got %s", tc.min, tc.period, j)
+				}
+			}
+		})
+	}
+}
+
+func Test_reloadHookLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("example.org\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+	}
+	list, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	before := runtime.NumGoroutine()
+
+	// Stopping a hook which was never started is a no-op
+	(&WarnlistPlugin{}).stopReloadHook()
+
+	for i := 0; i < 100; i++ {
+		wp := &WarnlistPlugin{warnlist: list, Options: options}
+		wp.startReloadHook(time.Millisecond)
+		if i%2 == 0 {
+			// Give some of the hooks the time to reload before they're stopped
+			time.Sleep(2 * time.Millisecond)
+		}
+		wp.stopReloadHook()
+		// Stopping a hook twice, like a restart followed by the final shutdown, doesn't block
+		wp.stopReloadHook()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the reload hooks to stop, %d goroutines are left over", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCorefileReloadStopsReloadHook(t *testing.T) {
+	// Goroutines left over by other tests, like timed out startup builds, aren't leaks of this one
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("example.org\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Plugins only run if they're listed as a directive, which external plugins are by the CoreDNS build
+	if !contains(dnsserver.Directives, "warnlist") {
+		dnsserver.Directives = append(dnsserver.Directives, "warnlist")
+	}
+	caddy.Quiet = true
+	dnsserver.Quiet = true
+
+	input := caddy.CaddyfileInput{
+		Contents: []byte(fmt.Sprintf(`.:0 {
+			warnlist {
+				file %s text
+				reload 1s
+				reload_signal SIGHUP
+			}
+		}`, path)),
+		ServerTypeName: "dns",
+	}
+	instance, err := caddy.Start(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForServers(t, instance)
+
+	// Every reload of the Corefile runs setup again, and has to stop the reload and signal hooks of the instance it
+	// replaces
+	for i := 0; i < 5; i++ {
+		instance, err = instance.Restart(input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		waitForServers(t, instance)
+	}
+
+	if errs := instance.ShutdownCallbacks(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if err := instance.Stop(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFailedCorefileReloadStartsNoHooks(t *testing.T) {
+	// The signal package watches for signals in a goroutine of its own, which is started by the first handler
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	signal.Stop(c)
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("example.org\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if !contains(dnsserver.Directives, "warnlist") {
+		dnsserver.Directives = append(dnsserver.Directives, "warnlist")
+	}
+	caddy.Quiet = true
+	dnsserver.Quiet = true
+
+	instance, err := caddy.Start(caddy.CaddyfileInput{
+		Contents:       []byte(fmt.Sprintf(".:0 {\n\twarnlist {\n\t\tfile %s text\n\t}\n}", path)),
+		ServerTypeName: "dns",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForServers(t, instance)
+
+	// The first server block is set up before the second one fails, so its instance is dropped without being started
+	// or shut down, and mustn't leave a signal handler behind
+	_, err = instance.Restart(caddy.CaddyfileInput{
+		Contents: []byte(fmt.Sprintf(`.:0 {
+			warnlist {
+				file %s text
+				reload_signal SIGHUP
+			}
+		}
+		example.org:0 {
+			warnlist {
+				file %s bogus
+			}
+		}`, path, path)),
+		ServerTypeName: "dns",
+	})
+	if err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+
+	if errs := instance.ShutdownCallbacks(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if err := instance.Stop(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// waitForServers waits until the servers of the instance answer queries. Servers which are stopped before they're
+// serving keep their listeners open.
+func waitForServers(t *testing.T, instance *caddy.Instance) {
+	for _, server := range instance.Servers() {
+		for network, addr := range map[string]net.Addr{"udp": server.LocalAddr(), "tcp": server.Addr()} {
+			m := new(dns.Msg)
+			m.SetQuestion("example.org.", dns.TypeA)
+			client := &dns.Client{Net: network}
+			if _, _, err := client.Exchange(m, addr.String()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
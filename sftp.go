@@ -0,0 +1,117 @@
+package warnlist
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultSFTPPort is the port of sftp sources which don't set one.
+const defaultSFTPPort = "22"
+
+// newSFTPConfig returns the SSH configuration to connect to sftp sources with, authenticating with the private key in
+// keyPath, and only accepting the host keys listed in the known hosts file, so a spoofed server is refused.
+func newSFTPConfig(keyPath string, knownHostsPath string) (*ssh.ClientConfig, error) {
+	if keyPath == "" || knownHostsPath == "" {
+		return nil, errors.New("sftp sources require sftp_key and sftp_known_hosts")
+	}
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sftp_key %s: %w", keyPath, err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse sftp_key %s: %w", keyPath, err)
+	}
+	hostKeys, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load sftp_known_hosts %s: %w", knownHostsPath, err)
+	}
+	return &ssh.ClientConfig{Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)}, HostKeyCallback: hostKeys}, nil
+}
+
+// parseSFTPURL splits an sftp://user@host[:port]/path URL into the user, the address of the server, and the path of
+// the file on it.
+func parseSFTPURL(path string) (string, string, string, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", "", "", err
+	}
+	if u.Scheme != "sftp" || u.User == nil || u.User.Username() == "" || u.Hostname() == "" || u.Path == "" {
+		return "", "", "", fmt.Errorf("invalid sftp URL %s (must be sftp://user@host/path)", redactURL(path))
+	}
+	if _, ok := u.User.Password(); ok {
+		// Only keys are supported, and a password in the Corefile would be logged along with the URL
+		return "", "", "", fmt.Errorf("invalid sftp URL %s (use sftp_key instead of a password)", redactURL(path))
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultSFTPPort
+	}
+	return u.User.Username(), net.JoinHostPort(u.Hostname(), port), u.Path, nil
+}
+
+// sftpFile is a file being read from an sftp source, which closes the connection to the server once it is closed.
+type sftpFile struct {
+	*sftp.File
+	client *sftp.Client
+	conn   *ssh.Client
+}
+
+func (f *sftpFile) Close() error {
+	err := f.File.Close()
+	f.client.Close()
+	f.conn.Close()
+	return err
+}
+
+// openSFTP connects to the server of the sftp://user@host/path URL, and opens the file for reading.
+func openSFTP(path string, options PluginOptions) (*sftpFile, error) {
+	user, addr, remotePath, err := parseSFTPURL(path)
+	if err != nil {
+		return nil, err
+	}
+	if options.SFTPConfig == nil {
+		return nil, errors.New("sftp sources require sftp_key and sftp_known_hosts")
+	}
+
+	config := *options.SFTPConfig
+	config.User = user
+	config.Timeout = options.Timeout
+	if config.Timeout == 0 {
+		config.Timeout = DefaultFetchTimeout
+	}
+	conn, err := ssh.Dial("tcp", addr, &config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %s: %w", addr, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to start sftp on %s: %w", addr, err)
+	}
+	file, err := client.Open(remotePath)
+	if err != nil {
+		client.Close()
+		conn.Close()
+		return nil, fmt.Errorf("unable to open %s: %w", redactURL(path), err)
+	}
+	return &sftpFile{File: file, client: client, conn: conn}, nil
+}
+
+// statSFTP returns the file info of the file of an sftp source, for validating it like a local file.
+func statSFTP(path string, options PluginOptions) (os.FileInfo, error) {
+	file, err := openSFTP(path, options)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
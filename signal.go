@@ -0,0 +1,41 @@
+package warnlist
+
+import (
+	"os"
+	"os/signal"
+	"time"
+)
+
+// DefaultReloadSignal is the signal which triggers a reload when reload_signal is given without a signal. CoreDNS
+// ignores it, unlike SIGUSR1 which reloads the whole Corefile, so it only reloads the warnlist.
+const DefaultReloadSignal = "SIGHUP"
+
+// signalHook rebuilds the warnlist whenever the process receives sig, alongside any periodic reloads. The returned
+// function stops handling the signal.
+func signalHook(wp *WarnlistPlugin, sig os.Signal) func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-c:
+				log.Infof("Received %s, reloading warnlist", sig)
+				start := time.Now()
+
+				rebuildWarnlist(wp)
+
+				log.Infof("Finished %s reload in %s", sig, time.Since(start))
+
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
@@ -0,0 +1,108 @@
+//go:build !windows
+// +build !windows
+
+package warnlist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseReloadSignal(t *testing.T) {
+	var testCases = []struct {
+		name   string
+		config string
+		signal os.Signal
+	}{
+		{
+			name: "case 0: no reload signal is handled by default",
+			config: `warnlist {
+				file domains.txt text
+			}`,
+		},
+		{
+			name: "case 1: reload_signal without a signal uses SIGHUP",
+			config: `warnlist {
+				file domains.txt text
+				reload_signal
+			}`,
+			signal: syscall.SIGHUP,
+		},
+		{
+			name: "case 2: reload_signal uses the given signal",
+			config: `warnlist {
+				file domains.txt text
+				reload_signal SIGUSR1
+			}`,
+			signal: syscall.SIGUSR1,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			c := caddy.NewTestController("dns", tc.config)
+			options, err := parseArguments(c)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(tc.signal, options.ReloadSignal) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.signal, options.ReloadSignal))
+			}
+		})
+	}
+}
+
+func Test_signalHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("example.org\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+	}
+	list, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := &WarnlistPlugin{warnlist: list, Options: options}
+
+	stop := signalHook(wp, syscall.SIGUSR1)
+	defer stop()
+
+	if err := ioutil.WriteFile(path, []byte("example.org\nsomething.evil\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		warnlist, _ := wp.lists()
+		if warnlist.Contains("something.evil.") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the signal to reload the warnlist")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package warnlist
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals are the signals which can be given to reload_signal. SIGUSR2 isn't one of them, since CoreDNS
+// upgrades its binary when it receives it.
+var reloadSignals = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+}
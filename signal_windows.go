@@ -0,0 +1,6 @@
+package warnlist
+
+import "os"
+
+// reloadSignals are the signals which can be given to reload_signal, of which there are none on Windows.
+var reloadSignals = map[string]os.Signal{}
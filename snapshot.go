@@ -0,0 +1,206 @@
+package warnlist
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultCacheMaxAge is the age above which a snapshot is considered too stale to start with.
+const DefaultCacheMaxAge = 24 * time.Hour
+
+// The kinds of snapshot entries.
+const (
+	snapshotDomain    = "domain"
+	snapshotRegex     = "regex"
+	snapshotException = "exception"
+)
+
+// snapshotHeader is the first line of every snapshot, so other files and snapshots of another layout are rejected.
+const snapshotHeader = "warnlist snapshot v1"
+
+// snapshotWriter writes the entries of a warnlist build to a gzip compressed snapshot. Entries are written to a
+// temporary file next to the snapshot, which only replaces it once the build succeeded, so a failed build or a crash
+// never leaves a truncated snapshot behind.
+//
+// Each line of a snapshot holds the kind of an entry, domain, regex or exception, the entry in its canonical form, the name of its
+// source, and the query types it is limited to, separated by tabs.
+type snapshotWriter struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	w    *bufio.Writer
+	err  error
+}
+
+func newSnapshotWriter(path string) (*snapshotWriter, error) {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	s := &snapshotWriter{path: path, file: file, gz: gz, w: bufio.NewWriter(gz)}
+	_, s.err = s.w.WriteString(snapshotHeader + "\n")
+	return s, nil
+}
+
+// add writes an entry loaded from the named source to the snapshot. Write errors are returned by commit.
+func (s *snapshotWriter) add(entry listEntry, source string) {
+	if s == nil || s.err != nil {
+		return
+	}
+
+	kind := snapshotDomain
+	if entry.pattern != nil {
+		kind = snapshotRegex
+	} else if entry.exception {
+		kind = snapshotException
+	}
+	qtypes := make([]string, 0, len(entry.qtypes))
+	for _, qtype := range entry.qtypes {
+		qtypes = append(qtypes, dns.TypeToString[qtype])
+	}
+	_, s.err = fmt.Fprintf(s.w, "%s\t%s\t%s\t%s\n", kind, entry.domain, source, strings.Join(qtypes, " "))
+}
+
+// commit replaces the snapshot with the entries written so far.
+func (s *snapshotWriter) commit() error {
+	if s == nil {
+		return nil
+	}
+	if s.err == nil {
+		s.err = s.w.Flush()
+	}
+	if s.err == nil {
+		s.err = s.gz.Close()
+	}
+	if err := s.file.Close(); s.err == nil {
+		s.err = err
+	}
+	if s.err == nil {
+		s.err = os.Rename(s.file.Name(), s.path)
+	}
+	if s.err != nil {
+		os.Remove(s.file.Name())
+	}
+	return s.err
+}
+
+// abort discards the entries written so far, keeping the previous snapshot.
+func (s *snapshotWriter) abort() {
+	if s == nil {
+		return
+	}
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// touchSnapshot marks the snapshot as fresh, for reloads which found the sources unchanged.
+func touchSnapshot(path string) {
+	if path == "" {
+		return
+	}
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil && !os.IsNotExist(err) {
+		log.Warningf("unable to refresh warnlist snapshot %s: %v", path, err)
+	}
+}
+
+// loadSnapshot loads the warnlist from the snapshot at path, unless it is older than maxAge, and returns when the
+// snapshot was written. maxAge 0 accepts a snapshot of any age. A snapshot which can't be read completely is rejected
+// as a whole.
+func loadSnapshot(path string, maxAge time.Duration, options PluginOptions) (Warnlist, time.Time, error) {
+	// Print a log message with the time it took to load the snapshot
+	defer logTime("Loading warnlist snapshot took %s", time.Now())
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if age := time.Since(info.ModTime()); maxAge > 0 && age > maxAge {
+		return nil, time.Time{}, fmt.Errorf("snapshot is %s old, older than the cache_max_age of %s", age.Round(time.Second), maxAge)
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(nil, maxLineSize)
+	if !scanner.Scan() || scanner.Text() != snapshotHeader {
+		if err := scanner.Err(); err != nil {
+			return nil, time.Time{}, err
+		}
+		return nil, time.Time{}, errors.New("not a warnlist snapshot")
+	}
+
+	list := newListBuilder(options)
+	for line := 1; scanner.Scan(); line++ {
+		entry, source, err := parseSnapshotLine(scanner.Text())
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("malformed snapshot entry on line %d: %w", line, err)
+		}
+		list.add(entry, source)
+	}
+	if err := scanner.Err(); err != nil {
+		// Usually a truncated or corrupted file
+		return nil, time.Time{}, err
+	}
+	warnlist, err := list.close()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	log.Infof("loaded %d domains into warnlist from snapshot %s", warnlist.Len(), path)
+	options.counts.recordLoaded("warnlist", warnlist.Len())
+	return warnlist, info.ModTime(), nil
+}
+
+// parseSnapshotLine returns the entry on a line of a snapshot, and the name of its source.
+func parseSnapshotLine(line string) (listEntry, string, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 4 {
+		return listEntry{}, "", errors.New("wrong number of fields")
+	}
+
+	entry := listEntry{domain: fields[1]}
+	switch fields[0] {
+	case snapshotDomain, snapshotException:
+		if !isValidEntry(entry.domain) {
+			return listEntry{}, "", fmt.Errorf("invalid domain %q", entry.domain)
+		}
+		entry.exception = fields[0] == snapshotException
+	case snapshotRegex:
+		re, err := regexp.Compile(entry.domain)
+		if err != nil {
+			return listEntry{}, "", err
+		}
+		entry.pattern = re
+	default:
+		return listEntry{}, "", fmt.Errorf("unknown kind %q", fields[0])
+	}
+
+	for _, name := range strings.Fields(fields[3]) {
+		qtype, ok := dns.StringToType[name]
+		if !ok {
+			return listEntry{}, "", fmt.Errorf("unknown query type %s", name)
+		}
+		entry.qtypes = append(entry.qtypes, qtype)
+	}
+	return entry, fields[2], nil
+}
@@ -0,0 +1,220 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+)
+
+func Test_snapshotRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(source, []byte("Bad.Example\nexfil.example TXT NULL\n*.wild.example\n!safe.wild.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, matchSubdomains := range []bool{true, false} {
+		options := PluginOptions{
+			Sources:         []DomainSource{{Path: source, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList, Name: "local"}},
+			MatchSubdomains: matchSubdomains,
+			CacheFile:       filepath.Join(dir, "warnlist.gz"),
+		}
+		built, err := buildCacheFromFile(options, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		loaded, _, err := loadSnapshot(options.CacheFile, DefaultCacheMaxAge, options)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !cmp.Equal(built.Len(), loaded.Len()) {
+			t.Fatalf("match_subdomains %t: \n\n%s\n", matchSubdomains, cmp.Diff(built.Len(), loaded.Len()))
+		}
+		if !cmp.Equal("local", sourceOf(loaded, "bad.example.")) {
+			t.Fatalf("match_subdomains %t: \n\n%s\n", matchSubdomains, cmp.Diff("local", sourceOf(loaded, "bad.example.")))
+		}
+		if _, ok := matchType(loaded, "www.wild.example.", dns.TypeA); !ok {
+			t.Fatalf("match_subdomains %t: expected the wildcard entry to be loaded", matchSubdomains)
+		}
+		if _, ok := matchType(loaded, "safe.wild.example.", dns.TypeA); ok {
+			t.Fatalf("match_subdomains %t: expected the exception to be loaded", matchSubdomains)
+		}
+		if _, ok := matchType(loaded, "exfil.example.", dns.TypeNULL); !ok {
+			t.Fatalf("match_subdomains %t: expected the qualified entry to match its type", matchSubdomains)
+		}
+		if _, ok := matchType(loaded, "exfil.example.", dns.TypeA); ok {
+			t.Fatalf("match_subdomains %t: expected the qualified entry not to match other types", matchSubdomains)
+		}
+	}
+}
+
+func Test_loadSnapshotRejects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	valid := string(gzipped(t, snapshotHeader+"\ndomain\tbad.example.\t\t\n"))
+
+	var testCases = []struct {
+		name    string
+		content string
+		age     time.Duration
+	}{
+		{
+			name:    "case 0: a snapshot older than the max age is rejected",
+			content: valid,
+			age:     48 * time.Hour,
+		},
+		{
+			name:    "case 1: a file which isn't compressed is rejected",
+			content: snapshotHeader + "\ndomain\tbad.example.\t\t\n",
+		},
+		{
+			name:    "case 2: a truncated snapshot is rejected",
+			content: valid[:len(valid)-6],
+		},
+		{
+			name:    "case 3: a compressed file which isn't a snapshot is rejected",
+			content: string(gzipped(t, "bad.example\n")),
+		},
+		{
+			name:    "case 4: a snapshot with a malformed entry is rejected",
+			content: string(gzipped(t, snapshotHeader+"\ndomain\tbad.example.\t\t\n<html>\n")),
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			path := filepath.Join(dir, strconv.Itoa(i)+".gz")
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			modified := time.Now().Add(-tc.age)
+			if err := os.Chtimes(path, modified, modified); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := loadSnapshot(path, DefaultCacheMaxAge, PluginOptions{MatchSubdomains: true}); err == nil {
+				t.Fatalf("expected an error, got none")
+			}
+		})
+	}
+}
+
+func Test_buildCacheKeepsSnapshotOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(source, []byte(testTextList), 0600); err != nil {
+		t.Fatal(err)
+	}
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: source, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+		CacheFile:       filepath.Join(dir, "warnlist.gz"),
+	}
+	if _, err := buildCacheFromFile(options, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A failed build leaves neither a partial snapshot nor a temporary file behind
+	if err := os.Remove(source); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildCacheFromFile(options, nil); err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+	loaded, _, err := loadSnapshot(options.CacheFile, DefaultCacheMaxAge, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cmp.Equal(2, loaded.Len()) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(2, loaded.Len()))
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(1, len(files)) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(1, len(files)))
+	}
+}
+
+func Test_buildStartupCachesFromSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hang until the test is done, like a slow feed
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	snapshot := filepath.Join(dir, "warnlist.gz")
+	if err := ioutil.WriteFile(snapshot, gzipped(t, snapshotHeader+"\ndomain\tbad.example.\turlhaus\t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	written := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(snapshot, written, written); err != nil {
+		t.Fatal(err)
+	}
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: server.URL, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+		Timeout:         10 * time.Second,
+		StartupTimeout:  5 * time.Second,
+		CacheFile:       snapshot,
+		CacheMaxAge:     DefaultCacheMaxAge,
+	}
+
+	start := time.Now()
+	caches, err := buildStartupCaches(options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected to start from the snapshot without fetching, took %s", elapsed)
+	}
+	if !caches.fromSnapshot || !caches.loaded {
+		t.Fatalf("expected the caches to be loaded from the snapshot")
+	}
+	if !caches.warnlist.Contains("www.bad.example.") {
+		t.Fatalf("expected the snapshot entries to be loaded")
+	}
+	if caches.validators != nil {
+		t.Fatalf("expected the next reload to fetch every source")
+	}
+
+	// The warnlist is as old as the snapshot, not as its loading
+	wp := newWarnlistPlugin(options, caches, time.Now())
+	if !wp.lastReloadTime.Equal(written) {
+		t.Fatalf("expected the last reload at %s, got %s", written, wp.lastReloadTime)
+	}
+}
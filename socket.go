@@ -0,0 +1,26 @@
+package warnlist
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// dialSocket connects to a unix socket source, which a co-located process writes the list to before closing the
+// connection. Reads time out like url requests, so a producer which stops writing can't stall the build.
+func dialSocket(path string, options PluginOptions) (net.Conn, error) {
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = DefaultFetchTimeout
+	}
+
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to socket %s: %w", path, err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to set deadline on socket %s: %w", path, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,94 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_buildCacheFromSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var testCases = []struct {
+		name      string
+		write     func(conn net.Conn)
+		expectErr bool
+	}{
+		{
+			name: "case 0: a list written before closing the connection is loaded",
+			write: func(conn net.Conn) {
+				_, _ = conn.Write([]byte(testTextList))
+				conn.Close()
+			},
+		},
+		{
+			name: "case 1: a gzipped list is loaded",
+			write: func(conn net.Conn) {
+				_, _ = conn.Write(gzipped(t, testTextList))
+				conn.Close()
+			},
+		},
+		{
+			name: "case 2: a producer which stops writing without closing the connection returns an error",
+			write: func(conn net.Conn) {
+				_, _ = conn.Write([]byte("example.org\n"))
+			},
+			expectErr: true,
+		},
+		{
+			name:      "case 3: a missing socket returns an error",
+			expectErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			path := filepath.Join(dir, strconv.Itoa(i)+".sock")
+			if tc.write != nil {
+				ln, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer ln.Close()
+				go func() {
+					conn, err := ln.Accept()
+					if err != nil {
+						return
+					}
+					tc.write(conn)
+				}()
+			}
+
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeSocket, Format: DomainFileFormatTextList}},
+				MatchSubdomains: true,
+				Timeout:         100 * time.Millisecond,
+			}
+			list, err := buildCacheFromFile(options, nil)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(2, list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(2, list.Len()))
+			}
+		})
+	}
+}
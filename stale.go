@@ -0,0 +1,45 @@
+package warnlist
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// longestReloadPeriod returns the longest time between two periodic reloads of a warnlist source, out of the reload
+// period and the reload periods of sources, so max_stale can be checked against the source which is refreshed least
+// often. Jitter only ever shortens the configured periods, so they are the longest ones.
+func (o PluginOptions) longestReloadPeriod() time.Duration {
+	longest := o.ReloadPeriod
+	for period := range o.sourceReloadPeriods() {
+		if period > longest {
+			longest = period
+		}
+	}
+	return longest
+}
+
+// stale returns true if max_stale is set and the last successful reload is longer ago, in which case warnlisted queries
+// are passed through instead of being blocked, so an outdated warnlist isn't served indefinitely. Each query passed
+// through is counted, and the first one logs an error, until a reload succeeds again.
+func (wp *WarnlistPlugin) stale(server string) bool {
+	if wp.Options.MaxStale == 0 {
+		return false
+	}
+
+	wp.mu.RLock()
+	age := time.Since(wp.lastReloadTime)
+	wp.mu.RUnlock()
+
+	if age <= wp.Options.MaxStale {
+		if atomic.CompareAndSwapUint32(&wp.staleLogged, 1, 0) {
+			log.Info("warnlist reloaded, blocking warnlisted queries again")
+		}
+		return false
+	}
+
+	if atomic.CompareAndSwapUint32(&wp.staleLogged, 0, 1) {
+		log.Errorf("warnlist was last reloaded %s ago, longer than max_stale %s, passing warnlisted queries through until a reload succeeds", age.Round(time.Second), wp.Options.MaxStale)
+	}
+	stalePassthroughs.WithLabelValues(server).Inc()
+	return true
+}
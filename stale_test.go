@@ -0,0 +1,127 @@
+package warnlist
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMaxStale(t *testing.T) {
+	wl := NewRadixWarnlist()
+	wl.Add("evil.com.")
+	wl.Close()
+
+	var testCases = []struct {
+		name       string
+		maxStale   time.Duration
+		reloadedAt time.Duration
+		domain     string
+		rcode      int
+		passed     float64
+	}{
+		{
+			name:       "case 0: a warnlist reloaded within max_stale blocks",
+			maxStale:   time.Hour,
+			reloadedAt: 30 * time.Minute,
+			domain:     "evil.com.",
+			rcode:      dns.RcodeNameError,
+		},
+		{
+			name:       "case 1: a warnlist older than max_stale passes warnlisted queries through",
+			maxStale:   time.Hour,
+			reloadedAt: 2 * time.Hour,
+			domain:     "evil.com.",
+			rcode:      dns.RcodeServerFailure,
+			passed:     1,
+		},
+		{
+			name:       "case 2: without max_stale, an old warnlist still blocks",
+			reloadedAt: 24 * time.Hour,
+			domain:     "evil.com.",
+			rcode:      dns.RcodeNameError,
+		},
+		{
+			name:       "case 3: queries which aren't warnlisted aren't counted",
+			maxStale:   time.Hour,
+			reloadedAt: 2 * time.Hour,
+			domain:     "clean.example.",
+			rcode:      dns.RcodeServerFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			m := WarnlistPlugin{
+				Next:           test.ErrorHandler(),
+				warnlist:       wl,
+				lastReloadTime: time.Now().Add(-tc.reloadedAt),
+				Options:        PluginOptions{Response: ResponseNXDomain, MaxStale: tc.maxStale},
+			}
+
+			counter := stalePassthroughs.WithLabelValues("")
+			before := testutil.ToFloat64(counter)
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			rcode, err := m.ServeDNS(context.TODO(), rec, r)
+			if err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+			if !cmp.Equal(tc.rcode, rcode) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.rcode, rcode))
+			}
+			if !cmp.Equal(tc.passed, testutil.ToFloat64(counter)-before) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.passed, testutil.ToFloat64(counter)-before))
+			}
+		})
+	}
+}
+
+func TestMaxStaleRecovers(t *testing.T) {
+	wl := NewRadixWarnlist()
+	wl.Add("evil.com.")
+	wl.Close()
+
+	m := WarnlistPlugin{
+		Next:           test.ErrorHandler(),
+		warnlist:       wl,
+		lastReloadTime: time.Now().Add(-2 * time.Hour),
+		Options:        PluginOptions{Response: ResponseNXDomain, MaxStale: time.Hour},
+	}
+
+	serve := func() int {
+		r := new(dns.Msg)
+		r.SetQuestion("evil.com.", dns.TypeA)
+		rcode, err := m.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), r)
+		if err != nil {
+			t.Fatalf("Error serving DNS: %v", err)
+		}
+		return rcode
+	}
+
+	if rcode := serve(); !cmp.Equal(dns.RcodeServerFailure, rcode) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(dns.RcodeServerFailure, rcode))
+	}
+
+	// A successful reload resumes blocking
+	m.mu.Lock()
+	m.lastReloadTime = time.Now()
+	m.mu.Unlock()
+	if rcode := serve(); !cmp.Equal(dns.RcodeNameError, rcode) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(dns.RcodeNameError, rcode))
+	}
+	if m.staleLogged != 0 {
+		t.Fatalf("expected blocking to be logged as resumed")
+	}
+}
@@ -0,0 +1,118 @@
+package warnlist
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// startupCaches holds the caches built when the plugin is set up.
+type startupCaches struct {
+	warnlist    Warnlist
+	allowlist   Warnlist
+	protected   *TypoMatcher
+	ipBlocklist *IPBlocklist
+	reportList  Warnlist
+	validators  sourceValidators
+	// sources holds the entries of the warnlist sources, if any of them has a reload period of its own
+	sources sourceCache
+	// counts holds the sizes of the lists
+	counts *listCounts
+	// loaded is false if the plugin starts with an empty warnlist, until a reload succeeds
+	loaded bool
+	// fromSnapshot is true if the warnlist was loaded from the snapshot, so it still has to be fetched from the sources,
+	// and snapshotTime is when the snapshot was written
+	fromSnapshot bool
+	snapshotTime time.Time
+}
+
+// buildStartupCaches builds the caches the plugin starts with. A build which fails, or which takes longer than the
+// startup timeout, fails the setup, unless empty startups are allowed, in which case the plugin starts with an empty
+// warnlist which is populated by the next reload.
+func buildStartupCaches(options PluginOptions) (startupCaches, error) {
+	if options.CacheFile != "" {
+		caches, err := startFromSnapshot(options)
+		if err == nil {
+			return caches, nil
+		}
+		if os.IsNotExist(err) {
+			log.Infof("no warnlist snapshot at %s yet, building from the sources", options.CacheFile)
+		} else {
+			// A corrupt or stale snapshot is only a missed shortcut
+			log.Warningf("unable to load warnlist snapshot %s, building from the sources: %v", options.CacheFile, err)
+		}
+	}
+
+	caches, err := buildCachesWithin(options, options.StartupTimeout)
+	if err == nil {
+		return caches, nil
+	}
+	if !options.AllowEmptyStartup {
+		return startupCaches{}, err
+	}
+
+	log.Warningf("starting with an empty warnlist until the next reload: %v", err)
+	// An empty cache rather than none, so reloads can report its size until one succeeds
+	warnlist := newWarnlist(options)
+	if err := warnlist.Close(); err != nil {
+		return startupCaches{}, err
+	}
+	return startupCaches{warnlist: warnlist}, nil
+}
+
+// buildCachesWithin builds the caches, giving up once the timeout has passed if it isn't 0. A build which is given up
+// on keeps running in the background until its fetches time out, but its caches are discarded.
+func buildCachesWithin(options PluginOptions, timeout time.Duration) (startupCaches, error) {
+	type result struct {
+		caches startupCaches
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		validators := sourceValidators{}
+		sources := newSourceCache(options)
+		caches, err := buildCaches(options, validators, nil, sources)
+		done <- result{caches: caches, err: err}
+	}()
+
+	if timeout == 0 {
+		r := <-done
+		return r.caches, r.err
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case r := <-done:
+		return r.caches, r.err
+	case <-deadline.C:
+		return startupCaches{}, fmt.Errorf("building the warnlist took longer than the startup timeout of %s", timeout)
+	}
+}
+
+// startFromSnapshot loads the warnlist from the snapshot, and builds the other caches, which are usually much smaller,
+// from their sources. The loaded caches have no validators, so the next reload fetches every source.
+func startFromSnapshot(options PluginOptions) (startupCaches, error) {
+	options.counts = newListCounts()
+	warnlist, snapshotTime, err := loadSnapshot(options.CacheFile, options.CacheMaxAge, options)
+	if err != nil {
+		return startupCaches{}, err
+	}
+	allowlist, err := buildAllowlistFromFile(options, nil)
+	if err != nil {
+		return startupCaches{}, err
+	}
+	protected, err := buildProtectedFromFile(options, nil)
+	if err != nil {
+		return startupCaches{}, err
+	}
+	ipBlocklist, err := buildIPBlocklistFromFile(options, nil)
+	if err != nil {
+		return startupCaches{}, err
+	}
+	reportList, err := buildReportListFromFile(options, nil)
+	if err != nil {
+		return startupCaches{}, err
+	}
+	return startupCaches{warnlist: warnlist, allowlist: allowlist, protected: protected, ipBlocklist: ipBlocklist, reportList: reportList, counts: options.counts, loaded: true, fromSnapshot: true, snapshotTime: snapshotTime}, nil
+}
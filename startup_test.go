@@ -0,0 +1,105 @@
+package warnlist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_buildStartupCaches(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hang" {
+			// Hang until the test is done, like a dead feed
+			<-release
+			return
+		}
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testTextList))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	var testCases = []struct {
+		name              string
+		path              string
+		startupTimeout    time.Duration
+		allowEmptyStartup bool
+		entries           int
+		loaded            bool
+		expectErr         bool
+	}{
+		{
+			name:           "case 0: a build within the startup timeout is loaded",
+			path:           "/list",
+			startupTimeout: 5 * time.Second,
+			entries:        2,
+			loaded:         true,
+		},
+		{
+			name:           "case 1: a build exceeding the startup timeout fails the setup",
+			path:           "/hang",
+			startupTimeout: 50 * time.Millisecond,
+			expectErr:      true,
+		},
+		{
+			name:              "case 2: a build exceeding the startup timeout starts empty if allowed",
+			path:              "/hang",
+			startupTimeout:    50 * time.Millisecond,
+			allowEmptyStartup: true,
+		},
+		{
+			name:              "case 3: a failed build starts empty if allowed",
+			path:              "/missing",
+			allowEmptyStartup: true,
+		},
+		{
+			name:      "case 4: a failed build fails the setup",
+			path:      "/missing",
+			expectErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Sources:           []DomainSource{{Path: server.URL + tc.path, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList}},
+				MatchSubdomains:   true,
+				Timeout:           10 * time.Second,
+				StartupTimeout:    tc.startupTimeout,
+				AllowEmptyStartup: tc.allowEmptyStartup,
+			}
+
+			start := time.Now()
+			caches, err := buildStartupCaches(options)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("expected the startup build to give up, took %s", elapsed)
+			}
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(tc.entries, caches.warnlist.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.entries, caches.warnlist.Len()))
+			}
+			if !cmp.Equal(tc.loaded, caches.loaded) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.loaded, caches.loaded))
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package warnlist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// taxiiMediaType is the media type of TAXII 2.1 requests and responses.
+const taxiiMediaType = "application/taxii+json;version=2.1"
+
+// taxiiObjectTypes are the types of the STIX objects requested from collections, which domains are extracted from.
+const taxiiObjectTypes = "indicator,domain-name,url"
+
+// taxiiMaxPageSize is the size above which a page of a collection is refused, so a misbehaving server can't exhaust
+// the memory of the plugin.
+const taxiiMaxPageSize = 32 * 1024 * 1024
+
+// stixPatternValue matches the comparisons of a STIX pattern with the value of a domain or URL, e.g.
+// [domain-name:value = 'evil.example'], capturing the object type and the quoted value.
+var stixPatternValue = regexp.MustCompile(`\b(domain-name|url):value\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// stixUnescaper unescapes the quoted values of STIX patterns.
+var stixUnescaper = strings.NewReplacer(`\'`, `'`, `\\`, `\`)
+
+// taxiiEnvelope is a page of the objects of a TAXII collection.
+type taxiiEnvelope struct {
+	More    bool         `json:"more"`
+	Next    string       `json:"next"`
+	Objects []stixObject `json:"objects"`
+}
+
+// stixObject holds the fields of the STIX indicators and observables domains are extracted from.
+type stixObject struct {
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Pattern     string `json:"pattern"`
+	PatternType string `json:"pattern_type"`
+	Revoked     bool   `json:"revoked"`
+}
+
+// taxiiObjectsURL returns the URL of the objects endpoint of the collection at the given URL.
+func taxiiObjectsURL(collection string) (*url.URL, error) {
+	u, err := url.Parse(collection)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported taxii collection scheme %q (must be http or https)", u.Scheme)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	if !strings.HasSuffix(u.Path, "/objects/") {
+		u.Path += "objects/"
+	}
+	return u, nil
+}
+
+// openTAXII streams the domains of the STIX objects of a TAXII 2.1 collection, one per line, as its pages are fetched.
+// The first page is fetched right away, so an unreachable server or refused credentials fail the open.
+func openTAXII(collection string, options PluginOptions) (io.ReadCloser, error) {
+	objects, err := taxiiObjectsURL(collection)
+	if err != nil {
+		return nil, err
+	}
+	page, last, err := fetchTAXIIPage(objects, url.Values{}, options)
+	if err != nil {
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		var err error
+		defer func() {
+			w.CloseWithError(err)
+		}()
+
+		var addedAfter string
+		for {
+			for _, domain := range page.domains() {
+				if _, err = io.WriteString(w, domain+"\n"); err != nil {
+					// The reader was closed, so nobody is interested in the rest of the collection
+					return
+				}
+			}
+			if !page.More {
+				return
+			}
+
+			params := url.Values{}
+			switch {
+			case page.Next != "":
+				params.Set("next", page.Next)
+			case last != "" && last != addedAfter:
+				// Servers which don't hand out next parameters are paged through by the date the last object was added
+				addedAfter = last
+				params.Set("added_after", addedAfter)
+			default:
+				err = fmt.Errorf("taxii collection %s has more objects, but no way to request them", collection)
+				return
+			}
+			page, last, err = fetchTAXIIPage(objects, params, options)
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return r, nil
+}
+
+// fetchTAXIIPage requests a page of the objects of a collection, returning it along with the date the last object of
+// the page was added. The headers of url sources aren't sent, since their credentials belong to other servers.
+func fetchTAXIIPage(objects *url.URL, params url.Values, options PluginOptions) (taxiiEnvelope, string, error) {
+	u := *objects
+	params.Set("match[type]", taxiiObjectTypes)
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return taxiiEnvelope{}, "", err
+	}
+	req.Header.Set("Accept", taxiiMediaType)
+	req.Header.Set("User-Agent", userAgent(options))
+	if options.TAXIIUser != "" {
+		req.SetBasicAuth(options.TAXIIUser, options.TAXIIPassword)
+	}
+
+	resp, err := httpClient(options).Do(req)
+	if err != nil {
+		return taxiiEnvelope{}, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return taxiiEnvelope{}, "", fmt.Errorf("unexpected status loading taxii collection %s: %s", objects, resp.Status)
+	}
+
+	var page taxiiEnvelope
+	if err := json.NewDecoder(io.LimitReader(resp.Body, taxiiMaxPageSize)).Decode(&page); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return taxiiEnvelope{}, "", fmt.Errorf("taxii page of %s exceeds %d bytes or is truncated", objects, taxiiMaxPageSize)
+		}
+		return taxiiEnvelope{}, "", fmt.Errorf("unable to parse taxii page of %s: %w", objects, err)
+	}
+	return page, resp.Header.Get("X-TAXII-Date-Added-Last"), nil
+}
+
+// domains returns the domains of the objects of the page: the values of domain-name observables, the hosts of url
+// observables, and the domains and URL hosts compared with by the patterns of indicators which aren't revoked.
+func (e taxiiEnvelope) domains() []string {
+	var domains []string
+	for _, o := range e.Objects {
+		switch o.Type {
+		case "domain-name":
+			domains = append(domains, o.Value)
+		case "url":
+			if host := urlHost(o.Value); host != "" {
+				domains = append(domains, host)
+			}
+		case "indicator":
+			if o.Revoked || (o.PatternType != "" && o.PatternType != "stix") {
+				continue
+			}
+			for _, m := range stixPatternValue.FindAllStringSubmatch(o.Pattern, -1) {
+				value := stixUnescaper.Replace(m[2])
+				if m[1] == "url" {
+					value = urlHost(value)
+				}
+				if value != "" {
+					domains = append(domains, value)
+				}
+			}
+		}
+	}
+	return domains
+}
+
+// urlHost returns the host of a URL, which may lack a scheme, or "" if it has none.
+func urlHost(value string) string {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
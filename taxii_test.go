@@ -0,0 +1,132 @@
+package warnlist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testTAXIIPages are the pages of a mocked TAXII collection, keyed by the parameter requesting them. The first page
+// hands out a next parameter, and the second one is paged through by the date its last object was added.
+var testTAXIIPages = map[string]string{
+	"": `{"more": true, "next": "page-2", "objects": [
+		{"type": "indicator", "pattern_type": "stix", "pattern": "[domain-name:value = 'c2.evil.example']"},
+		{"type": "indicator", "pattern_type": "stix", "pattern": "[url:value = 'http://phish.example/login'] OR [domain-name:value = 'drop.example']"},
+		{"type": "indicator", "pattern_type": "stix", "pattern": "[domain-name:value = 'revoked.example']", "revoked": true},
+		{"type": "indicator", "pattern_type": "snort", "pattern": "alert tcp any any -> any any (content:\"snort.example\";)"},
+		{"type": "indicator", "pattern_type": "stix", "pattern": "[ipv4-addr:value = '192.0.2.1']"}
+	]}`,
+	"next=page-2": `{"more": true, "objects": [
+		{"type": "domain-name", "value": "observed.example"},
+		{"type": "url", "value": "https://malware.example:8443/payload.exe"}
+	]}`,
+	"added_after=2021-06-03T00%3A00%3A00.000Z": `{"more": false, "objects": [
+		{"type": "domain-name", "value": "last.example"}
+	]}`,
+}
+
+func Test_buildCacheFromTAXII(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "analyst" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-Api-Key") != "" {
+			// The headers of url sources are meant for their feeds
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path != "/api1/collections/indicators/objects/" || r.Header.Get("Accept") != taxiiMediaType {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		query := r.URL.Query()
+		if query.Get("match[type]") != taxiiObjectTypes {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		query.Del("match[type]")
+		page, ok := testTAXIIPages[query.Encode()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", taxiiMediaType)
+		w.Header().Set("X-TAXII-Date-Added-Last", "2021-06-03T00:00:00.000Z")
+		_, _ = w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	var testCases = []struct {
+		name      string
+		password  string
+		matched   []string
+		unmatched []string
+		expectErr bool
+	}{
+		{
+			name:     "case 0: the domains of every page of the collection are loaded",
+			password: "secret",
+			matched: []string{
+				"c2.evil.example.",
+				"phish.example.",
+				"drop.example.",
+				"observed.example.",
+				"malware.example.",
+				"last.example.",
+			},
+			unmatched: []string{
+				"revoked.example.",
+				"snort.example.",
+				"evil.example.",
+			},
+		},
+		{
+			name:      "case 1: a collection refusing the credentials fails the build",
+			password:  "wrong",
+			expectErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: server.URL + "/api1/collections/indicators", Type: DomainSourceTypeTAXII, Format: DomainFileFormatTextList}},
+				MatchSubdomains: true,
+				TAXIIUser:       "analyst",
+				TAXIIPassword:   tc.password,
+				Headers:         map[string]string{"Authorization": "Bearer feed-token", "X-Api-Key": "feed-key", "Accept": "text/plain"},
+			}
+			list, err := buildCacheFromFile(options, nil)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, name := range tc.matched {
+				if !list.Contains(name) {
+					t.Fatalf("expected %s to be matched", name)
+				}
+			}
+			for _, name := range tc.unmatched {
+				if list.Contains(name) {
+					t.Fatalf("expected %s not to be matched", name)
+				}
+			}
+			if !cmp.Equal(len(tc.matched), list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(len(tc.matched), list.Len()))
+			}
+		})
+	}
+}
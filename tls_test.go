@@ -0,0 +1,208 @@
+package warnlist
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testCert is a generated certificate and key, along with their PEM encoded files.
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert generates a certificate signed by the parent, or a self-signed CA if parent is nil.
+func newTestCert(t *testing.T, dir string, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &testCert{cert: cert, key: key, certFile: filepath.Join(dir, name+".crt"), keyFile: filepath.Join(dir, name+".key")}
+	if err := ioutil.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func Test_fetchURLMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, dir, "ca", nil)
+	serverCert := newTestCert(t, dir, "server", ca)
+	clientCert := newTestCert(t, dir, "client", ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testTextList))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.cert.Raw}, PrivateKey: serverCert.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	var testCases = []struct {
+		name      string
+		cert      string
+		key       string
+		ca        string
+		expectErr bool
+	}{
+		{
+			name: "case 0: a client certificate signed by the server's CA is accepted",
+			cert: clientCert.certFile,
+			key:  clientCert.keyFile,
+			ca:   ca.certFile,
+		},
+		{
+			name:      "case 1: a request without a client certificate is rejected",
+			ca:        ca.certFile,
+			expectErr: true,
+		},
+		{
+			name:      "case 2: a server without a trusted CA is rejected",
+			cert:      clientCert.certFile,
+			key:       clientCert.keyFile,
+			expectErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			transport, err := newTLSTransport(tc.cert, tc.key, tc.ca)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: server.URL, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList}},
+				MatchSubdomains: true,
+				Transport:       transport,
+			}
+			list, err := buildCacheFromFile(options, nil)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(2, list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(2, list.Len()))
+			}
+		})
+	}
+}
+
+func Test_newTLSTransportErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, dir, "ca", nil)
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name string
+		cert string
+		key  string
+		ca   string
+	}{
+		{
+			name: "case 0: a missing certificate file returns an error",
+			cert: filepath.Join(dir, "missing.crt"),
+			key:  ca.keyFile,
+		},
+		{
+			name: "case 1: a certificate without a key returns an error",
+			cert: ca.certFile,
+		},
+		{
+			name: "case 2: a missing CA file returns an error",
+			ca:   filepath.Join(dir, "missing.crt"),
+		},
+		{
+			name: "case 3: a CA file without certificates returns an error",
+			ca:   notPEM,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			if _, err := newTLSTransport(tc.cert, tc.key, tc.ca); err == nil {
+				t.Fatalf("expected an error, got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package warnlist
+
+import (
+	"sort"
+	"strings"
+)
+
+// TrieWarnlist matches domains and their subdomains with a tree of labels, starting at the TLD. A single walk along
+// the labels of a lookup finds any listed parent, without allocating.
+type TrieWarnlist struct {
+	root *trieNode
+	len  int
+}
+
+// trieNode holds the children of a label. Children are kept in a map while the list is being built, and in a sorted
+// slice of interned labels once it is closed, which takes less memory.
+type trieNode struct {
+	building map[string]*trieNode
+	edges    []trieEdge
+	terminal bool
+}
+
+// trieEdge links a node to the child for a label.
+type trieEdge struct {
+	label string
+	node  *trieNode
+}
+
+func NewTrieWarnlist() Warnlist {
+	t := &TrieWarnlist{}
+	t.Open()
+	return t
+}
+
+func (t *TrieWarnlist) Add(key string) {
+	// Every entry matches its subdomains, so wildcard entries are the same as their base domain
+	key = strings.TrimPrefix(key, wildcardPrefix)
+
+	node := t.root
+	name := strings.TrimSuffix(key, ".")
+	for name != "" {
+		var label string
+		label, name, _ = lastLabel(name)
+
+		child := node.child(label)
+		if child == nil {
+			child = &trieNode{}
+			node.addChild(label, child)
+		}
+		node = child
+	}
+
+	if !node.terminal {
+		node.terminal = true
+		t.len++
+	}
+}
+
+func (t *TrieWarnlist) Remove(key string) {
+	key = strings.TrimPrefix(key, wildcardPrefix)
+
+	node := t.root
+	name := strings.TrimSuffix(key, ".")
+	for name != "" {
+		var label string
+		label, name, _ = lastLabel(name)
+
+		node = node.child(label)
+		if node == nil {
+			return
+		}
+	}
+
+	// The nodes of the entry are kept, since they may lead to other entries, and cost nothing to lookups
+	if node.terminal {
+		node.terminal = false
+		t.len--
+	}
+}
+
+func (t *TrieWarnlist) Contains(key string) bool {
+	_, ok := t.Match(key)
+	return ok
+}
+
+func (t *TrieWarnlist) Match(key string) (string, bool) {
+	node := t.root
+	if node.terminal {
+		return ".", true
+	}
+
+	name := strings.TrimSuffix(key, ".")
+	for name != "" {
+		var label string
+		var start int
+		label, name, start = lastLabel(name)
+
+		node = node.child(label)
+		if node == nil {
+			return "", false
+		}
+		if node.terminal {
+			// The entry is the rest of the key from this label on
+			return key[start:], true
+		}
+	}
+	return "", false
+}
+
+func (t *TrieWarnlist) MatchAll(key string) []string {
+	node := t.root
+	var entries []string
+	if node.terminal {
+		entries = append(entries, ".")
+	}
+
+	// Every terminal node on the path is an entry, from the broadest to the longest
+	name := strings.TrimSuffix(key, ".")
+	for name != "" {
+		var label string
+		var start int
+		label, name, start = lastLabel(name)
+
+		node = node.child(label)
+		if node == nil {
+			break
+		}
+		if node.terminal {
+			entries = append(entries, key[start:])
+		}
+	}
+	return entries
+}
+
+func (t *TrieWarnlist) Close() error {
+	t.root.compact()
+
+	// Copy every distinct label into a single string, so labels repeated across domains (like com) are only stored
+	// once, and the added keys they were sliced from can be freed.
+	offsets := make(map[string]int)
+	var b strings.Builder
+	t.root.walk(func(n *trieNode) {
+		for _, e := range n.edges {
+			if _, ok := offsets[e.label]; !ok {
+				offsets[e.label] = b.Len()
+				b.WriteString(e.label)
+			}
+		}
+	})
+	arena := b.String()
+	t.root.walk(func(n *trieNode) {
+		for i, e := range n.edges {
+			offset := offsets[e.label]
+			n.edges[i].label = arena[offset : offset+len(e.label)]
+		}
+	})
+	return nil
+}
+
+func (t *TrieWarnlist) Len() int {
+	return t.len
+}
+
+func (t *TrieWarnlist) Open() {
+	t.root = &trieNode{}
+	t.len = 0
+}
+
+// lastLabel splits the last label off a name without a trailing dot, and returns the offset the label starts at.
+// Names are walked from the start of the key, so the offset also locates the label in the key.
+func lastLabel(name string) (string, string, int) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return name, "", 0
+	}
+	return name[i+1:], name[:i], i + 1
+}
+
+func (n *trieNode) child(label string) *trieNode {
+	if n.building != nil {
+		return n.building[label]
+	}
+	i := sort.Search(len(n.edges), func(i int) bool { return n.edges[i].label >= label })
+	if i < len(n.edges) && n.edges[i].label == label {
+		return n.edges[i].node
+	}
+	return nil
+}
+
+func (n *trieNode) addChild(label string, child *trieNode) {
+	if n.building == nil {
+		n.building = make(map[string]*trieNode, len(n.edges)+1)
+		// Added to after closing, so go back to building
+		for _, e := range n.edges {
+			n.building[e.label] = e.node
+		}
+		n.edges = nil
+	}
+	n.building[label] = child
+}
+
+// walk calls f for the node and all of its descendants.
+func (n *trieNode) walk(f func(*trieNode)) {
+	f(n)
+	for _, e := range n.edges {
+		e.node.walk(f)
+	}
+}
+
+// compact replaces the maps of the node and its children with sorted slices.
+func (n *trieNode) compact() {
+	if n.building != nil {
+		n.edges = make([]trieEdge, 0, len(n.building))
+		for label, child := range n.building {
+			n.edges = append(n.edges, trieEdge{label: label, node: child})
+		}
+		sort.Slice(n.edges, func(i, j int) bool { return n.edges[i].label < n.edges[j].label })
+		n.building = nil
+	}
+
+	for _, e := range n.edges {
+		e.node.compact()
+	}
+}
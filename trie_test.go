@@ -0,0 +1,128 @@
+package warnlist
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_trieMatch(t *testing.T) {
+	list := NewTrieWarnlist()
+	for _, d := range []string{"example.org.", "something.evil.", "*.wildcard.example.", "ample.org.", "org.test.", "test."} {
+		list.Add(d)
+	}
+	list.Close()
+
+	var testCases = []struct {
+		name   string
+		domain string
+		entry  string
+		hit    bool
+	}{
+		{
+			name:   "case 0: an exact domain matches",
+			domain: "example.org.",
+			entry:  "example.org.",
+			hit:    true,
+		},
+		{
+			name:   "case 1: a subdomain matches its listed parent",
+			domain: "deep.www.example.org.",
+			entry:  "example.org.",
+			hit:    true,
+		},
+		{
+			name:   "case 2: a domain sharing a suffix which isn't a label doesn't match",
+			domain: "notexample.org.",
+		},
+		{
+			name:   "case 3: a parent of a listed domain doesn't match",
+			domain: "org.",
+		},
+		{
+			name:   "case 4: a wildcard entry matches its base domain and subdomains",
+			domain: "www.wildcard.example.",
+			entry:  "wildcard.example.",
+			hit:    true,
+		},
+		{
+			name:   "case 5: a listed domain matches with a longer listed domain sharing its suffix",
+			domain: "www.ample.org.",
+			entry:  "ample.org.",
+			hit:    true,
+		},
+		{
+			name:   "case 6: a listed parent matches with a longer listed domain sharing its suffix",
+			domain: "www.xorg.test.",
+			entry:  "test.",
+			hit:    true,
+		},
+		{
+			name:   "case 7: a domain without a trailing dot matches",
+			domain: "www.something.evil",
+			entry:  "something.evil",
+			hit:    true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			entry, hit := list.Match(tc.domain)
+			if !cmp.Equal(tc.hit, hit) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.hit, hit))
+			}
+			if !cmp.Equal(tc.entry, entry) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.entry, entry))
+			}
+			if !cmp.Equal(tc.hit, list.Contains(tc.domain)) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.hit, list.Contains(tc.domain)))
+			}
+		})
+	}
+
+	if !cmp.Equal(6, list.Len()) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(6, list.Len()))
+	}
+}
+
+// benchmarkDeepSubdomains looks up deep subdomains in a large list, and reports the 99th percentile latency.
+func benchmarkDeepSubdomains(b *testing.B, list Warnlist) {
+	for i := 0; i < 200000; i++ {
+		list.Add(fmt.Sprintf("listed-%d.example.", i))
+	}
+	if err := list.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	queries := make([]string, 1000)
+	for i := range queries {
+		queries[i] = fmt.Sprintf("a.b.c.d.e.f.www.unlisted-%d.example.", i)
+	}
+	queries[0] = "a.b.c.d.e.f.www.listed-42.example."
+
+	durations := make([]time.Duration, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		list.Contains(queries[i%len(queries)])
+		durations[i] = time.Since(start)
+	}
+	b.StopTimer()
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	b.ReportMetric(float64(durations[len(durations)*99/100].Nanoseconds()), "p99-ns")
+}
+
+func BenchmarkDeepSubdomainsRadix(b *testing.B) {
+	benchmarkDeepSubdomains(b, NewRadixWarnlist())
+}
+
+func BenchmarkDeepSubdomainsTrie(b *testing.B) {
+	benchmarkDeepSubdomains(b, NewTrieWarnlist())
+}
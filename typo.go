@@ -0,0 +1,176 @@
+package warnlist
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTypoDistance is the edit distance within which a name resembles a protected domain if none is configured.
+const DefaultTypoDistance = 1
+
+// TypoMatcher finds names which resemble, but aren't, a protected domain, like typosquats of a brand.
+type TypoMatcher struct {
+	distance int
+
+	// protected holds the protected domains by their number of labels, so a name is only compared with domains
+	// having as many labels as its suffix. labels holds its keys in ascending order, so matches don't depend on the
+	// order of the map.
+	protected map[int][]string
+	labels    []int
+	len       int
+}
+
+func NewTypoMatcher(distance int) *TypoMatcher {
+	return &TypoMatcher{distance: distance, protected: make(map[int][]string)}
+}
+
+func (t *TypoMatcher) Add(domain string) {
+	domain = strings.TrimPrefix(domain, wildcardPrefix)
+	if domain == "." {
+		return
+	}
+	labels := strings.Count(domain, ".")
+	for _, p := range t.protected[labels] {
+		if p == domain {
+			return
+		}
+	}
+	if _, ok := t.protected[labels]; !ok {
+		t.labels = append(t.labels, labels)
+		sort.Ints(t.labels)
+	}
+	t.protected[labels] = append(t.protected[labels], domain)
+	t.len++
+}
+
+func (t *TypoMatcher) Len() int {
+	return t.len
+}
+
+// Match returns the protected domain which the name resembles most closely. Of several domains equally close to it,
+// the one with the fewest labels, then the one added first, is returned. The protected domains themselves and their
+// subdomains never match.
+func (t *TypoMatcher) Match(name string) (string, bool) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+
+	match := ""
+	closest := t.distance + 1
+	for _, labels := range t.labels {
+		suffix, ok := lastLabels(name, labels)
+		if !ok {
+			continue
+		}
+		for _, p := range t.protected[labels] {
+			if p == suffix {
+				// The name is under a protected domain
+				return "", false
+			}
+			// A length difference is a lower bound of the edit distance, which is much cheaper to check
+			if diff := len(p) - len(suffix); diff >= closest || -diff >= closest {
+				continue
+			}
+			if d, ok := editDistance(suffix, p, closest-1); ok {
+				match, closest = p, d
+			}
+		}
+	}
+	return match, match != ""
+}
+
+// lastLabels returns the suffix of the fully qualified name made of its last n labels.
+func lastLabels(name string, n int) (string, bool) {
+	end := len(name) - 1
+	for i := end - 1; i >= 0; i-- {
+		if name[i] == '.' {
+			n--
+			if n == 0 {
+				return name[i+1:], true
+			}
+		}
+	}
+	if n == 1 {
+		return name, true
+	}
+	return "", false
+}
+
+// editDistance returns the Levenshtein distance between a and b, and true if it is at most max. The computation stops
+// as soon as every alignment exceeds max.
+func editDistance(a string, b string, max int) (int, bool) {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return 0, false
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)], prev[len(b)] <= max
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// buildProtectedFromFile builds the matcher for the protected domains. It returns nil if none are configured.
+func buildProtectedFromFile(options PluginOptions, validators sourceValidators) (*TypoMatcher, error) {
+	if len(options.Protected) == 0 {
+		return nil, nil
+	}
+
+	// Print a log message with the time it took to build the matcher
+	defer logTime("Building protected domains took %s", time.Now())
+
+	distance := options.TypoDistance
+	if distance == 0 {
+		distance = DefaultTypoDistance
+	}
+	matcher := NewTypoMatcher(distance)
+
+	sources, err := expandSources(options.Protected, options)
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		domains, errs := domainsFromSource(source, options, validators, nil)
+		for entry := range domains {
+			if entry.pattern != nil {
+				// Lookalikes are found by their distance to protected domains, which patterns have none of
+				continue
+			}
+			matcher.Add(entry.domain)
+		}
+		if err := <-errs; err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof("loaded %d protected domains", matcher.Len())
+	options.counts.recordLoaded("protected", matcher.Len())
+	return matcher, nil
+}
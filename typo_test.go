@@ -0,0 +1,234 @@
+package warnlist
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_typoMatcher(t *testing.T) {
+	matcher := NewTypoMatcher(1)
+	for _, d := range []string{"paypal.com.", "example.co.uk.", "*.bank.example."} {
+		matcher.Add(d)
+	}
+
+	var testCases = []struct {
+		name      string
+		domain    string
+		protected string
+		hit       bool
+	}{
+		{
+			name:   "case 0: a protected domain doesn't match",
+			domain: "paypal.com.",
+		},
+		{
+			name:   "case 1: a subdomain of a protected domain doesn't match",
+			domain: "www.paypal.com.",
+		},
+		{
+			name:      "case 2: a substituted character matches",
+			domain:    "paypa1.com.",
+			protected: "paypal.com.",
+			hit:       true,
+		},
+		{
+			name:      "case 3: a subdomain of a lookalike matches",
+			domain:    "login.paypall.com.",
+			protected: "paypal.com.",
+			hit:       true,
+		},
+		{
+			name:      "case 4: a changed TLD matches",
+			domain:    "paypal.co.",
+			protected: "paypal.com.",
+			hit:       true,
+		},
+		{
+			name:   "case 5: a name beyond the distance doesn't match",
+			domain: "paypa11.com.",
+		},
+		{
+			name:      "case 6: a name is compared on as many labels as the protected domain",
+			domain:    "secure.exampl.co.uk.",
+			protected: "example.co.uk.",
+			hit:       true,
+		},
+		{
+			name:      "case 7: a wildcard entry is protected like its base domain",
+			domain:    "bamk.example.",
+			protected: "bank.example.",
+			hit:       true,
+		},
+		{
+			name:   "case 8: an unrelated name doesn't match",
+			domain: "coredns.io.",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			protected, hit := matcher.Match(tc.domain)
+			if !cmp.Equal(tc.hit, hit) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.hit, hit))
+			}
+			if hit && !cmp.Equal(tc.protected, protected) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.protected, protected))
+			}
+		})
+	}
+}
+
+func Test_typoMatcherClosest(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		protected []string
+		domain    string
+		expected  string
+	}{
+		{
+			name:      "case 0: the closest protected domain matches, rather than the first one added",
+			protected: []string{"bank.example.", "banks.example."},
+			domain:    "banks1.example.",
+			expected:  "banks.example.",
+		},
+		{
+			name:      "case 1: of equally close domains, the one with the fewest labels matches",
+			protected: []string{"example.co.uk.", "co.ux."},
+			domain:    "exampl.co.uk.",
+			expected:  "co.ux.",
+		},
+		{
+			name:      "case 2: of equally close domains with as many labels, the one added first matches",
+			protected: []string{"paypal.com.", "paypal.co."},
+			domain:    "paypal.cm.",
+			expected:  "paypal.com.",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			matcher := NewTypoMatcher(2)
+			for _, d := range tc.protected {
+				matcher.Add(d)
+			}
+			// Matching repeatedly catches a dependence on the random order of map iteration
+			for j := 0; j < 20; j++ {
+				protected, _ := matcher.Match(tc.domain)
+				if !cmp.Equal(tc.expected, protected) {
+					t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, protected))
+				}
+			}
+		})
+	}
+}
+
+func Test_editDistance(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		a        string
+		b        string
+		max      int
+		distance int
+		expected bool
+	}{
+		{name: "case 0: equal strings are within 0", a: "paypal", b: "paypal", max: 0, distance: 0, expected: true},
+		{name: "case 1: a substitution is within 1", a: "paypal", b: "paypa1", max: 1, distance: 1, expected: true},
+		{name: "case 2: an insertion is within 1", a: "paypal", b: "paypall", max: 1, distance: 1, expected: true},
+		{name: "case 3: a deletion is within 1", a: "paypal", b: "paypl", max: 1, distance: 1, expected: true},
+		{name: "case 4: a transposition is 2 edits", a: "paypal", b: "papyal", max: 1, expected: false},
+		{name: "case 5: a transposition is within 2", a: "paypal", b: "papyal", max: 2, distance: 2, expected: true},
+		{name: "case 6: an empty string is its length away", a: "", b: "abc", max: 2, expected: false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			distance, ok := editDistance(tc.a, tc.b, tc.max)
+			if !cmp.Equal(tc.expected, ok) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, ok))
+			}
+			// The distance is only computed in full when it is within max
+			if ok && !cmp.Equal(tc.distance, distance) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.distance, distance))
+			}
+		})
+	}
+}
+
+func TestTyposquatMatching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "brands.txt")
+	if err := ioutil.WriteFile(path, []byte("paypal.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	options := PluginOptions{
+		MatchSubdomains: true,
+		Protected:       []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+	}
+	protected, err := buildProtectedFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wl := NewTrieWarnlist()
+	wl.Add("evil.example.")
+	wl.Close()
+	m := WarnlistPlugin{Next: test.ErrorHandler(), warnlist: wl, protected: protected, Options: options}
+
+	var testCases = []struct {
+		name    string
+		domain  string
+		matches float64
+	}{
+		{
+			name:    "case 0: a lookalike of a protected domain is counted",
+			domain:  "www.paypa1.com.",
+			matches: 1,
+		},
+		{
+			name:   "case 1: the protected domain isn't counted",
+			domain: "www.paypal.com.",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			r := new(dns.Msg)
+			r.SetQuestion(tc.domain, dns.TypeA)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			counter := typosquatMatches.WithLabelValues("", "paypal.com.")
+			before := testutil.ToFloat64(counter)
+			if _, err := m.ServeDNS(context.TODO(), rec, r); err != nil {
+				t.Fatalf("Error serving DNS: %v", err)
+			}
+
+			matches := testutil.ToFloat64(counter) - before
+			if !cmp.Equal(tc.matches, matches) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.matches, matches))
+			}
+		})
+	}
+}
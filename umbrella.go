@@ -0,0 +1,54 @@
+package warnlist
+
+import (
+	"strconv"
+	"strings"
+)
+
+// newUmbrellaParser returns a parser for rank,domain lists, like the Cisco Umbrella and Tranco top 1 million lists,
+// which takes the domain and ignores its rank. A first row whose rank isn't a number is skipped as a header.
+// malformed is called for every other row which isn't a rank followed by a domain.
+func newUmbrellaParser(malformed func()) lineParser {
+	first := true
+
+	return func(line string) (string, bool) {
+		header := first
+		first = false
+
+		rank, domain, ok := splitRankedDomain(line)
+		if ok && !isRank(rank) {
+			if header {
+				// The optional header, like "rank,domain", is the only row whose rank may not be a number
+				return "", false
+			}
+			ok = false
+		}
+		if !ok {
+			malformed()
+			log.Warningf("skipping malformed umbrella row %q, expected rank,domain", line)
+			return "", false
+		}
+		return domain, domain != ""
+	}
+}
+
+// splitRankedDomain splits a rank,domain row into its rank and domain, returning false if it doesn't have exactly two
+// non-empty columns.
+func splitRankedDomain(line string) (string, string, bool) {
+	i := strings.IndexByte(line, ',')
+	if i < 0 {
+		return "", "", false
+	}
+	rank := strings.TrimSpace(line[:i])
+	domain := strings.TrimSpace(line[i+1:])
+	if rank == "" || domain == "" || strings.IndexByte(domain, ',') >= 0 {
+		return "", "", false
+	}
+	return rank, domain, true
+}
+
+// isRank returns true if the first column of a row is a rank, rather than the name of the column.
+func isRank(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
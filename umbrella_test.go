@@ -0,0 +1,135 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testUmbrellaList is a sample of the Cisco Umbrella top 1 million list (top-1m.csv).
+const testUmbrellaList = `1,google.com
+2,www.google.com
+3,microsoft.com
+4,netflix.com
+5,api-global.netflix.com
+`
+
+func Test_umbrellaParser(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		data      string
+		expected  []string
+		malformed int
+	}{
+		{
+			name:     "case 0: the domains are taken without their ranks",
+			data:     testUmbrellaList,
+			expected: []string{"google.com", "www.google.com", "microsoft.com", "netflix.com", "api-global.netflix.com"},
+		},
+		{
+			name:     "case 1: a header row is skipped",
+			data:     "rank,domain\n1,google.com\n2,microsoft.com\n",
+			expected: []string{"google.com", "microsoft.com"},
+		},
+		{
+			name:      "case 2: rows which aren't a rank followed by a domain are malformed",
+			data:      "1,google.com\nmicrosoft.com\n3,\nthree,netflix.com\n4,netflix.com,extra\n5,amazon.com\n",
+			expected:  []string{"google.com", "amazon.com"},
+			malformed: 4,
+		},
+		{
+			name:      "case 3: only the first row can be a header",
+			data:      "1,google.com\nrank,domain\n",
+			expected:  []string{"google.com"},
+			malformed: 1,
+		},
+		{
+			name:     "case 4: spaces around the columns are trimmed",
+			data:     "1, google.com \n",
+			expected: []string{"google.com"},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			malformed := 0
+			parse := newUmbrellaParser(func() { malformed++ })
+			var domains []string
+			for _, line := range splitLines(tc.data) {
+				if domain, ok := parse(line); ok {
+					domains = append(domains, domain)
+				}
+			}
+
+			if !cmp.Equal(tc.expected, domains) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, domains))
+			}
+			if !cmp.Equal(tc.malformed, malformed) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.malformed, malformed))
+			}
+		})
+	}
+}
+
+func Test_buildCacheUmbrella(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var testCases = []struct {
+		name      string
+		contents  string
+		format    string
+		malformed int
+	}{
+		{
+			name:      "case 0: the domains of an umbrella list are loaded below its header",
+			contents:  "rank,domain\n" + testUmbrellaList + "6,\n",
+			format:    DomainFileFormatUmbrella,
+			malformed: 1,
+		},
+		{
+			name:     "case 1: an umbrella list is detected",
+			contents: testUmbrellaList,
+			format:   DomainFileFormatAuto,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			path := filepath.Join(dir, "top-1m-"+strconv.Itoa(i)+".csv")
+			if err := ioutil.WriteFile(path, []byte(tc.contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+			options := PluginOptions{Sources: []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: tc.format}}}
+			list, malformed, err := buildCache(options.Sources, options, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(5, list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(5, list.Len()))
+			}
+			if !cmp.Equal(tc.malformed, malformed) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.malformed, malformed))
+			}
+			for _, domain := range []string{"google.com.", "api-global.netflix.com."} {
+				if !list.Contains(domain) {
+					t.Fatalf("expected %s to be loaded", domain)
+				}
+			}
+			if list.Contains("1.") {
+				t.Fatalf("expected the ranks not to be loaded")
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package warnlist
+
+import (
+	"net/url"
+	"strings"
+)
+
+// newURLListParser returns a parser for lists of URLs, like phishing and malware feeds, which extracts the hostname of
+// each URL (e.g. bad.example from http://user@bad.example:8080/path?q=1). Entries without a scheme, like
+// bad.example:8080 or bad.example/path, are parsed the same way. Lines which aren't URLs are counted as malformed.
+func newURLListParser(malformed func()) lineParser {
+	return func(line string) (string, bool) {
+		host, ok := parseURLLine(line)
+		if !ok {
+			malformed()
+		}
+		return host, ok
+	}
+}
+
+// parseURLLine returns the hostname of the URL on a line, returning false if the line holds none.
+func parseURLLine(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", false
+	}
+	raw := fields[0]
+	if !strings.Contains(raw, "://") {
+		// Parse a bare host, with or without a port and path, as the authority of a URL
+		raw = "//" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	host := u.Hostname()
+	if host == "" || strings.Contains(host, ":") {
+		// IPv6 addresses can't be matched on names
+		return "", false
+	}
+	return host, true
+}
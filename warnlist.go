@@ -8,11 +8,24 @@ import (
 
 	"github.com/alecthomas/mph"
 	iradix "github.com/hashicorp/go-immutable-radix"
+	"github.com/miekg/dns"
 )
 
+// Warnlist is a list of domains which queries are matched against, whether it matches subdomains and wildcard
+// entries depending on the kind of list. Keys are canonical names (see canonicalDomain). To check a domain the same
+// way a query for it is checked, including the allowlist and excludes, use WarnlistPlugin.Contains instead.
 type Warnlist interface {
 	Add(key string)
+	// Contains returns true if an entry matches the key, like Match.
 	Contains(key string) bool
+	// Match returns the list entry which matches the key, if any, whatever the type of the query.
+	Match(key string) (string, bool)
+	// MatchAll returns every list entry which matches the key, e.g. both a domain and its listed parent.
+	MatchAll(key string) []string
+	// Remove removes the entry added for the key, if any, the same way Add added it, so a wildcard entry is removed by
+	// its wildcard key. Subdomains still match a listed parent. Lists which can't be changed once closed log a warning
+	// instead, and have to be rebuilt. Like Add, it must not be called while the list is being served.
+	Remove(key string)
 	Close() error
 	Len() int
 	Open()
@@ -35,6 +48,9 @@ type RadixWarnlist struct {
 }
 
 func (r *RadixWarnlist) Add(key string) {
+	// Every entry matches its subdomains, so wildcard entries are the same as their base domain
+	key = strings.TrimPrefix(key, wildcardPrefix)
+
 	// Add the domain in reverse so we can pretend it's a prefix.
 	key = reverseString(key)
 
@@ -42,6 +58,13 @@ func (r *RadixWarnlist) Add(key string) {
 	r.warnlist = b
 }
 
+func (r *RadixWarnlist) Remove(key string) {
+	key = reverseString(strings.TrimPrefix(key, wildcardPrefix))
+
+	b, _, _ := r.warnlist.Delete([]byte(key))
+	r.warnlist = b
+}
+
 func (r *RadixWarnlist) Contains(key string) bool {
 	keyR := reverseString(key)
 
@@ -52,6 +75,30 @@ func (r *RadixWarnlist) Contains(key string) bool {
 	return isFullPrefixMatch(keyR, string(m))
 }
 
+func (r *RadixWarnlist) Match(key string) (string, bool) {
+	keyR := reverseString(key)
+
+	m, _, ok := r.warnlist.Root().LongestPrefix([]byte(keyR))
+	if !ok || !isFullPrefixMatch(keyR, string(m)) {
+		return "", false
+	}
+	return reverseString(string(m)), true
+}
+
+func (r *RadixWarnlist) MatchAll(key string) []string {
+	keyR := reverseString(key)
+
+	// Every listed prefix on the path is an entry, from the broadest to the longest
+	var entries []string
+	r.warnlist.Root().WalkPath([]byte(keyR), func(k []byte, _ interface{}) bool {
+		if isFullPrefixMatch(keyR, string(k)) {
+			entries = append(entries, reverseString(string(k)))
+		}
+		return false
+	})
+	return entries
+}
+
 func (r *RadixWarnlist) Close() error {
 	// Nothing to do to close an iradix
 	return nil
@@ -76,11 +123,23 @@ func (m *GoMapWarnlist) Add(key string) {
 	m.warnlist[key] = struct{}{}
 }
 
+func (m *GoMapWarnlist) Remove(key string) {
+	delete(m.warnlist, key)
+}
+
 func (m *GoMapWarnlist) Contains(key string) bool {
 	_, ok := m.warnlist[key]
 	return ok
 }
 
+func (m *GoMapWarnlist) Match(key string) (string, bool) {
+	return key, m.Contains(key)
+}
+
+func (m *GoMapWarnlist) MatchAll(key string) []string {
+	return matchOne(m.Match(key))
+}
+
 func (m *GoMapWarnlist) Close() error {
 	// Nothing to do to close a map
 	return nil
@@ -105,11 +164,24 @@ func (m *MPHWarnlist) Add(key string) {
 	m.builder.Add([]byte(key), []byte(""))
 }
 
+func (m *MPHWarnlist) Remove(key string) {
+	// Neither the builder nor the table can drop a key
+	log.Warningf("unable to remove %s from an MPH warnlist, which has to be rebuilt without it", key)
+}
+
 func (m *MPHWarnlist) Contains(key string) bool {
 	hit := m.warnlist.Get([]byte(key))
 	return hit != nil
 }
 
+func (m *MPHWarnlist) Match(key string) (string, bool) {
+	return key, m.Contains(key)
+}
+
+func (m *MPHWarnlist) MatchAll(key string) []string {
+	return matchOne(m.Match(key))
+}
+
 func (m *MPHWarnlist) Close() error {
 	warnlist, err := m.builder.Build()
 	if err != nil {
@@ -135,29 +207,555 @@ func (m *MPHWarnlist) Open() {
 	m.builder = mph.Builder()
 }
 
-func buildCacheFromFile(options PluginOptions) (Warnlist, error) {
+// Wildcards
+
+// wildcardPrefix marks list entries which match a domain and all of its subdomains.
+const wildcardPrefix = "*."
+
+// WildcardWarnlist adds wildcard entries (*.example.com) to a Warnlist which only matches exact domains.
+// Wildcard entries are kept in a separate trie, so they match their subdomains too.
+type WildcardWarnlist struct {
+	Warnlist
+	wildcards Warnlist
+}
+
+func NewWildcardWarnlist(w Warnlist) Warnlist {
+	b := &WildcardWarnlist{Warnlist: w, wildcards: NewTrieWarnlist()}
+	b.Open()
+	return b
+}
+
+func (w *WildcardWarnlist) Add(key string) {
+	if strings.HasPrefix(key, wildcardPrefix) {
+		w.wildcards.Add(key)
+		return
+	}
+	w.Warnlist.Add(key)
+}
+
+func (w *WildcardWarnlist) Remove(key string) {
+	if strings.HasPrefix(key, wildcardPrefix) {
+		w.wildcards.Remove(key)
+		return
+	}
+	w.Warnlist.Remove(key)
+}
+
+func (w *WildcardWarnlist) Contains(key string) bool {
+	if w.Warnlist.Contains(key) {
+		return true
+	}
+	// Most lists have no wildcard entries, so skip the trie lookup for them
+	return w.wildcards.Len() > 0 && w.wildcards.Contains(key)
+}
+
+func (w *WildcardWarnlist) Match(key string) (string, bool) {
+	if entry, ok := w.Warnlist.Match(key); ok {
+		return entry, true
+	}
+	if w.wildcards.Len() == 0 {
+		return "", false
+	}
+	entry, ok := w.wildcards.Match(key)
+	if !ok {
+		return "", false
+	}
+	return wildcardPrefix + entry, true
+}
+
+func (w *WildcardWarnlist) MatchAll(key string) []string {
+	entries := w.Warnlist.MatchAll(key)
+	if w.wildcards.Len() == 0 {
+		return entries
+	}
+	for _, entry := range w.wildcards.MatchAll(key) {
+		entries = append(entries, wildcardPrefix+entry)
+	}
+	return entries
+}
+
+func (w *WildcardWarnlist) Close() error {
+	if err := w.wildcards.Close(); err != nil {
+		return err
+	}
+	return w.Warnlist.Close()
+}
+
+func (w *WildcardWarnlist) Len() int {
+	return w.Warnlist.Len() + w.wildcards.Len()
+}
+
+func (w *WildcardWarnlist) Open() {
+	w.Warnlist.Open()
+	w.wildcards.Open()
+}
+
+// Annotations
+
+// AnnotatedWarnlist records where each entry of a Warnlist was loaded from, so matches can be attributed to their
+// feed, and the query types entries are limited to. An entry listed by several sources is attributed to the first one
+// it was loaded from, and matches all query types if any of them lists it without a type.
+type AnnotatedWarnlist struct {
+	Warnlist
+	matchSubdomains bool
+	sources         map[string]string
+	// qtypes holds the query types of the entries limited to some types. Entries matching all types aren't kept,
+	// unless they were limited before being listed again without types, in which case they have none.
+	qtypes map[string][]uint16
+}
+
+func NewAnnotatedWarnlist(w Warnlist, matchSubdomains bool) *AnnotatedWarnlist {
+	a := &AnnotatedWarnlist{Warnlist: w, matchSubdomains: matchSubdomains}
+	a.Open()
+	return a
+}
+
+func (a *AnnotatedWarnlist) Add(key string) {
+	a.AddEntry(key, "", nil)
+}
+
+// AddEntry adds the key, recording the name of the source it was loaded from, and the query types it is limited to.
+// An entry without query types matches all of them.
+func (a *AnnotatedWarnlist) AddEntry(key string, source string, qtypes []uint16) {
+	// The wrapped Warnlist only grows for entries it didn't hold yet
+	before := a.Warnlist.Len()
+	a.Warnlist.Add(key)
+	added := a.Warnlist.Len() > before
+
+	if a.matchSubdomains {
+		// Entries matching subdomains are returned without their wildcard by Match
+		key = strings.TrimPrefix(key, wildcardPrefix)
+	}
+	if source != "" {
+		if _, ok := a.sources[key]; !ok {
+			a.sources[key] = source
+		}
+	}
+
+	limited, ok := a.qtypes[key]
+	switch {
+	case len(qtypes) == 0:
+		if ok {
+			// Listed again for all types
+			a.qtypes[key] = nil
+		}
+	case added:
+		a.qtypes[key] = qtypes
+	case len(limited) > 0:
+		a.qtypes[key] = append(limited, qtypes...)
+	}
+	// Otherwise the entry was already listed for all types
+}
+
+// Remove removes the key along with its source and query types.
+func (a *AnnotatedWarnlist) Remove(key string) {
+	a.Warnlist.Remove(key)
+
+	if a.matchSubdomains {
+		key = strings.TrimPrefix(key, wildcardPrefix)
+	}
+	delete(a.sources, key)
+	delete(a.qtypes, key)
+}
+
+// Source returns the name of the source a matched entry was loaded from, or an empty string if it has none.
+func (a *AnnotatedWarnlist) Source(entry string) string {
+	return a.sources[entry]
+}
+
+// MatchType returns the entry matching the key like Match, skipping entries limited to other query types.
+func (a *AnnotatedWarnlist) MatchType(key string, qtype uint16) (string, bool) {
+	entry, ok := a.Warnlist.Match(key)
+	if !ok || len(a.qtypes) == 0 || a.matchesType(entry, qtype) {
+		return entry, ok
+	}
+	// Another entry matching the key, like a listed parent, may still apply to the type
+	for _, entry := range a.Warnlist.MatchAll(key) {
+		if a.matchesType(entry, qtype) {
+			return entry, true
+		}
+	}
+	return "", false
+}
+
+// matchesType returns true if the entry applies to the query type. ANY queries match entries of every type.
+func (a *AnnotatedWarnlist) matchesType(entry string, qtype uint16) bool {
+	limited := a.qtypes[entry]
+	if len(limited) == 0 || qtype == dns.TypeANY {
+		return true
+	}
+	for _, t := range limited {
+		if t == qtype {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AnnotatedWarnlist) Open() {
+	a.Warnlist.Open()
+	a.sources = make(map[string]string)
+	a.qtypes = make(map[string][]uint16)
+}
+
+// sourceRecorder is implemented by Warnlists which record the sources their entries were loaded from.
+type sourceRecorder interface {
+	Source(entry string) string
+}
+
+// typeMatcher is implemented by Warnlists whose entries may be limited to some query types.
+type typeMatcher interface {
+	MatchType(key string, qtype uint16) (string, bool)
+}
+
+// sourceOf returns the name of the source a matched entry was loaded from, if the warnlist records them.
+func sourceOf(warnlist Warnlist, entry string) string {
+	if s, ok := warnlist.(sourceRecorder); ok {
+		return s.Source(entry)
+	}
+	return ""
+}
+
+// matchType returns the entry matching a query for the name and type, skipping entries limited to other types if the
+// warnlist records them.
+func matchType(warnlist Warnlist, name string, qtype uint16) (string, bool) {
+	if t, ok := warnlist.(typeMatcher); ok {
+		return t.MatchType(name, qtype)
+	}
+	return warnlist.Match(name)
+}
+
+// buildCacheFromFile builds the warnlist cache. If validators is not nil, the validators of the sources are recorded in it.
+func buildCacheFromFile(options PluginOptions, validators sourceValidators) (Warnlist, error) {
+	return buildWarnlistCache(options, validators, nil, nil)
+}
+
+// buildWarnlistCache builds the warnlist cache like buildCacheFromFile. If change is not nil, the changes from its
+// previous warnlist are counted in it. If cache is not nil, the sources it holds are replayed from it, and the entries
+// of the others are recorded in it.
+func buildWarnlistCache(options PluginOptions, validators sourceValidators, change *listChange, cache sourceCache) (Warnlist, error) {
 	// Print a log message with the time it took to build the cache
 	defer logTime("Building warnlist cache took %s", time.Now())
 
+	var snapshot *snapshotWriter
+	if options.CacheFile != "" {
+		var err error
+		if snapshot, err = newSnapshotWriter(options.CacheFile); err != nil {
+			// The snapshot only speeds up restarts, so the build goes on without it
+			log.Warningf("unable to write warnlist snapshot %s: %v", options.CacheFile, err)
+		}
+	}
+
+	warnlist, malformed, err := buildCache(options.Sources, options, validators, snapshot, change, cache)
+	if err == nil {
+		err = checkMinEntries(warnlist, options)
+	}
+	if err == nil {
+		log.Infof("loaded %d domains into warnlist, skipped %d malformed lines", warnlist.Len(), malformed)
+		options.counts.recordLoaded("warnlist", warnlist.Len())
+		options.counts.recordMalformed("warnlist", malformed)
+		if err := snapshot.commit(); err != nil {
+			log.Warningf("unable to write warnlist snapshot %s: %v", options.CacheFile, err)
+		}
+	} else {
+		snapshot.abort()
+	}
+
+	return warnlist, err
+}
+
+// checkMinEntries returns an error if the warnlist holds fewer entries than min_entries, like a feed which momentarily
+// serves an empty or truncated file would load, so the build fails rather than replacing a good warnlist.
+func checkMinEntries(warnlist Warnlist, options PluginOptions) error {
+	if options.MinEntries == 0 || warnlist.Len() >= options.MinEntries {
+		return nil
+	}
+	log.Warningf("only %d entries loaded into warnlist, below the minimum of %d, failing the build", warnlist.Len(), options.MinEntries)
+	minEntriesRejections.WithLabelValues("warnlist").Inc()
+	return fmt.Errorf("only %d entries loaded, fewer than min_entries %d", warnlist.Len(), options.MinEntries)
+}
+
+// buildAllowlistFromFile builds the allowlist cache. It returns a nil Warnlist if no allowlist is configured.
+func buildAllowlistFromFile(options PluginOptions, validators sourceValidators) (Warnlist, error) {
+	if len(options.Allowlist) == 0 {
+		return nil, nil
+	}
+
+	// Print a log message with the time it took to build the cache
+	defer logTime("Building allowlist cache took %s", time.Now())
+
+	// The allowlist carves out the names it lists, rather than the whole organizations they belong to, or their homographs
+	options.ETLDPlusOne = false
+	options.Confusables = false
+
+	allowlist, malformed, err := buildCache(options.Allowlist, options, validators, nil, nil, nil)
+	if err == nil {
+		log.Infof("loaded %d domains into allowlist, skipped %d malformed lines", allowlist.Len(), malformed)
+		options.counts.recordLoaded("allowlist", allowlist.Len())
+		options.counts.recordMalformed("allowlist", malformed)
+	}
+
+	return allowlist, err
+}
+
+// newWarnlist returns an empty Warnlist of the kind configured by the options.
+func newWarnlist(options PluginOptions) *AnnotatedWarnlist {
 	var warnlist Warnlist
 	{
 		if options.MatchSubdomains {
-			warnlist = NewRadixWarnlist()
+			warnlist = NewTrieWarnlist()
 		} else {
-			warnlist = NewWarnlist()
+			warnlist = NewPackedWarnlist()
+		}
+		if options.Bloom {
+			warnlist = NewBloomWarnlist(warnlist, options.MatchSubdomains)
 		}
+		if !options.MatchSubdomains {
+			// Wildcard entries still match subdomains
+			warnlist = NewWildcardWarnlist(warnlist)
+		}
+	}
+	return NewAnnotatedWarnlist(warnlist, options.MatchSubdomains)
+}
+
+// buildCache loads all domains from the given sources into a new Warnlist, and returns the number of lines skipped
+// because they couldn't be parsed. Domains listed by several sources are only added once. If snapshot is not nil,
+// every added domain is also written to it. If change is not nil, the changes from its previous Warnlist are counted.
+// If cache is not nil, the entries of the sources it holds are replayed from it instead of being fetched, and the
+// entries of the other sources are recorded in it. With build_workers, the sources are fetched concurrently, and the
+// errors of all the sources which failed are returned.
+func buildCache(sources []DomainSource, options PluginOptions, validators sourceValidators, snapshot *snapshotWriter, change *listChange, cache sourceCache) (Warnlist, int, error) {
+	list := newListBuilder(options)
+	list.change = change
+	malformed := 0
+	truncated := false
+
+	// add adds an entry read from the source, returning false if it was skipped because the warnlist is full
+	add := func(entry listEntry, source DomainSource) bool {
+		if truncated {
+			return false
+		}
+		if options.MaxEntries > 0 && list.Len() >= options.MaxEntries {
+			if options.StrictMaxEntries {
+				log.Warningf("%s exceeds the limit of %d entries, failing the build", redactURL(source.Path), options.MaxEntries)
+			} else {
+				log.Warningf("%s exceeds the limit of %d entries, skipping the remaining entries", redactURL(source.Path), options.MaxEntries)
+			}
+			truncated = true
+			return false
+		}
+		if list.add(entry, source.Name) {
+			snapshot.add(entry, source.Name)
+		}
+		return true
 	}
 
-	for domain := range domainsFromSource(options.DomainSource, options.DomainSourceType, options.FileFormat) {
-		warnlist.Add(domain)
+	// The configured sources are expanded first, so the files of directories can be fetched along with the others
+	expanded := make([][]DomainSource, len(sources))
+	var fetching []DomainSource
+	for i, configured := range sources {
+		if _, ok := cache[configured]; ok {
+			continue
+		}
+		var err error
+		if expanded[i], err = expandSources([]DomainSource{configured}, options); err != nil {
+			return nil, 0, err
+		}
+		fetching = append(fetching, expanded[i]...)
 	}
+	var fetched []*fetchedSource
+	if options.BuildWorkers > 1 && len(fetching) > 1 {
+		// The sources which aren't fetched yet are dropped when the build returns early, like on a strict max_entries
+		stop := make(chan struct{})
+		defer close(stop)
+		fetched = prefetchSources(fetching, options, validators != nil, options.BuildWorkers, stop)
+	}
+	var failed sourceErrors
+
+	for i, configured := range sources {
+		if cached, ok := cache[configured]; ok {
+			// The source isn't due for a reload, so its entries of the last build are added in its place
+			malformed += cached.malformed
+			for _, entry := range cached.entries {
+				add(entry, configured)
+			}
+			if truncated && options.StrictMaxEntries {
+				return nil, 0, fmt.Errorf("more than %d entries loaded from %s", options.MaxEntries, redactURL(configured.Path))
+			}
+			continue
+		}
 
-	err := warnlist.Close()
+		var cached *cachedSource
+		if cache != nil {
+			cached = &cachedSource{}
+			cache[configured] = cached
+		}
+		for _, source := range expanded[i] {
+			skipped := 0
+			addEntry := func(entry listEntry) {
+				// Once the warnlist is full, the rest of the source is drained, so its reader finishes
+				if add(entry, source) && cached != nil {
+					cached.entries = append(cached.entries, entry)
+				}
+			}
+			if fetched != nil {
+				// The partial lists are added in the order of their sources, like a sequential build would
+				f := fetched[0]
+				fetched = fetched[1:]
+				<-f.done
+				if f.err != nil {
+					failed = append(failed, f.err)
+					continue
+				}
+				for path, v := range f.validators {
+					validators[path] = v
+				}
+				for _, entry := range f.entries {
+					addEntry(entry)
+				}
+				skipped = f.malformed
+			} else {
+				domains, errs := domainsFromSource(source, options, validators, &skipped)
+				for entry := range domains {
+					addEntry(entry)
+				}
+				if err := <-errs; err != nil {
+					return nil, 0, err
+				}
+			}
+			malformed += skipped
+			if cached != nil {
+				cached.malformed += skipped
+				cached.paths = append(cached.paths, source.Path)
+			}
+			if truncated && options.StrictMaxEntries {
+				return nil, 0, fmt.Errorf("more than %d entries loaded from %s", options.MaxEntries, redactURL(source.Path))
+			}
+		}
+	}
+	if err := failed.err(); err != nil {
+		return nil, 0, err
+	}
+
+	warnlist, err := list.close()
 	if err == nil {
-		log.Infof("added %d domains to warnlist", warnlist.Len())
+		change.finish(warnlist)
 	}
 
-	return warnlist, err
+	return warnlist, malformed, err
+}
+
+// listBuilder adds the entries read from sources to a new Warnlist, which only evaluates regex patterns once any
+// have been added.
+type listBuilder struct {
+	annotated  *AnnotatedWarnlist
+	regexes    *RegexWarnlist
+	maxRegexes int
+	capped     bool
+
+	// list is the annotated Warnlist, reducing query names to their registered domains if registered is set
+	list       Warnlist
+	registered bool
+	suffixes   int
+
+	// matchName returns the form in which the added domains are matched
+	matchName func(domain string) string
+
+	// rejectsBroad returns true for the domains skipped because they would match a whole public suffix
+	rejectsBroad func(domain string) bool
+
+	// exceptions holds the domains carved out of the list by its sources, if any were added
+	exceptions Warnlist
+
+	// change counts the entries the previous warnlist didn't hold, if set
+	change *listChange
+}
+
+func newListBuilder(options PluginOptions) *listBuilder {
+	b := &listBuilder{annotated: newWarnlist(options), maxRegexes: options.MaxRegexes, registered: options.ETLDPlusOne, matchName: func(domain string) string { return options.warnlistName(options.matchName(domain)) }, rejectsBroad: options.rejectsBroad}
+	b.list = b.annotated
+	if b.registered {
+		b.list = NewRegisteredWarnlist(b.annotated)
+	}
+	return b
+}
+
+// add adds an entry loaded from the named source, returning false if it was skipped.
+func (b *listBuilder) add(entry listEntry, source string) bool {
+	if entry.exception {
+		if b.exceptions == nil {
+			b.exceptions = NewTrieWarnlist()
+		}
+		// Exceptions match their subdomains anyway, and aren't reduced to registered domains, like the allowlist
+		domain := strings.TrimPrefix(entry.domain, wildcardPrefix)
+		b.exceptions.Add(b.matchName(domain))
+		return true
+	}
+
+	if entry.pattern == nil {
+		entry.domain = b.matchName(entry.domain)
+		if b.rejectsBroad(entry.domain) {
+			log.Warningf("skipping entry %s, which would match every domain under a public suffix (set allow_broad_entries true to load it)", entry.domain)
+			return false
+		}
+		if b.registered {
+			// Listed names are reduced to their registered domains, except public suffixes, which would match
+			// every domain registered under them
+			domain, ok := registeredDomain(entry.domain)
+			if !ok {
+				b.suffixes++
+				return false
+			}
+			entry.domain = domain
+		}
+		before := b.annotated.Len()
+		b.annotated.AddEntry(entry.domain, source, entry.qtypes)
+		if b.annotated.Len() > before {
+			b.change.count(entry)
+		}
+		return true
+	}
+
+	if b.regexes == nil {
+		// Patterns are matched against the whole query name
+		b.regexes = NewRegexWarnlist(b.list, b.maxRegexes)
+	}
+	if !b.regexes.AddPattern(entry.pattern, source) {
+		if !b.capped {
+			log.Warningf("more than %d regex patterns listed, skipping the remaining patterns", b.regexes.max)
+			b.capped = true
+		}
+		return false
+	}
+	b.change.count(entry)
+	return true
+}
+
+// Len returns the number of domains added, which don't include patterns, since those are capped on their own.
+func (b *listBuilder) Len() int {
+	return b.annotated.Len()
+}
+
+// close closes the Warnlist, and returns it.
+func (b *listBuilder) close() (Warnlist, error) {
+	if err := b.annotated.Close(); err != nil {
+		return nil, err
+	}
+	if b.suffixes > 0 {
+		log.Warningf("skipped %d entries which are public suffixes, and have no registered domain to match", b.suffixes)
+	}
+	list := b.list
+	if b.regexes != nil {
+		list = b.regexes
+	}
+	if b.exceptions != nil {
+		if err := b.exceptions.Close(); err != nil {
+			return nil, err
+		}
+		log.Infof("loaded %d exceptions", b.exceptions.Len())
+		list = NewExceptionWarnlist(list, b.exceptions)
+	}
+	return list, nil
 }
 
 // isFullPrefixMatch is a radix helper to determine if the prefix match is valid.
@@ -167,6 +765,14 @@ func isFullPrefixMatch(input string, match string) bool {
 	return len(input) == len(match) || string(input[len(match)]) == "."
 }
 
+// matchOne returns the entry of a list which matches at most one entry per key as the result of MatchAll.
+func matchOne(entry string, ok bool) []string {
+	if !ok {
+		return nil
+	}
+	return []string{entry}
+}
+
 // Prints the elapsed time in the pre-formatted message
 func logTime(msg string, since time.Time) {
 	elapsed := time.Since(since)
@@ -174,26 +780,134 @@ func logTime(msg string, since time.Time) {
 	log.Info(msg)
 }
 
+// buildCaches builds the warnlist, the allowlist, the protected domains, the IP blocklist, and the report list, so all
+// of them can be swapped together. It stops at the first cache which fails to build. If validators is not nil, the
+// validators of the sources are recorded in it, if change is not nil, the changes of the warnlist are counted in it,
+// and if cache is not nil, the entries of the warnlist sources are recorded in it.
+func buildCaches(options PluginOptions, validators sourceValidators, change *listChange, cache sourceCache) (startupCaches, error) {
+	options.counts = newListCounts()
+	warnlist, err := buildWarnlistCache(options, validators, change, cache)
+	if err != nil {
+		return startupCaches{}, err
+	}
+	allowlist, err := buildAllowlistFromFile(options, validators)
+	if err != nil {
+		return startupCaches{}, err
+	}
+	protected, err := buildProtectedFromFile(options, validators)
+	if err != nil {
+		return startupCaches{}, err
+	}
+	ipBlocklist, err := buildIPBlocklistFromFile(options, validators)
+	if err != nil {
+		return startupCaches{}, err
+	}
+	reportList, err := buildReportListFromFile(options, validators)
+	if err != nil {
+		return startupCaches{}, err
+	}
+	return startupCaches{
+		warnlist:    warnlist,
+		allowlist:   allowlist,
+		protected:   protected,
+		ipBlocklist: ipBlocklist,
+		reportList:  reportList,
+		validators:  validators,
+		sources:     cache,
+		counts:      options.counts,
+		loaded:      true,
+	}, nil
+}
+
+// rebuildWarnlist reloads the caches for the reload ticker and signal, which only log failures.
 func rebuildWarnlist(wp *WarnlistPlugin) {
-	// Rebuild the cache for the warnlist
-	warnlist, err := buildCacheFromFile(wp.Options)
+	_ = wp.Reload()
+}
+
+// Reload builds fresh caches and only swaps them in if all of them were built successfully, returning the error
+// otherwise. On failure the previously loaded caches are kept, so a transient error doesn't disable the plugin.
+// It is safe to call while queries are being served, and concurrent reloads run one at a time.
+func (wp *WarnlistPlugin) Reload() error {
+	wp.reloadMu.Lock()
+	defer wp.reloadMu.Unlock()
+	return wp.reload()
+}
+
+// reload reloads the caches like Reload, which the caller serializes by holding reloadMu.
+func (wp *WarnlistPlugin) reload() error {
+	if wp.deltaDue() {
+		return wp.reloadDelta()
+	}
+	return wp.reloadFull()
+}
+
+// reloadFull reloads the caches from all of their sources, like reload once the full sync is due, which the caller
+// serializes by holding reloadMu.
+func (wp *WarnlistPlugin) reloadFull() error {
+	// The sources found changed are kept, so the rebuild doesn't fetch them a second time
+	options := wp.Options
+	options.prefetched = newPrefetchedSources()
+	defer options.prefetched.close()
+
+	if wp.validators != nil && sourcesUnchanged(options.allSources(), options, wp.validators) {
+		log.Info("warnlist sources are unchanged, skipping reload")
+		// The snapshot is still up to date too, so it stays fresh for the next restart
+		touchSnapshot(wp.Options.CacheFile)
+
+		wp.mu.Lock()
+		defer wp.mu.Unlock()
+		// The loaded warnlist is still up to date
+		wp.lastReloadTime = time.Now()
+		wp.lastFullSync = wp.lastReloadTime
+		wp.lastReloadErr = nil
+		if wp.serverName != "" {
+			reloadsSkipped.WithLabelValues(wp.serverName).Inc()
+			lastReloadTimestamp.WithLabelValues(wp.serverName).Set(float64(wp.lastReloadTime.Unix()))
+		}
+		return nil
+	}
+
+	// Rebuild the caches, recording the validators of their sources
+	validators := sourceValidators{}
+	change := wp.changeToCount()
+	// Every source is fetched again, so the entries of all of them are recorded anew
+	cache := newSourceCache(wp.Options)
+	caches, err := buildCaches(options, validators, change, cache)
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
 	if err != nil {
-		log.Errorf("error rebuilding warnlist: %v#", err)
+		log.Warningf("error rebuilding warnlist, keeping the previously loaded warnlist: %v", err)
+		wp.lastReloadErr = err
 
 		if wp.serverName != "" {
-			reloadsFailedCount.WithLabelValues(wp.serverName).Inc()
+			countReloadFailure(wp.serverName)
 		}
 
 		// Don't update the existing warnlist
 	} else {
 		reloadTime := time.Now()
-		wp.warnlist = warnlist
+		wp.warnlist = caches.warnlist
+		wp.allowlist = caches.allowlist
+		wp.protected = caches.protected
+		wp.ipBlocklist = caches.ipBlocklist
+		wp.reportList = caches.reportList
+		wp.validators = validators
+		wp.sources = cache
+		wp.counts = caches.counts
 		wp.lastReloadTime = reloadTime
+		wp.lastReloadErr = nil
+		// The changes of the delta feed are dropped along with the previous warnlist, so they are fetched again
+		wp.lastFullSync = reloadTime
+		wp.deltaValidator = httpValidator{}
+		wp.notifyChange(change, wp.serverName)
+		wp.loaded = true
 	}
 	if wp.serverName != "" {
 		warnlistSize.WithLabelValues(wp.serverName).Set(float64(wp.warnlist.Len()))
+		lastReloadTimestamp.WithLabelValues(wp.serverName).Set(float64(wp.lastReloadTime.Unix()))
+		wp.counts.set(wp.serverName)
 	}
-
+	return err
 }
 
 // reverseString returns a reversed representation of the input, including unicode.
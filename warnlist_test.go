@@ -1,10 +1,18 @@
 package warnlist
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 var testWarnlist = []string{
@@ -109,3 +117,722 @@ func Test_radixContains(t *testing.T) {
 		})
 	}
 }
+
+func Test_rebuildKeepsWarnlistOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(source, []byte(strings.Join(testWarnlist, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("example.org\n"))
+	}))
+	defer server.Close()
+
+	var testCases = []struct {
+		name       string
+		sourceType string
+		fail       func()
+	}{
+		{
+			name:       "case 0: a file source which disappeared keeps the old warnlist",
+			sourceType: DomainSourceTypeFile,
+			fail: func() {
+				if err := os.Remove(source); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:       "case 1: a url source with a server error keeps the old warnlist",
+			sourceType: DomainSourceTypeURL,
+			fail: func() {
+				failing = true
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			s := DomainSource{Path: source, Type: tc.sourceType, Format: DomainFileFormatTextList}
+			if tc.sourceType == DomainSourceTypeURL {
+				s.Path = server.URL
+				failing = false
+			}
+			options := PluginOptions{Sources: []DomainSource{s}, MatchSubdomains: true}
+
+			list, err := buildCacheFromFile(options, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			wp := &WarnlistPlugin{warnlist: list, Options: options}
+
+			tc.fail()
+			rebuildWarnlist(wp)
+
+			if list != wp.warnlist {
+				t.Fatalf("expected the previous warnlist to be kept")
+			}
+			if !wp.warnlist.Contains("example.org.") {
+				t.Fatalf("expected example.org. to still match")
+			}
+		})
+	}
+}
+
+func Test_buildCacheFromMultipleSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first.txt")
+	if err := ioutil.WriteFile(first, []byte("example.org\nsomething.evil\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	second := filepath.Join(dir, "second.txt")
+	if err := ioutil.WriteFile(second, []byte("127.0.0.1 something.evil\n127.0.0.1 evil.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{
+		Sources: []DomainSource{
+			{Path: first, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+			{Path: second, Type: DomainSourceTypeFile, Format: DomainFileFormatHostfile},
+		},
+		MatchSubdomains: true,
+	}
+	list, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, domain := range []string{"example.org.", "something.evil.", "evil.com."} {
+		if !list.Contains(domain) {
+			t.Fatalf("expected %s to be loaded", domain)
+		}
+	}
+	// The overlapping domain is only stored once
+	if !cmp.Equal(3, list.Len()) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(3, list.Len()))
+	}
+}
+
+func Test_countReloadFailure(t *testing.T) {
+	server := "reload-failure-test"
+	countReloadFailure(server)
+
+	// The deprecated counter stays in step with the current one
+	if !cmp.Equal(float64(1), testutil.ToFloat64(reloadFailures.WithLabelValues(server))) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(float64(1), testutil.ToFloat64(reloadFailures.WithLabelValues(server))))
+	}
+	if !cmp.Equal(float64(1), testutil.ToFloat64(reloadsFailedCount.WithLabelValues(server))) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(float64(1), testutil.ToFloat64(reloadsFailedCount.WithLabelValues(server))))
+	}
+}
+
+func Test_rebuildSkipsUnchangedSources(t *testing.T) {
+	content := "example.org\n"
+	etag := `"v1"`
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: server.URL, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+	}
+	validators := sourceValidators{}
+	list, err := buildCacheFromFile(options, validators)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := &WarnlistPlugin{warnlist: list, validators: validators, Options: options}
+
+	// An unchanged source keeps the loaded warnlist
+	rebuildWarnlist(wp)
+	if list != wp.warnlist {
+		t.Fatalf("expected the unchanged warnlist to be kept")
+	}
+	if !cmp.Equal(2, requests) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(2, requests))
+	}
+
+	// A changed source is reloaded from the response to the conditional request, without fetching it again
+	content = "example.org\nsomething.evil\n"
+	etag = `"v2"`
+	rebuildWarnlist(wp)
+	if list == wp.warnlist {
+		t.Fatalf("expected the changed warnlist to be reloaded")
+	}
+	if !wp.warnlist.Contains("something.evil.") {
+		t.Fatalf("expected something.evil. to be loaded")
+	}
+	if !cmp.Equal(3, requests) {
+		t.Fatalf("\n\n%s\n", cmp.Diff(3, requests))
+	}
+
+	// The new validators are used for the next reload
+	list = wp.warnlist
+	rebuildWarnlist(wp)
+	if list != wp.warnlist {
+		t.Fatalf("expected the unchanged warnlist to be kept")
+	}
+}
+
+func Test_wildcardEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("*.evil.example\nexact.example\n*.Upper.Example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name            string
+		matchSubdomains bool
+		bloom           bool
+		expected        map[string]bool
+	}{
+		{
+			name: "case 0: wildcard entries match subdomains while exact entries don't",
+			expected: map[string]bool{
+				"evil.example.":            true,
+				"www.evil.example.":        true,
+				"deep.www.evil.example.":   true,
+				"notevil.example.":         false,
+				"exact.example.":           true,
+				"www.exact.example.":       false,
+				"www.upper.example.":       true,
+				"example.":                 false,
+				"*.evil.example.":          true,
+				"unrelated.evil.example2.": false,
+			},
+		},
+		{
+			name:  "case 1: wildcard entries match subdomains with a bloom filter",
+			bloom: true,
+			expected: map[string]bool{
+				"www.evil.example.":  true,
+				"exact.example.":     true,
+				"www.exact.example.": false,
+			},
+		},
+		{
+			name:            "case 2: wildcard entries match their base domain when matching subdomains",
+			matchSubdomains: true,
+			expected: map[string]bool{
+				"evil.example.":      true,
+				"www.evil.example.":  true,
+				"www.exact.example.": true,
+				"notevil.example.":   false,
+			},
+		},
+		{
+			name:            "case 3: wildcard entries match subdomains with a bloom filter when matching subdomains",
+			matchSubdomains: true,
+			bloom:           true,
+			expected: map[string]bool{
+				"evil.example.":     true,
+				"www.evil.example.": true,
+				"notevil.example.":  false,
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+				MatchSubdomains: tc.matchSubdomains,
+				Bloom:           tc.bloom,
+			}
+			list, err := buildCacheFromFile(options, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for domain, expected := range tc.expected {
+				if !cmp.Equal(expected, list.Contains(domain)) {
+					t.Fatalf("%s: \n\n%s\n", domain, cmp.Diff(expected, list.Contains(domain)))
+				}
+			}
+			if !cmp.Equal(3, list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(3, list.Len()))
+			}
+		})
+	}
+}
+
+func Test_remove(t *testing.T) {
+	lists := []struct {
+		name            string
+		matchSubdomains bool
+		new             func() Warnlist
+	}{
+		{name: "trie", matchSubdomains: true, new: func() Warnlist { return newWarnlist(PluginOptions{MatchSubdomains: true}) }},
+		{name: "trie with bloom filter", matchSubdomains: true, new: func() Warnlist { return newWarnlist(PluginOptions{MatchSubdomains: true, Bloom: true}) }},
+		{name: "packed", new: func() Warnlist { return newWarnlist(PluginOptions{}) }},
+		{name: "packed with bloom filter", new: func() Warnlist { return newWarnlist(PluginOptions{Bloom: true}) }},
+		{name: "radix", matchSubdomains: true, new: NewRadixWarnlist},
+	}
+
+	var testCases = []struct {
+		name     string
+		removed  []string
+		expected map[string]bool
+		// subtree holds the expected matches of lists matching subdomains, which differ from exact ones
+		subtree map[string]bool
+		len     int
+	}{
+		{
+			name:     "case 0: a removed exact entry is no longer matched",
+			removed:  []string{"exact.example."},
+			expected: map[string]bool{"exact.example.": false, "parent.example.": true},
+			len:      3,
+		},
+		{
+			name:     "case 1: removing an entry which isn't listed changes nothing",
+			removed:  []string{"missing.example.", "www.exact.example."},
+			expected: map[string]bool{"exact.example.": true, "missing.example.": false},
+			len:      4,
+		},
+		{
+			name:     "case 2: a wildcard entry is removed by its wildcard key",
+			removed:  []string{"*.wild.example."},
+			expected: map[string]bool{"www.wild.example.": false, "exact.example.": true},
+			len:      3,
+		},
+		{
+			name:     "case 3: removing a listed subdomain keeps its parent",
+			removed:  []string{"child.parent.example."},
+			expected: map[string]bool{"parent.example.": true},
+			subtree:  map[string]bool{"child.parent.example.": true},
+			len:      3,
+		},
+		{
+			name:     "case 4: removing a parent keeps its listed subdomain",
+			removed:  []string{"parent.example."},
+			expected: map[string]bool{"parent.example.": false, "child.parent.example.": true, "other.parent.example.": false},
+			len:      3,
+		},
+		{
+			name:     "case 5: removing an entry twice only removes it once",
+			removed:  []string{"exact.example.", "exact.example."},
+			expected: map[string]bool{"exact.example.": false},
+			len:      3,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			for _, l := range lists {
+				// Removing works the same before and after closing the list
+				for _, closed := range []bool{false, true} {
+					list := l.new()
+					for _, domain := range []string{"exact.example.", "*.wild.example.", "parent.example.", "child.parent.example."} {
+						list.Add(domain)
+					}
+					if closed {
+						if err := list.Close(); err != nil {
+							t.Fatalf("unexpected error: %v", err)
+						}
+					}
+					for _, domain := range tc.removed {
+						list.Remove(domain)
+					}
+					if err := list.Close(); err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+
+					expected := tc.expected
+					if l.matchSubdomains && tc.subtree != nil {
+						expected = tc.subtree
+					}
+					for domain, hit := range expected {
+						if !cmp.Equal(hit, list.Contains(domain)) {
+							t.Fatalf("%s, closed %t, %s: \n\n%s\n", l.name, closed, domain, cmp.Diff(hit, list.Contains(domain)))
+						}
+					}
+					if !cmp.Equal(tc.len, list.Len()) {
+						t.Fatalf("%s, closed %t: \n\n%s\n", l.name, closed, cmp.Diff(tc.len, list.Len()))
+					}
+
+					// Removed entries can be added again
+					for _, domain := range tc.removed {
+						list.Add(domain)
+					}
+					if err := list.Close(); err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					for _, domain := range tc.removed {
+						if strings.HasPrefix(domain, "missing.") || strings.HasPrefix(domain, "www.") {
+							continue
+						}
+						if !list.Contains(domain) {
+							t.Fatalf("%s, closed %t: expected %s to be matched once added again", l.name, closed, domain)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_buildCacheMaxEntries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// An enormous list, like a misconfigured feed could return
+		for i := 0; i < 10000; i++ {
+			_, _ = w.Write([]byte("listed-" + strconv.Itoa(i) + ".example\n"))
+		}
+	}))
+	defer server.Close()
+
+	var testCases = []struct {
+		name       string
+		maxEntries int
+		strict     bool
+		len        int
+		expectErr  bool
+	}{
+		{
+			name:       "case 0: a list within the limit is loaded",
+			maxEntries: 10000,
+			strict:     true,
+			len:        10000,
+		},
+		{
+			name:       "case 1: a list exceeding the limit fails the build in strict mode",
+			maxEntries: 100,
+			strict:     true,
+			expectErr:  true,
+		},
+		{
+			name:       "case 2: a list exceeding the limit is truncated without strict mode",
+			maxEntries: 100,
+			len:        100,
+		},
+		{
+			name: "case 3: a list isn't limited without max_entries",
+			len:  10000,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			options := PluginOptions{
+				Sources:          []DomainSource{{Path: server.URL, Type: DomainSourceTypeURL, Format: DomainFileFormatTextList}},
+				MatchSubdomains:  true,
+				MaxEntries:       tc.maxEntries,
+				StrictMaxEntries: tc.strict,
+			}
+			list, err := buildCacheFromFile(options, nil)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cmp.Equal(tc.len, list.Len()) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.len, list.Len()))
+			}
+		})
+	}
+}
+
+func TestReloadMinEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("a.example\nb.example\nc.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+		MinEntries:      2,
+	}
+	list, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := newWarnlistPlugin(options, startupCaches{warnlist: list, loaded: true}, time.Now())
+
+	// A feed which momentarily serves an empty file fails the reload, and keeps the loaded warnlist
+	if err := ioutil.WriteFile(path, []byte(""), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.Reload(); err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+	if warnlist, _ := wp.lists(); warnlist.Len() != 3 || !warnlist.Contains("a.example.") {
+		t.Fatalf("expected the loaded warnlist to be kept")
+	}
+
+	// A list with the minimum number of entries is loaded
+	if err := ioutil.WriteFile(path, []byte("d.example\ne.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if warnlist, _ := wp.lists(); warnlist.Len() != 2 || !warnlist.Contains("d.example.") {
+		t.Fatalf("expected the rebuilt warnlist to be served")
+	}
+}
+
+func Test_rebuildWarnlistReady(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+	}
+	wp := &WarnlistPlugin{Options: options}
+
+	// Without a loaded warnlist, the plugin isn't ready
+	rebuildWarnlist(wp)
+	if wp.Ready() {
+		t.Fatalf("expected the plugin not to be ready before a warnlist is loaded")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(testTextList), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rebuildWarnlist(wp)
+	if !wp.Ready() {
+		t.Fatalf("expected the plugin to be ready once a warnlist is loaded")
+	}
+
+	// A failed reload keeps serving the loaded warnlist, so the plugin stays ready
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	rebuildWarnlist(wp)
+	if !wp.Ready() {
+		t.Fatalf("expected the plugin to stay ready after a failed reload")
+	}
+}
+
+func Test_matchAll(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		list     Warnlist
+		entries  []string
+		domain   string
+		expected []string
+	}{
+		{
+			name:     "case 0: the radix list returns a domain and its listed parent",
+			list:     NewRadixWarnlist(),
+			entries:  []string{"evil.com.", "www.evil.com.", "other.com."},
+			domain:   "a.www.evil.com.",
+			expected: []string{"evil.com.", "www.evil.com."},
+		},
+		{
+			name:     "case 1: the trie list returns a domain and its listed parent",
+			list:     NewTrieWarnlist(),
+			entries:  []string{"evil.com.", "www.evil.com.", "other.com."},
+			domain:   "a.www.evil.com.",
+			expected: []string{"evil.com.", "www.evil.com."},
+		},
+		{
+			name:     "case 2: an exact list returns the exact entry and the matching wildcards",
+			list:     NewWildcardWarnlist(NewWarnlist()),
+			entries:  []string{"*.evil.com.", "www.evil.com.", "evil.com."},
+			domain:   "www.evil.com.",
+			expected: []string{"www.evil.com.", "*.evil.com."},
+		},
+		{
+			name:     "case 3: the bloom filter returns the entries of the wrapped list",
+			list:     NewBloomWarnlist(NewTrieWarnlist(), true),
+			entries:  []string{"evil.com.", "www.evil.com."},
+			domain:   "www.evil.com.",
+			expected: []string{"evil.com.", "www.evil.com."},
+		},
+		{
+			name:    "case 4: an unlisted domain returns no entries",
+			list:    NewPackedWarnlist(),
+			entries: []string{"evil.com."},
+			domain:  "www.evil.com.",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			for _, entry := range tc.entries {
+				tc.list.Add(entry)
+			}
+			if err := tc.list.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			entries := tc.list.MatchAll(tc.domain)
+			if !cmp.Equal(tc.expected, entries) {
+				t.Fatalf("\n\n%s\n", cmp.Diff(tc.expected, entries))
+			}
+		})
+	}
+}
+
+func Test_buildCacheSourceNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	feeds := map[string]string{
+		"first.txt":  "evil.example\n*.wild.example\n",
+		"second.txt": "evil.example\nother.example\n",
+		"plain.txt":  "plain.example\n",
+	}
+	for name, content := range feeds {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sources := []DomainSource{
+		{Path: filepath.Join(dir, "first.txt"), Type: DomainSourceTypeFile, Format: DomainFileFormatTextList, Name: "first"},
+		{Path: filepath.Join(dir, "second.txt"), Type: DomainSourceTypeFile, Format: DomainFileFormatTextList, Name: "second"},
+		{Path: filepath.Join(dir, "plain.txt"), Type: DomainSourceTypeFile, Format: DomainFileFormatTextList},
+	}
+
+	var testCases = []struct {
+		name   string
+		domain string
+		source string
+	}{
+		{
+			name:   "case 0: a domain listed by several sources is attributed to the first",
+			domain: "www.evil.example.",
+			source: "first",
+		},
+		{
+			name:   "case 1: a domain is attributed to the source it was loaded from",
+			domain: "other.example.",
+			source: "second",
+		},
+		{
+			name:   "case 2: a wildcard entry is attributed to its source",
+			domain: "www.wild.example.",
+			source: "first",
+		},
+		{
+			name:   "case 3: a domain from an unnamed source has no source",
+			domain: "plain.example.",
+		},
+	}
+
+	for _, matchSubdomains := range []bool{true, false} {
+		options := PluginOptions{Sources: sources, MatchSubdomains: matchSubdomains}
+		list, err := buildCacheFromFile(options, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for i, tc := range testCases {
+			t.Run(strconv.Itoa(i), func(t *testing.T) {
+				t.Log(tc.name)
+
+				domain := tc.domain
+				if !matchSubdomains && !strings.HasPrefix(domain, "www.wild.") {
+					// Only wildcard entries match subdomains
+					domain = strings.TrimPrefix(domain, "www.")
+				}
+				entry, hit := list.Match(domain)
+				if !hit {
+					t.Fatalf("expected %s to match (match_subdomains %t)", domain, matchSubdomains)
+				}
+				source := sourceOf(list, entry)
+				if !cmp.Equal(tc.source, source) {
+					t.Fatalf("match_subdomains %t: \n\n%s\n", matchSubdomains, cmp.Diff(tc.source, source))
+				}
+			})
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte(testTextList), 0600); err != nil {
+		t.Fatal(err)
+	}
+	options := PluginOptions{
+		Sources:         []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		MatchSubdomains: true,
+	}
+	wp := &WarnlistPlugin{Options: options}
+
+	if err := wp.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	list, _ := wp.lists()
+	if !list.Contains("something.evil.") {
+		t.Fatalf("expected something.evil. to be loaded")
+	}
+
+	// A failed reload returns its error, and keeps the loaded warnlist
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.Reload(); err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+	if current, _ := wp.lists(); current != list {
+		t.Fatalf("expected the loaded warnlist to be kept")
+	}
+}
@@ -0,0 +1,154 @@
+package warnlist
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is the time the events of a change are collected for before the warnlist is reloaded, since a single
+// update, like the symlink swap of a ConfigMap, emits several of them.
+const watchDebounce = 100 * time.Millisecond
+
+// fileWatcher watches the directories of file sources, and reloads the warnlist when any of the files change.
+// Directories are watched rather than the files, so updates which replace a file are seen too: editors which rename
+// a new file over the old one, and Kubernetes ConfigMap volumes, whose files are symlinks into a ..data directory
+// which is swapped by atomically renaming a new symlink over it.
+type fileWatcher struct {
+	watcher *fsnotify.Watcher
+	// names are the names of the files watched in each directory, or nil if every change in it is relevant, like for
+	// directory sources
+	names   map[string]map[string]struct{}
+	stopped chan struct{}
+}
+
+// newFileWatcher returns a fileWatcher for the file sources. Directories which can't be watched are logged and
+// skipped, so a source which doesn't exist yet only fails its loads, like without watching.
+func newFileWatcher(sources []DomainSource) (*fileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	fw := &fileWatcher{watcher: watcher, names: make(map[string]map[string]struct{}), stopped: make(chan struct{})}
+	for _, source := range sources {
+		if source.Type != DomainSourceTypeFile {
+			continue
+		}
+		dir, name := filepath.Dir(source.Path), filepath.Base(source.Path)
+		if info, err := os.Stat(source.Path); err == nil && info.IsDir() {
+			dir, name = source.Path, ""
+		}
+
+		names, watched := fw.names[dir]
+		if !watched {
+			if err := watcher.Add(dir); err != nil {
+				log.Warningf("unable to watch %s for changes of %s: %v", dir, source.Path, err)
+				continue
+			}
+			names = make(map[string]struct{})
+			fw.names[dir] = names
+			log.Infof("Watching %s for changes of %s", dir, source.Path)
+		}
+		if name == "" {
+			fw.names[dir] = nil
+		} else if names != nil {
+			names[name] = struct{}{}
+		}
+	}
+	return fw, nil
+}
+
+// relevant returns true if the event changes a watched file. The ..data entries of ConfigMap volumes are relevant for
+// every file in their directory, since swapping them changes the targets of the symlinks of all its files.
+func (fw *fileWatcher) relevant(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	names, ok := fw.names[filepath.Dir(event.Name)]
+	if !ok {
+		return false
+	}
+	if names == nil {
+		return true
+	}
+	name := filepath.Base(event.Name)
+	if strings.HasPrefix(name, "..") {
+		return true
+	}
+	_, ok = names[name]
+	return ok
+}
+
+// run calls reload once the events of a change have been collected, until the fileWatcher is closed.
+func (fw *fileWatcher) run(reload func()) {
+	defer close(fw.stopped)
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case event, ok := <-fw.watcher.Events:
+			if !ok {
+				return
+			}
+			if fw.relevant(event) && pending == nil {
+				log.Debugf("%s changed, reloading the warnlist", event.Name)
+				pending = time.After(watchDebounce)
+			}
+
+		case <-pending:
+			pending = nil
+			reload()
+
+		case err, ok := <-fw.watcher.Errors:
+			if !ok {
+				return
+			}
+			// Like an overflow of the event queue, which the next change is still seen after
+			log.Warningf("error watching warnlist files: %v", err)
+		}
+	}
+}
+
+// Close stops watching, and waits for a reload which is running to finish.
+func (fw *fileWatcher) Close() error {
+	err := fw.watcher.Close()
+	<-fw.stopped
+	return err
+}
+
+// startWatcher starts watching the file sources, reloading the warnlist whenever any of them change.
+func (wp *WarnlistPlugin) startWatcher() error {
+	fw, err := newFileWatcher(wp.Options.allSources())
+	if err != nil {
+		return err
+	}
+	wp.watcher = fw
+	go fw.run(wp.reloadChanged)
+	return nil
+}
+
+// stopWatcher stops watching the file sources. It is safe to call if the watcher was never started, or was stopped
+// already.
+func (wp *WarnlistPlugin) stopWatcher() {
+	if wp.watcher == nil {
+		return
+	}
+	if err := wp.watcher.Close(); err != nil {
+		log.Warningf("unable to stop watching warnlist files: %v", err)
+	}
+	wp.watcher = nil
+}
+
+// reloadChanged reloads the caches after the watcher saw their files change. The validators are dropped, so every
+// source is built again even if the change can't be told from them, like a file of the same size written within the
+// same second. The caches are always built from all sources, since the delta feed doesn't hold the changed files.
+func (wp *WarnlistPlugin) reloadChanged() {
+	wp.reloadMu.Lock()
+	defer wp.reloadMu.Unlock()
+	wp.validators = nil
+	_ = wp.reloadFull()
+}
@@ -0,0 +1,162 @@
+package warnlist
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForEntry waits until the warnlist of the plugin contains the name, failing the test if it doesn't in time.
+func waitForEntry(t *testing.T, wp *WarnlistPlugin, name string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if warnlist, _ := wp.lists(); warnlist.Contains(name) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %s to be loaded after its file changed", name)
+}
+
+func TestWatchConfigMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Lay out the volume like the kubelet does: the file is a symlink into ..data, which links to a timestamped
+	// directory holding the contents
+	if err := os.Mkdir(filepath.Join(dir, "..2021_1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "..2021_1", "domains.txt"), []byte("a.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..2021_1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..data", "domains.txt"), filepath.Join(dir, "domains.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{
+		Sources: []DomainSource{{Path: filepath.Join(dir, "domains.txt"), Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		Watch:   true,
+	}
+	list, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := newWarnlistPlugin(options, startupCaches{warnlist: list, loaded: true}, time.Now())
+	if err := wp.startWatcher(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wp.stopWatcher()
+
+	// Update the ConfigMap by swapping ..data for a link to a new directory
+	if err := os.Mkdir(filepath.Join(dir, "..2021_2"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "..2021_2", "domains.txt"), []byte("b.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..2021_2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "..2021_1")); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForEntry(t, wp, "b.example.")
+	if warnlist, _ := wp.lists(); warnlist.Contains("a.example.") {
+		t.Fatalf("expected a.example. to be dropped after the update")
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("a.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := PluginOptions{
+		Sources: []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		Watch:   true,
+	}
+	list, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := newWarnlistPlugin(options, startupCaches{warnlist: list, loaded: true}, time.Now())
+	if err := wp.startWatcher(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Writing another file in the directory doesn't reload, so the in-place write below is the first change seen.
+	// The new contents have the same size and are written within the same second, so they wouldn't be told apart by
+	// the validators.
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte("c.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("b.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	waitForEntry(t, wp, "b.example.")
+
+	// Stopping twice is safe
+	wp.stopWatcher()
+	wp.stopWatcher()
+}
+
+func TestWatchDelta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warnlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "domains.txt")
+	if err := ioutil.WriteFile(path, []byte("a.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	deltaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("+added.example\n"))
+	}))
+	defer deltaServer.Close()
+
+	options := PluginOptions{
+		Sources:        []DomainSource{{Path: path, Type: DomainSourceTypeFile, Format: DomainFileFormatTextList}},
+		Watch:          true,
+		DeltaURL:       deltaServer.URL,
+		FullSyncPeriod: time.Hour,
+	}
+	list, err := buildCacheFromFile(options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wp := newWarnlistPlugin(options, startupCaches{warnlist: list, loaded: true}, time.Now())
+
+	// A changed file is loaded even while reloads apply the delta feed
+	if err := ioutil.WriteFile(path, []byte("b.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	wp.reloadChanged()
+	warnlist, _ := wp.lists()
+	if !warnlist.Contains("b.example.") {
+		t.Fatalf("expected the changed file to be loaded")
+	}
+}